@@ -0,0 +1,294 @@
+// Attributes of paths: the .gitattributes files of the work tree, info/attributes and core.attributesFile giving
+// named values to the paths matching their patterns, with the macros grouping attributes, like git's attr.c
+package attr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	ignore "github.com/codecrafters-io/git-starter-go/ignore"
+)
+
+// The name of the files of per-directory attributes
+const FileName = ".gitattributes"
+
+// The values of the attributes set or unset without a value, an attribute with no value is unspecified
+const (
+	Set   = "set"
+	Unset = "unset"
+)
+
+// The macros every repository has
+const builtinMacros = "[attr]binary -diff -merge -text"
+
+// An attribute of a line: its name and value, "" when made unspecified with "!"
+type state struct {
+	name  string
+	value string
+}
+
+// A line of an attributes file: the attributes of the paths matching its pattern
+type rule struct {
+	pattern ignore.Pattern
+	states  []state
+}
+
+// The attributes of a work tree, by decreasing precedence: info/attributes, the .gitattributes files from the
+// deepest directory up to the top, then core.attributesFile
+// Each attribute is decided by the last line matching a path in the file of highest precedence
+type Matcher struct {
+	workTree   string
+	ignoreCase bool
+	// Return the content of a .gitattributes file from its path from the top, the file of the work tree by default
+	read   func(name string) ([]byte, error)
+	global []rule
+	info   []rule
+	// The rules of the .gitattributes files by directory, read when first needed
+	dirs map[string][]rule
+	// The attributes the macros stand for
+	macros map[string][]state
+	// The names of the attributes in the order they were first read, the order -a lists them in
+	names []string
+	known map[string]bool
+	// Where the warnings about the lines ignored go
+	warnings io.Writer
+	// The files read on the first lookup
+	globalFile, infoFile string
+	loaded               bool
+}
+
+// Return the attributes of a work tree, from its .gitattributes files and the files given; the patterns match
+// case-insensitively with ignoreCase and a file "" is skipped
+func New(workTree, globalFile, infoFile string, ignoreCase bool) *Matcher {
+	m := &Matcher{
+		workTree:   workTree,
+		ignoreCase: ignoreCase,
+		dirs:       make(map[string][]rule),
+		macros:     make(map[string][]state),
+		known:      make(map[string]bool),
+		warnings:   os.Stderr,
+		globalFile: globalFile,
+		infoFile:   infoFile,
+	}
+	m.read = func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(m.workTree, name))
+	}
+	return m
+}
+
+// Read the .gitattributes files with read instead of from the work tree, like from the index
+func (m *Matcher) SetReader(read func(name string) ([]byte, error)) {
+	m.read = read
+}
+
+// Write the warnings about the lines ignored to w instead of the standard error
+func (m *Matcher) SetWarnings(w io.Writer) {
+	m.warnings = w
+}
+
+// Whether a name is valid for an attribute: letters, digits, dashes, dots and underscores, not starting with a dash
+func ValidName(name string) bool {
+	if name == "" || name[0] == '-' {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if !(c == '-' || c == '.' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse the lines of an attributes file, dir being its directory; the macros are only allowed at the top
+func (m *Matcher) parse(content []byte, source, dir string, macrosAllowed bool) []rule {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	rules := make([]rule, 0)
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimLeft(line, " \t\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var text, rest string
+		if line[0] == '"' {
+			// A quoted pattern may hold spaces
+			end := 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				continue
+			}
+			unquoted, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				continue
+			}
+			text, rest = unquoted, line[end+1:]
+		} else {
+			end := strings.IndexAny(line, " \t\r")
+			if end < 0 {
+				end = len(line)
+			}
+			text, rest = line[:end], line[end:]
+		}
+		states := make([]state, 0)
+		valid := true
+		for _, field := range strings.Fields(rest) {
+			s := state{name: field, value: Set}
+			switch {
+			case field[0] == '-':
+				s = state{name: field[1:], value: Unset}
+			case field[0] == '!':
+				s = state{name: field[1:], value: ""}
+			case strings.Contains(field, "="):
+				s.name, s.value, _ = strings.Cut(field, "=")
+			}
+			if !ValidName(s.name) {
+				fmt.Fprintf(m.warnings, "%s is not a valid attribute name: %s:%d\n", s.name, source, i+1)
+				valid = false
+				break
+			}
+			states = append(states, s)
+		}
+		if !valid {
+			continue
+		}
+		if macro, found := strings.CutPrefix(text, "[attr]"); found {
+			if !macrosAllowed {
+				fmt.Fprintf(m.warnings, "%s not allowed: %s:%d\n", strings.TrimRight(line, " \t\r"), source, i+1)
+				continue
+			}
+			if !ValidName(macro) {
+				fmt.Fprintf(m.warnings, "%s is not a valid attribute name: %s:%d\n", macro, source, i+1)
+				continue
+			}
+			m.register(macro)
+			for _, s := range states {
+				m.register(s.name)
+			}
+			m.macros[macro] = states
+			continue
+		}
+		if text[0] == '!' {
+			fmt.Fprintf(m.warnings, "warning: Negative patterns are ignored in git attributes\nUse '\\!' for literal leading exclamation.\n")
+			continue
+		}
+		// The patterns of attributes are those of the ignore files, without negation
+		p, ok := ignore.ParsePattern(text, source, i+1, dir)
+		if !ok {
+			continue
+		}
+		for _, s := range states {
+			m.register(s.name)
+		}
+		rules = append(rules, rule{pattern: p, states: states})
+	}
+	return rules
+}
+
+// Remember the order an attribute was first seen in
+func (m *Matcher) register(name string) {
+	if !m.known[name] {
+		m.known[name] = true
+		m.names = append(m.names, name)
+	}
+}
+
+// Read the files of the attributes of the whole work tree, once
+func (m *Matcher) load() {
+	if m.loaded {
+		return
+	}
+	m.loaded = true
+	m.parse([]byte(builtinMacros), "[builtin]", "", true)
+	readFile := func(file string) []rule {
+		if file == "" {
+			return nil
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil
+		}
+		return m.parse(content, file, "", true)
+	}
+	m.global = readFile(m.globalFile)
+	m.directoryRules("")
+	m.info = readFile(m.infoFile)
+}
+
+// Return the rules of the .gitattributes file of a directory
+func (m *Matcher) directoryRules(dir string) []rule {
+	if rules, found := m.dirs[dir]; found {
+		return rules
+	}
+	source := path.Join(dir, FileName)
+	rules := make([]rule, 0)
+	if content, err := m.read(source); err == nil {
+		rules = m.parse(content, source, dir, dir == "")
+	}
+	m.dirs[dir] = rules
+	return rules
+}
+
+// Return the attributes of a path from the top of the work tree, by name: Set, Unset or their value
+// The unspecified attributes are left out
+func (m *Matcher) Attributes(name string) map[string]string {
+	m.load()
+	decided := make(map[string]string)
+	var fill func(states []state)
+	fill = func(states []state) {
+		for i := len(states) - 1; i >= 0; i-- {
+			s := states[i]
+			if _, found := decided[s.name]; found {
+				continue
+			}
+			decided[s.name] = s.value
+			// A macro set sets its attributes, with the precedence of the line setting it
+			if macro, found := m.macros[s.name]; found && s.value == Set {
+				fill(macro)
+			}
+		}
+	}
+	fillRules := func(rules []rule) {
+		for i := len(rules) - 1; i >= 0; i-- {
+			if rules[i].pattern.Matches(name, false, m.ignoreCase) {
+				fill(rules[i].states)
+			}
+		}
+	}
+	fillRules(m.info)
+	dirs := make([]string, 0)
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		fillRules(m.directoryRules(dir))
+	}
+	fillRules(m.directoryRules(""))
+	fillRules(m.global)
+	for attrName, value := range decided {
+		if value == "" {
+			delete(decided, attrName)
+		}
+	}
+	return decided
+}
+
+// Return the names of the attributes of a path, in the order they were first read
+func (m *Matcher) Names(attributes map[string]string) []string {
+	names := make([]string, 0, len(attributes))
+	for _, name := range m.names {
+		if _, found := attributes[name]; found {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,84 @@
+package attr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	file := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, expected := range map[string]bool{"text": true, "my-attr.x_1": true, "": false, "-text": false, "a b": false, "a=b": false} {
+		if ValidName(name) != expected {
+			t.Fatalf("%q: expected %v", name, expected)
+		}
+	}
+}
+
+var TestCaseAttributes = []struct {
+	Path     string
+	Expected map[string]string
+}{
+	{Path: "a.txt", Expected: map[string]string{"text": "set"}},
+	{Path: "b.bin", Expected: map[string]string{"binary": "set", "diff": "unset", "merge": "unset", "text": "unset"}},
+	{Path: "x.c", Expected: map[string]string{"mymacro": "set", "text": "set", "eol": "lf", "diff": "unset", "foo": "bar"}},
+	{Path: "sp ace.md", Expected: map[string]string{"text": "set"}},
+	{Path: "sub/a.txt", Expected: map[string]string{"text": "unset", "other": "set"}},
+	{Path: "sub/x.c", Expected: map[string]string{"mymacro": "set", "text": "set", "eol": "lf", "diff": "unset", "foo": "bar"}},
+	{Path: "z.x", Expected: map[string]string{"zed": "set"}},
+	{Path: "Z.TXT", Expected: map[string]string{}},
+	{Path: "dir", Expected: map[string]string{}},
+	{Path: "dir/file", Expected: map[string]string{}},
+}
+
+func TestAttributes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, ".gitattributes", "[attr]mymacro text eol=crlf -diff\n*.txt text\n*.bin binary\n*.c mymacro foo=bar\n"+
+		"\"sp ace.md\" text\n!neg text\ndir/ text\n*.x text !text zed\n")
+	writeTestFile(t, dir, "sub/.gitattributes", "[attr]bad text\n*.txt -text other\n")
+	writeTestFile(t, dir, "info", "*.c eol=lf\n")
+	m := New(dir, "", filepath.Join(dir, "info"), false)
+	warnings := new(strings.Builder)
+	m.SetWarnings(warnings)
+	for _, tc := range TestCaseAttributes {
+		if got := m.Attributes(tc.Path); !reflect.DeepEqual(got, tc.Expected) {
+			t.Fatalf("%s: expected %v, got %v", tc.Path, tc.Expected, got)
+		}
+	}
+	expected := "warning: Negative patterns are ignored in git attributes\nUse '\\!' for literal leading exclamation.\n" +
+		"[attr]bad text not allowed: sub/.gitattributes:1\n"
+	if warnings.String() != expected {
+		t.Fatalf("expected the warnings %q, got %q", expected, warnings.String())
+	}
+	names := m.Names(m.Attributes("x.c"))
+	if strings.Join(names, " ") != "diff text mymacro eol foo" {
+		t.Fatalf("expected the attributes in the order they were read, got %v", names)
+	}
+	if got := New(dir, "", "", true).Attributes("Z.TXT"); got["text"] != "set" {
+		t.Fatalf("expected the patterns to ignore the case, got %v", got)
+	}
+}
+
+func TestReader(t *testing.T) {
+	m := New(t.TempDir(), "", "", false)
+	m.SetReader(func(name string) ([]byte, error) {
+		if name == ".gitattributes" {
+			return []byte("*.md text\n"), nil
+		}
+		return nil, os.ErrNotExist
+	})
+	if got := m.Attributes("doc/a.md"); got["text"] != "set" {
+		t.Fatalf("expected the attributes of the reader, got %v", got)
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+
+	ignore "github.com/codecrafters-io/git-starter-go/ignore"
+	index "github.com/codecrafters-io/git-starter-go/index"
+	pathspec "github.com/codecrafters-io/git-starter-go/pathspec"
+)
+
+type addOptions struct {
+	dryRun  bool
+	verbose bool
+	// Stage the ignored files too
+	force bool
+	// Stage the whole work tree, new files included, when no path is given
+	all bool
+	// Only stage the changes of the tracked files
+	update bool
+	// Record the new files without their content
+	intentToAdd bool
+	// Stage the tracked files again, even when they look unchanged
+	renormalize bool
+	// "+x" or "-x" to set or clear the executable bit of the files staged
+	chmod     string
+	pathspecs []string
+}
+
+/*
+Command: mygit add [-n] [-v] [-f] [-A | -u] [-N] [--chmod=(+|-)x] [--renormalize] [--] [<pathspec>...]
+
+Stage the content of the files matching the pathspecs: new and changed files are written to the object store and
+recorded in the index, and the files deleted from the work tree are removed from it
+With -u only the tracked files are staged, -A and -u without a pathspec stage the whole work tree, -N records the new
+files as intended to be added without their content, and --renormalize stages again every tracked file
+The untracked files ignored by the .gitignore files, info/exclude or core.excludesFile are left out unless -f is given,
+naming one of them is an error once the others are staged
+*/
+func addCommand(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit add [-n] [-v] [-f] [-A | -u] [-N] [--chmod=(+|-)x] [--renormalize] [--] [<pathspec>...]")
+	opts := addOptions{}
+	for i, arg := range args {
+		if arg == "--" {
+			opts.pathspecs = append(opts.pathspecs, args[i+1:]...)
+			break
+		}
+		switch {
+		case arg == "-n" || arg == "--dry-run":
+			opts.dryRun = true
+		case arg == "-v" || arg == "--verbose":
+			opts.verbose = true
+		case arg == "-f" || arg == "--force":
+			opts.force = true
+		case arg == "-A" || arg == "--all":
+			opts.all = true
+		case arg == "-u" || arg == "--update":
+			opts.update = true
+		case arg == "-N" || arg == "--intent-to-add":
+			opts.intentToAdd = true
+		case arg == "--renormalize":
+			opts.renormalize = true
+			opts.update = true
+		case strings.HasPrefix(arg, "--chmod="):
+			opts.chmod = strings.TrimPrefix(arg, "--chmod=")
+			if opts.chmod != "+x" && opts.chmod != "-x" {
+				return "", fmt.Errorf("--chmod param '%s' must be either -x or +x", opts.chmod)
+			}
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return "", usage
+		default:
+			opts.pathspecs = append(opts.pathspecs, arg)
+		}
+	}
+	if opts.all && opts.update {
+		return "", fmt.Errorf("options '-A' and '-u' cannot be used together")
+	}
+	if repo.Bare() {
+		return "", fmt.Errorf("this operation must be run in a work tree")
+	}
+	if len(opts.pathspecs) == 0 && !opts.all && !opts.update {
+		fmt.Fprintf(os.Stderr, "Nothing specified, nothing added.\nhint: Maybe you wanted to say 'git add .'?\n")
+		return "", nil
+	}
+	// Without a pathspec, -A and -u stage the whole work tree
+	ps, err := parsePathspec(opts.pathspecs, repo.Prefix, pathspec.Options{Forbidden: pathspec.Attr})
+	if err != nil {
+		return "", err
+	}
+
+	idx, lock, err := lockIndex()
+	if err != nil {
+		return "", err
+	}
+	out, err := addPaths(idx, opts, ps)
+	if err != nil && err != errSilentFailure || opts.dryRun {
+		lock.Rollback()
+		return out, err
+	}
+	// The files are staged even when some of them can't be made executable
+	if commitErr := commitIndex(lock, idx); commitErr != nil {
+		return out, commitErr
+	}
+	return out, err
+}
+
+// Stage the files matching the pathspec, return the lines of --verbose and --dry-run
+func addPaths(idx *index.Index, opts addOptions, ps *pathspec.Pathspec) (string, error) {
+	// The lines of the changes, in the order they are made
+	out := new(strings.Builder)
+	report := func(action, name string) {
+		if opts.verbose || opts.dryRun {
+			fmt.Fprintf(out, "%s '%s'\n", action, name)
+		}
+	}
+	lines := out.String
+	seen := make([]bool, len(ps.Items))
+	files := make(map[string]os.FileInfo)
+	// The ignored paths named by the pathspec
+	ignored := make([]string, 0)
+	if !opts.update {
+		var m *ignore.Matcher
+		if !opts.force {
+			var err error
+			if m, err = newIgnoreMatcher(); err != nil {
+				return "", err
+			}
+		}
+		found, skipped, err := workTreeFiles(ps, m)
+		if err != nil {
+			return "", err
+		}
+		files = found
+		for _, name := range skipped {
+			if idx.Get(name) == nil && namedByPathspec(ps, name) {
+				ignored = append(ignored, name)
+			}
+		}
+		for i, item := range ps.Items {
+			if _, err := os.Lstat(filepath.Join(repo.WorkTree, item.Match)); err == nil && !item.HasWildcard() {
+				// An existing directory matches its path even when it holds no file
+				seen[i] = true
+			}
+		}
+	}
+	// The tracked files, deleted ones included
+	removed := make([]string, 0)
+	for _, e := range idx.Entries {
+		if !ps.MatchSeen(e.Path, false, seen) {
+			continue
+		}
+		if _, found := files[e.Path]; found {
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(repo.WorkTree, e.Path))
+		if err == nil && (!info.IsDir() || isNestedRepository(filepath.Join(repo.WorkTree, e.Path))) {
+			files[e.Path] = info
+			continue
+		}
+		if !opts.intentToAdd && (len(removed) == 0 || removed[len(removed)-1] != e.Path) {
+			removed = append(removed, e.Path)
+		}
+	}
+	// Like git, the tracked paths are updated first, the removed ones included, in the order of the index, then the new
+	// files are added, sorted
+	removing := make(map[string]bool, len(removed))
+	names := slices.Clone(removed)
+	for _, name := range removed {
+		removing[name] = true
+	}
+	for name := range files {
+		names = append(names, name)
+	}
+	isTracked := make(map[string]bool, len(names))
+	for _, name := range names {
+		isTracked[name] = idx.Get(name) != nil
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if isTracked[names[i]] != isTracked[names[j]] {
+			return isTracked[names[i]]
+		}
+		return names[i] < names[j]
+	})
+	// When the work tree doesn't tell two paths apart, an untracked file is staged as the tracked path its path folds
+	// to, or as the file added before it, when both paths name the same file; a different file is left out, the entry
+	// keeping its content
+	fold := pathFolder()
+	aliases := make(map[string]string)
+	stagedAs := make(map[string]string)
+	for i := len(idx.Entries) - 1; i >= 0 && fold != nil; i-- {
+		if name := idx.Entries[i].Path; !removing[name] {
+			aliases[fold(name)] = name
+		}
+	}
+	for _, name := range names {
+		if removing[name] {
+			report("remove", name)
+			if !opts.dryRun {
+				idx.Remove(name)
+			}
+			continue
+		}
+		ps.MatchSeen(name, false, seen)
+		staged := name
+		if fold != nil {
+			if alias, found := aliases[fold(name)]; found && idx.Get(name) == nil {
+				stagedAs[name] = alias
+				if !sameFile(name, alias, files) {
+					continue
+				}
+				staged = alias
+			} else if !found {
+				aliases[fold(name)] = name
+			}
+			stagedAs[name] = staged
+		}
+		tracked := idx.Get(staged) != nil
+		if opts.update && !tracked {
+			continue
+		}
+		info := files[name]
+		if !tracked && info.IsDir() {
+			fmt.Fprintf(os.Stderr, "warning: adding embedded git repository: %s\n", name)
+		}
+		if !tracked && opts.intentToAdd {
+			report("add", name)
+			empty, err := calculateObjectHash(newBlob(nil))
+			if err != nil {
+				return "", err
+			}
+			entry := index.Entry{Stat: index.StatFromFileInfo(info), Mode: index.ModeFromFileMode(info.Mode()), Path: staged, IntentToAdd: true}
+			entry.Hash = fmt.Sprintf("%x", empty)
+			if err := idx.Add(entry, true); err != nil {
+				return "", err
+			}
+			continue
+		}
+		changed, err := addFile(idx, opts, name, staged, info)
+		if err != nil {
+			return "", err
+		}
+		if changed {
+			report("add", name)
+		}
+	}
+	for i, item := range ps.Items {
+		if !seen[i] && item.Magic&pathspec.Exclude == 0 {
+			return lines(), fmt.Errorf("pathspec '%s' did not match any files", item.Original)
+		}
+	}
+	warnCollisions(stagedCollisions(stagedAs, files), "index")
+	if len(ignored) > 0 {
+		fmt.Fprintf(os.Stderr, "The following paths are ignored by one of your .gitignore files:\n%s\n", strings.Join(ignored, "\n"))
+		if advice, found := configValue("advice.addignoredfile"); !found || advice != "false" {
+			fmt.Fprintf(os.Stderr, "hint: Use -f if you really want to add them.\nhint: Turn this message off by running\nhint: \"git config advice.addIgnoredFile false\"\n")
+		}
+	}
+	if opts.chmod != "" && !opts.dryRun {
+		for _, name := range names {
+			if idx.Get(name) == nil {
+				continue
+			}
+			if err := chmodEntry(idx, name, opts.chmod); err != nil {
+				fmt.Fprintf(os.Stderr, "error: cannot chmod %s '%s'\n", opts.chmod, name)
+				return lines(), errSilentFailure
+			}
+		}
+	}
+	if len(ignored) > 0 {
+		return lines(), errSilentFailure
+	}
+	return lines(), nil
+}
+
+// Stage a file as a path unless its entry is up to date, return whether the entry changed
+// The path is the path of the file, or the tracked path the work tree doesn't tell apart from it
+func addFile(idx *index.Index, opts addOptions, name, staged string, info os.FileInfo) (bool, error) {
+	mode := index.ModeFromFileMode(info.Mode())
+	stat := index.StatFromFileInfo(info)
+	existing := idx.Get(staged)
+	if len(existing) == 1 && existing[0].Stage == 0 && !existing[0].IntentToAdd && !opts.renormalize &&
+		existing[0].Mode == mode && existing[0].Stat == stat && !idx.IsRacy(existing[0]) {
+		return false, nil
+	}
+	var entry index.Entry
+	var err error
+	if opts.dryRun {
+		entry, err = hashFile(name, info)
+	} else {
+		entry, err = stageFile(name, info)
+	}
+	if err != nil {
+		return false, err
+	}
+	entry.Path = staged
+	changed := len(existing) != 1 || existing[0].Stage != 0 || existing[0].IntentToAdd ||
+		existing[0].Mode != entry.Mode || existing[0].Hash != entry.Hash
+	if opts.dryRun {
+		return changed, nil
+	}
+	if !changed {
+		// Only the stat data is refreshed
+		entry.AssumeValid, entry.SkipWorktree = existing[0].AssumeValid, existing[0].SkipWorktree
+	}
+	return changed, idx.Add(entry, true)
+}
+
+// Return the index entry of a file of the work tree without writing its object
+func hashFile(name string, info os.FileInfo) (index.Entry, error) {
+	file := filepath.Join(repo.WorkTree, name)
+	entry := index.Entry{Stat: index.StatFromFileInfo(info), Mode: index.ModeFromFileMode(info.Mode()), Path: name}
+	var content []byte
+	switch entry.Mode {
+	case index.ModeSymlink:
+		target, err := os.Readlink(file)
+		if err != nil {
+			return index.Entry{}, err
+		}
+		content = newBlob([]byte(target))
+	case index.ModeGitlink:
+		return stageFile(name, info)
+	default:
+		blob, err := getBlobFromFile(file, name, 0)
+		if err != nil {
+			return index.Entry{}, err
+		}
+		content = blob
+	}
+	hash, err := calculateObjectHash(content)
+	if err != nil {
+		return index.Entry{}, err
+	}
+	entry.Hash = fmt.Sprintf("%x", hash)
+	return entry, nil
+}
+
+// Return the files of the work tree matching the pathspec, by their path from its top: the regular files, the
+// symlinks and the nested repositories, the .git directories excluded
+// The files and the directories ignored by m are left out and returned apart, unless m is nil
+// Only the directories where the pathspec may match are read
+func workTreeFiles(ps *pathspec.Pathspec, m *ignore.Matcher) (map[string]os.FileInfo, []string, error) {
+	files := make(map[string]os.FileInfo)
+	ignored := make([]string, 0)
+	isIgnored := func(name string, isDir bool) bool {
+		if m == nil {
+			return false
+		}
+		p := m.MatchName(name, isDir)
+		return p != nil && !p.Negated
+	}
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := os.ReadDir(filepath.Join(repo.WorkTree, dir))
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Name() == ".git" {
+				continue
+			}
+			name := path.Join(dir, e.Name())
+			info, err := os.Lstat(filepath.Join(repo.WorkTree, name))
+			if err != nil {
+				return err
+			}
+			if (info.IsDir() || info.Mode().IsRegular() || info.Mode()&os.ModeSymlink != 0) && isIgnored(name, info.IsDir()) {
+				ignored = append(ignored, name)
+				continue
+			}
+			switch {
+			case info.IsDir() && isNestedRepository(filepath.Join(repo.WorkTree, name)):
+				if ps.Match(name, false) {
+					files[name] = info
+				}
+			case info.IsDir():
+				if ps.MayMatchUnder(name) {
+					if err := walk(name); err != nil {
+						return err
+					}
+				}
+			case info.Mode().IsRegular() || info.Mode()&os.ModeSymlink != 0:
+				if ps.Match(name, false) {
+					files[name] = info
+				}
+			}
+		}
+		return nil
+	}
+	root := ps.CommonPrefix()
+	// The walk starts under the directories leading to the root, which may be ignored
+	for i := 1; root != "" && i <= len(root); i++ {
+		if i < len(root) && root[i] != '/' {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(repo.WorkTree, root[:i])); err == nil && isIgnored(root[:i], true) {
+			return files, append(ignored, root[:i]), nil
+		}
+	}
+	if root != "" && isNestedRepository(filepath.Join(repo.WorkTree, root)) {
+		// The files of a nested repository belong to it
+		return files, ignored, nil
+	}
+	return files, ignored, walk(root)
+}
+
+// Whether an ignored path is named by the pathspec: the leading part of one of its paths without wildcards is the
+// ignored path or is under it
+func namedByPathspec(ps *pathspec.Pathspec, name string) bool {
+	for _, item := range ps.Items {
+		literal := item.LiteralPrefix()
+		if item.Magic&pathspec.Exclude == 0 && (literal == name || strings.HasPrefix(literal, name+"/")) {
+			return true
+		}
+	}
+	return false
+}
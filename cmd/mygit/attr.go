@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	attr "github.com/codecrafters-io/git-starter-go/attr"
+	config "github.com/codecrafters-io/git-starter-go/config"
+	convert "github.com/codecrafters-io/git-starter-go/convert"
+	filter "github.com/codecrafters-io/git-starter-go/filter"
+	index "github.com/codecrafters-io/git-starter-go/index"
+)
+
+// Return the attributes of the repository: the .gitattributes files of the work tree, info/attributes and
+// core.attributesFile, $XDG_CONFIG_HOME/git/attributes by default
+func newAttrMatcher() *attr.Matcher {
+	globalFile, found := "", false
+	if cfg, err := loadConfig(); err == nil {
+		globalFile, found = cfg.Path("core.attributesfile")
+	}
+	if !found {
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if home, err := os.UserHomeDir(); xdg == "" && err == nil {
+			xdg = filepath.Join(home, ".config")
+		}
+		if xdg != "" {
+			globalFile = filepath.Join(xdg, "git", "attributes")
+		}
+	}
+	m := attr.New(repo.WorkTree, globalFile, repo.Path("info", "attributes"), ignoreCase())
+	if repo.Bare() {
+		m.SetReader(func(string) ([]byte, error) { return nil, os.ErrNotExist })
+	}
+	return m
+}
+
+// The attributes of the work tree, read once per run
+var workTreeAttributes *attr.Matcher
+
+// Return the attributes of a path from the top of the work tree, by name: "set", "unset" or their value
+func attributesFor(name string) map[string]string {
+	if workTreeAttributes == nil {
+		workTreeAttributes = newAttrMatcher()
+	}
+	return workTreeAttributes.Attributes(name)
+}
+
+// How the content of the work tree is converted to a blob
+type convertFlags int
+
+const (
+	// The blob is written, the conversions that can't be undone are warned about, or refused, as core.safecrlf asks
+	convertWrite convertFlags = 1 << iota
+	// Convert the line endings whatever the index has, even those the automatic conversion usually leaves alone
+	convertRenormalize
+)
+
+// Return the settings of the line endings of the text files: core.autocrlf and core.eol
+func convertSettings() convert.Settings {
+	s := convert.Settings{AutoCRLF: "false", EOL: "native"}
+	if value, found := configValue("core.autocrlf"); found {
+		if strings.EqualFold(value, "input") {
+			s.AutoCRLF = "input"
+		} else if b, err := config.ParseBool(value); err == nil && b {
+			s.AutoCRLF = "true"
+		}
+	}
+	if value, found := configValue("core.eol"); found {
+		s.EOL = strings.ToLower(value)
+	}
+	return s
+}
+
+// Return the encoding of the files of the work tree a working-tree-encoding attribute gives, "" when they are UTF-8
+// like the blobs
+func workingTreeEncoding(attrs map[string]string) (string, error) {
+	value, found := attrs["working-tree-encoding"]
+	switch {
+	case !found || value == "unset" || value == "":
+		return "", nil
+	case value == "set":
+		return "", fmt.Errorf("true/false are no valid working-tree-encodings")
+	case convert.IsUTF8(value):
+		return "", nil
+	}
+	return value, nil
+}
+
+// Whether core.checkRoundtripEncoding, a list separated by commas or spaces, SHIFT-JIS by default, has an encoding
+func checkRoundtrip(enc string) bool {
+	list := "SHIFT-JIS"
+	if value, found := configValue("core.checkroundtripencoding"); found {
+		list = value
+	}
+	for _, e := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if strings.EqualFold(e, enc) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the content of a file of the work tree in an encoding converted to UTF-8
+// The blob is refused when written and the content can't be converted, or not back to the same content when
+// core.checkRoundtripEncoding asks; otherwise the error is reported and the content kept as it is
+func encodeToGit(name string, content []byte, enc string, flags convertFlags) ([]byte, error) {
+	if enc == "" || len(content) == 0 {
+		return content, nil
+	}
+	fail := func(err error) ([]byte, error) {
+		if flags&convertWrite != 0 {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return content, nil
+	}
+	utf := strings.TrimPrefix(strings.TrimPrefix(strings.ToUpper(enc), "UTF"), "-")
+	switch convert.CheckBOM(content, enc) {
+	case convert.ErrBOMProhibited:
+		fmt.Fprintf(os.Stderr, "hint: The file '%s' contains a byte order mark (BOM). Please use UTF-%s as working-tree-encoding.\n", name, utf[:len(utf)-2])
+		return fail(fmt.Errorf("BOM is prohibited in '%s' if encoded as %s", name, enc))
+	case convert.ErrBOMRequired:
+		// An encoding like UTF-16LE-BOM already gives the byte order
+		if !strings.HasSuffix(utf, "-BOM") {
+			fmt.Fprintf(os.Stderr, "hint: The file '%s' is missing a byte order mark (BOM). Please use UTF-%sBE or UTF-%sLE (depending on the byte order) as working-tree-encoding.\n", name, utf, utf)
+		}
+		return fail(fmt.Errorf("BOM is required in '%s' if encoded as %s", name, enc))
+	}
+	decoded, err := convert.Decode(content, enc)
+	if err != nil {
+		return fail(fmt.Errorf("failed to encode '%s' from %s to UTF-8", name, enc))
+	}
+	if flags&convertWrite != 0 && checkRoundtrip(enc) {
+		if encoded, err := convert.Encode(decoded, enc); err != nil || !bytes.Equal(encoded, content) {
+			return nil, fmt.Errorf("encoding '%s' from %s to UTF-8 and back is not the same", name, enc)
+		}
+	}
+	return decoded, nil
+}
+
+// Return the UTF-8 content of a blob converted to the encoding of its file in the work tree, or as it is with an
+// error reported when it can't be
+func encodeToWorkTree(name string, content []byte, enc string) []byte {
+	if enc == "" || len(content) == 0 {
+		return content
+	}
+	encoded, err := convert.Encode(content, enc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to encode '%s' from UTF-8 to %s\n", name, enc)
+		return content
+	}
+	return encoded
+}
+
+// Return the content of the file of the work tree at a path as stored in its blob: cleaned by its filter driver,
+// converted to UTF-8 from its working-tree-encoding, then its line endings converted as its attributes, core.autocrlf
+// and core.eol ask
+func convertToGit(name string, content []byte, flags convertFlags) ([]byte, error) {
+	attrs := attributesFor(name)
+	enc, err := workingTreeEncoding(attrs)
+	if err != nil {
+		return nil, err
+	}
+	content, err = applyFilter(name, content, lookupFilterDriver(attrs), filter.Clean)
+	if err != nil {
+		return nil, err
+	}
+	content, err = encodeToGit(name, content, enc, flags)
+	if err != nil {
+		return nil, err
+	}
+	action := convert.Decide(attrs, convertSettings())
+	indexHasCRLF := func() bool {
+		idx, err := readIndex()
+		if err != nil {
+			return false
+		}
+		i, found := idx.Find(name, 0)
+		if !found || idx.Entries[i].Mode != index.ModeFile && idx.Entries[i].Mode != index.ModeExecutable {
+			return false
+		}
+		blob, err := readBlob(idx.Entries[i].Hash)
+		return err == nil && convert.HasCRLF(blob)
+	}
+	if flags&convertRenormalize != 0 {
+		indexHasCRLF = nil
+	}
+	converted, loss := convert.ToGit(content, action, indexHasCRLF)
+	if loss == convert.NoLoss || flags&convertWrite == 0 {
+		return converted, nil
+	}
+	safeCRLF := "warn"
+	if value, found := configValue("core.safecrlf"); found && !strings.EqualFold(value, "warn") {
+		if b, err := config.ParseBool(value); err == nil && b {
+			safeCRLF = "true"
+		} else {
+			safeCRLF = "false"
+		}
+	}
+	switch {
+	case safeCRLF == "true" && loss == convert.CRLFLost:
+		return nil, fmt.Errorf("CRLF would be replaced by LF in %s", name)
+	case safeCRLF == "true":
+		return nil, fmt.Errorf("LF would be replaced by CRLF in %s", name)
+	case safeCRLF == "warn" && loss == convert.CRLFLost:
+		fmt.Fprintf(os.Stderr, "warning: in the working copy of '%s', CRLF will be replaced by LF the next time Git touches it\n", name)
+	case safeCRLF == "warn":
+		fmt.Fprintf(os.Stderr, "warning: in the working copy of '%s', LF will be replaced by CRLF the next time Git touches it\n", name)
+	}
+	return converted, nil
+}
+
+// How a blob is converted to the file of the work tree at a path, decided from its attributes and the config
+type worktreeConversion struct {
+	action   convert.Action
+	encoding string
+	// The filter driver smudging the blob, nil when there is none
+	driver *filterDriver
+	// Write the symlinks as symlinks, not as files holding their target, unless core.symlinks is false
+	symlinks bool
+}
+
+// Return how a blob is converted to the file of the work tree at a path
+func worktreeConversionFor(name string) (worktreeConversion, error) {
+	attrs := attributesFor(name)
+	enc, err := workingTreeEncoding(attrs)
+	if err != nil {
+		return worktreeConversion{}, err
+	}
+	c := worktreeConversion{action: convert.Decide(attrs, convertSettings()), encoding: enc, driver: lookupFilterDriver(attrs), symlinks: true}
+	if value, found := configValue("core.symlinks"); found {
+		c.symlinks, _ = config.ParseBool(value)
+	}
+	return c, nil
+}
+
+// Return the content of a blob converted for the file of the work tree at a path: its line endings converted, then
+// encoded to its working-tree-encoding, then smudged by its filter driver
+// Without a filter driver, nothing is shared with the other conversions running at the same time
+func (c worktreeConversion) apply(name string, content []byte) ([]byte, error) {
+	content = convert.ToWorkTree(content, c.action)
+	content = encodeToWorkTree(name, content, c.encoding)
+	return applyFilter(name, content, c.driver, filter.Smudge)
+}
+
+// Return the content of a blob as written to the file of the work tree at a path: its line endings converted as its
+// attributes, core.autocrlf and core.eol ask, converted to its working-tree-encoding, then smudged by its filter driver
+func convertToWorkTree(name string, content []byte) ([]byte, error) {
+	c, err := worktreeConversionFor(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.apply(name, content)
+}
+
+type checkAttrOptions struct {
+	all    bool
+	cached bool
+	stdin  bool
+	nul    bool
+}
+
+/*
+Command: mygit check-attr [--cached] [--stdin [-z]] [-a | --all | <attr>...] [--] [<path>...]
+
+Show the attributes of paths, one line per path and attribute: "<path>: <attr>: <value>", the value being set, unset,
+unspecified or the value given to the attribute
+The paths are read from the standard input with --stdin, one per line or separated by NUL with -z
+Without "--", the first argument is the attribute and the others are the paths, or every argument is an attribute with
+--stdin; -a shows all the attributes specified for the paths instead
+With --cached, the .gitattributes files are read from the index instead of the work tree
+*/
+func checkAttr(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit check-attr [--cached] [--stdin [-z]] [-a | --all | <attr>...] [--] [<path>...]")
+	opts := checkAttrOptions{}
+	rest := make([]string, 0)
+	doubleDash := -1
+	for i, arg := range args {
+		if arg == "--" {
+			doubleDash = len(rest)
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+		switch {
+		case arg == "-a" || arg == "--all":
+			opts.all = true
+		case arg == "--cached":
+			opts.cached = true
+		case arg == "--stdin":
+			opts.stdin = true
+		case arg == "-z":
+			opts.nul = true
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return "", usage
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	var names, paths []string
+	switch {
+	case opts.all && doubleDash >= 1:
+		return "", fmt.Errorf("Attributes and --all both specified")
+	case opts.all:
+		paths = rest
+	case doubleDash == 0 || doubleDash < 0 && len(rest) == 0:
+		return "", fmt.Errorf("No attribute specified")
+	case doubleDash > 0:
+		names, paths = rest[:doubleDash], rest[doubleDash:]
+	case opts.stdin:
+		names = rest
+	default:
+		names, paths = rest[:1], rest[1:]
+	}
+	switch {
+	case opts.stdin && len(paths) > 0:
+		return "", fmt.Errorf("Can't specify files with --stdin")
+	case !opts.stdin && len(paths) == 0:
+		return "", fmt.Errorf("No file specified")
+	}
+	for _, name := range names {
+		if !attr.ValidName(name) {
+			fmt.Fprintf(os.Stderr, "error: %s: not a valid attribute name\n", name)
+			return "", errSilentFailure
+		}
+	}
+	if opts.stdin {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		separator := "\n"
+		if opts.nul {
+			separator = "\x00"
+		}
+		for _, line := range strings.Split(string(content), separator) {
+			if line != "" {
+				paths = append(paths, line)
+			}
+		}
+	}
+
+	m := newAttrMatcher()
+	if opts.cached {
+		idx, err := readIndex()
+		if err != nil {
+			return "", err
+		}
+		m.SetReader(func(name string) ([]byte, error) {
+			i, found := idx.Find(name, 0)
+			if !found {
+				return nil, os.ErrNotExist
+			}
+			return readBlob(idx.Entries[i].Hash)
+		})
+	}
+	out := new(strings.Builder)
+	for _, name := range paths {
+		full, err := repoPath(name)
+		if err != nil {
+			return out.String(), fmt.Errorf("'%s' is outside repository at '%s'", name, repo.WorkTree)
+		}
+		attrs := m.Attributes(full)
+		shown := names
+		if opts.all {
+			shown = m.Names(attrs)
+		}
+		display := quotePath(name, false)
+		if opts.nul {
+			display = name
+		}
+		for _, attrName := range shown {
+			value, found := attrs[attrName]
+			if !found {
+				value = "unspecified"
+			}
+			if opts.nul {
+				fmt.Fprintf(out, "%s\x00%s\x00%s\x00", display, attrName, value)
+			} else {
+				fmt.Fprintf(out, "%s: %s: %s\n", display, attrName, value)
+			}
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+	refs "github.com/codecrafters-io/git-starter-go/refs"
+	wildmatch "github.com/codecrafters-io/git-starter-go/wildmatch"
+)
+
+// What the branch command does, list when nothing else is asked
+type branchMode int
+
+const (
+	branchList branchMode = iota
+	branchCreate
+	branchDelete
+	branchMove
+	branchCopy
+	branchSetUpstream
+	branchUnsetUpstream
+	branchShowCurrent
+)
+
+// How a new branch tracks its start point, branch.autoSetupMerge decides by default
+type branchTrack int
+
+const (
+	trackDefault branchTrack = iota
+	trackNever
+	trackExplicit
+)
+
+type branchOptions struct {
+	mode     branchMode
+	force    bool
+	remotes  bool
+	all      bool
+	verbose  int
+	quiet    bool
+	track    branchTrack
+	upstream string
+	filter   refFilter
+	operands []string
+	// Allow resetting the current branch, as checkout -B does
+	resetCurrent bool
+}
+
+/*
+Command: mygit branch [-v | -vv] [-r | -a] [--merged [<commit>]] [--no-merged [<commit>]] [--contains [<commit>]] [--list] [<pattern>...]
+Command: mygit branch [-f] [--track | --no-track] <name> [<start-point>]
+Command: mygit branch (-d | -D) [-r] <name>...
+Command: mygit branch (-m | -M | -c | -C) [<old-name>] <new-name>
+Command: mygit branch (-u <upstream> | --set-upstream-to=<upstream>) [<name>]
+Command: mygit branch --unset-upstream [<name>]
+Command: mygit branch --show-current
+
+List, create, delete, rename or copy branches, and set the upstream they track
+*/
+func branchCommand(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit branch [<options>] [-r | -a] [--merged] [--no-merged] | [-f] <name> [<start-point>] | (-d | -D) <name>... | (-m | -M | -c | -C) [<old>] <new> | (-u <upstream> | --unset-upstream) [<name>] | --show-current")
+	opts := branchOptions{}
+	list := false
+	setMode := func(mode branchMode) error {
+		if opts.mode != branchList && opts.mode != mode {
+			return usage
+		}
+		opts.mode = mode
+		return nil
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			opts.operands = append(opts.operands, args[i+1:]...)
+			break
+		}
+		if ok, err := opts.filter.parseOption(args, &i); ok {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		var err error
+		switch {
+		case arg == "-d" || arg == "--delete":
+			err = setMode(branchDelete)
+		case arg == "-D":
+			err = setMode(branchDelete)
+			opts.force = true
+		case arg == "-m" || arg == "--move":
+			err = setMode(branchMove)
+		case arg == "-M":
+			err = setMode(branchMove)
+			opts.force = true
+		case arg == "-c" || arg == "--copy":
+			err = setMode(branchCopy)
+		case arg == "-C":
+			err = setMode(branchCopy)
+			opts.force = true
+		case arg == "-f" || arg == "--force":
+			opts.force = true
+		case arg == "-r" || arg == "--remotes":
+			opts.remotes = true
+		case arg == "-a" || arg == "--all":
+			opts.all = true
+		case arg == "-l" || arg == "--list":
+			list = true
+		case arg == "-v" || arg == "--verbose":
+			opts.verbose++
+		case arg == "-vv":
+			opts.verbose += 2
+		case arg == "-q" || arg == "--quiet":
+			opts.quiet = true
+		case arg == "-t" || arg == "--track":
+			opts.track = trackExplicit
+		case arg == "--no-track":
+			opts.track = trackNever
+		case arg == "-u" || arg == "--set-upstream-to":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			i++
+			opts.upstream = args[i]
+			err = setMode(branchSetUpstream)
+		case strings.HasPrefix(arg, "--set-upstream-to="):
+			opts.upstream = strings.TrimPrefix(arg, "--set-upstream-to=")
+			err = setMode(branchSetUpstream)
+		case arg == "--unset-upstream":
+			err = setMode(branchUnsetUpstream)
+		case arg == "--show-current":
+			err = setMode(branchShowCurrent)
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return "", usage
+		default:
+			opts.operands = append(opts.operands, arg)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	// Without another mode, names are patterns with --list or a filter, and a new branch otherwise
+	if opts.mode == branchList && len(opts.operands) > 0 && !list && !opts.filter.active() && !opts.all && !opts.remotes {
+		opts.mode = branchCreate
+	}
+	switch opts.mode {
+	case branchList:
+		return listBranches(opts)
+	case branchCreate:
+		if len(opts.operands) > 2 {
+			return "", usage
+		}
+		start := "HEAD"
+		if len(opts.operands) == 2 {
+			start = opts.operands[1]
+		}
+		return createBranch(opts, opts.operands[0], start)
+	case branchDelete:
+		if len(opts.operands) == 0 {
+			return "", fmt.Errorf("branch name required")
+		}
+		return deleteBranches(opts)
+	case branchMove, branchCopy:
+		return moveBranch(opts)
+	case branchSetUpstream, branchUnsetUpstream:
+		if len(opts.operands) > 1 {
+			return "", usage
+		}
+		name, err := branchOperand(opts.operands)
+		if err != nil {
+			return "", err
+		}
+		if opts.mode == branchUnsetUpstream {
+			return "", unsetUpstream(name)
+		}
+		return setUpstream(name, opts.upstream)
+	case branchShowCurrent:
+		if current, ok := currentBranch(); ok {
+			return refs.ShortName(current) + "\n", nil
+		}
+		return "", nil
+	}
+	return "", usage
+}
+
+// Return the branch HEAD points to, false when HEAD is detached
+func currentBranch() (string, bool) {
+	head, err := refStore().Read("HEAD")
+	if err != nil || !strings.HasPrefix(head.Symbolic, "refs/heads/") {
+		return "", false
+	}
+	return head.Symbolic, true
+}
+
+// Return the short name of the branch an option applies to: the only operand, or the current branch
+func branchOperand(operands []string) (string, error) {
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	current, ok := currentBranch()
+	if !ok {
+		return "", fmt.Errorf("could not set upstream of HEAD when it does not point to any branch")
+	}
+	return refs.ShortName(current), nil
+}
+
+// Check a new branch name and return its ref
+func branchRefName(name string) (string, error) {
+	ref := "refs/heads/" + name
+	if name == "HEAD" || strings.HasPrefix(name, "-") || refs.CheckRefFormat(ref, 0) != nil {
+		return "", fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	return ref, nil
+}
+
+// One line of the branch listing
+type branchLine struct {
+	name    string
+	display string
+	hash    string
+	current bool
+	// The target of a symbolic ref, like origin/HEAD
+	symbolic string
+}
+
+// List the branches matching the patterns and the filter
+func listBranches(opts branchOptions) (string, error) {
+	store := refStore()
+	lines := make([]branchLine, 0)
+	head, headErr := store.Read("HEAD")
+	if headErr == nil && !head.IsSymbolic() && !opts.remotes && opts.filter.keep(head.Target) {
+		name := fmt.Sprintf("(HEAD detached at %s)", abbreviate(head.Target))
+		lines = append(lines, branchLine{name: name, display: name, hash: head.Target, current: true})
+	}
+	prefixes := []string{"refs/heads/"}
+	switch {
+	case opts.all:
+		prefixes = append(prefixes, "refs/remotes/")
+	case opts.remotes:
+		prefixes = []string{"refs/remotes/"}
+	}
+	for _, prefix := range prefixes {
+		list, err := store.List(prefix)
+		if err != nil {
+			return "", err
+		}
+		for _, ref := range list {
+			short := strings.TrimPrefix(ref.Name, prefix)
+			if !matchesBranchPattern(short, opts.operands) {
+				continue
+			}
+			line := branchLine{name: ref.Name, display: short, current: ref.Name == head.Symbolic}
+			if opts.all && prefix == "refs/remotes/" {
+				line.display = "remotes/" + short
+			}
+			if ref.IsSymbolic() {
+				line.symbolic = refs.ShortName(ref.Symbolic)
+			} else {
+				line.hash = ref.Target
+			}
+			resolved, err := store.Resolve(ref.Name)
+			if err != nil || !opts.filter.keep(resolved.Target) {
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	width := 0
+	for _, line := range lines {
+		width = max(width, len(line.display))
+	}
+	out := new(strings.Builder)
+	for _, line := range lines {
+		marker := ' '
+		if line.current {
+			marker = '*'
+		}
+		switch {
+		case line.symbolic != "":
+			fmt.Fprintf(out, "%c %s -> %s\n", marker, line.display, line.symbolic)
+		case opts.verbose > 0:
+			tracking := ""
+			if strings.HasPrefix(line.name, "refs/heads/") {
+				tracking = upstreamTracking(refs.ShortName(line.name), opts.verbose > 1)
+			}
+			fmt.Fprintf(out, "%c %-*s %s %s%s\n", marker, width, line.display, abbreviate(line.hash), tracking, commitSubject(line.hash))
+		default:
+			fmt.Fprintf(out, "%c %s\n", marker, line.display)
+		}
+	}
+	return out.String(), nil
+}
+
+// Whether a branch name matches one of the patterns, any name matches no pattern
+func matchesBranchPattern(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if wildmatch.Match(pattern, name, 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return how a branch compares to its upstream as branch -v shows it: "[ahead 1, behind 2] ", "[gone] ",
+// or with the upstream name when verbose like "[origin/main: ahead 1] ", "" when it has no upstream
+func upstreamTracking(branch string, verbose bool) string {
+	state, ok := branchUpstreamState(branch)
+	if !ok {
+		return ""
+	}
+	switch track := state.String(); {
+	case verbose && track == "":
+		return fmt.Sprintf("[%s] ", refs.ShortName(state.ref))
+	case verbose:
+		return fmt.Sprintf("[%s: %s] ", refs.ShortName(state.ref), track)
+	case track == "":
+		return ""
+	default:
+		return fmt.Sprintf("[%s] ", track)
+	}
+}
+
+// Return the ref a branch tracks from branch.<name>.remote and branch.<name>.merge,
+// mapped through the fetch refspecs of the remote to its remote-tracking branch
+func branchUpstream(branch string) (string, bool) {
+	remote, hasRemote := configValue("branch." + branch + ".remote")
+	merge, hasMerge := configValue("branch." + branch + ".merge")
+	if !hasRemote || !hasMerge {
+		return "", false
+	}
+	if remote == "." {
+		return merge, true
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", false
+	}
+	for _, fetch := range cfg.GetAll("remote." + remote + ".fetch") {
+		src, dst, _ := strings.Cut(strings.TrimPrefix(fetch.Value, "+"), ":")
+		if tracking, ok := mapRefspec(src, dst, merge); ok {
+			return tracking, true
+		}
+	}
+	return "", false
+}
+
+// Map a ref name matching the source side of a refspec to its destination side, a "*" standing for any part of the name
+func mapRefspec(src, dst, name string) (string, bool) {
+	before, after, glob := strings.Cut(src, "*")
+	if !glob {
+		return dst, name == src && dst != ""
+	}
+	if !strings.HasPrefix(name, before) || !strings.HasSuffix(name, after) || len(name) < len(before)+len(after) {
+		return "", false
+	}
+	return strings.Replace(dst, "*", name[len(before):len(name)-len(after)], 1), true
+}
+
+// Return the remote and the ref on that remote a tracking branch mirrors, like origin and refs/heads/main
+// for refs/remotes/origin/main, or "." and the branch itself for a local branch
+func trackingSource(upstream string) (string, string, bool) {
+	if strings.HasPrefix(upstream, "refs/heads/") {
+		return ".", upstream, true
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", "", false
+	}
+	for _, e := range cfg.Entries() {
+		section, remote, name, err := config.SplitKey(e.Key)
+		if err != nil || section != "remote" || name != "fetch" || remote == "" {
+			continue
+		}
+		src, dst, _ := strings.Cut(strings.TrimPrefix(e.Value, "+"), ":")
+		if merge, ok := mapRefspec(dst, src, upstream); ok {
+			return remote, merge, true
+		}
+	}
+	return "", "", false
+}
+
+// Write branch.<name>.remote and branch.<name>.merge for a branch to track upstream, a full ref name
+func setTracking(branch, upstream string) (string, error) {
+	remote, merge, ok := trackingSource(upstream)
+	if !ok {
+		return "", fmt.Errorf("cannot set up tracking information; starting point '%s' is not a branch", refs.ShortName(upstream))
+	}
+	err := editRepositoryConfig(func(f *config.File) error {
+		if err := f.Set("branch."+branch+".remote", remote); err != nil {
+			return err
+		}
+		return f.Set("branch."+branch+".merge", merge)
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("branch '%s' set up to track '%s'.\n", branch, refs.ShortName(upstream)), nil
+}
+
+// Set the upstream of a branch, from the name of a local or remote-tracking branch
+func setUpstream(branch, upstream string) (string, error) {
+	store := refStore()
+	if _, err := store.Read("refs/heads/" + branch); err != nil {
+		return "", fmt.Errorf("branch '%s' does not exist", branch)
+	}
+	upstreamRef, ok := expandBranchName(store, upstream)
+	if !ok {
+		return "", fmt.Errorf("the requested upstream branch '%s' does not exist", upstream)
+	}
+	return setTracking(branch, upstreamRef)
+}
+
+// Remove the upstream of a branch
+func unsetUpstream(branch string) error {
+	if _, ok := configValue("branch." + branch + ".merge"); !ok {
+		return fmt.Errorf("branch '%s' has no upstream information", branch)
+	}
+	return editRepositoryConfig(func(f *config.File) error {
+		if _, err := f.Unset("branch."+branch+".remote", true); err != nil {
+			return err
+		}
+		_, err := f.Unset("branch."+branch+".merge", true)
+		return err
+	})
+}
+
+// Create a branch at a start point, or reset it with --force, tracking the start point when it is a remote-tracking branch
+func createBranch(opts branchOptions, name, start string) (string, error) {
+	ref, err := branchRefName(name)
+	if err != nil {
+		return "", err
+	}
+	store := refStore()
+	_, readErr := store.Read(ref)
+	exists := readErr == nil
+	if exists && !opts.force {
+		return "", fmt.Errorf("a branch named '%s' already exists", name)
+	}
+	if current, ok := currentBranch(); exists && ok && current == ref && !opts.resetCurrent {
+		return "", fmt.Errorf("cannot force update the current branch")
+	}
+	startName := start
+	if start == "HEAD" {
+		if current, ok := currentBranch(); ok {
+			startName = refs.ShortName(current)
+		}
+	}
+	hash, err := resolveCommit(start)
+	if err != nil {
+		return "", fmt.Errorf("not a valid object name: '%s'", startName)
+	}
+	message := "branch: Created from " + start
+	old := ""
+	if exists {
+		message = "branch: Reset to " + start
+	} else {
+		old, _ = resolveOldValue("")
+	}
+	if err := store.Update(refs.Update{Name: ref, New: hash, Old: old, Message: message}, true); err != nil {
+		return "", err
+	}
+	if opts.track == trackNever {
+		return "", nil
+	}
+	startRef, found := expandBranchName(store, start)
+	track := found && strings.HasPrefix(startRef, "refs/remotes/")
+	if opts.track == trackExplicit {
+		if !found || !strings.HasPrefix(startRef, "refs/heads/") && !strings.HasPrefix(startRef, "refs/remotes/") {
+			return "", fmt.Errorf("cannot set up tracking information; starting point '%s' is not a branch", start)
+		}
+		track = true
+	} else if autoSetup, ok := configValue("branch.autosetupmerge"); ok {
+		if enabled, err := config.ParseBool(autoSetup); err == nil && !enabled {
+			track = false
+		}
+	}
+	if !track {
+		return "", nil
+	}
+	if _, _, ok := trackingSource(startRef); !ok && opts.track == trackDefault {
+		return "", nil
+	}
+	out, err := setTracking(name, startRef)
+	if opts.quiet {
+		out = ""
+	}
+	return out, err
+}
+
+// Delete branches, or remote-tracking branches with -r, refusing those not merged into their upstream or HEAD
+// without --force; the deletions are reported even when some of the names fail
+func deleteBranches(opts branchOptions) (string, error) {
+	store := refStore()
+	out := new(strings.Builder)
+	failed := false
+	current, onBranch := currentBranch()
+	head, _ := store.Resolve("HEAD")
+	for _, name := range opts.operands {
+		ref := "refs/heads/" + name
+		if opts.remotes {
+			ref = "refs/remotes/" + name
+		}
+		existing, err := store.Read(ref)
+		if err != nil {
+			if opts.remotes {
+				fmt.Fprintf(os.Stderr, "error: remote-tracking branch '%s' not found.\n", name)
+			} else {
+				fmt.Fprintf(os.Stderr, "error: branch '%s' not found.\n", name)
+			}
+			failed = true
+			continue
+		}
+		if !opts.remotes && onBranch && ref == current {
+			fmt.Fprintf(os.Stderr, "error: Cannot delete branch '%s' checked out at '%s'\n", name, repo.WorkTree)
+			failed = true
+			continue
+		}
+		// Remote-tracking branches follow their remote, they are deleted whether merged or not
+		if !opts.force && !opts.remotes && !existing.IsSymbolic() && !branchMerged(name, existing.Target, head.Target) {
+			fmt.Fprintf(os.Stderr, "error: The branch '%s' is not fully merged.\n"+
+				"If you are sure you want to delete it, run 'mygit branch -D %s'.\n", name, name)
+			failed = true
+			continue
+		}
+		if err := store.Update(refs.Update{Name: ref, Delete: true, Old: existing.Target}, true); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			failed = true
+			continue
+		}
+		if !opts.remotes {
+			err := editRepositoryConfig(func(f *config.File) error {
+				_, err := f.RemoveSection("branch", name)
+				return err
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: unable to remove the configuration of branch '%s': %s\n", name, err)
+			}
+		}
+		if opts.quiet {
+			continue
+		}
+		was := abbreviate(existing.Target)
+		if existing.IsSymbolic() {
+			was = existing.Symbolic
+		}
+		if opts.remotes {
+			fmt.Fprintf(out, "Deleted remote-tracking branch %s (was %s).\n", name, was)
+		} else {
+			fmt.Fprintf(out, "Deleted branch %s (was %s).\n", name, was)
+		}
+	}
+	if failed {
+		return out.String(), errSilentFailure
+	}
+	return out.String(), nil
+}
+
+// Whether a branch is merged into its upstream, or into HEAD when it has none
+func branchMerged(branch, hash, head string) bool {
+	into := head
+	if upstream, ok := branchUpstream(branch); ok {
+		if ref, err := refStore().Resolve(upstream); err == nil {
+			into = ref.Target
+		}
+	}
+	return into != "" && newReachability(into).contains(hash)
+}
+
+// Rename or copy a branch with its reflog and its configuration
+func moveBranch(opts branchOptions) (string, error) {
+	copying := opts.mode == branchCopy
+	var oldName, newName string
+	current, onBranch := currentBranch()
+	switch len(opts.operands) {
+	case 1:
+		if !onBranch {
+			if copying {
+				return "", fmt.Errorf("cannot copy the current branch while not on any branch")
+			}
+			return "", fmt.Errorf("cannot rename the current branch while not on any branch")
+		}
+		oldName, newName = refs.ShortName(current), opts.operands[0]
+	case 2:
+		oldName, newName = opts.operands[0], opts.operands[1]
+	default:
+		return "", fmt.Errorf("too many arguments for a rename operation")
+	}
+	oldRef := "refs/heads/" + oldName
+	newRef, err := branchRefName(newName)
+	if err != nil {
+		return "", err
+	}
+	store := refStore()
+	_, oldErr := store.Read(oldRef)
+	// The current branch may not have been born yet, there is only HEAD to move then
+	unborn := oldErr == refs.ErrNotFound && onBranch && oldRef == current
+	if oldErr != nil && !unborn {
+		return "", fmt.Errorf("no branch named '%s'", oldName)
+	}
+	if _, err := store.Read(newRef); err == nil && newRef != oldRef {
+		if !opts.force {
+			return "", fmt.Errorf("a branch named '%s' already exists", newName)
+		}
+		if onBranch && current == newRef {
+			return "", fmt.Errorf("cannot force update the current branch")
+		}
+	}
+	verb := "renamed"
+	if copying {
+		verb = "copied"
+	}
+	message := fmt.Sprintf("Branch: %s %s to %s", verb, oldRef, newRef)
+	switch {
+	case unborn && !copying:
+		if err := store.Update(refs.Update{Name: "HEAD", NewSymbolic: newRef, NoLog: true}, true); err != nil {
+			return "", err
+		}
+	case unborn:
+		return "", fmt.Errorf("no branch named '%s'", oldName)
+	case copying:
+		err = store.Copy(oldRef, newRef, message, opts.force)
+	default:
+		err = store.Rename(oldRef, newRef, message, opts.force)
+	}
+	if err != nil {
+		return "", fmt.Errorf("branch %s failed: %s", strings.TrimSuffix(verb, "d"), err)
+	}
+	if oldRef == newRef {
+		return "", nil
+	}
+	err = editRepositoryConfig(func(f *config.File) error {
+		if _, err := f.RemoveSection("branch", newName); err != nil {
+			return err
+		}
+		if copying {
+			_, err := f.CopySection("branch", oldName, newName)
+			return err
+		}
+		_, err := f.RenameSection("branch", oldName, newName)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("branch is %s, but update of config-file failed: %s", verb, err)
+	}
+	return "", nil
+}
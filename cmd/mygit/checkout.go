@@ -0,0 +1,944 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	ignore "github.com/codecrafters-io/git-starter-go/ignore"
+	index "github.com/codecrafters-io/git-starter-go/index"
+	pathspec "github.com/codecrafters-io/git-starter-go/pathspec"
+	refs "github.com/codecrafters-io/git-starter-go/refs"
+)
+
+type switchOptions struct {
+	// Throw away the local changes and the untracked files in the way
+	force bool
+	quiet bool
+	// The branch to create at the target, reset when it exists with forceCreate
+	newBranch   string
+	forceCreate bool
+	// Detach HEAD at the commit even when it is a branch
+	detach bool
+	// A commit that isn't a branch detaches HEAD, as checkout does, switch wants --detach
+	implicitDetach bool
+}
+
+// Where a switch goes: a branch, or a commit HEAD is detached at
+type switchTarget struct {
+	// The name given, shown in the messages and the reflog
+	name string
+	// The ref of the branch, "" to detach HEAD
+	branch string
+	// The commit, "" for a new branch created on an unborn HEAD
+	commit string
+	// The start point of the branch created, as given
+	start string
+}
+
+// The message git shows when HEAD gets detached at a commit that isn't a branch
+const detachedHeadAdvice = `You are in 'detached HEAD' state. You can look around, make experimental
+changes and commit them, and you can discard any commits you make in this
+state without impacting any branches by switching back to a branch.
+
+If you want to create a new branch to retain commits you create, you may
+do so (now or later) by using -c with the switch command. Example:
+
+  git switch -c <new-branch-name>
+
+Or undo this operation with:
+
+  git switch -
+
+Turn off this advice by setting config variable advice.detachedHead to false
+`
+
+/*
+Command: mygit switch [-q] [-f] <branch>
+Command: mygit switch [-q] [-f] (-c | -C) <new-branch> [<start-point>]
+Command: mygit switch [-q] [-f] --detach [<commit>]
+
+Switch to a branch, updating the index and the work tree to its commit, or detach HEAD at a commit
+The changes of the index and the work tree are kept when the files they touch are the same in both commits, the
+switch is refused when they would be lost, or when an untracked file is in the way, unless -f throws them away
+-c creates the branch first, -C resets it when it exists
+*/
+func switchCommand(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit switch [-q] [-f] [(-c | -C) <new-branch>] [--detach] [<branch> | <start-point>]")
+	opts := switchOptions{}
+	operands := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			operands = append(operands, args[i+1:]...)
+			break
+		}
+		switch {
+		case arg == "-q" || arg == "--quiet":
+			opts.quiet = true
+		case arg == "-f" || arg == "--force" || arg == "--discard-changes":
+			opts.force = true
+		case arg == "-c" || arg == "--create" || arg == "-C" || arg == "--force-create":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			opts.forceCreate = arg == "-C" || arg == "--force-create"
+			i++
+			opts.newBranch = args[i]
+		case arg == "-d" || arg == "--detach":
+			opts.detach = true
+		case strings.HasPrefix(arg, "-"):
+			return "", usage
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	switch {
+	case len(operands) > 1:
+		return "", fmt.Errorf("only one reference expected")
+	case len(operands) == 0 && opts.newBranch == "" && !opts.detach:
+		return "", fmt.Errorf("missing branch or commit argument")
+	case opts.newBranch != "" && opts.detach:
+		return "", fmt.Errorf("options '-c' and '--detach' cannot be used together")
+	}
+	name := "HEAD"
+	if len(operands) == 1 {
+		name = operands[0]
+	}
+	target, err := resolveSwitchTarget(name, opts)
+	if err != nil {
+		return "", err
+	}
+	return switchTo(target, opts)
+}
+
+// Return where a switch to a name goes: the branch it names, unless HEAD is detached, or the commit it stands for
+// With a branch to create, the name is its start point
+func resolveSwitchTarget(name string, opts switchOptions) (switchTarget, error) {
+	invalid := fmt.Errorf("invalid reference: %s", name)
+	store := refStore()
+	if opts.newBranch != "" {
+		ref, err := branchRefName(opts.newBranch)
+		if err != nil {
+			return switchTarget{}, err
+		}
+		if _, err := store.Read(ref); err == nil && !opts.forceCreate {
+			return switchTarget{}, fmt.Errorf("a branch named '%s' already exists", opts.newBranch)
+		}
+		target := switchTarget{name: opts.newBranch, branch: ref, start: name}
+		commit, err := resolveCommit(name)
+		if _, unborn := store.Resolve("HEAD"); err != nil && (name != "HEAD" || unborn == nil) {
+			return switchTarget{}, invalid
+		}
+		target.commit = commit
+		return target, nil
+	}
+	ref := "refs/heads/" + name
+	if _, err := store.Read(ref); err == nil && !opts.detach {
+		commit, _ := resolveCommit(ref)
+		return switchTarget{name: name, branch: ref, commit: commit}, nil
+	}
+	commit, err := resolveCommit(name)
+	if err != nil {
+		return switchTarget{}, invalid
+	}
+	if !opts.detach && !opts.implicitDetach {
+		return switchTarget{}, fmt.Errorf("a branch is expected, got commit '%s'\n"+
+			"hint: If you want to detach HEAD at the commit, try again with the --detach option.", name)
+	}
+	return switchTarget{name: name, commit: commit}, nil
+}
+
+// Switch to a target: merge the changes between the commit of HEAD and the target into the index and the work tree,
+// then point HEAD to it, creating its branch first when asked
+// The local changes kept are returned the way diff --name-status shows them
+func switchTo(target switchTarget, opts switchOptions) (string, error) {
+	if repo.Bare() {
+		return "", fmt.Errorf("this operation must be run in a work tree")
+	}
+	store := refStore()
+	current, onBranch := currentBranch()
+	oldCommit := ""
+	if head, err := store.Resolve("HEAD"); err == nil {
+		oldCommit = head.Target
+	}
+	idx, lock, err := lockIndex()
+	if err != nil {
+		return "", err
+	}
+	var newEntries []index.Entry
+	if target.commit != "" {
+		oldEntries := make([]index.Entry, 0)
+		if oldCommit != "" {
+			oldEntries, err = commitEntries(oldCommit)
+		}
+		if err == nil {
+			newEntries, err = commitEntries(target.commit)
+		}
+		var plan *checkoutPlan
+		if err == nil {
+			plan, err = twoWayMerge(idx, oldEntries, newEntries, opts.force)
+		}
+		if err == nil {
+			err = applyCheckout(idx, plan)
+		}
+		if err != nil {
+			lock.Rollback()
+			return "", err
+		}
+	}
+	if err := commitIndex(lock, idx); err != nil {
+		return "", err
+	}
+
+	_, readErr := store.Read(target.branch)
+	branchExisted := opts.newBranch != "" && readErr == nil
+	if opts.newBranch != "" && target.commit != "" {
+		branchOpts := branchOptions{force: opts.forceCreate, resetCurrent: true, track: trackNever}
+		if _, err := createBranch(branchOpts, opts.newBranch, target.start); err != nil {
+			return "", err
+		}
+	}
+	from := refs.ShortName(current)
+	if !onBranch {
+		from = oldCommit
+	}
+	message := fmt.Sprintf("checkout: moving from %s to %s", from, target.name)
+	if target.branch != "" {
+		err = store.SetSymbolic("HEAD", target.branch, message)
+	} else {
+		err = store.Update(refs.Update{Name: "HEAD", New: target.commit, Message: message}, true)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if opts.quiet {
+		return "", nil
+	}
+	describe := func(label, commit string) {
+		fmt.Fprintf(os.Stderr, "%s %s %s\n", label, abbreviate(commit), commitSubject(commit))
+	}
+	if !onBranch && oldCommit != "" && oldCommit != target.commit {
+		describe("Previous HEAD position was", oldCommit)
+	}
+	switch {
+	case target.branch == "":
+		advice, found := configValue("advice.detachedhead")
+		if onBranch && !opts.detach && (!found || advice != "false") {
+			fmt.Fprintf(os.Stderr, "Note: switching to '%s'.\n\n%s\n", target.name, detachedHeadAdvice)
+		}
+		describe("HEAD is now at", target.commit)
+	case onBranch && current == target.branch && opts.forceCreate:
+		fmt.Fprintf(os.Stderr, "Reset branch '%s'\n", target.name)
+	case onBranch && current == target.branch:
+		fmt.Fprintf(os.Stderr, "Already on '%s'\n", target.name)
+	case branchExisted:
+		fmt.Fprintf(os.Stderr, "Switched to and reset branch '%s'\n", target.name)
+	case opts.newBranch != "":
+		fmt.Fprintf(os.Stderr, "Switched to a new branch '%s'\n", target.name)
+	default:
+		fmt.Fprintf(os.Stderr, "Switched to branch '%s'\n", target.name)
+	}
+	if opts.force || target.commit == "" {
+		return "", nil
+	}
+	return localChanges(idx, newEntries)
+}
+
+// Return the entries of the tree of a commit
+func commitEntries(commit string) ([]index.Entry, error) {
+	tree, err := resolveTree(commit)
+	if err != nil {
+		return nil, err
+	}
+	return readTreeEntries(tree)
+}
+
+// Return the changes of the index and the work tree from the entries of a tree, one "<letter>\t<path>" line per path
+// like diff-index --name-status shows them: 'A' added, 'D' deleted, 'M' modified, 'T' type changed or 'U' unmerged
+func localChanges(idx *index.Index, tree []index.Entry) (string, error) {
+	inTree := make(map[string]index.Entry, len(tree))
+	for _, e := range tree {
+		inTree[e.Path] = e
+	}
+	letters := make(map[string]byte)
+	for _, e := range idx.Entries {
+		if e.Stage > 0 {
+			letters[e.Path] = 'U'
+			continue
+		}
+		t, found := inTree[e.Path]
+		change, mode, _, err := worktreeChange(idx, e)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case change == 'D' && found:
+			letters[e.Path] = 'D'
+		case change == 'D':
+		case !found:
+			letters[e.Path] = 'A'
+		case mode&0o170000 != t.Mode&0o170000:
+			letters[e.Path] = 'T'
+		case change != ' ' || e.Hash != t.Hash || mode != t.Mode:
+			letters[e.Path] = 'M'
+		}
+	}
+	for _, t := range tree {
+		if idx.Get(t.Path) == nil {
+			letters[t.Path] = 'D'
+		}
+	}
+	paths := make([]string, 0, len(letters))
+	for name := range letters {
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+	out := new(strings.Builder)
+	for _, name := range paths {
+		fmt.Fprintf(out, "%c\t%s\n", letters[name], quotePath(name, false))
+	}
+	return out.String(), nil
+}
+
+// The changes a checkout makes to the index and the work tree
+type checkoutPlan struct {
+	// The paths whose entries and files are removed
+	remove []string
+	// The entries whose files are written, then staged with their stat data
+	write []index.Entry
+}
+
+// Plan the checkout of the tree of newEntries over the tree of oldEntries, the commit of HEAD, like git's two-way
+// merge: a path the trees have the same keeps its entry and its file, with their changes, and a path they don't gets
+// the entry of the new tree, unless the index or the work tree has changes that would be lost
+// The paths that can't be checked out are reported on the standard error, the untracked files in the way too, and
+// nothing is planned; force throws all the changes away instead
+func twoWayMerge(idx *index.Index, oldEntries, newEntries []index.Entry, force bool) (*checkoutPlan, error) {
+	olds := make(map[string]*index.Entry, len(oldEntries))
+	news := make(map[string]*index.Entry, len(newEntries))
+	currents := make(map[string]*index.Entry, len(idx.Entries))
+	paths := make([]string, 0, len(idx.Entries)+len(newEntries))
+	addPath := func(name string) {
+		if olds[name] == nil && news[name] == nil && currents[name] == nil {
+			paths = append(paths, name)
+		}
+	}
+	for i := range oldEntries {
+		addPath(oldEntries[i].Path)
+		olds[oldEntries[i].Path] = &oldEntries[i]
+	}
+	for i := range newEntries {
+		addPath(newEntries[i].Path)
+		news[newEntries[i].Path] = &newEntries[i]
+	}
+	unmerged := make([]string, 0)
+	for i := range idx.Entries {
+		e := &idx.Entries[i]
+		if e.Stage > 0 {
+			if len(unmerged) == 0 || unmerged[len(unmerged)-1] != e.Path {
+				unmerged = append(unmerged, e.Path)
+			}
+			addPath(e.Path)
+			continue
+		}
+		addPath(e.Path)
+		currents[e.Path] = e
+	}
+	if len(unmerged) > 0 && !force {
+		for _, name := range unmerged {
+			fmt.Fprintf(os.Stderr, "%s: needs merge\n", name)
+		}
+		fmt.Fprintf(os.Stderr, "error: you need to resolve your current index first\n")
+		return nil, errSilentFailure
+	}
+	sort.Strings(paths)
+
+	same := func(a, b *index.Entry) bool {
+		return a != nil && b != nil && a.Hash == b.Hash && a.Mode == b.Mode
+	}
+	// The file of an entry matches it, or is missing
+	upToDate := func(e *index.Entry) (bool, error) {
+		change, _, _, err := worktreeChange(idx, *e)
+		return change == ' ' || change == 'D', err
+	}
+	tracked := func(name string) bool {
+		return len(idx.Get(name)) > 0
+	}
+	m, err := newIgnoreMatcher()
+	if err != nil {
+		return nil, err
+	}
+	plan := &checkoutPlan{}
+	localChanges := make([]string, 0)
+	untracked := make([]string, 0)
+	// The directories where a file goes holding untracked files
+	lost := make([]string, 0)
+	for _, name := range paths {
+		old, new, current := olds[name], news[name], currents[name]
+		if force {
+			switch {
+			case new == nil:
+				plan.remove = append(plan.remove, name)
+			case same(current, new):
+				if clean, err := upToDate(current); err != nil {
+					return nil, err
+				} else if !clean {
+					plan.write = append(plan.write, *new)
+				}
+			default:
+				plan.write = append(plan.write, *new)
+			}
+			continue
+		}
+		switch {
+		case current != nil && (old == nil && new == nil || old == nil && same(current, new) || same(old, new) || old != nil && same(current, new)):
+			// Nothing changes, the changes of the index and the work tree are kept
+		case current != nil && old != nil && same(current, old):
+			clean, err := upToDate(current)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case !clean:
+				localChanges = append(localChanges, name)
+			case new == nil:
+				plan.remove = append(plan.remove, name)
+			default:
+				plan.write = append(plan.write, *new)
+			}
+		case current != nil:
+			localChanges = append(localChanges, name)
+		case new != nil && old != nil:
+			// The deletion of the path was staged
+			if !same(old, new) {
+				localChanges = append(localChanges, name)
+			}
+		case new != nil:
+			if blocking, found := untrackedInTheWay(name, tracked, m); found && strings.HasPrefix(blocking, name+"/") {
+				lost = append(lost, name)
+			} else if found {
+				untracked = append(untracked, blocking)
+			} else {
+				plan.write = append(plan.write, *new)
+			}
+		}
+	}
+	if len(localChanges) == 0 && len(untracked) == 0 && len(lost) == 0 {
+		return plan, nil
+	}
+	if len(localChanges) > 0 {
+		fmt.Fprintf(os.Stderr, "error: Your local changes to the following files would be overwritten by checkout:\n\t%s\n"+
+			"Please commit your changes or stash them before you switch branches.\n", strings.Join(localChanges, "\n\t"))
+	}
+	if len(lost) > 0 {
+		fmt.Fprintf(os.Stderr, "error: Updating the following directories would lose untracked files in them:\n\t%s\n\n",
+			strings.Join(lost, "\n\t"))
+	}
+	if len(untracked) > 0 {
+		fmt.Fprintf(os.Stderr, "error: The following untracked working tree files would be overwritten by checkout:\n\t%s\n"+
+			"Please move or remove them before you switch branches.\n", strings.Join(untracked, "\n\t"))
+	}
+	fmt.Fprintf(os.Stderr, "Aborting\n")
+	return nil, errSilentFailure
+}
+
+// Return the untracked file a checkout of a path would overwrite, a file where one of its directories goes or what is
+// at the path itself, a file of the directory there, and whether there is one
+// The ignored files are expendable, and so are the directories holding only tracked files, removed by the checkout
+func untrackedInTheWay(name string, tracked func(string) bool, m *ignore.Matcher) (string, bool) {
+	components := strings.Split(name, "/")
+	for i := range components {
+		prefix := strings.Join(components[:i+1], "/")
+		info, err := os.Lstat(filepath.Join(repo.WorkTree, prefix))
+		if err != nil {
+			return "", false
+		}
+		leaf := i == len(components)-1
+		if info.IsDir() && !leaf {
+			continue
+		}
+		if !info.IsDir() {
+			if tracked(prefix) || m.Ignored(prefix, false) {
+				return "", false
+			}
+			return prefix, true
+		}
+		blocking := ""
+		filepath.WalkDir(filepath.Join(repo.WorkTree, prefix), func(file string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, _ := filepath.Rel(repo.WorkTree, file)
+			rel = filepath.ToSlash(rel)
+			if !tracked(rel) && !m.Ignored(rel, false) {
+				blocking = rel
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		return blocking, blocking != ""
+	}
+	return "", false
+}
+
+// Apply a checkout plan: remove the files and entries, then write the files and stage their entries
+func applyCheckout(idx *index.Index, plan *checkoutPlan) error {
+	for _, name := range plan.remove {
+		if err := removeWorktreeFile(name); err != nil {
+			return err
+		}
+		idx.Remove(name)
+	}
+	written, err := checkoutEntries(plan.write)
+	if err != nil {
+		return err
+	}
+	for _, e := range written {
+		if err := idx.Add(e, true); err != nil {
+			return err
+		}
+	}
+	warnCheckoutCollisions(idx, written)
+	return nil
+}
+
+// Remove the file of a path from the work tree, then the directories left empty above it
+func removeWorktreeFile(name string) error {
+	file := filepath.Join(repo.WorkTree, name)
+	info, err := os.Lstat(file)
+	switch {
+	case os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR):
+		return nil
+	case err != nil:
+		return err
+	case info.IsDir():
+		// The directory of a submodule only goes when it is empty
+		os.Remove(file)
+	default:
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("unable to unlink '%s': %s", name, errors.Unwrap(err))
+		}
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		// The current directory is kept
+		if strings.HasPrefix(repo.Prefix, dir+"/") || os.Remove(filepath.Join(repo.WorkTree, dir)) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Write the file of an entry to the work tree, replacing whatever is in the way, and return the entry with the stat
+// data of the file written
+func checkoutEntry(e index.Entry) (index.Entry, error) {
+	if err := prepareCheckout(e); err != nil {
+		return index.Entry{}, err
+	}
+	c, err := worktreeConversionFor(e.Path)
+	if err != nil {
+		return index.Entry{}, err
+	}
+	return writeCheckout(e, c)
+}
+
+// Return the error of a file of the work tree that couldn't be written
+func checkoutError(name string, err error) error {
+	if reason := errors.Unwrap(err); reason != nil {
+		err = reason
+	}
+	return fmt.Errorf("unable to create file %s: %s", name, err)
+}
+
+// Make room for the file of an entry: create its directories, replacing the files in the way, and remove what is at
+// its path, but the directory of a gitlink
+func prepareCheckout(e index.Entry) error {
+	file := filepath.Join(repo.WorkTree, e.Path)
+	for dir := path.Dir(e.Path); dir != "."; dir = path.Dir(dir) {
+		if info, err := os.Lstat(filepath.Join(repo.WorkTree, dir)); err == nil && !info.IsDir() {
+			os.Remove(filepath.Join(repo.WorkTree, dir))
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o777); err != nil {
+		return checkoutError(e.Path, err)
+	}
+	info, err := os.Lstat(file)
+	switch {
+	case err != nil:
+		return nil
+	case info.IsDir() && e.Mode != index.ModeGitlink:
+		err = os.RemoveAll(file)
+	case !info.IsDir():
+		err = os.Remove(file)
+	}
+	if err != nil {
+		return checkoutError(e.Path, err)
+	}
+	return nil
+}
+
+// Write the file of an entry to the work tree, its path prepared, and return the entry with the stat data of the file
+// written; the error is fs.ErrExist when a file was written at its path since, for a path that collides with another
+// The blobs are converted as c says, the symlinks are written as files holding their target when core.symlinks is
+// false, and a gitlink only gets an empty directory, its repository isn't checked out
+func writeCheckout(e index.Entry, c worktreeConversion) (index.Entry, error) {
+	file := filepath.Join(repo.WorkTree, e.Path)
+	if e.Mode == index.ModeGitlink {
+		if err := os.MkdirAll(file, 0o777); err != nil {
+			return index.Entry{}, checkoutError(e.Path, err)
+		}
+		e.Stat = index.Stat{}
+		return e, nil
+	}
+	content, err := readBlob(e.Hash)
+	if err != nil {
+		return index.Entry{}, err
+	}
+	if e.Mode == index.ModeSymlink && c.symlinks {
+		err = os.Symlink(string(content), file)
+	} else {
+		perm := os.FileMode(0o666)
+		if e.Mode == index.ModeExecutable {
+			perm = 0o777
+		}
+		if e.Mode != index.ModeSymlink {
+			if content, err = c.apply(e.Path, content); err != nil {
+				return index.Entry{}, err
+			}
+		}
+		err = writeNewFile(file, content, perm)
+	}
+	if errors.Is(err, fs.ErrExist) {
+		return index.Entry{}, fs.ErrExist
+	} else if err != nil {
+		return index.Entry{}, checkoutError(e.Path, err)
+	}
+	info, err := os.Lstat(file)
+	if err != nil {
+		return index.Entry{}, checkoutError(e.Path, err)
+	}
+	e.Stat = index.StatFromFileInfo(info)
+	return e, nil
+}
+
+// Write a file that doesn't exist yet
+func writeNewFile(file string, content []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type restoreOptions struct {
+	// The tree-ish the files come from, the index when ""
+	source string
+	// Restore the entries of the index, and the files of the work tree
+	staged, worktree bool
+	// Keep the paths the source doesn't have, instead of removing them
+	overlay bool
+}
+
+// Restore the paths matching a pathspec from the source, in the index and the work tree as asked, and return how many
+// files were written
+// The pathspecs matching no path of the source nor of the index are errors, and so are the unmerged paths restored
+// from the index
+func restorePaths(ps *pathspec.Pathspec, opts restoreOptions) (int, error) {
+	if repo.Bare() {
+		return 0, fmt.Errorf("this operation must be run in a work tree")
+	}
+	var sources []index.Entry
+	if opts.source != "" {
+		tree, err := resolveTree(opts.source)
+		if err != nil {
+			return 0, fmt.Errorf("could not resolve %s", opts.source)
+		}
+		if sources, err = readTreeEntries(tree); err != nil {
+			return 0, err
+		}
+	}
+	idx, lock, err := lockIndex()
+	if err != nil {
+		return 0, err
+	}
+	seen := make([]bool, len(ps.Items))
+	matched := make([]index.Entry, 0)
+	inSource := make(map[string]bool)
+	for _, e := range sources {
+		if ps.MatchSeen(e.Path, false, seen) {
+			matched = append(matched, e)
+			inSource[e.Path] = true
+		}
+	}
+	stale := make([]string, 0)
+	unmerged := false
+	for _, e := range idx.Entries {
+		if !ps.MatchSeen(e.Path, false, seen) {
+			continue
+		}
+		switch {
+		case opts.source != "" && !inSource[e.Path]:
+			if len(stale) == 0 || stale[len(stale)-1] != e.Path {
+				stale = append(stale, e.Path)
+			}
+		case opts.source != "":
+		case e.Stage > 0:
+			if len(matched) == 0 || matched[len(matched)-1].Path != e.Path {
+				fmt.Fprintf(os.Stderr, "error: path '%s' is unmerged\n", e.Path)
+				unmerged = true
+			}
+			matched = append(matched, e)
+		default:
+			matched = append(matched, e)
+		}
+	}
+	unmatched := false
+	for i, item := range ps.Items {
+		if !seen[i] && item.Magic&pathspec.Exclude == 0 {
+			fmt.Fprintf(os.Stderr, "error: pathspec '%s' did not match any file(s) known to git\n", item.Original)
+			unmatched = true
+		}
+	}
+	if unmatched || unmerged {
+		lock.Rollback()
+		return 0, errSilentFailure
+	}
+
+	toWrite := make([]index.Entry, 0)
+	for _, e := range matched {
+		current := idx.Get(e.Path)
+		unchanged := len(current) == 1 && current[0].Stage == 0 && current[0].Hash == e.Hash && current[0].Mode == e.Mode
+		if unchanged && opts.worktree {
+			change, _, _, err := worktreeChange(idx, current[0])
+			if err != nil {
+				lock.Rollback()
+				return 0, err
+			}
+			unchanged = change == ' '
+		}
+		switch {
+		case unchanged:
+		case opts.worktree:
+			toWrite = append(toWrite, e)
+		case opts.staged:
+			if err := idx.Add(e, true); err != nil {
+				lock.Rollback()
+				return 0, err
+			}
+		}
+	}
+	for _, name := range stale {
+		if opts.overlay {
+			break
+		}
+		if opts.worktree {
+			if err := removeWorktreeFile(name); err != nil {
+				lock.Rollback()
+				return 0, err
+			}
+		}
+		if opts.staged {
+			idx.Remove(name)
+		}
+	}
+	written, err := checkoutEntries(toWrite)
+	if err != nil {
+		lock.Rollback()
+		return 0, err
+	}
+	for _, e := range written {
+		if opts.source != "" && !opts.staged {
+			break
+		}
+		if err := idx.Add(e, true); err != nil {
+			lock.Rollback()
+			return 0, err
+		}
+	}
+	warnCheckoutCollisions(idx, written)
+	return len(written), commitIndex(lock, idx)
+}
+
+/*
+Command: mygit restore [-q] [(-s | --source) <tree-ish>] [-S | --staged] [-W | --worktree] [--overlay] [--] <pathspec>...
+
+Restore the files of the work tree matching the pathspecs from the index, or their entries in the index with
+--staged, or both with --staged --worktree
+The source is the index for the work tree alone and HEAD otherwise, unless --source gives another tree-ish, and the
+paths the source doesn't have are removed, unless --overlay keeps them
+*/
+func restoreCommand(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit restore [-q] [(-s | --source) <tree-ish>] [-S | --staged] [-W | --worktree] [--overlay] [--] <pathspec>...")
+	opts := restoreOptions{}
+	paths := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		switch {
+		case arg == "-s" || arg == "--source":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			i++
+			opts.source = args[i]
+		case strings.HasPrefix(arg, "--source="):
+			opts.source = strings.TrimPrefix(arg, "--source=")
+		case arg == "-S" || arg == "--staged":
+			opts.staged = true
+		case arg == "-W" || arg == "--worktree":
+			opts.worktree = true
+		case arg == "--overlay":
+			opts.overlay = true
+		case arg == "--no-overlay":
+			opts.overlay = false
+		case arg == "-q" || arg == "--quiet":
+		case strings.HasPrefix(arg, "-"):
+			return "", usage
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("you must specify path(s) to restore")
+	}
+	if !opts.staged {
+		opts.worktree = true
+	}
+	if opts.source == "" && opts.staged {
+		opts.source = "HEAD"
+	}
+	ps, err := parsePathspec(paths, repo.Prefix, pathspec.Options{})
+	if err != nil {
+		return "", err
+	}
+	_, err = restorePaths(ps, opts)
+	return "", err
+}
+
+/*
+Command: mygit checkout [-q] [-f] [<branch>]
+Command: mygit checkout [-q] [-f] (-b | -B) <new-branch> [<start-point>]
+Command: mygit checkout [-q] [-f] --detach [<commit>]
+Command: mygit checkout [-q] [<tree-ish>] [--] <pathspec>...
+
+Switch to a branch like switch does, detaching HEAD at a commit that isn't a branch, or check out the paths matching
+the pathspecs from the index, or from a tree-ish into the index and the work tree
+Without "--", the first argument is a tree-ish when it stands for one, and a pathspec otherwise
+*/
+func checkoutCommand(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit checkout [-q] [-f] [(-b | -B) <new-branch>] [--detach] [<branch> | <start-point>] | [<tree-ish>] [--] <pathspec>...")
+	opts := switchOptions{implicitDetach: true}
+	operands := make([]string, 0)
+	paths := make([]string, 0)
+	dashDash := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			dashDash = true
+			break
+		}
+		switch {
+		case arg == "-q" || arg == "--quiet":
+			opts.quiet = true
+		case arg == "-f" || arg == "--force":
+			opts.force = true
+		case arg == "-b" || arg == "-B":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			opts.forceCreate = arg == "-B"
+			i++
+			opts.newBranch = args[i]
+		case arg == "--detach":
+			opts.detach = true
+		case strings.HasPrefix(arg, "-"):
+			return "", usage
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	source := ""
+	switch {
+	case dashDash && len(operands) > 1:
+		return "", fmt.Errorf("only one reference expected, %d given.", len(operands))
+	case dashDash && len(operands) == 1:
+		if _, err := resolveTree(operands[0]); err != nil {
+			return "", fmt.Errorf("invalid reference: %s", operands[0])
+		}
+		source = operands[0]
+	case len(operands) > 0:
+		if _, err := resolveTree(operands[0]); err == nil {
+			source, operands = operands[0], operands[1:]
+		}
+		paths = append(paths, operands...)
+	}
+	if len(paths) > 0 || dashDash {
+		switch {
+		case opts.newBranch != "":
+			return "", fmt.Errorf("Cannot update paths and switch to branch '%s' at the same time.", opts.newBranch)
+		case opts.detach:
+			return "", fmt.Errorf("git checkout: --detach does not take a path argument '%s'", paths[0])
+		case len(paths) == 0:
+			return "", fmt.Errorf("you must specify path(s) to restore")
+		}
+		ps, err := parsePathspec(paths, repo.Prefix, pathspec.Options{})
+		if err != nil {
+			return "", err
+		}
+		written, err := restorePaths(ps, restoreOptions{source: source, staged: source != "", worktree: true, overlay: true})
+		if err != nil || opts.quiet || dashDash {
+			return "", err
+		}
+		from := "the index"
+		if source != "" {
+			tree, _ := resolveTree(source)
+			from = abbreviate(tree)
+		}
+		plural := "s"
+		if written == 1 {
+			plural = ""
+		}
+		fmt.Fprintf(os.Stderr, "Updated %d path%s from %s\n", written, plural, from)
+		return "", nil
+	}
+	if source == "" && opts.newBranch == "" && !opts.detach {
+		// Only the local changes are shown
+		idx, err := readIndex()
+		if err != nil {
+			return "", err
+		}
+		head, err := refStore().Resolve("HEAD")
+		if err != nil {
+			return "", fmt.Errorf("You are on a branch yet to be born")
+		}
+		entries, err := commitEntries(head.Target)
+		if err != nil {
+			return "", err
+		}
+		return localChanges(idx, entries)
+	}
+	name := source
+	if name == "" {
+		name = "HEAD"
+	}
+	target, err := resolveSwitchTarget(name, opts)
+	if err != nil {
+		return "", err
+	}
+	return switchTo(target, opts)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+	ignore "github.com/codecrafters-io/git-starter-go/ignore"
+	pathspec "github.com/codecrafters-io/git-starter-go/pathspec"
+)
+
+type cleanOptions struct {
+	dryRun bool
+	quiet  bool
+	// -f once to remove, twice to remove the nested repositories too
+	force int
+	// Remove the untracked directories
+	directories bool
+	// Remove the ignored files too with -x, only them with -X
+	noIgnore    bool
+	ignoredOnly bool
+	// The patterns given with -e, added to the ignore rules
+	excludes []string
+}
+
+// A path clean removes, or the nested repository it skips
+type cleanTarget struct {
+	path string
+	skip bool
+}
+
+/*
+Command: mygit clean [-n] [-f]... [-q] [-d] [-x | -X] [-e <pattern>]... [--] [<pathspec>...]
+
+Remove the untracked files of the work tree under the current directory, or matching the pathspecs
+The ignored files are kept, unless -x is given, and -X only removes them; the patterns of -e are ignored as well
+The untracked directories are only removed with -d, or when a pathspec names them, and the nested repositories only
+when -f is given twice
+Unless clean.requireForce is false, nothing is removed without -f, -n shows what would be
+*/
+func cleanCommand(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit clean [-n] [-f]... [-q] [-d] [-x | -X] [-e <pattern>]... [--] [<pathspec>...]")
+	opts := cleanOptions{}
+	paths := make([]string, 0)
+	args = splitShortOptions(args, "e")
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		switch {
+		case arg == "-n" || arg == "--dry-run":
+			opts.dryRun = true
+		case arg == "-q" || arg == "--quiet":
+			opts.quiet = true
+		case arg == "-f" || arg == "--force":
+			opts.force++
+		case arg == "-d":
+			opts.directories = true
+		case arg == "-x":
+			opts.noIgnore = true
+		case arg == "-X":
+			opts.ignoredOnly = true
+		case arg == "-e" || arg == "--exclude":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			i++
+			opts.excludes = append(opts.excludes, args[i])
+		case strings.HasPrefix(arg, "--exclude="):
+			opts.excludes = append(opts.excludes, strings.TrimPrefix(arg, "--exclude="))
+		case strings.HasPrefix(arg, "-"):
+			return "", usage
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if opts.noIgnore && opts.ignoredOnly {
+		return "", fmt.Errorf("options '-x' and '-X' cannot be used together")
+	}
+	if opts.force == 0 && !opts.dryRun {
+		value, found := configValue("clean.requireforce")
+		requireForce := true
+		if found {
+			requireForce, _ = config.ParseBool(value)
+		}
+		if requireForce && found {
+			return "", fmt.Errorf("clean.requireForce set to true and neither -i, -n, nor -f given; refusing to clean")
+		}
+		if requireForce {
+			return "", fmt.Errorf("clean.requireForce defaults to true and neither -i, -n, nor -f given; refusing to clean")
+		}
+	}
+	if repo.Bare() {
+		return "", fmt.Errorf("this operation must be run in a work tree")
+	}
+	ps, err := parsePathspec(paths, repo.Prefix, pathspec.Options{PreferCwd: true})
+	if err != nil {
+		return "", err
+	}
+	var m *ignore.Matcher
+	if opts.noIgnore {
+		m = ignore.NewEmpty(ignoreCase())
+	} else if m, err = newIgnoreMatcher(); err != nil {
+		return "", err
+	}
+	for _, pattern := range opts.excludes {
+		m.AddPattern(pattern)
+	}
+	targets, err := cleanTargets(ps, m, opts)
+	if err != nil {
+		return "", err
+	}
+
+	out := new(strings.Builder)
+	failed := false
+	for _, target := range targets {
+		name := quotePath(displayPath(strings.TrimSuffix(target.path, "/")), false)
+		if strings.HasSuffix(target.path, "/") {
+			name += "/"
+		}
+		switch {
+		case target.skip && opts.dryRun:
+			fmt.Fprintf(out, "Would skip repository %s\n", name)
+		case target.skip:
+			if !opts.quiet {
+				fmt.Fprintf(out, "Skipping repository %s\n", name)
+			}
+		case opts.dryRun:
+			fmt.Fprintf(out, "Would remove %s\n", name)
+		default:
+			if err := os.RemoveAll(filepath.Join(repo.WorkTree, target.path)); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to remove %s: %s\n", name, err)
+				failed = true
+				continue
+			}
+			if !opts.quiet {
+				fmt.Fprintf(out, "Removing %s\n", name)
+			}
+		}
+	}
+	if failed {
+		return out.String(), errSilentFailure
+	}
+	return out.String(), nil
+}
+
+// Return the paths clean removes, sorted, the directories ending with a slash
+// A directory is removed as a whole when everything in it would be, the paths to remove in it are listed otherwise
+func cleanTargets(ps *pathspec.Pathspec, m *ignore.Matcher, opts cleanOptions) ([]cleanTarget, error) {
+	idx, err := readIndex()
+	if err != nil {
+		return nil, err
+	}
+	tracked := make(map[string]bool)
+	trackedDirs := make(map[string]bool)
+	for _, e := range idx.Entries {
+		tracked[e.Path] = true
+		for dir := path.Dir(e.Path); dir != "."; dir = path.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+	// -X only removes the ignored paths, the other modes only the paths that aren't
+	removable := func(isIgnored bool) bool {
+		return isIgnored == opts.ignoredOnly
+	}
+	// Whether a pathspec names the directory, which is then removed even without -d
+	named := func(dir string) bool {
+		for _, item := range ps.Items {
+			if item.Magic&pathspec.Exclude == 0 && strings.TrimSuffix(item.Match, "/") == dir {
+				return true
+			}
+		}
+		return false
+	}
+	// Return the paths to remove in a directory, and whether all of its content is removed
+	var walk func(dir string, excluded, directories bool) ([]cleanTarget, bool, error)
+	walk = func(dir string, excluded, directories bool) ([]cleanTarget, bool, error) {
+		entries, err := os.ReadDir(filepath.Join(repo.WorkTree, dir))
+		if err != nil {
+			return nil, false, err
+		}
+		targets := make([]cleanTarget, 0)
+		whole := true
+		for _, e := range entries {
+			name := path.Join(dir, e.Name())
+			if e.Name() == ".git" || !e.IsDir() && !e.Type().IsRegular() && e.Type()&os.ModeSymlink == 0 {
+				whole = false
+				continue
+			}
+			nested := e.IsDir() && isNestedRepository(filepath.Join(repo.WorkTree, name))
+			if (!e.IsDir() || nested) && tracked[name] {
+				whole = false
+				continue
+			}
+			isIgnored := excluded
+			if !isIgnored {
+				p := m.MatchName(name, e.IsDir())
+				isIgnored = p != nil && !p.Negated
+			}
+			switch {
+			case nested:
+				if !ps.Match(name, true) || !removable(isIgnored) || !directories && !named(name) {
+					whole = false
+				} else if opts.force < 2 {
+					targets = append(targets, cleanTarget{path: name, skip: true})
+					whole = false
+				} else {
+					targets = append(targets, cleanTarget{path: name + "/"})
+				}
+			case !e.IsDir():
+				if ps.Match(name, false) && removable(isIgnored) {
+					targets = append(targets, cleanTarget{path: name})
+				} else {
+					whole = false
+				}
+			case trackedDirs[name]:
+				sub, _, err := walk(name, isIgnored, directories)
+				if err != nil {
+					return nil, false, err
+				}
+				targets = append(targets, sub...)
+				whole = false
+			case isIgnored && !opts.ignoredOnly:
+				// The ignored directories are kept whole
+				whole = false
+			case ps.Match(name, true):
+				// Without -d, -X still walks an untracked directory, reading its .gitignore files, and removes the
+				// ignored files in it, but keeps the directories holding only ignored paths
+				removeDir := directories || named(name)
+				if !removeDir && !opts.ignoredOnly {
+					whole = false
+					continue
+				}
+				sub, subWhole, err := walk(name, isIgnored, removeDir)
+				if err != nil {
+					return nil, false, err
+				}
+				switch {
+				case !removeDir && subWhole:
+					whole = false
+				// -X doesn't remove the directories holding no ignored path
+				case subWhole && (len(sub) > 0 || isIgnored || !opts.ignoredOnly):
+					targets = append(targets, cleanTarget{path: name + "/"})
+				default:
+					targets = append(targets, sub...)
+					whole = false
+				}
+			case ps.MayMatchUnder(name):
+				sub, _, err := walk(name, isIgnored, directories)
+				if err != nil {
+					return nil, false, err
+				}
+				targets = append(targets, sub...)
+				whole = false
+			default:
+				whole = false
+			}
+		}
+		return targets, whole, nil
+	}
+	root := ps.CommonPrefix()
+	if info, err := os.Stat(filepath.Join(repo.WorkTree, root)); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+	excluded := root != "" && m.Ignored(root, true)
+	if excluded && !opts.ignoredOnly {
+		return nil, nil
+	}
+	targets, _, err := walk(root, excluded, opts.directories)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].path < targets[j].path })
+	return targets, nil
+}
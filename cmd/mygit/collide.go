@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+	index "github.com/codecrafters-io/git-starter-go/index"
+	unorm "github.com/codecrafters-io/git-starter-go/unorm"
+)
+
+// Whether the work tree doesn't tell apart the file names written in NFC and in NFD, core.precomposeUnicode
+func precomposeUnicode() bool {
+	value, found := configValue("core.precomposeunicode")
+	if !found {
+		return false
+	}
+	b, err := config.ParseBool(value)
+	return err == nil && b
+}
+
+// Return the key the paths naming the same file of the work tree share: the path folded to a case with
+// core.ignoreCase and decomposed to NFD with core.precomposeUnicode; nil when the work tree tells every path apart
+func pathFolder() func(string) string {
+	ignoreCase, precompose := ignoreCase(), precomposeUnicode()
+	if !ignoreCase && !precompose {
+		return nil
+	}
+	return func(name string) string {
+		if precompose {
+			name = unorm.NFD(name)
+		}
+		if ignoreCase {
+			name = strings.Map(foldRune, name)
+		}
+		return name
+	}
+}
+
+// Return the character all the characters equal to a character when the case is ignored fold to: the least of them
+func foldRune(r rune) rune {
+	folded := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		folded = min(folded, f)
+	}
+	return folded
+}
+
+// Return the groups of paths naming the same file of the work tree as fold tells, each sorted, sorted by their first
+// path, only those holding one of the paths of among
+func collidingPaths(paths []string, among []string, fold func(string) string) [][]string {
+	if fold == nil {
+		return nil
+	}
+	groups := make(map[string][]string)
+	for _, name := range paths {
+		key := fold(name)
+		if group := groups[key]; len(group) == 0 || group[len(group)-1] != name {
+			groups[key] = append(group, name)
+		}
+	}
+	colliding := make([][]string, 0)
+	for _, name := range among {
+		key := fold(name)
+		if group := groups[key]; len(group) > 1 {
+			sort.Strings(group)
+			colliding = append(colliding, group)
+			delete(groups, key)
+		}
+	}
+	sort.Slice(colliding, func(i, j int) bool { return colliding[i][0] < colliding[j][0] })
+	return colliding
+}
+
+// Warn about the groups of paths clobbering each other, only one of each group being kept in the working tree, or
+// the index
+func warnCollisions(groups [][]string, where string) {
+	if len(groups) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: the following paths have collided (e.g. case-sensitive paths\n"+
+		"on a case-insensitive filesystem) and only one from the same\ncolliding group is in the %s:\n", where)
+	for _, group := range groups {
+		for _, name := range group {
+			fmt.Fprintf(os.Stderr, "  '%s'\n", name)
+		}
+	}
+}
+
+// Warn about the files written by a checkout that clobbered each other, or the file of a tracked path, the work tree
+// not telling their paths apart
+func warnCheckoutCollisions(idx *index.Index, written []index.Entry) {
+	fold := pathFolder()
+	if fold == nil || len(written) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(idx.Entries)+len(written))
+	among := make([]string, 0, len(written))
+	for _, e := range written {
+		among = append(among, e.Path)
+		if idx.Get(e.Path) == nil {
+			paths = append(paths, e.Path)
+		}
+	}
+	for _, e := range idx.Entries {
+		if len(paths) == 0 || paths[len(paths)-1] != e.Path {
+			paths = append(paths, e.Path)
+		}
+	}
+	warnCollisions(collidingPaths(paths, among, fold), "working tree")
+}
+
+// Return the groups of files of the work tree staged as the same path, the work tree not telling their paths apart,
+// each sorted, sorted by their first path; the paths of the same file don't collide
+// stagedAs gives the path each file of files was staged as, or would have been when it was left out
+func stagedCollisions(stagedAs map[string]string, files map[string]os.FileInfo) [][]string {
+	groups := make(map[string][]string)
+	for name, staged := range stagedAs {
+		if name != staged {
+			groups[staged] = append(groups[staged], name)
+		}
+	}
+	colliding := make([][]string, 0)
+	for staged, group := range groups {
+		if workTreeFile(staged, files) != nil {
+			group = append(group, staged)
+		}
+		sort.Strings(group)
+		for _, name := range group[1:] {
+			if !sameFile(group[0], name, files) {
+				colliding = append(colliding, group)
+				break
+			}
+		}
+	}
+	sort.Slice(colliding, func(i, j int) bool { return colliding[i][0] < colliding[j][0] })
+	return colliding
+}
+
+// Return whether two paths of the work tree name the same file, as they do when the work tree doesn't tell them apart
+// files holds the files already looked up
+func sameFile(name, other string, files map[string]os.FileInfo) bool {
+	info, otherInfo := workTreeFile(name, files), workTreeFile(other, files)
+	return info != nil && otherInfo != nil && os.SameFile(info, otherInfo)
+}
+
+// Return the file of the work tree at a path, from files when it was already looked up, nil when there is none
+func workTreeFile(name string, files map[string]os.FileInfo) os.FileInfo {
+	if info, found := files[name]; found {
+		return info
+	}
+	info, err := os.Lstat(filepath.Join(repo.WorkTree, name))
+	if err != nil {
+		return nil
+	}
+	return info
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+)
+
+// Returned when the key asked to config isn't set, it exits with 1 and no message like git
+var errConfigKeyNotFound = errors.New("config key not found")
+
+// The "<key>[=<value>]" given with the -c global option
+var commandLineConfig []string
+
+var loadedConfig *config.Config
+
+// Return the configuration of every scope, read once per run
+func loadConfig() (*config.Config, error) {
+	if loadedConfig != nil {
+		return loadedConfig, nil
+	}
+	gitDir := ""
+	if repo != nil {
+		gitDir = repo.GitDir
+	}
+	cfg, err := config.Load(config.Options{GitDir: gitDir, CommandLine: commandLineConfig})
+	if err != nil {
+		return nil, err
+	}
+	loadedConfig = cfg
+	return cfg, nil
+}
+
+// Return the value of a config key, for the callers that ignore config errors
+func configValue(key string) (string, bool) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", false
+	}
+	return cfg.Get(key)
+}
+
+/*
+Command: mygit config [<scope>] [<type>] [--show-origin] <action>
+
+	<scope>: --system | --global | --local | --worktree | --file <path>
+	<type>: --type=(bool|int|bool-or-int|path) | --bool | --int | --path
+	<action>: --get <key> | --get-all <key> | --list | [--set] <key> <value> | --add <key> <value>
+	          | --replace-all <key> <value> | --unset <key> | --unset-all <key> | <key>
+*/
+func configCommand(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit config [--system | --global | --local | --worktree | --file <path>] [--type=<type>] [--show-origin] (--get | --get-all | --list | --set | --add | --replace-all | --unset | --unset-all) [<key> [<value>]]")
+	scope := config.Scope(-1)
+	file := ""
+	valueType := ""
+	showOrigin := false
+	action := ""
+	operands := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--system":
+			scope = config.ScopeSystem
+		case arg == "--global":
+			scope = config.ScopeGlobal
+		case arg == "--local":
+			scope = config.ScopeLocal
+		case arg == "--worktree":
+			scope = config.ScopeWorktree
+		case arg == "--file" || arg == "-f":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			i++
+			file = args[i]
+		case strings.HasPrefix(arg, "--file="):
+			file = strings.TrimPrefix(arg, "--file=")
+		case strings.HasPrefix(arg, "--type="):
+			valueType = strings.TrimPrefix(arg, "--type=")
+		case arg == "--bool" || arg == "--int" || arg == "--bool-or-int" || arg == "--path":
+			valueType = strings.TrimPrefix(arg, "--")
+		case arg == "--show-origin":
+			showOrigin = true
+		case arg == "--get" || arg == "--get-all" || arg == "--list" || arg == "-l" || arg == "--set" || arg == "--add" ||
+			arg == "--replace-all" || arg == "--unset" || arg == "--unset-all":
+			if action != "" {
+				return "", fmt.Errorf("only one action at a time")
+			}
+			action = strings.TrimLeft(arg, "-")
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return "", usage
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	switch valueType {
+	case "", "bool", "int", "bool-or-int", "path":
+	default:
+		return "", fmt.Errorf("unrecognized --type argument, %s", valueType)
+	}
+	if action == "" {
+		// "config <key>" reads, "config <key> <value>" writes
+		switch len(operands) {
+		case 1:
+			action = "get"
+		case 2:
+			action = "set"
+		default:
+			return "", usage
+		}
+	}
+	if action == "l" {
+		action = "list"
+	}
+	if (scope == config.ScopeLocal || scope == config.ScopeWorktree) && repo == nil {
+		return "", fmt.Errorf("--%s can only be used inside a git repository", scope)
+	}
+	if scope >= 0 && file == "" {
+		gitDir := ""
+		if repo != nil {
+			gitDir = repo.GitDir
+		}
+		path, err := config.ScopeWritePath(scope, gitDir)
+		if err != nil {
+			return "", err
+		}
+		file = path
+	}
+
+	switch action {
+	case "get", "get-all", "list":
+		var cfg *config.Config
+		var err error
+		if file != "" {
+			if scope < 0 {
+				scope = config.ScopeCommand
+			}
+			cfg, err = config.LoadFile(file, scope)
+		} else {
+			cfg, err = loadConfig()
+		}
+		if err != nil {
+			return "", err
+		}
+		var entries []config.Entry
+		switch action {
+		case "list":
+			if len(operands) != 0 {
+				return "", usage
+			}
+			entries = cfg.Entries()
+		case "get":
+			if len(operands) != 1 {
+				return "", usage
+			}
+			if _, err := config.CanonicalKey(operands[0]); err != nil {
+				return "", err
+			}
+			entry, found := cfg.Lookup(operands[0])
+			if !found {
+				return "", errConfigKeyNotFound
+			}
+			entries = []config.Entry{entry}
+		case "get-all":
+			if len(operands) != 1 {
+				return "", usage
+			}
+			if _, err := config.CanonicalKey(operands[0]); err != nil {
+				return "", err
+			}
+			entries = cfg.GetAll(operands[0])
+			if len(entries) == 0 {
+				return "", errConfigKeyNotFound
+			}
+		}
+		out := new(strings.Builder)
+		for _, e := range entries {
+			if showOrigin {
+				out.WriteString(e.Origin + "\t")
+			}
+			value, err := formatConfigValue(e, valueType)
+			if err != nil {
+				return "", err
+			}
+			switch {
+			case action != "list":
+				out.WriteString(value + "\n")
+			case e.NoValue && valueType == "":
+				out.WriteString(e.Key + "\n")
+			default:
+				out.WriteString(e.Key + "=" + value + "\n")
+			}
+		}
+		return out.String(), nil
+	}
+
+	if file == "" {
+		if repo == nil {
+			return "", fmt.Errorf("not in a git directory")
+		}
+		file = repo.Path("config")
+	}
+	f, err := config.OpenFile(file)
+	if err != nil {
+		return "", err
+	}
+	switch action {
+	case "set", "add", "replace-all":
+		if len(operands) != 2 {
+			return "", usage
+		}
+		value, err := normalizeConfigValue(operands[1], valueType)
+		if err != nil {
+			return "", err
+		}
+		switch action {
+		case "set":
+			err = f.Set(operands[0], value)
+		case "add":
+			err = f.Add(operands[0], value)
+		case "replace-all":
+			err = f.ReplaceAll(operands[0], value)
+		}
+		if err != nil {
+			return "", err
+		}
+	case "unset", "unset-all":
+		if len(operands) != 1 {
+			return "", usage
+		}
+		n, err := f.Unset(operands[0], action == "unset-all")
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			return "", errConfigKeyNotFound
+		}
+	}
+	return "", f.Write()
+}
+
+// Return the value of an entry as the type asks
+func formatConfigValue(e config.Entry, valueType string) (string, error) {
+	switch valueType {
+	case "bool":
+		if e.NoValue {
+			return "true", nil
+		}
+		b, err := config.ParseBool(e.Value)
+		if err != nil {
+			return "", fmt.Errorf("bad boolean config value '%s' for '%s'", e.Value, e.Key)
+		}
+		return strconv.FormatBool(b), nil
+	case "int":
+		i, err := config.ParseInt(e.Value)
+		if err != nil {
+			return "", fmt.Errorf("bad numeric config value '%s' for '%s'", e.Value, e.Key)
+		}
+		return strconv.FormatInt(i, 10), nil
+	case "bool-or-int":
+		if i, err := config.ParseInt(e.Value); err == nil && !e.NoValue {
+			return strconv.FormatInt(i, 10), nil
+		}
+		return formatConfigValue(e, "bool")
+	case "path":
+		return config.ExpandPath(e.Value), nil
+	}
+	return e.Value, nil
+}
+
+// Return the value to write once checked against the type
+func normalizeConfigValue(value, valueType string) (string, error) {
+	switch valueType {
+	case "bool", "int", "bool-or-int":
+		return formatConfigValue(config.Entry{Key: "value", Value: value}, valueType)
+	}
+	return value, nil
+}
+
+// Edit the config file of the repository, the configuration is read again afterwards
+func editRepositoryConfig(edit func(f *config.File) error) error {
+	f, err := config.OpenFile(repo.Path("config"))
+	if err != nil {
+		return err
+	}
+	if err := edit(f); err != nil {
+		return err
+	}
+	loadedConfig = nil
+	return f.Write()
+}
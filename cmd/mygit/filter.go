@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+	filter "github.com/codecrafters-io/git-starter-go/filter"
+)
+
+// A filter driver, the commands of filter.<name> for the files whose filter attribute is name
+type filterDriver struct {
+	name    string
+	clean   string
+	smudge  string
+	process string
+	// The files can't be added nor checked out without filtering them
+	required bool
+}
+
+// Return the filter driver the filter attribute of a file names, nil when it has none or no driver of its name is
+// configured
+func lookupFilterDriver(attrs map[string]string) *filterDriver {
+	name, found := attrs["filter"]
+	if !found || name == "set" || name == "unset" {
+		return nil
+	}
+	d := &filterDriver{name: name}
+	configured := false
+	for key, value := range map[string]*string{"clean": &d.clean, "smudge": &d.smudge, "process": &d.process} {
+		if v, found := configValue("filter." + name + "." + key); found {
+			*value, configured = v, true
+		}
+	}
+	if value, found := configValue("filter." + name + ".required"); found {
+		d.required, _ = config.ParseBool(value)
+		configured = true
+	}
+	if !configured {
+		return nil
+	}
+	return d
+}
+
+// The long-running filters started, by command, stopped when the command ends
+var filterProcesses = make(map[string]*filter.Process)
+
+// Return the running filter process of a command, started on first use
+func filterProcess(command string) (*filter.Process, error) {
+	if p, found := filterProcesses[command]; found {
+		return p, nil
+	}
+	dir := repo.WorkTree
+	if dir == "" {
+		dir = repo.GitDir
+	}
+	p, err := filter.Start(command, dir)
+	if err != nil {
+		return nil, err
+	}
+	filterProcesses[command] = p
+	return p, nil
+}
+
+// Stop the long-running filters, waiting for them to end
+func stopFilterProcesses() {
+	for command, p := range filterProcesses {
+		p.Stop()
+		delete(filterProcesses, command)
+	}
+}
+
+// Run the clean or smudge capability of the filter driver of a file on its content
+// A filter that fails, or that the driver lacks, leaves the content as it is, unless the driver is required
+func applyFilter(name string, content []byte, d *filterDriver, capability string) ([]byte, error) {
+	if d == nil {
+		return content, nil
+	}
+	command := d.clean
+	if capability == filter.Smudge {
+		command = d.smudge
+	}
+	var filtered []byte
+	var err error
+	switch {
+	case d.process == "" && command != "":
+		filtered, err = runFilterCommand(name, content, command)
+	case d.process != "":
+		filtered, err = runFilterProcess(name, content, d.process, capability)
+	default:
+		err = errFilterNotRun
+	}
+	if err == nil {
+		return filtered, nil
+	}
+	switch {
+	case !d.required:
+		return content, nil
+	case capability == filter.Smudge:
+		return nil, fmt.Errorf("%s: smudge filter %s failed", name, d.name)
+	default:
+		return nil, fmt.Errorf("%s: clean filter '%s' failed", name, d.name)
+	}
+}
+
+// The error of a filter that didn't run on a file, its failure already reported
+var errFilterNotRun = errors.New("filter not run")
+
+// Run the command of a filter on a file, from the top of the work tree
+func runFilterCommand(name string, content []byte, command string) ([]byte, error) {
+	dir := repo.WorkTree
+	if dir == "" {
+		dir = repo.GitDir
+	}
+	filtered, err := filter.Run(command, name, dir, content)
+	var startErr *filter.StartError
+	var exitErr *filter.ExitError
+	switch {
+	case err == nil:
+		return filtered, nil
+	case errors.As(err, &startErr):
+		fmt.Fprintf(os.Stderr, "error: %s\nerror: cannot fork to run external filter '%s'\n", err, command)
+	case errors.As(err, &exitErr):
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	default:
+		fmt.Fprintf(os.Stderr, "error: read from external filter '%s' failed\n", command)
+	}
+	fmt.Fprintf(os.Stderr, "error: external filter '%s' failed\n", command)
+	return nil, errFilterNotRun
+}
+
+// Give a file to a long-running filter, started when first needed
+// A process that doesn't have the capability leaves the file as it is, and one that fails the protocol is stopped
+func runFilterProcess(name string, content []byte, command, capability string) ([]byte, error) {
+	p, err := filterProcess(command)
+	var startErr *filter.StartError
+	switch {
+	case errors.As(err, &startErr):
+		fmt.Fprintf(os.Stderr, "error: %s\nerror: cannot fork to run subprocess '%s'\n", err, command)
+		return nil, errFilterNotRun
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "error: %s\nerror: initialization for subprocess '%s' failed\n", err, command)
+		return nil, errFilterNotRun
+	}
+	if !p.Supports(capability) {
+		return nil, errFilterNotRun
+	}
+	filtered, err := p.Filter(capability, name, content)
+	var statusErr *filter.StatusError
+	switch {
+	case err == nil:
+		return filtered, nil
+	case errors.As(err, &statusErr):
+		// The filter refused the file, and reported why itself
+	default:
+		fmt.Fprintf(os.Stderr, "error: external filter '%s' failed\n", command)
+		p.Stop()
+		delete(filterProcesses, command)
+	}
+	return nil, errFilterNotRun
+}
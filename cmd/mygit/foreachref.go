@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+Command: mygit for-each-ref [--count=<count>] [--shell | --perl | --python | --tcl] [--sort=<key>]... [--format=<format>]
+
+	[--merged [<commit>]] [--no-merged [<commit>]] [--contains [<commit>]] [--no-contains [<commit>]]
+	[--points-at <object>] [<pattern>...]
+
+List the refs matching the patterns, a glob or a prefix like refs/heads, that the filter keeps
+Each ref is shown by the format, "%(objectname) %(objecttype)\t%(refname)" by default, see refFormatter for its atoms
+The refs are sorted by name, or by the keys of --sort, and --count keeps the first ones
+*/
+func forEachRef(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit for-each-ref [--count=<count>] [--shell | --perl | --python | --tcl] [--sort=<key>]... [--format=<format>] [--merged <commit>] [--contains <commit>] [--points-at <object>] [<pattern>...]")
+	format := defaultRefFormat
+	count := -1
+	sortKeys := make([]string, 0)
+	patterns := make([]string, 0)
+	var quote func(string) string
+	var filter refFilter
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			patterns = append(patterns, args[i+1:]...)
+			break
+		}
+		if ok, err := filter.parseOption(args, &i); ok {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch name {
+		case "--count", "--sort", "--format":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return "", usage
+				}
+				i++
+				value = args[i]
+			}
+		}
+		switch {
+		case name == "--count":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return "", fmt.Errorf("invalid --count argument: `%s'", value)
+			}
+			count = n
+		case name == "--sort":
+			sortKeys = append(sortKeys, value)
+		case name == "--format":
+			format = value
+		case refFormatQuotes[arg] != nil:
+			if quote != nil {
+				return "", fmt.Errorf("more than one quoting style?")
+			}
+			quote = refFormatQuotes[arg]
+		case strings.HasPrefix(arg, "-"):
+			return "", usage
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+	items, err := listRefItems("refs/")
+	if err != nil {
+		return "", err
+	}
+	kept := make([]*refItem, 0, len(items))
+	for _, item := range items {
+		if matchesRefPattern(item.name, patterns) && filter.keep(item.hash) {
+			kept = append(kept, item)
+		}
+	}
+	if len(sortKeys) == 0 {
+		sortKeys = append(sortKeys, "refname")
+	}
+	lines, err := formatRefItems(kept, format, sortKeys, quote)
+	if err != nil {
+		return "", err
+	}
+	if count >= 0 && count < len(lines) {
+		lines = lines[:count]
+	}
+	out := new(strings.Builder)
+	for _, line := range lines {
+		out.WriteString(line + "\n")
+	}
+	return out.String(), nil
+}
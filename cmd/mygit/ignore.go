@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+	ignore "github.com/codecrafters-io/git-starter-go/ignore"
+	index "github.com/codecrafters-io/git-starter-go/index"
+	pathspec "github.com/codecrafters-io/git-starter-go/pathspec"
+)
+
+// Return the ignore rules of the repository: the .gitignore files of the work tree, info/exclude and
+// core.excludesFile, $XDG_CONFIG_HOME/git/ignore by default
+func newIgnoreMatcher() (*ignore.Matcher, error) {
+	m := ignore.New(repo.WorkTree, ignoreCase())
+	excludesFile, found := "", false
+	if cfg, err := loadConfig(); err == nil {
+		excludesFile, found = cfg.Path("core.excludesfile")
+	}
+	if !found {
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if home, err := os.UserHomeDir(); xdg == "" && err == nil {
+			xdg = filepath.Join(home, ".config")
+		}
+		if xdg != "" {
+			excludesFile = filepath.Join(xdg, "git", "ignore")
+		}
+	}
+	if excludesFile != "" {
+		if err := m.AddFile(excludesFile, excludesFile); err != nil {
+			return nil, err
+		}
+	}
+	exclude := repo.Path("info", "exclude")
+	source := exclude
+	if rel, err := filepath.Rel(repo.WorkTree, exclude); err == nil && !strings.HasPrefix(rel, "..") {
+		source = filepath.ToSlash(rel)
+	}
+	if err := m.AddFile(exclude, source); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Whether the file names of the work tree are case-insensitive, core.ignoreCase
+func ignoreCase() bool {
+	value, found := configValue("core.ignorecase")
+	if !found {
+		return false
+	}
+	b, err := config.ParseBool(value)
+	return err == nil && b
+}
+
+type checkIgnoreOptions struct {
+	quiet       bool
+	verbose     bool
+	nonMatching bool
+	nul         bool
+	// Check the tracked paths as well
+	noIndex bool
+}
+
+/*
+Command: mygit check-ignore [-q] [-v [-n]] [--no-index] (<path>... | --stdin [-z])
+
+Show the paths ignored by the .gitignore files, info/exclude or core.excludesFile, the tracked paths excepted
+With -v, each path is preceded by the rule matching it: "<source>:<line>:<pattern>\t<path>", negated patterns
+included, and with -n the paths no rule matches are shown too, as "::\t<path>"
+It fails when no path is ignored
+*/
+func checkIgnore(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit check-ignore [-q] [-v [-n]] [--no-index] (<path>... | --stdin [-z])")
+	opts := checkIgnoreOptions{}
+	stdin := false
+	paths := make([]string, 0)
+	for i, arg := range args {
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		switch {
+		case arg == "-q" || arg == "--quiet":
+			opts.quiet = true
+		case arg == "-v" || arg == "--verbose":
+			opts.verbose = true
+		case arg == "-n" || arg == "--non-matching":
+			opts.nonMatching = true
+		case arg == "-z":
+			opts.nul = true
+		case arg == "--stdin":
+			stdin = true
+		case arg == "--no-index":
+			opts.noIndex = true
+		case strings.HasPrefix(arg, "-"):
+			return "", usage
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	switch {
+	case opts.nul && !stdin:
+		return "", fmt.Errorf("-z only makes sense with --stdin")
+	case stdin && len(paths) > 0:
+		return "", fmt.Errorf("cannot specify pathnames with --stdin")
+	case !stdin && len(paths) == 0:
+		return "", fmt.Errorf("no path specified")
+	case opts.quiet && opts.verbose:
+		return "", fmt.Errorf("cannot have both --quiet and --verbose")
+	case opts.quiet && len(paths) != 1:
+		return "", fmt.Errorf("--quiet is only valid with a single pathname")
+	case opts.nonMatching && !opts.verbose:
+		return "", fmt.Errorf("--non-matching is only valid with --verbose")
+	}
+	if stdin {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		separator := "\n"
+		if opts.nul {
+			separator = "\x00"
+		}
+		for _, line := range strings.Split(string(content), separator) {
+			if line != "" {
+				paths = append(paths, line)
+			}
+		}
+	}
+	m, err := newIgnoreMatcher()
+	if err != nil {
+		return "", err
+	}
+	idx := index.New(newObjectHash().Size())
+	if !opts.noIndex {
+		if idx, err = readIndex(); err != nil {
+			return "", err
+		}
+	}
+	out := new(strings.Builder)
+	ignored := false
+	for _, name := range paths {
+		matched, err := checkIgnorePath(out, m, idx, name, opts)
+		if err != nil {
+			return "", err
+		}
+		ignored = ignored || matched
+	}
+	if !ignored {
+		return out.String(), errSilentFailure
+	}
+	return out.String(), nil
+}
+
+// Write the result of check-ignore for a path given relative to the current directory, return whether a rule
+// matched it
+func checkIgnorePath(out *strings.Builder, m *ignore.Matcher, idx *index.Index, name string, opts checkIgnoreOptions) (bool, error) {
+	ps, err := parsePathspec([]string{name}, repo.Prefix, pathspec.Options{
+		Forbidden: pathspec.Glob | pathspec.Icase | pathspec.Exclude | pathspec.Attr,
+	})
+	if err != nil {
+		return false, err
+	}
+	item := ps.Items[0].AsLiteral()
+	full := strings.TrimSuffix(item.Match, "/")
+	var p *ignore.Pattern
+	tracked := false
+	for _, e := range idx.Entries {
+		if e.Path == full || strings.HasPrefix(e.Path, full+"/") {
+			tracked = true
+			break
+		}
+	}
+	if !tracked && full != "" {
+		isDir := strings.HasSuffix(item.Match, "/")
+		if info, err := os.Lstat(filepath.Join(repo.WorkTree, full)); err == nil && info.IsDir() {
+			isDir = true
+		}
+		p = m.Match(full, isDir)
+		if p != nil && p.Negated && !opts.verbose {
+			p = nil
+		}
+	}
+	if opts.quiet || p == nil && !opts.nonMatching {
+		return p != nil, nil
+	}
+	display, terminator := name, "\x00"
+	if !opts.nul {
+		display, terminator = quotePath(name, false), "\n"
+	}
+	switch {
+	case !opts.verbose:
+		out.WriteString(display + terminator)
+	case opts.nul && p == nil:
+		out.WriteString("\x00\x00\x00" + display + "\x00")
+	case opts.nul:
+		fmt.Fprintf(out, "%s\x00%d\x00%s\x00%s\x00", p.Source, p.Line, p.Text, display)
+	case p == nil:
+		out.WriteString("::\t" + display + "\n")
+	default:
+		fmt.Fprintf(out, "%s:%d:%s\t%s\n", p.Source, p.Line, p.Text, display)
+	}
+	return p != nil, nil
+}
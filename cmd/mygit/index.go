@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+	index "github.com/codecrafters-io/git-starter-go/index"
+	pathspec "github.com/codecrafters-io/git-starter-go/pathspec"
+)
+
+// The commands reading and writing the index
+var indexCommands = map[string]func(args []string) (string, error){
+	"add":          addCommand,
+	"check-attr":   checkAttr,
+	"check-ignore": checkIgnore,
+	"checkout":     checkoutCommand,
+	"clean":        cleanCommand,
+	"ls-files":     lsFiles,
+	"restore":      restoreCommand,
+	"status":       statusCommand,
+	"switch":       switchCommand,
+	"update-index": updateIndex,
+}
+
+// Return the path of the index file: GIT_INDEX_FILE, or the index of the git directory
+func indexPath() string {
+	if file := os.Getenv("GIT_INDEX_FILE"); file != "" {
+		return file
+	}
+	return repo.Path("index")
+}
+
+// Read the index, empty when the file doesn't exist yet
+func readIndex() (*index.Index, error) {
+	return index.Read(indexPath(), newObjectHash().Size())
+}
+
+// Lock the index and read it, the changes are written by committing the lock
+func lockIndex() (*index.Index, *index.Lockfile, error) {
+	return index.LockAndRead(indexPath(), newObjectHash().Size())
+}
+
+// Write the index and release its lock
+// The entries racily clean, whose file was modified in the same timestamp as the index was read, have their size
+// cleared when their content changed without their stat data changing, to be seen as modified from then on
+func commitIndex(lock *index.Lockfile, idx *index.Index) error {
+	for i := range idx.Entries {
+		e := &idx.Entries[i]
+		if e.Stage != 0 || e.IntentToAdd || !idx.IsRacy(*e) {
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(repo.WorkTree, e.Path))
+		if err != nil || index.StatFromFileInfo(info) != e.Stat {
+			continue
+		}
+		if current, err := hashFile(e.Path, info); err == nil && current.Hash != e.Hash {
+			e.Size = 0
+		}
+	}
+	return lock.Commit(idx)
+}
+
+// Return the path from the top of the work tree of a path given relative to the current directory,
+// an error when it is outside of the work tree
+func repoPath(name string) (string, error) {
+	full := path.Clean(repo.Prefix + filepath.ToSlash(name))
+	if full == ".." || strings.HasPrefix(full, "../") || path.IsAbs(full) {
+		return "", fmt.Errorf("%s: '%s' is outside repository at '%s'", name, name, repo.WorkTree)
+	}
+	if full == "." {
+		return "", nil
+	}
+	return full, nil
+}
+
+// Return a path from the top of the work tree relative to the current directory
+func displayPath(name string) string {
+	if repo.Prefix == "" {
+		return name
+	}
+	rel, err := filepath.Rel(repo.Prefix, name)
+	if err != nil {
+		return name
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Quote a path the way git shows the unusual ones: between double quotes, with C escapes for the control characters,
+// and octal escapes for the bytes past ASCII unless core.quotePath is false
+// With quoteSpace, a path holding a space is quoted too, as in the formats separating two paths with a space
+func quotePath(name string, quoteSpace bool) string {
+	quoteHigh := true
+	if value, found := configValue("core.quotepath"); found {
+		if b, err := config.ParseBool(value); err == nil {
+			quoteHigh = b
+		}
+	}
+	escapes := map[byte]string{'\a': `\a`, '\b': `\b`, '\t': `\t`, '\n': `\n`, '\v': `\v`, '\f': `\f`, '\r': `\r`, '"': `\"`, '\\': `\\`}
+	out := new(strings.Builder)
+	quoted := false
+	for _, c := range []byte(name) {
+		if escape, found := escapes[c]; found {
+			out.WriteString(escape)
+			quoted = true
+			continue
+		}
+		if c < 0x20 || c == 0x7f || c >= 0x80 && quoteHigh {
+			fmt.Fprintf(out, "\\%03o", c)
+			quoted = true
+			continue
+		}
+		out.WriteByte(c)
+		quoted = quoted || c == ' ' && quoteSpace
+	}
+	if !quoted {
+		return name
+	}
+	return `"` + out.String() + `"`
+}
+
+// Parse the pathspecs given to a command from the directory prefix, usually the current one, with the options of the command and the global
+// settings of the GIT_LITERAL_PATHSPECS, GIT_GLOB_PATHSPECS, GIT_NOGLOB_PATHSPECS and GIT_ICASE_PATHSPECS
+// environment variables
+func parsePathspec(args []string, prefix string, opts pathspec.Options) (*pathspec.Pathspec, error) {
+	envBool := func(name string) bool {
+		b, err := config.ParseBool(os.Getenv(name))
+		return err == nil && b
+	}
+	opts.Literal = envBool("GIT_LITERAL_PATHSPECS")
+	opts.Glob = envBool("GIT_GLOB_PATHSPECS")
+	opts.NoGlob = envBool("GIT_NOGLOB_PATHSPECS")
+	opts.Icase = envBool("GIT_ICASE_PATHSPECS")
+	opts.WorkTree = repo.WorkTree
+	opts.Attributes = attributesFor
+	return pathspec.Parse(args, prefix, opts)
+}
+
+/*
+Command: mygit ls-files [-s | --stage] [-z] [--error-unmatch] [--] [<pathspec>...]
+
+List the paths of the index under the current directory, or matching the pathspecs, relative to the current directory
+With --stage, each path is shown with its mode, its object and its stage: <mode> <object> <stage>\t<path>
+With --error-unmatch, a pathspec matching no path of the index is an error
+*/
+func lsFiles(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit ls-files [-s | --stage] [-z] [--error-unmatch] [--] [<pathspec>...]")
+	stage := false
+	errorUnmatch := false
+	terminator := "\n"
+	paths := make([]string, 0)
+	for i, arg := range args {
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		switch {
+		case arg == "-s" || arg == "--stage":
+			stage = true
+		case arg == "-c" || arg == "--cached":
+			// The index is all that is listed
+		case arg == "-z":
+			terminator = "\x00"
+		case arg == "--error-unmatch":
+			errorUnmatch = true
+		case strings.HasPrefix(arg, "-"):
+			return "", usage
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	ps, err := parsePathspec(paths, repo.Prefix, pathspec.Options{PreferCwd: true})
+	if err != nil {
+		return "", err
+	}
+	idx, err := readIndex()
+	if err != nil {
+		return "", err
+	}
+	out := new(strings.Builder)
+	seen := make([]bool, len(ps.Items))
+	for _, e := range idx.Entries {
+		if !ps.MatchSeen(e.Path, false, seen) {
+			continue
+		}
+		name := displayPath(e.Path)
+		if terminator == "\n" {
+			name = quotePath(name, false)
+		}
+		if stage {
+			fmt.Fprintf(out, "%06o %s %d\t", e.Mode, e.Hash, e.Stage)
+		}
+		out.WriteString(name + terminator)
+	}
+	if !errorUnmatch {
+		return out.String(), nil
+	}
+	unmatched := false
+	for i, item := range ps.Items {
+		if !seen[i] && item.Magic&pathspec.Exclude == 0 && i < len(paths) {
+			fmt.Fprintf(os.Stderr, "error: pathspec '%s' did not match any file(s) known to git\n", item.Original)
+			unmatched = true
+		}
+	}
+	if unmatched {
+		fmt.Fprintf(os.Stderr, "Did you forget to 'git add'?\n")
+		return out.String(), errSilentFailure
+	}
+	return out.String(), nil
+}
+
+type updateIndexOptions struct {
+	add         bool
+	remove      bool
+	forceRemove bool
+	replace     bool
+	// "+x" or "-x" to set or clear the executable bit of the paths that follow
+	chmod string
+}
+
+/*
+Command: mygit update-index [--add] [--remove | --force-remove] [--replace] [--chmod=(+|-)x]
+
+	[--cacheinfo <mode>,<object>,<path>]... [--index-version <n>] [--] [<path>...]
+
+Stage the current content of files, or an object as the content of a path with --cacheinfo
+The options apply to the paths that follow them: --add stages the paths not in the index yet, --remove unstages
+the paths missing from the work tree and --force-remove unstages the paths whether they exist or not
+*/
+func updateIndex(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit update-index [--add] [--remove | --force-remove] [--replace] [--chmod=(+|-)x] [--cacheinfo <mode>,<object>,<path>]... [--index-version <n>] [--] [<path>...]")
+	idx, lock, err := lockIndex()
+	if err != nil {
+		return "", err
+	}
+	opts := updateIndexOptions{}
+	onlyPaths := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if onlyPaths || !strings.HasPrefix(arg, "-") {
+			if err := updateIndexPath(idx, opts, arg); err != nil {
+				lock.Rollback()
+				return "", err
+			}
+			continue
+		}
+		switch {
+		case arg == "--":
+			onlyPaths = true
+		case arg == "--add":
+			opts.add = true
+		case arg == "--remove":
+			opts.remove = true
+		case arg == "--force-remove":
+			opts.forceRemove = true
+		case arg == "--replace":
+			opts.replace = true
+		case strings.HasPrefix(arg, "--chmod="):
+			opts.chmod = strings.TrimPrefix(arg, "--chmod=")
+			if opts.chmod != "+x" && opts.chmod != "-x" {
+				lock.Rollback()
+				return "", fmt.Errorf("option 'chmod' expects \"+x\" or \"-x\"")
+			}
+		case arg == "--cacheinfo":
+			// Either one <mode>,<object>,<path> argument or three arguments
+			var fields []string
+			if i+1 < len(args) && strings.Count(args[i+1], ",") >= 2 {
+				fields = strings.SplitN(args[i+1], ",", 3)
+				i++
+			} else if i+3 < len(args) {
+				fields = args[i+1 : i+4]
+				i += 3
+			}
+			if err := updateIndexCacheinfo(idx, opts, fields); err != nil {
+				lock.Rollback()
+				return "", err
+			}
+		case arg == "--index-version":
+			if i+1 >= len(args) {
+				lock.Rollback()
+				return "", usage
+			}
+			i++
+			version, err := strconv.Atoi(args[i])
+			if err != nil || version < index.MinVersion || version > index.MaxVersion {
+				lock.Rollback()
+				return "", fmt.Errorf("index-version %s not in range: %d..%d", args[i], index.MinVersion, index.MaxVersion)
+			}
+			idx.Version = uint32(version)
+		default:
+			lock.Rollback()
+			return "", usage
+		}
+	}
+	if err := commitIndex(lock, idx); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// Stage the file at name, or unstage it as the options ask, then apply --chmod
+func updateIndexPath(idx *index.Index, opts updateIndexOptions, name string) error {
+	full, err := repoPath(name)
+	if err != nil || full == "" {
+		return fmt.Errorf("Ignoring path %s", name)
+	}
+	failed := func(reason string) error {
+		fmt.Fprintf(os.Stderr, "error: %s: %s\n", full, reason)
+		return fmt.Errorf("Unable to process path %s", full)
+	}
+	if opts.forceRemove {
+		idx.Remove(full)
+		return nil
+	}
+	info, err := os.Lstat(filepath.Join(repo.WorkTree, full))
+	switch {
+	case os.IsNotExist(err) && opts.remove:
+		idx.Remove(full)
+		return nil
+	case os.IsNotExist(err):
+		return failed("does not exist and --remove not passed")
+	case err != nil:
+		return failed(err.Error())
+	case info.IsDir() && !isNestedRepository(filepath.Join(repo.WorkTree, full)):
+		if opts.remove && len(idx.Get(full)) > 0 {
+			idx.Remove(full)
+			return nil
+		}
+		return failed("is a directory - add files inside instead")
+	}
+	if idx.Get(full) == nil && !opts.add {
+		return failed("cannot add to the index - missing --add option?")
+	}
+	entry, err := stageFile(full, info)
+	if err != nil {
+		return failed(err.Error())
+	}
+	if err := idx.Add(entry, opts.replace); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return failed("cannot add to the index - missing --add option?")
+	}
+	if opts.chmod != "" {
+		return chmodEntry(idx, full, opts.chmod)
+	}
+	return nil
+}
+
+// Write the object of the file at a path of the work tree and return its index entry
+func stageFile(name string, info os.FileInfo) (index.Entry, error) {
+	file := filepath.Join(repo.WorkTree, name)
+	entry := index.Entry{Stat: index.StatFromFileInfo(info), Mode: index.ModeFromFileMode(info.Mode()), Path: name}
+	var hash string
+	switch entry.Mode {
+	case index.ModeSymlink:
+		target, err := os.Readlink(file)
+		if err != nil {
+			return index.Entry{}, err
+		}
+		if hash, err = writeObject(newBlob([]byte(target))); err != nil {
+			return index.Entry{}, err
+		}
+	case index.ModeGitlink:
+		commit, err := resolveGitlink(file)
+		if err != nil {
+			return index.Entry{}, err
+		}
+		hash = hex.EncodeToString(commit)
+	default:
+		content, err := getBlobFromFile(file, name, convertWrite)
+		if err != nil {
+			return index.Entry{}, err
+		}
+		if hash, err = writeObject(content); err != nil {
+			return index.Entry{}, err
+		}
+	}
+	entry.Hash = hash
+	return entry, nil
+}
+
+// Stage an object at a path with --cacheinfo, without reading the work tree
+func updateIndexCacheinfo(idx *index.Index, opts updateIndexOptions, fields []string) error {
+	usage := fmt.Errorf("option 'cacheinfo' expects <mode>,<sha1>,<path>")
+	if len(fields) != 3 {
+		return usage
+	}
+	mode, err := strconv.ParseUint(fields[0], 8, 32)
+	hash := strings.ToLower(fields[1])
+	if _, hexErr := hex.DecodeString(hash); err != nil || hexErr != nil || len(hash) != newObjectHash().Size()*2 {
+		return usage
+	}
+	full, err := repoPath(fields[2])
+	if err != nil || full == "" {
+		return fmt.Errorf("git update-index: --cacheinfo cannot add %s", fields[2])
+	}
+	cannotAdd := func() error {
+		fmt.Fprintf(os.Stderr, "error: %s: cannot add to the index - missing --add option?\n", full)
+		return fmt.Errorf("git update-index: --cacheinfo cannot add %s", full)
+	}
+	if idx.Get(full) == nil && !opts.add {
+		return cannotAdd()
+	}
+	entry := index.Entry{Mode: canonicalMode(uint32(mode)), Hash: hash, Path: full}
+	if err := idx.Add(entry, opts.replace); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return cannotAdd()
+	}
+	return nil
+}
+
+// Return the mode an entry records for a mode given by the user: a regular file is 100644 or 100755
+func canonicalMode(mode uint32) uint32 {
+	switch mode & 0o170000 {
+	case index.ModeSymlink, index.ModeGitlink:
+		return mode & 0o170000
+	}
+	if mode&0o111 != 0 {
+		return index.ModeExecutable
+	}
+	return index.ModeFile
+}
+
+// Set or clear the executable bit of the entry of a path, chmod being "+x" or "-x"
+func chmodEntry(idx *index.Index, name, chmod string) error {
+	i, found := idx.Find(name, 0)
+	if !found || idx.Entries[i].Mode&0o170000 != 0o100000 {
+		return fmt.Errorf("git update-index: cannot chmod %s '%s'", chmod, name)
+	}
+	idx.Entries[i].Mode = index.ModeFile
+	if chmod == "+x" {
+		idx.Entries[i].Mode = index.ModeExecutable
+	}
+	idx.InvalidateTree()
+	return nil
+}
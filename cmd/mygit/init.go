@@ -0,0 +1,478 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+	refs "github.com/codecrafters-io/git-starter-go/refs"
+	repository "github.com/codecrafters-io/git-starter-go/repository"
+	utils "github.com/codecrafters-io/git-starter-go/utils"
+)
+
+// The branch HEAD points to in a new repository, unless init.defaultBranch says otherwise
+const defaultBranch = "main"
+
+// What to create with init
+type initOptions struct {
+	dir            string
+	bare           bool
+	quiet          bool
+	initialBranch  string
+	template       string
+	hasTemplate    bool
+	separateGitDir string
+	shared         string
+	objectFormat   string
+	refFormat      string
+}
+
+/*
+Command: mygit init [-q] [--bare] [--initial-branch=<name>] [--template=<dir>] [--separate-git-dir=<dir>]
+[--shared[=<permissions>]] [--object-format=<format>] [--ref-format=<format>] [<dir>]
+
+Create an empty repository, or reinitialize an existing one without touching its HEAD nor its config
+*/
+func initRepository(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit init [-q] [--bare] [--initial-branch=<name>] [--template=<dir>] [--separate-git-dir=<dir>] [--shared[=<permissions>]] [--object-format=<format>] [--ref-format=<format>] [<dir>]")
+	opts := initOptions{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		// The options taking a value accept both "--opt=<value>" and "--opt <value>"
+		name, value, hasValue := strings.Cut(arg, "=")
+		takeValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			i++
+			return args[i], nil
+		}
+		var err error
+		switch name {
+		case "-q", "--quiet":
+			opts.quiet = true
+		case "--bare":
+			opts.bare = true
+		case "-b", "--initial-branch":
+			opts.initialBranch, err = takeValue()
+		case "--template":
+			opts.template, err = takeValue()
+			opts.hasTemplate = true
+		case "--separate-git-dir":
+			opts.separateGitDir, err = takeValue()
+		case "--shared":
+			opts.shared = "group"
+			if hasValue {
+				opts.shared = value
+			}
+		case "--object-format":
+			opts.objectFormat, err = takeValue()
+		case "--ref-format":
+			opts.refFormat, err = takeValue()
+		default:
+			if strings.HasPrefix(arg, "-") || opts.dir != "" {
+				return "", usage
+			}
+			opts.dir = arg
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if opts.bare && opts.separateGitDir != "" {
+		return "", fmt.Errorf("--separate-git-dir and --bare are mutually exclusive")
+	}
+	return createRepository(opts)
+}
+
+func createRepository(opts initOptions) (string, error) {
+	workTree := opts.dir
+	if workTree == "" {
+		workTree = "."
+	}
+	if err := os.MkdirAll(workTree, 0755); err != nil {
+		return "", fmt.Errorf("cannot mkdir %s: %s", workTree, err)
+	}
+	workTree, err := filepath.Abs(workTree)
+	if err != nil {
+		return "", err
+	}
+	gitDir := filepath.Join(workTree, ".git")
+	switch {
+	case opts.bare:
+		gitDir = workTree
+	case opts.separateGitDir != "":
+		if gitDir, err = filepath.Abs(opts.separateGitDir); err != nil {
+			return "", err
+		}
+		// Move a repository being reinitialized to its new place
+		dotGit := filepath.Join(workTree, ".git")
+		if info, err := os.Lstat(dotGit); err == nil && info.IsDir() {
+			if err := os.Rename(dotGit, gitDir); err != nil {
+				return "", fmt.Errorf("unable to move %s to %s: %s", dotGit, gitDir, err)
+			}
+		}
+	default:
+		// A .git file links to a separated git dir being reinitialized
+		if target, err := repository.ReadGitFile(gitDir); err == nil {
+			gitDir = target
+		}
+	}
+
+	_, err = os.Stat(filepath.Join(gitDir, "HEAD"))
+	reinit := err == nil
+	if reinit {
+		if err := repository.CheckFormat(gitDir); err != nil {
+			return "", err
+		}
+	}
+
+	sharedPerm, err := parseSharedPermissions(opts.shared)
+	if err != nil {
+		return "", err
+	}
+	refFormat, err := initRefFormat(opts, gitDir, reinit)
+	if err != nil {
+		return "", err
+	}
+	dirs := []string{gitDir, "objects", "objects/info", "objects/pack", "refs", "refs/heads", "refs/tags", "hooks", "info"}
+	if refFormat == "reftable" {
+		dirs = []string{gitDir, "objects", "objects/info", "objects/pack", "refs", "reftable", "hooks", "info"}
+	}
+	for i, dir := range dirs {
+		if i > 0 {
+			dirs[i] = filepath.Join(gitDir, dir)
+		}
+	}
+	if err := utils.Mkdir(0755, dirs...); err != nil {
+		return "", fmt.Errorf("error creating directory: %s", err)
+	}
+	if err := copyTemplate(opts, gitDir); err != nil {
+		return "", err
+	}
+
+	// The config read while creating the repository, init.defaultBranch and init.templateDir come from it
+	cfg, err := config.Load(config.Options{GitDir: gitDir, CommandLine: commandLineConfig})
+	if err != nil {
+		return "", err
+	}
+	f, err := config.OpenFile(filepath.Join(gitDir, "config"))
+	if err != nil {
+		return "", err
+	}
+	existingFormat := "sha1"
+	if format, found := cfg.Get("extensions.objectformat"); found && reinit {
+		existingFormat = strings.ToLower(format)
+	}
+	format := strings.ToLower(opts.objectFormat)
+	switch {
+	case format == "" && reinit:
+		format = existingFormat
+	case format == "":
+		format = "sha1"
+		if env := os.Getenv("GIT_DEFAULT_HASH"); env != "" {
+			format = strings.ToLower(env)
+		}
+	case reinit && format != existingFormat:
+		return "", fmt.Errorf("attempt to reinitialize repository with different hash")
+	}
+	if format != "sha1" && format != "sha256" {
+		return "", fmt.Errorf("unknown hash algorithm '%s'", format)
+	}
+
+	branch := ""
+	if !reinit {
+		version := "0"
+		if format != "sha1" || refFormat != "files" {
+			version = "1"
+		}
+		settings := [][2]string{
+			{"core.repositoryformatversion", version},
+			{"core.filemode", "true"},
+			{"core.bare", strconv.FormatBool(opts.bare)},
+		}
+		if !opts.bare {
+			settings = append(settings, [2]string{"core.logallrefupdates", "true"})
+		}
+		// Like git, the settings are written only when the file system needs them
+		if probeFileSystem(gitDir, "CoNfIgPrObE", "cOnFiGpRoBe") {
+			settings = append(settings, [2]string{"core.ignorecase", "true"})
+		}
+		if probeFileSystem(gitDir, "\u00c4probe", "A\u0308probe") {
+			settings = append(settings, [2]string{"core.precomposeunicode", "true"})
+		}
+		if format != "sha1" {
+			settings = append(settings, [2]string{"extensions.objectformat", format})
+		}
+		if refFormat != "files" {
+			settings = append(settings, [2]string{"extensions.refstorage", refFormat})
+		}
+		for _, setting := range settings {
+			if err := f.Set(setting[0], setting[1]); err != nil {
+				return "", err
+			}
+		}
+
+		branch = opts.initialBranch
+		if branch == "" {
+			branch = defaultBranch
+			if name, found := cfg.Get("init.defaultbranch"); found && name != "" {
+				branch = name
+			}
+		}
+		if refs.CheckRefFormat("refs/heads/"+branch, 0) != nil {
+			return "", fmt.Errorf("invalid initial branch name: '%s'", branch)
+		}
+		if err := writeInitialHead(gitDir, refFormat, branch); err != nil {
+			return "", err
+		}
+	} else if opts.initialBranch != "" {
+		fmt.Fprintf(os.Stderr, "warning: re-init: ignored --initial-branch=%s\n", opts.initialBranch)
+	}
+	if opts.shared != "" {
+		if err := f.Set("core.sharedrepository", sharedConfigValue(opts.shared, sharedPerm)); err != nil {
+			return "", err
+		}
+	}
+	if err := f.Write(); err != nil {
+		return "", err
+	}
+	// The real HEAD of a reftable repository lives in the tables, which the config must select first
+	if refFormat == "reftable" && branch != "" {
+		if err := refs.Open(gitDir, refs.Options{}).SetSymbolic("HEAD", "refs/heads/"+branch, ""); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.separateGitDir != "" {
+		link := []byte(fmt.Sprintf("gitdir: %s\n", gitDir))
+		if err := os.WriteFile(filepath.Join(workTree, ".git"), link, 0644); err != nil {
+			return "", fmt.Errorf("error writing file: %s", err)
+		}
+	}
+	if sharedPerm != 0 {
+		if err := applySharedPermissions(gitDir, opts.shared, sharedPerm); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.quiet {
+		return "", nil
+	}
+	shared := ""
+	if sharedPerm != 0 {
+		shared = "shared "
+	}
+	if reinit {
+		return fmt.Sprintf("Reinitialized existing %sGit repository in %s/\n", shared, gitDir), nil
+	}
+	return fmt.Sprintf("Initialized empty %sGit repository in %s/\n", shared, gitDir), nil
+}
+
+// Return the ref storage format of the repository: --ref-format, else GIT_DEFAULT_REF_FORMAT, else files
+// A repository being reinitialized keeps its format
+func initRefFormat(opts initOptions, gitDir string, reinit bool) (string, error) {
+	existing := "files"
+	if reinit {
+		cfg, err := config.LoadFile(filepath.Join(gitDir, "config"), config.ScopeLocal)
+		if err != nil {
+			return "", err
+		}
+		if format, found := cfg.Get("extensions.refstorage"); found {
+			existing = strings.ToLower(format)
+		}
+	}
+	format := strings.ToLower(opts.refFormat)
+	switch {
+	case format == "" && reinit:
+		return existing, nil
+	case format == "":
+		format = "files"
+		if env := os.Getenv("GIT_DEFAULT_REF_FORMAT"); env != "" {
+			format = strings.ToLower(env)
+		}
+	}
+	if format != "files" && format != "reftable" {
+		return "", fmt.Errorf("unknown ref storage format '%s'", format)
+	}
+	if reinit && format != existing {
+		return "", fmt.Errorf("attempt to reinitialize repository with different reference storage format")
+	}
+	return format, nil
+}
+
+// Return whether the file system takes name and other for the same file: a probe file named name is created in dir,
+// looked up as other, then removed
+func probeFileSystem(dir, name, other string) bool {
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	defer os.Remove(path)
+	_, err = os.Lstat(filepath.Join(dir, other))
+	return err == nil
+}
+
+// Write the HEAD of a new repository, pointing to branch
+// With reftable the HEAD file only keeps older tools from taking the directory for a files repository,
+// like the refs/heads file
+func writeInitialHead(gitDir, refFormat, branch string) error {
+	head := fmt.Sprintf("ref: refs/heads/%s\n", branch)
+	if refFormat == "reftable" {
+		head = "ref: refs/heads/.invalid\n"
+		stub := []byte("this repository uses the reftable format\n")
+		if err := os.WriteFile(filepath.Join(gitDir, "refs", "heads"), stub, 0644); err != nil {
+			return fmt.Errorf("error writing file: %s", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte(head), 0644); err != nil {
+		return fmt.Errorf("error writing file: %s", err)
+	}
+	return nil
+}
+
+// Copy the files of the template dir into the git dir, keeping the files already there
+func copyTemplate(opts initOptions, gitDir string) error {
+	template := opts.template
+	if !opts.hasTemplate {
+		template = os.Getenv("GIT_TEMPLATE_DIR")
+	}
+	if !opts.hasTemplate && template == "" {
+		cfg, err := config.Load(config.Options{CommandLine: commandLineConfig})
+		if err != nil {
+			return err
+		}
+		template, _ = cfg.Path("init.templatedir")
+	}
+	if template == "" {
+		return nil
+	}
+	template = config.ExpandPath(template)
+	if _, err := os.Stat(template); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: templates not found in %s\n", template)
+		return nil
+	}
+	return filepath.WalkDir(template, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(template, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		// The template can't replace the repository files
+		if rel == "HEAD" || rel == "config" {
+			return nil
+		}
+		target := filepath.Join(gitDir, rel)
+		if _, err := os.Lstat(target); err == nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Return the permissions of the files of a shared repository, or 0 for the umask default
+// https://git-scm.com/docs/git-init#Documentation/git-init.txt---sharedfalsetrueumaskgroupallworldeverybodyltpermgt
+func parseSharedPermissions(shared string) (fs.FileMode, error) {
+	switch strings.ToLower(shared) {
+	case "", "umask", "false", "no", "off", "0":
+		return 0, nil
+	case "group", "true", "yes", "on", "1":
+		return 0660, nil
+	case "all", "world", "everybody", "2":
+		return 0664, nil
+	}
+	perm, err := strconv.ParseUint(shared, 8, 32)
+	if err != nil || perm&0600 != 0600 || perm > 0777 {
+		return 0, fmt.Errorf("problem with core.sharedRepository filemode value (%s)", shared)
+	}
+	return fs.FileMode(perm), nil
+}
+
+// Return the core.sharedRepository value git writes for --shared
+func sharedConfigValue(shared string, perm fs.FileMode) string {
+	switch perm {
+	case 0:
+		return "0"
+	case 0660:
+		return "1"
+	case 0664:
+		return "2"
+	}
+	return fmt.Sprintf("0%o", perm)
+}
+
+// Give the group, and maybe others, access to everything in the git dir
+// The named permissions add to the existing ones, the octal ones replace them
+// Directories get the setgid bit so that new files belong to the group
+func applySharedPermissions(gitDir, shared string, perm fs.FileMode) error {
+	exact := strings.HasPrefix(shared, "0")
+	return filepath.WalkDir(gitDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil || info.Mode()&fs.ModeSymlink != 0 {
+			return err
+		}
+		tweak := perm
+		if info.Mode()&0200 == 0 {
+			tweak &^= 0222
+		}
+		// What can be read can be searched or executed if it already was
+		if d.IsDir() || info.Mode()&0100 != 0 {
+			tweak |= (tweak & 0444) >> 2
+		}
+		mode := info.Mode().Perm() | tweak
+		if exact {
+			mode = tweak
+		}
+		if d.IsDir() {
+			mode |= fs.ModeSetgid
+		}
+		return os.Chmod(path, mode)
+	})
+}
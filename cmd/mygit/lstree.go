@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	index "github.com/codecrafters-io/git-starter-go/index"
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+	pathspec "github.com/codecrafters-io/git-starter-go/pathspec"
+)
+
+type lsTreeOptions struct {
+	recursive bool
+	// Show the trees themselves, not their content, with -d
+	treesOnly bool
+	// Show the trees walked into with -r
+	showTrees bool
+	long      bool
+	nameOnly  bool
+	// Show the paths from the top of the work tree instead of the current directory
+	fullName   bool
+	terminator string
+}
+
+/*
+Command: mygit ls-tree [-r] [-d] [-t] [-l] [-z] [--name-only | --name-status] [--full-name] [--full-tree]
+
+	<tree-ish> [<path>...]
+
+List the content of a tree, of a commit or of a tag pointing to one: "<mode> <type> <object>\t<path>" for each entry,
+with the size of the blobs before the path with -l
+Without -r, the trees aren't walked into unless a path is under them, -d only shows the trees and -t shows the trees
+walked into
+The paths are literal, and limited to the current directory unless --full-tree is given
+*/
+func lsTree(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit ls-tree [-r] [-d] [-t] [-l] [-z] [--name-only | --name-status] [--full-name] [--full-tree] <tree-ish> [<path>...]")
+	opts := lsTreeOptions{terminator: "\n"}
+	fullTree := false
+	positional := make([]string, 0)
+	for i, arg := range args {
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		switch {
+		case arg == "-r":
+			opts.recursive = true
+		case arg == "-d":
+			opts.treesOnly = true
+		case arg == "-t":
+			opts.showTrees = true
+		case arg == "-l" || arg == "--long":
+			opts.long = true
+		case arg == "-z":
+			opts.terminator = "\x00"
+		case arg == "--name-only" || arg == "--name-status":
+			opts.nameOnly = true
+		case arg == "--full-name":
+			opts.fullName = true
+		case arg == "--full-tree":
+			fullTree = true
+			opts.fullName = true
+		case strings.HasPrefix(arg, "-"):
+			return "", usage
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) == 0 {
+		return "", usage
+	}
+	if opts.long && opts.nameOnly {
+		return "", fmt.Errorf("options '--long' and '--name-only' cannot be used together")
+	}
+	// -d -r shows the trees it walks into
+	if opts.treesOnly && opts.recursive {
+		opts.showTrees = true
+	}
+	tree, err := resolveTree(positional[0])
+	if err != nil {
+		return "", err
+	}
+	prefix := repo.Prefix
+	if fullTree {
+		prefix = ""
+	}
+	// The paths are literal, only the magic choosing where they start from is allowed
+	ps, err := parsePathspec(positional[1:], prefix, pathspec.Options{
+		PreferCwd: true,
+		Forbidden: pathspec.Glob | pathspec.Icase | pathspec.Exclude | pathspec.Attr,
+	})
+	if err != nil {
+		return "", err
+	}
+	for i := range ps.Items {
+		ps.Items[i] = ps.Items[i].AsLiteral()
+	}
+	out := new(strings.Builder)
+	if err := listTreeEntries(out, tree, "", ps, opts); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Write the entries of a tree whose path is base, walking into the trees matching the pathspec
+func listTreeEntries(out *strings.Builder, tree, base string, ps *pathspec.Pathspec, opts lsTreeOptions) error {
+	_, content, err := readObject(tree)
+	if err != nil {
+		return err
+	}
+	items, err := objects.ParseTree(content, newObjectHash().Size())
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		name := path.Join(base, item.Name)
+		hash := hex.EncodeToString(item.Sha1_Hash)
+		isTree := item.Permission == objects.ModeTree
+		if !ps.Match(name, isTree) && !(isTree && ps.MayMatchUnder(name)) {
+			continue
+		}
+		if isTree && (opts.recursive || pathUnderTree(ps, name)) {
+			if opts.showTrees {
+				if err := writeTreeEntry(out, item, hash, name, opts); err != nil {
+					return err
+				}
+			}
+			if err := listTreeEntries(out, hash, name, ps, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		if opts.treesOnly && !isTree {
+			continue
+		}
+		if err := writeTreeEntry(out, item, hash, name, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Whether one of the paths is under the tree, which is then walked into even without -r
+func pathUnderTree(ps *pathspec.Pathspec, name string) bool {
+	for _, item := range ps.Items {
+		if strings.HasPrefix(item.Match, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTreeEntry(out *strings.Builder, item objects.TreeObjectItem, hash, name string, opts lsTreeOptions) error {
+	if !opts.fullName {
+		name = displayPath(name)
+	}
+	if opts.terminator == "\n" {
+		name = quotePath(name, false)
+	}
+	if opts.nameOnly {
+		out.WriteString(name + opts.terminator)
+		return nil
+	}
+	fmt.Fprintf(out, "%06s %s %s", item.Permission, item.Type(), hash)
+	if opts.long {
+		size := "-"
+		if item.Type() == "blob" {
+			_, content, err := readObject(hash)
+			if err != nil {
+				return err
+			}
+			size = fmt.Sprintf("%d", len(content))
+		}
+		fmt.Fprintf(out, " %7s", size)
+	}
+	out.WriteString("\t" + name + opts.terminator)
+	return nil
+}
+
+// Return the tree a tree-ish stands for: a tree, or the tree of a commit, following the tags pointing to them
+func resolveTree(revision string) (string, error) {
+	hash, err := resolveRevision(revision)
+	if err != nil {
+		return "", fmt.Errorf("Not a valid object name %s", revision)
+	}
+	if peeled, err := peelTag(hash); err != nil {
+		return "", err
+	} else if peeled != "" {
+		hash = peeled
+	}
+	objectType, content, err := readObject(hash)
+	if err != nil {
+		return "", err
+	}
+	switch objectType {
+	case "tree":
+		return hash, nil
+	case "commit":
+		commit, err := objects.ParseCommit(content)
+		if err != nil {
+			return "", err
+		}
+		return string(commit.TreeSha), nil
+	}
+	return "", fmt.Errorf("not a tree object")
+}
+
+// Return the entries of the blobs and gitlinks of a tree and its subtrees, as index entries without stat data,
+// sorted like the index
+func readTreeEntries(tree string) ([]index.Entry, error) {
+	entries := make([]index.Entry, 0)
+	var walk func(tree, base string) error
+	walk = func(tree, base string) error {
+		_, content, err := readObject(tree)
+		if err != nil {
+			return err
+		}
+		items, err := objects.ParseTree(content, newObjectHash().Size())
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			name := path.Join(base, item.Name)
+			mode, err := strconv.ParseUint(item.Permission, 8, 32)
+			if err != nil {
+				return fmt.Errorf("invalid mode %s of %s in tree %s", item.Permission, name, tree)
+			}
+			hash := hex.EncodeToString(item.Sha1_Hash)
+			if item.Permission == objects.ModeTree {
+				if err := walk(hash, name); err != nil {
+					return err
+				}
+				continue
+			}
+			entries = append(entries, index.Entry{Mode: uint32(mode), Hash: hash, Path: name})
+		}
+		return nil
+	}
+	if err := walk(tree, ""); err != nil {
+		return nil, err
+	}
+	// The trees sort their subtrees as if their name ended with a slash, the index sorts paths bytewise
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
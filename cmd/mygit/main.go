@@ -4,20 +4,32 @@ import (
 	"bytes"
 	"compress/zlib"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"regexp"
 	"strings"
 
+	ident "github.com/codecrafters-io/git-starter-go/ident"
+	index "github.com/codecrafters-io/git-starter-go/index"
 	objects "github.com/codecrafters-io/git-starter-go/objects"
+	refs "github.com/codecrafters-io/git-starter-go/refs"
+	repository "github.com/codecrafters-io/git-starter-go/repository"
 	utils "github.com/codecrafters-io/git-starter-go/utils"
 )
 
 type Dir string
 type File string
 
+const globalUsage = "usage: mygit [-C <path>] [-c <name>=<value>] [--git-dir=<path>] [--work-tree=<path>] <command> [<args>...]"
+
+// The repository the command runs in, nil for init and for config outside of a repository
+var repo *repository.Repository
+
 // Usage: your_program.sh <command> <arg1> <arg2> ...
 func main() {
 	if len(os.Args) < 2 {
@@ -25,22 +37,81 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Global options come before the command
+	args := os.Args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch {
+		case args[0] == "-c" && len(args) > 1:
+			commandLineConfig = append(commandLineConfig, args[1])
+			args = args[2:]
+		case args[0] == "-C" && len(args) > 1:
+			// Run as if started in <path>, an empty path is ignored
+			if args[1] != "" {
+				if err := os.Chdir(args[1]); err != nil {
+					fmt.Fprintf(os.Stderr, "fatal: cannot change to '%s': %s\n", args[1], err)
+					os.Exit(128)
+				}
+			}
+			args = args[2:]
+		case strings.HasPrefix(args[0], "--git-dir="):
+			os.Setenv("GIT_DIR", strings.TrimPrefix(args[0], "--git-dir="))
+			args = args[1:]
+		case strings.HasPrefix(args[0], "--work-tree="):
+			os.Setenv("GIT_WORK_TREE", strings.TrimPrefix(args[0], "--work-tree="))
+			args = args[1:]
+		default:
+			fmt.Fprintf(os.Stderr, "unknown option: %s\n%s\n", args[0], globalUsage)
+			os.Exit(1)
+		}
+	}
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "%s\n", globalUsage)
+		os.Exit(1)
+	}
+	// The commands find their arguments in os.Args from index 2
+	os.Args = append([]string{os.Args[0]}, args...)
+
+	// Every command but init runs in a repository, config can also run outside of one
+	if command := os.Args[1]; command != "init" {
+		r, err := repository.Discover()
+		var formatErr *repository.FormatError
+		switch {
+		case err == nil:
+		case command == "config" && errors.As(err, &formatErr):
+			// Left outside of the repository, its config file can still be fixed with --file
+			fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+		case command == "config" && err == repository.ErrNotFound:
+		default:
+			fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
+			os.Exit(128)
+		}
+		repo = r
+	}
+
 	switch command := os.Args[1]; command {
 	case "init":
 		// Initialize a new git repository, creating the necessary directories and files
-		if err := utils.Mkdir(0755, ".git", ".git/objects", ".git/refs", ".git/hooks"); err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating directory: %s\n", err)
+		res, err := initRepository(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(res)
+	case "config":
+		// Read and write the configuration files
+		res, err := configCommand(os.Args[2:])
+		if err == errConfigKeyNotFound {
+			os.Exit(1)
 		}
-		headFileContents := []byte("ref: refs/heads/main\n")
-		configFileContents := []byte("[core]\nrepositoryformatversion = 0\nfilemode = true\nbare = false\nlogallrefupdates = true\nignorecase = true\nprecomposeunicode = true")
-		err := utils.Mkfile([]string{".git/HEAD", ".git/config"}, [][]byte{headFileContents, configFileContents}, 0644)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing file: %s\n", err)
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
 		}
-		fmt.Println("Initialized git directory")
+		fmt.Print(res)
 	case "cat-file":
 		// Display information about .git/objects
 		res, err := catFile(os.Args)
+		stopFilterProcesses()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error while doing catfile stuff %s\n", err)
 			os.Exit(1)
@@ -49,6 +120,7 @@ func main() {
 	case "hash-object":
 		// Encode file to blob object (it's represents a file)
 		res, err := hashObject()
+		stopFilterProcesses()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error while doing catfile stuff %s\n", err)
 			os.Exit(1)
@@ -56,33 +128,66 @@ func main() {
 		fmt.Print(res)
 	case "ls-tree":
 		// Decode a tree object and print its content
-		res, err := listTree()
+		res, err := lsTree(os.Args[2:])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error while processing ls-tree: %s\n", err)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
+			os.Exit(128)
 		}
 		fmt.Print(res)
 	case "write-tree":
 		// Write a tree object (it's represents a folder)
-		tree, err := buildTree("./")
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error while building the tree: %s\n", err)
-			os.Exit(1)
-		}
-		hash, err := writeObject(tree)
+		hash, err := writeTree(os.Args[2:])
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error while writing the tree: %s\n", err)
 			os.Exit(1)
 		}
 		fmt.Print(hash)
+	case "rev-parse":
+		// Show where the repository is, or the object names of revisions
+		res, err := revParse(os.Args[2:])
+		if err == errSilentFailure {
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
+			os.Exit(128)
+		}
+		fmt.Print(res)
 	case "commit-tree":
 		// Write a commit object
-		hash, err := writeCommit()
+		hash, err := writeCommit(os.Args[2:])
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error while commit tree: %s\n", err)
 			os.Exit(1)
 		}
 		fmt.Print(hash)
+	case "update-ref", "symbolic-ref", "show-ref", "pack-refs", "check-ref-format", "reflog", "branch", "tag", "for-each-ref":
+		// Read and write the refs
+		res, err := refCommands[command](os.Args[2:])
+		if err == errSilentFailure {
+			// What was done before the failure is still reported
+			fmt.Print(res)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
+			os.Exit(128)
+		}
+		fmt.Print(res)
+	case "ls-files", "update-index", "add", "status", "check-ignore", "clean", "check-attr",
+		"checkout", "switch", "restore":
+		// Read and write the index
+		res, err := indexCommands[command](os.Args[2:])
+		stopFilterProcesses()
+		if err == errSilentFailure {
+			fmt.Print(res)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
+			os.Exit(128)
+		}
+		fmt.Print(res)
 	default:
 		// Undefined command
 		fmt.Fprintf(os.Stderr, "Undefined command %s\n", command)
@@ -91,19 +196,80 @@ func main() {
 }
 
 // $ git commit-tree 5b825dc642cb6eb9a060e54bf8d69288fbee4904 -p 3b18e512dba79e4c8300dd08aeb37f8e728b8dad -m "Second commit"
-func writeCommit() (string, error) {
-	if len(os.Args) < 7 {
-		return "", fmt.Errorf("usage: mygit comit-tree <tree_sha> -p <parent_commit_sha> -m <commit_message>")
+//
+// Usage: mygit commit-tree <tree_sha> [(-p <parent_commit_sha>)...] [(-m <message>)...] [(-F <file>)...]
+// Without -m nor -F, the message is read from the standard input
+func writeCommit(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit commit-tree <tree_sha> [(-p <parent_commit_sha>)...] [(-m <message>)...] [(-F <file>)...]")
+	commit := objects.Commit{}
+	message := new(bytes.Buffer)
+	hasMessage := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-p", "-m", "-F":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			i++
+		}
+		switch arg {
+		case "-p":
+			parent, err := verifyObjectHash(args[i])
+			if err != nil {
+				return "", err
+			}
+			duplicate := false
+			for _, p := range commit.ParentShas {
+				duplicate = duplicate || string(p) == parent
+			}
+			if duplicate {
+				fmt.Fprintf(os.Stderr, "duplicate parent %s ignored\n", parent)
+				continue
+			}
+			commit.ParentShas = append(commit.ParentShas, []byte(parent))
+		case "-m":
+			appendMessageParagraph(message, args[i])
+			hasMessage = true
+		case "-F":
+			if message.Len() > 0 {
+				message.WriteByte('\n')
+			}
+			if err := readMessageFile(args[i], message); err != nil {
+				return "", err
+			}
+			hasMessage = true
+		default:
+			if commit.TreeSha != nil || strings.HasPrefix(arg, "-") {
+				return "", usage
+			}
+			tree, err := verifyObjectHash(arg)
+			if err != nil {
+				return "", err
+			}
+			commit.TreeSha = []byte(tree)
+		}
 	}
-	treeSha := os.Args[2]
-	parentTreeSha := os.Args[4]
-	message := os.Args[6]
-
-	commit := objects.Commit{
-		TreeSha:   []byte(treeSha),
-		ParentSha: []byte(parentTreeSha),
-		Message:   []byte(message),
+	if commit.TreeSha == nil {
+		return "", usage
+	}
+	if !hasMessage {
+		if err := readMessageFile("-", message); err != nil {
+			return "", err
+		}
+	}
+	commit.Message = message.Bytes()
+	author, err := ident.Get(ident.Author, configValue)
+	if err != nil {
+		return "", err
+	}
+	committer, err := ident.Get(ident.Committer, configValue)
+	if err != nil {
+		return "", err
 	}
+	commit.Author = []byte(author.String())
+	commit.Committer = []byte(committer.String())
+
 	content := commit.ToByteSlice()
 	h, err := writeObject(content)
 	if err != nil {
@@ -112,70 +278,194 @@ func writeCommit() (string, error) {
 	return h, nil
 }
 
-/*
-Command: mygit write-tree
-
-Writes the working directory in a tree object to the .git/objects directory
-*/
-func buildTree(root string) ([]byte, error) {
-	// fmt.Printf("The root is %s\n", root)
-	// The files & dirs in root
-	dirs := make(map[string]bool)
+// Append a paragraph given with -m to message, each -m is its own paragraph
+func appendMessageParagraph(message *bytes.Buffer, paragraph string) {
+	if message.Len() > 0 {
+		message.WriteByte('\n')
+	}
+	message.WriteString(paragraph)
+	if !strings.HasSuffix(paragraph, "\n") {
+		message.WriteByte('\n')
+	}
+}
 
-	// Walk the root dir
-	entries, err := os.ReadDir(root)
+// Append the content of file, or of the standard input for "-", to message
+func readMessageFile(file string, message *bytes.Buffer) error {
+	if file == "-" {
+		if _, err := io.Copy(message, os.Stdin); err != nil {
+			return fmt.Errorf("error while reading the message from stdin: %s", err)
+		}
+		return nil
+	}
+	b, err := utils.ReadFile(file)
 	if err != nil {
-		return []byte{}, err
+		return err
 	}
+	message.Write(b.Bytes())
+	return nil
+}
 
-	treeItems := make([]objects.TreeObjectItem, 0)
-	// Map each dir/file found
-	for _, entry := range entries {
-		if entry.IsDir() {
-			// fmt.Printf("%s/\n", entry.Name())
-			if entry.Name() != ".git" {
-				dirs[entry.Name()] = true
-			} else {
-				// fmt.Println("ignoring .git/ dir")
-			}
-		} else {
-			// fmt.Printf("%s\n", entry.Name())
-			// For each file, create a TreeObjectItem
-			content, err := getBlobFromFile(root + entry.Name())
-			if err != nil {
-				return []byte{}, err
+// Return the arguments with their bundled short options split like git's parse-options does: -fdx is -f -d -x
+// The options of withValue take the rest of their bundle as their value, like -fepattern for -f -e pattern, or the next
+// argument, which is then left as it is, like everything after "--"
+func splitShortOptions(args []string, withValue string) []string {
+	split := make([]string, 0, len(args))
+	value := false
+	for i, arg := range args {
+		switch {
+		case value:
+			split = append(split, arg)
+			value = false
+			continue
+		case arg == "--":
+			return append(split, args[i:]...)
+		case len(arg) <= 2 || arg[0] != '-' || arg[1] == '-':
+			split = append(split, arg)
+			value = len(arg) == 2 && arg[0] == '-' && strings.IndexByte(withValue, arg[1]) >= 0
+			continue
+		}
+		for j := 1; j < len(arg); j++ {
+			split = append(split, "-"+arg[j:j+1])
+			if strings.IndexByte(withValue, arg[j]) >= 0 {
+				if j+1 < len(arg) {
+					split = append(split, arg[j+1:])
+				} else {
+					value = true
+				}
+				break
 			}
-			hash, err := calculateObjectHash(content)
-			if err != nil {
-				return []byte{}, err
+		}
+	}
+	return split
+}
+
+// Check that hash names an object of the .git/objects directory
+func verifyObjectHash(hash string) (string, error) {
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != newObjectHash().Size()*2 {
+		return "", fmt.Errorf("not a valid object name %s", hash)
+	}
+	if _, err := os.Stat(repo.Path("objects", hash[:2], hash[2:])); err != nil {
+		return "", fmt.Errorf("not a valid object name %s", hash)
+	}
+	return hash, nil
+}
+
+/*
+Command: mygit write-tree [--missing-ok] [--prefix=<dir>]
+
+Writes the index, or only the <dir> subtree of it, in tree objects to the .git/objects directory
+The objects of the entries must exist unless --missing-ok is given, and the index must have no conflict
+*/
+func writeTree(args []string) (string, error) {
+	prefix := ""
+	missingOK := false
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--prefix="):
+			// The prefix is relative to the top of the work tree
+			prefix = strings.Trim(strings.TrimPrefix(arg, "--prefix="), "/")
+		case arg == "--missing-ok":
+			missingOK = true
+		default:
+			return "", fmt.Errorf("usage: mygit write-tree [--missing-ok] [--prefix=<dir>]")
+		}
+	}
+	idx, err := readIndex()
+	if err != nil {
+		return "", err
+	}
+	entries := make([]index.Entry, 0, len(idx.Entries))
+	unmerged := false
+	for _, e := range idx.Entries {
+		switch {
+		case e.Stage != 0:
+			fmt.Fprintf(os.Stderr, "%s: unmerged (%s)\n", e.Path, e.Hash)
+			unmerged = true
+		case !missingOK && !objectExists(e.Hash) && e.Mode != index.ModeGitlink:
+			return "", fmt.Errorf("invalid object %06o %s for '%s'", e.Mode, e.Hash, e.Path)
+		case e.IntentToAdd:
+			// Only recorded to be added later
+		default:
+			entries = append(entries, e)
+		}
+	}
+	if unmerged {
+		return "", fmt.Errorf("git-write-tree: error building trees")
+	}
+	if prefix != "" {
+		sub := make([]index.Entry, 0)
+		for _, e := range entries {
+			if rest, found := strings.CutPrefix(e.Path, prefix+"/"); found {
+				e.Path = rest
+				sub = append(sub, e)
 			}
-			treeItems = append(treeItems, objects.TreeObjectItem{
-				Permission: "100644",
-				Name:       entry.Name(),
-				Sha1_Hash:  hash,
-			})
 		}
+		if len(sub) == 0 {
+			return "", fmt.Errorf("prefix %s not found", prefix)
+		}
+		entries = sub
 	}
+	return buildTree(entries)
+}
 
-	for dir := range dirs {
-		tree, err := buildTree(dir + "/")
-		if err != nil {
-			return []byte{}, err
+// Write the tree object of index entries sorted by path, and the trees of their directories, return its hash
+func buildTree(entries []index.Entry) (string, error) {
+	treeItems := make([]objects.TreeObjectItem, 0)
+	for i := 0; i < len(entries); {
+		e := entries[i]
+		dir, _, isDir := strings.Cut(e.Path, "/")
+		if !isDir {
+			hash, _ := hex.DecodeString(e.Hash)
+			treeItems = append(treeItems, objects.TreeObjectItem{Name: e.Path, Permission: fmt.Sprintf("%o", e.Mode), Sha1_Hash: hash})
+			i++
+			continue
+		}
+		// The entries of a directory follow each other
+		sub := make([]index.Entry, 0)
+		for ; i < len(entries) && strings.HasPrefix(entries[i].Path, dir+"/"); i++ {
+			child := entries[i]
+			child.Path = strings.TrimPrefix(child.Path, dir+"/")
+			sub = append(sub, child)
 		}
-		hash, err := calculateObjectHash(tree)
+		hash, err := buildTree(sub)
 		if err != nil {
-			return []byte{}, err
+			return "", err
 		}
-		treeItems = append(treeItems, objects.TreeObjectItem{
-			Permission: "40000",
-			Name:       dir,
-			Sha1_Hash:  hash,
-		})
+		sha, _ := hex.DecodeString(hash)
+		treeItems = append(treeItems, objects.TreeObjectItem{Name: dir, Permission: objects.ModeTree, Sha1_Hash: sha})
 	}
-
-	// Concat the file and dir in one content slice
 	tree := objects.NewTreeObject(objects.ObjectHeader{}, treeItems...)
-	return tree.ToByteSlice(), nil
+	return writeObject(tree.ToByteSlice())
+}
+
+// Whether the object of hash is in the .git/objects directory
+func objectExists(hash string) bool {
+	_, err := verifyObjectHash(hash)
+	return err == nil
+}
+
+// Whether dir is the work tree of another repository
+func isNestedRepository(dir string) bool {
+	_, err := os.Lstat(dir + "/.git")
+	return err == nil
+}
+
+// Return the commit hash the HEAD of the repository nested in dir points to
+func resolveGitlink(dir string) ([]byte, error) {
+	gitDir := dir + "/.git"
+	// A .git file links to the real git directory
+	if linked, err := repository.ReadGitFile(gitDir); err == nil {
+		gitDir = linked
+	}
+	head, err := refs.Open(gitDir, refs.Options{}).Resolve("HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("the nested repository %s does not have a commit checked out", dir)
+	}
+	hash, err := hex.DecodeString(head.Target)
+	if err != nil || len(hash) != newObjectHash().Size() {
+		return nil, fmt.Errorf("the nested repository %s does not have a commit checked out", dir)
+	}
+	return hash, nil
 }
 
 // Encode the content and return its sha1 hash
@@ -187,7 +477,7 @@ func writeObject(content []byte) (string, error) {
 	}
 	sha1_hash := hex.EncodeToString(hash)
 
-	dir := fmt.Sprintf(".git/objects/%s", sha1_hash[:2])
+	dir := repo.Path("objects", sha1_hash[:2])
 	fileName := sha1_hash[2:]
 	fullPath := fmt.Sprintf("%s/%s", dir, fileName)
 
@@ -212,64 +502,6 @@ func writeObject(content []byte) (string, error) {
 	return sha1_hash, nil
 }
 
-// git ls-tree --name-only <tree_sha>
-//
-//	tree <size>\0
-//
-// <mode> <name>\0<20_byte_sha>
-// <mode> <name>\0<20_byte_sha>
-func listTree() (string, error) {
-	if len(os.Args) < 4 {
-		return "", fmt.Errorf("usage: mygit ls-tree <flags> <Treeobjects>")
-	}
-	fileHandle, err := os.Open(".git/objects/" + os.Args[3][:2] + "/" + os.Args[3][2:])
-	if err != nil {
-		return "", fmt.Errorf("unable to open %s\nError: %s", os.Args[3], err)
-	}
-	content, err := decodeFileWithZlib(fileHandle)
-	if err != nil {
-		return "", fmt.Errorf("error while decoding file with zlib: %s", err)
-	}
-	switch flag := os.Args[2]; flag {
-	case "--name-only":
-		treeContentNames, err := decodeTreeContentNames(content)
-		if err != nil {
-			return "", fmt.Errorf("error while decoding tree content: %s", err)
-		}
-		// fmt.Printf("The content of the file to string is:\n%s", string(content))
-		return strings.Join(treeContentNames, "\n") + "\n", nil
-	default:
-		return "", fmt.Errorf("unknown flag passed: %s", flag)
-	}
-}
-
-// return the names contained in the Tree
-func decodeTreeContentNames(content []byte) ([]string, error) {
-	// all the tree/blob names are before the null (\x00) byte, minus the first one
-	// we can collect all index of the null bytes, and grab all the chars before it until it finds a whitespace
-	indices := make([]int, 0)
-	for i, c := range content {
-		if c == '\x00' {
-			indices = append(indices, i)
-		}
-	}
-	indices = indices[1:]
-	names := make([]string, 0)
-	for _, i := range indices {
-		name := make([]byte, 0)
-		i--
-		for {
-			if content[i] == ' ' {
-				break
-			}
-			name = append([]byte{content[i]}, name...)
-			i--
-		}
-		names = append(names, string(name))
-	}
-	return names, nil
-}
-
 // hash-object -w test.txt
 func hashObject() (string, error) {
 	if len(os.Args) < 4 {
@@ -291,16 +523,39 @@ func hashObject() (string, error) {
 // Display content, size or type of a git/objects
 // The content is encoded using zlib
 // Example: mygit cat-file -p 4csejhtq23098ughaohjg
+// With --filters --path=<path>, the content of a blob is shown as it would be written to the work tree at the path
 func catFile(args []string) (string, error) {
 	if len(args) < 4 {
 		return "", fmt.Errorf("usage: mygit cat-file <flags> <objects>")
 	}
 
 	flag := args[2]
+	if flag == "--filters" {
+		name, found := "", false
+		if len(args) == 5 {
+			name, found = strings.CutPrefix(args[3], "--path=")
+		}
+		if !found {
+			return "", fmt.Errorf("usage: mygit cat-file --filters --path=<path> <blob>")
+		}
+		full, err := repoPath(name)
+		if err != nil {
+			return "", err
+		}
+		content, err := readBlob(args[4])
+		if err != nil {
+			return "", err
+		}
+		converted, err := convertToWorkTree(full, content)
+		if err != nil {
+			return "", err
+		}
+		return string(converted), nil
+	}
 	file := args[3]
 	dir := string(file[:2])
 	object := string(file[2:])
-	filePath := fmt.Sprintf(".git/objects/%s/%s", dir, object)
+	filePath := repo.Path("objects", dir, object)
 
 	// Decode the file content
 	blobObj, err := decodeBlobObject(filePath)
@@ -321,8 +576,14 @@ func catFile(args []string) (string, error) {
 }
 
 // Create a blob object and returns the sha1_sum and an error if there was any
+// The file is converted as the attributes of its path in the repository ask
 func encodeBlobObject(file string) (string, error) {
-	blobSlice, err := getBlobFromFile(file)
+	name, err := repoPath(file)
+	if err != nil {
+		// The files outside of the work tree have no attributes
+		name = ""
+	}
+	blobSlice, err := getBlobFromFile(file, name, convertWrite)
 	if err != nil {
 		return "", err
 	}
@@ -334,24 +595,36 @@ func encodeBlobObject(file string) (string, error) {
 }
 
 // Return the content of a file formatted in a blob fashion: <type> <size>\x00<content>
-func getBlobFromFile(file string) ([]byte, error) {
+// The content is converted as the attributes of name, the path of the file in the repository, ask, unless it is ""
+func getBlobFromFile(file, name string, flags convertFlags) ([]byte, error) {
 	b, err := utils.ReadFile(file)
 	if err != nil {
 		return []byte{}, err
 	}
+	content := b.Bytes()
+	if name != "" {
+		if content, err = convertToGit(name, content, flags); err != nil {
+			return []byte{}, err
+		}
+	}
+	return newBlob(content), nil
+}
+
+// Return content formatted in a blob fashion: <type> <size>\x00<content>
+func newBlob(content []byte) []byte {
 	blob := objects.NewBlobObject(
 		objects.ObjectHeader{
 			Type:   "blob",
-			Length: fmt.Sprintf("%d", b.Len()),
+			Length: fmt.Sprintf("%d", len(content)),
 		},
-		b.String(),
+		string(content),
 	)
-	return blob.ToByteSlice(), nil
+	return blob.ToByteSlice()
 }
 
-// Return the sha1hash of the content
+// Return the hash of the content, sha1 unless the repository uses the sha256 object format
 func calculateObjectHash(content []byte) ([]byte, error) {
-	h := sha1.New()
+	h := newObjectHash()
 	if _, e := h.Write(content); e != nil {
 		return []byte{}, e
 	}
@@ -388,6 +661,14 @@ func decodeBlobObject(filePath string) (objects.BlobObject, error) {
 	}, nil
 }
 
+// Return a new hash of the object format of the repository
+func newObjectHash() hash.Hash {
+	if format, _ := configValue("extensions.objectformat"); strings.EqualFold(format, "sha256") {
+		return sha256.New()
+	}
+	return sha1.New()
+}
+
 // Decode a zlib encoded content from file
 func decodeFileWithZlib(file *os.File) ([]byte, error) {
 	// Put the file data in a buffer we can read from
@@ -403,8 +684,55 @@ func decodeFileWithZlib(file *os.File) ([]byte, error) {
 	}
 	defer r.Close()
 	// Read the data from the zlib reader
-	decoded := make([]byte, 1024)
-	count, _ := r.Read(decoded)
-	decoded = decoded[:count]
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return []byte{}, fmt.Errorf("error while reading encoded data: %s", err)
+	}
 	return decoded, nil
 }
+
+// Return the type and the content, without its header, of an object of the .git/objects directory
+func readObject(hash string) (string, []byte, error) {
+	if len(hash) < 4 {
+		return "", nil, fmt.Errorf("not a valid object name %s", hash)
+	}
+	fileHandle, err := os.Open(repo.Path("objects", hash[:2], hash[2:]))
+	if err != nil {
+		return "", nil, fmt.Errorf("not a valid object name %s", hash)
+	}
+	defer fileHandle.Close()
+	decoded, err := decodeFileWithZlib(fileHandle)
+	if err != nil {
+		return "", nil, err
+	}
+	header, content, found := bytes.Cut(decoded, []byte{0})
+	if !found {
+		return "", nil, fmt.Errorf("object %s is corrupt: no header", hash)
+	}
+	objectType, _, _ := strings.Cut(string(header), " ")
+	return objectType, content, nil
+}
+
+// Return the object an annotated tag points to, following tags of tags, or "" when hash isn't a tag
+// It is the refs.PeelFunc used when packing refs
+func peelTag(hash string) (string, error) {
+	peeled := ""
+	for i := 0; ; i++ {
+		objectType, content, err := readObject(hash)
+		if err != nil {
+			return "", err
+		}
+		if objectType != "tag" {
+			return peeled, nil
+		}
+		if i >= 10 {
+			return "", fmt.Errorf("tag %s nested too deeply", hash)
+		}
+		target, found := bytes.CutPrefix(content, []byte("object "))
+		if !found {
+			return "", fmt.Errorf("tag %s is corrupt: no object header", hash)
+		}
+		hash, _, _ = strings.Cut(string(target), "\n")
+		peeled = hash
+	}
+}
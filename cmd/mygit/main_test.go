@@ -5,6 +5,8 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	objects "github.com/codecrafters-io/git-starter-go/objects"
@@ -121,6 +123,87 @@ func TestMyGit_Init(t *testing.T) {
 	}
 }
 
+// Test that init --bare creates the repository in the dir itself, and that init again keeps its HEAD
+func TestMyGit_InitBare(t *testing.T) {
+	bare := TEMPDIR + "bare.git"
+	cmd := exec.Command(APP, "init", "--bare", "--initial-branch=trunk", bare)
+	_, err := cmd.Output()
+	util.Check(err)
+	head, err := os.ReadFile(bare + "/HEAD")
+	util.Check(err)
+	if string(head) != "ref: refs/heads/trunk\n" {
+		log.Fatalf("unexpected HEAD, got: %q", head)
+	}
+	out, err := exec.Command(APP, "config", "--file", bare+"/config", "--get", "core.bare").Output()
+	util.Check(err)
+	if string(out) != "true\n" {
+		log.Fatalf("unexpected core.bare, got: %q", out)
+	}
+
+	out, err = exec.Command(APP, "init", "--bare", "--initial-branch=other", bare).Output()
+	util.Check(err)
+	if !strings.HasPrefix(string(out), "Reinitialized existing Git repository") {
+		log.Fatalf("unexpected output, got: %q", out)
+	}
+	head, err = os.ReadFile(bare + "/HEAD")
+	util.Check(err)
+	if string(head) != "ref: refs/heads/trunk\n" {
+		log.Fatalf("init again changed HEAD to: %q", head)
+	}
+
+	// The initial branch is a valid ref name
+	for _, branch := range []string{"a/.b", "a//b", "x@{y}", "end.", "end/"} {
+		cmd := exec.Command(APP, "init", "--bare", "--initial-branch="+branch, TEMPDIR+"invalid.git")
+		stderr := new(strings.Builder)
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err == nil || stderr.String() != "fatal: invalid initial branch name: '"+branch+"'\n" {
+			log.Fatalf("expected %q to be refused, got: %v %q", branch, err, stderr.String())
+		}
+	}
+}
+
+// Test that init --ref-format=reftable stores the refs in a reftable stack, leaving stubs for older tools
+func TestMyGit_InitReftable(t *testing.T) {
+	dir := TEMPDIR + "reftable"
+	util.Check(os.RemoveAll(dir))
+	run := func(args ...string) string {
+		cmd := exec.Command(APP, args...)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		util.Check(err)
+		return string(out)
+	}
+	util.Check(util.Mkdir(0755, dir))
+	run("init", "-q", "--ref-format=reftable", "--initial-branch=trunk")
+	head, err := os.ReadFile(dir + "/.git/HEAD")
+	util.Check(err)
+	if string(head) != "ref: refs/heads/.invalid\n" {
+		log.Fatalf("unexpected HEAD file, got: %q", head)
+	}
+	if _, err := os.Stat(dir + "/.git/reftable/tables.list"); err != nil {
+		log.Fatalf("expected a reftable stack: %s", err)
+	}
+	if out := run("symbolic-ref", "HEAD"); out != "refs/heads/trunk\n" {
+		log.Fatalf("unexpected HEAD, got: %q", out)
+	}
+	util.Check(util.Mkfile([]string{dir + "/file.txt"}, [][]byte{[]byte("hello\n")}, 0644))
+	hash := strings.TrimSpace(run("hash-object", "-w", "file.txt"))
+	run("update-ref", "HEAD", hash)
+	run("update-ref", "refs/tags/v1", hash)
+	if out := run("show-ref"); out != hash+" refs/heads/trunk\n"+hash+" refs/tags/v1\n" {
+		log.Fatalf("unexpected refs, got: %q", out)
+	}
+	run("pack-refs", "--all")
+	if out := run("rev-parse", "trunk"); out != hash+"\n" {
+		log.Fatalf("unexpected trunk after pack-refs, got: %q", out)
+	}
+	cmd := exec.Command(APP, "init", "--ref-format=files")
+	cmd.Dir = dir
+	if err := cmd.Run(); err == nil {
+		log.Fatalf("expected init to refuse changing the ref format")
+	}
+}
+
 // Test that the app properly hashes objects, this one only tests for file hashing
 func TestMyGit_HashObject(t *testing.T) {
 	for _, tc := range TestCaseHashObject {
@@ -179,6 +262,1092 @@ func TestMyGit_CatFile(t *testing.T) {
 	}
 }
 
+// Test that add stages executables, symlinks and nested dirs with their own mode and skips empty dirs,
+// and that write-tree writes them from the index, only writing the subtree given with --prefix
+func TestMyGit_WriteTree(t *testing.T) {
+	err := os.Chdir(TEMPDIR1)
+	util.Check(err)
+	err = util.Mkdir(0755, "tree_test/sub/deep", "tree_test/empty")
+	util.Check(err)
+	err = util.Mkfile(
+		[]string{"tree_test/a.txt", "tree_test/run.sh", "tree_test/sub/deep/d.txt", "tree_test/sub-file"},
+		[][]byte{[]byte("hello\n"), []byte("#!/bin/sh\n"), []byte("x\n"), []byte("y\n")},
+		0644,
+	)
+	util.Check(err)
+	util.Check(os.Chmod("tree_test/run.sh", 0755))
+	util.Check(os.Symlink("a.txt", "tree_test/link"))
+
+	// The tree is written from the index
+	_, err = useMyGit("add", "tree_test")
+	util.Check(err)
+
+	// Hash given by git for the same tree
+	expected := "b15bd7e866f3e6455b167e20eb29466d22680233"
+	hash, err := useWriteTree("--prefix=tree_test/")
+	util.Check(err)
+	if hash != expected {
+		log.Fatalf("unexpected tree hash, got: %s expected: %s", hash, expected)
+	}
+}
+
+// Test that commands find the repository from a subdirectory, or from the path given with -C
+func TestMyGit_Subdirectory(t *testing.T) {
+	cmd := exec.Command(APP, "write-tree", "--prefix=tree_test")
+	cmd.Dir = TEMPDIR1 + "/tree_test/sub"
+	hash, err := cmd.Output()
+	util.Check(err)
+	if string(hash) != "b15bd7e866f3e6455b167e20eb29466d22680233" {
+		log.Fatalf("unexpected tree hash from a subdirectory, got: %s", hash)
+	}
+
+	out, err := exec.Command(APP, "-C", TEMPDIR1+"/tree_test/sub/deep", "rev-parse", "--show-prefix", "--show-cdup").Output()
+	util.Check(err)
+	if string(out) != "tree_test/sub/deep/\n../../../\n" {
+		log.Fatalf("unexpected rev-parse output, got: %q", out)
+	}
+}
+
+var TestCaseRepositoryFormat = []struct {
+	Description string
+	Config      string
+	Refused     bool
+}{
+	{Description: "version 0 ignores unknown extensions", Config: "[core]\n\trepositoryformatversion = 0\n[extensions]\n\tfoo = bar\n"},
+	{Description: "version 1 with known extensions", Config: "[core]\n\trepositoryformatversion = 1\n[extensions]\n\tobjectformat = sha1\n\tworktreeconfig = true\n"},
+	{Description: "unknown version", Config: "[core]\n\trepositoryformatversion = 2\n", Refused: true},
+	{Description: "unknown extension", Config: "[core]\n\trepositoryformatversion = 1\n[extensions]\n\tfoo = bar\n", Refused: true},
+	{Description: "partial clone without promisor support", Config: "[core]\n\trepositoryformatversion = 1\n[extensions]\n\tpartialclone = origin\n", Refused: true},
+	{Description: "v1-only extension in version 0", Config: "[core]\n\trepositoryformatversion = 0\n[extensions]\n\tobjectformat = sha1\n", Refused: true},
+	{Description: "unknown object format", Config: "[core]\n\trepositoryformatversion = 1\n[extensions]\n\tobjectformat = md5\n", Refused: true},
+}
+
+// Test that commands refuse to run in a repository whose format isn't understood
+func TestMyGit_RepositoryFormat(t *testing.T) {
+	dir := TEMPDIR + "format"
+	util.Check(exec.Command(APP, "init", "-q", dir).Run())
+	for _, tc := range TestCaseRepositoryFormat {
+		t.Run(tc.Description, func(t *testing.T) {
+			util.Check(util.Mkfile([]string{dir + "/.git/config"}, [][]byte{[]byte(tc.Config)}, 0644))
+			cmd := exec.Command(APP, "write-tree")
+			cmd.Dir = dir
+			err := cmd.Run()
+			if tc.Refused && err == nil {
+				log.Fatalf("expected write-tree to be refused")
+			} else if !tc.Refused && err != nil {
+				log.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+var TestCaseCommitTree = []struct {
+	Description  string
+	Args         []string
+	Stdin        string
+	ExpectedHash string
+}{
+	{
+		Description:  "root commit",
+		Args:         []string{"b15bd7e866f3e6455b167e20eb29466d22680233", "-m", "first commit"},
+		ExpectedHash: "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71",
+	},
+	{
+		Description:  "message from stdin",
+		Args:         []string{"b15bd7e866f3e6455b167e20eb29466d22680233", "-p", "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71"},
+		Stdin:        "second",
+		ExpectedHash: "48bc9ef9f98bd4bef2597cb2ab74b5ba9f49667a",
+	},
+	{
+		Description: "merge with paragraphs",
+		Args: []string{"b15bd7e866f3e6455b167e20eb29466d22680233",
+			"-p", "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71", "-p", "48bc9ef9f98bd4bef2597cb2ab74b5ba9f49667a",
+			"-m", "merge", "-m", "body"},
+		ExpectedHash: "932b6c9b683318cb744191978027d606382c0574",
+	},
+}
+
+// Test that commit-tree writes root commits and merges the way git does
+// This test relies on the tree written by the write-tree test
+func TestMyGit_CommitTree(t *testing.T) {
+	for _, tc := range TestCaseCommitTree {
+		t.Run(tc.Description, func(t *testing.T) {
+			hash, err := useCommitTree(tc.Stdin, tc.Args...)
+			util.Check(err)
+			if hash != tc.ExpectedHash {
+				log.Fatalf("unexpected commit hash, got: %s expected: %s", hash, tc.ExpectedHash)
+			}
+		})
+	}
+}
+
+var TestCaseUpdateRef = []struct {
+	Description string
+	Args        []string
+	Fails       bool
+}{
+	{Description: "create a branch", Args: []string{"update-ref", "refs/heads/main", "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71"}},
+	{Description: "move it by its short name", Args: []string{"update-ref", "refs/heads/main", "48bc9ef9", "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71"}},
+	{Description: "refuse a stale old value", Args: []string{"update-ref", "refs/heads/main", "932b6c9b", "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71"}, Fails: true},
+	{Description: "refuse to create an existing ref", Args: []string{"update-ref", "refs/heads/main", "932b6c9b", ""}, Fails: true},
+	{Description: "create with a reason", Args: []string{"update-ref", "-m", "merge", "refs/heads/topic", "932b6c9b"}},
+	{Description: "pack them", Args: []string{"pack-refs", "--all"}},
+	{Description: "delete a packed ref", Args: []string{"update-ref", "-d", "refs/heads/topic"}},
+	{Description: "refuse an invalid name", Args: []string{"update-ref", "refs/heads/a..b", "main"}, Fails: true},
+}
+
+// Test that update-ref checks old values, and that show-ref lists the loose and packed refs
+// This test relies on the commits written by the commit-tree test
+func TestMyGit_UpdateRef(t *testing.T) {
+	for _, tc := range TestCaseUpdateRef {
+		t.Run(tc.Description, func(t *testing.T) {
+			_, err := useMyGit(tc.Args...)
+			if tc.Fails && err == nil {
+				log.Fatalf("expected %v to fail", tc.Args)
+			}
+			if !tc.Fails {
+				util.Check(err)
+			}
+		})
+	}
+	out, err := useMyGit("show-ref")
+	util.Check(err)
+	if expected := "48bc9ef9f98bd4bef2597cb2ab74b5ba9f49667a refs/heads/main\n"; out != expected {
+		log.Fatalf("unexpected show-ref output, got: %q expected: %q", out, expected)
+	}
+	out, err = useMyGit("rev-parse", "HEAD")
+	util.Check(err)
+	if expected := "48bc9ef9f98bd4bef2597cb2ab74b5ba9f49667a\n"; out != expected {
+		log.Fatalf("unexpected HEAD, got: %q expected: %q", out, expected)
+	}
+}
+
+// Test that update-ref --stdin applies every update of a transaction, or none of them
+// This test relies on the refs written by the update-ref test
+func TestMyGit_UpdateRefStdin(t *testing.T) {
+	out, err := useMyGitStdin("start\n"+
+		"create refs/heads/topic 932b6c9b683318cb744191978027d606382c0574\n"+
+		"update refs/heads/main bddfc7d0c478fa3738272cfbb1dbcdbca8058e71 48bc9ef9f98bd4bef2597cb2ab74b5ba9f49667a\n"+
+		"verify refs/tags/none\n"+
+		"prepare\ncommit\n", "update-ref", "--stdin")
+	util.Check(err)
+	if expected := "start: ok\nprepare: ok\ncommit: ok\n"; out != expected {
+		log.Fatalf("unexpected update-ref --stdin output, got: %q expected: %q", out, expected)
+	}
+	// refs/heads/main/x can't be created next to refs/heads/main, so refs/heads/other isn't created either
+	if _, err := useMyGitStdin("create refs/heads/other 932b6c9b\ncreate refs/heads/main/x 932b6c9b\n", "update-ref", "--stdin"); err == nil {
+		log.Fatalf("expected a conflict between refs/heads/main and refs/heads/main/x")
+	}
+	out, err = useMyGit("show-ref", "--heads")
+	util.Check(err)
+	expected := "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71 refs/heads/main\n" +
+		"932b6c9b683318cb744191978027d606382c0574 refs/heads/topic\n"
+	if out != expected {
+		log.Fatalf("unexpected refs, got: %q expected: %q", out, expected)
+	}
+}
+
+var TestCaseReflog = []struct {
+	Revision     string
+	ExpectedHash string
+}{
+	{"main@{0}", "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71"},
+	{"main@{1}", "48bc9ef9f98bd4bef2597cb2ab74b5ba9f49667a"},
+	{"HEAD@{2}", "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71"},
+	{"@{1}", "48bc9ef9f98bd4bef2597cb2ab74b5ba9f49667a"},
+	{"main@{1 hour ago}", "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71"},
+}
+
+// Test that the updates of the branch HEAD points to are recorded in both reflogs
+// This test relies on the refs written by the update-ref tests
+func TestMyGit_Reflog(t *testing.T) {
+	out, err := useMyGit("reflog", "show", "main")
+	util.Check(err)
+	expected := "bddfc7d main@{0}: \n48bc9ef main@{1}: \nbddfc7d main@{2}: \n"
+	if out != expected {
+		log.Fatalf("unexpected reflog, got: %q expected: %q", out, expected)
+	}
+	for _, tc := range TestCaseReflog {
+		t.Run(tc.Revision, func(t *testing.T) {
+			hash, err := useMyGit("rev-parse", tc.Revision)
+			util.Check(err)
+			if hash != tc.ExpectedHash+"\n" {
+				log.Fatalf("unexpected hash, got: %s expected: %s", hash, tc.ExpectedHash)
+			}
+		})
+	}
+	if _, err := useMyGit("rev-parse", "main@{3}"); err == nil {
+		log.Fatalf("expected main@{3} to be past the end of the reflog")
+	}
+}
+
+var TestCaseBranch = []struct {
+	Description string
+	Args        []string
+	Expected    string
+	Fails       bool
+}{
+	{Description: "list", Args: []string{"branch"}, Expected: "* main\n  topic\n"},
+	{Description: "create", Args: []string{"branch", "feature", "48bc9ef9"}},
+	{Description: "refuse an existing name", Args: []string{"branch", "feature"}, Fails: true},
+	{Description: "merged into topic", Args: []string{"branch", "--merged", "topic"}, Expected: "  feature\n* main\n  topic\n"},
+	{Description: "not merged into HEAD", Args: []string{"branch", "--no-merged"}, Expected: "  feature\n  topic\n"},
+	{Description: "containing a commit", Args: []string{"branch", "--contains", "48bc9ef9"}, Expected: "  feature\n  topic\n"},
+	{Description: "set the upstream", Args: []string{"branch", "--set-upstream-to=topic", "feature"}, Expected: "branch 'feature' set up to track 'topic'.\n"},
+	{Description: "verbose with upstream", Args: []string{"branch", "-vv"}, Expected: "" +
+		"  feature 48bc9ef [topic: behind 1] second\n" +
+		"* main    bddfc7d first commit\n" +
+		"  topic   932b6c9 merge\n"},
+	{Description: "rename with its upstream", Args: []string{"branch", "-m", "feature", "renamed"}},
+	{Description: "upstream of the renamed branch", Args: []string{"branch", "-v", "--list", "re*"}, Expected: "  renamed 48bc9ef [behind 1] second\n"},
+	{Description: "refuse to delete an unmerged branch", Args: []string{"branch", "-d", "topic"}, Fails: true},
+	{Description: "force the deletion", Args: []string{"branch", "-D", "topic"}, Expected: "Deleted branch topic (was 932b6c9).\n"},
+	{Description: "refuse to delete a branch unmerged into HEAD once its upstream is gone", Args: []string{"branch", "-d", "renamed"}, Fails: true},
+	{Description: "copy the current branch", Args: []string{"branch", "-c", "copy"}},
+	{Description: "list after the copy", Args: []string{"branch"}, Expected: "  copy\n* main\n  renamed\n"},
+}
+
+// Test that branch creates, filters, renames and deletes branches, and follows their upstream
+// This test relies on the refs written by the update-ref tests
+func TestMyGit_Branch(t *testing.T) {
+	for _, tc := range TestCaseBranch {
+		t.Run(tc.Description, func(t *testing.T) {
+			out, err := useMyGit(tc.Args...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			if out != tc.Expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, tc.Expected)
+			}
+		})
+	}
+}
+
+var TestCaseTag = []struct {
+	Description string
+	Args        []string
+	Expected    string
+	Fails       bool
+}{
+	{Description: "lightweight", Args: []string{"tag", "v1.9", "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71"}},
+	{Description: "lightweight by abbreviated name", Args: []string{"tag", "v1.10", "48bc9ef9"}},
+	{Description: "annotated", Args: []string{"tag", "-m", "Release 2.0-rc1", "v2.0-rc1", "932b6c9b"}},
+	{Description: "lightweight on the same commit", Args: []string{"tag", "v2.0", "932b6c9b"}},
+	{Description: "list by name", Args: []string{"tag"}, Expected: "v1.10\nv1.9\nv2.0\nv2.0-rc1\n"},
+	{Description: "list by version", Args: []string{"tag", "--sort=version:refname"}, Expected: "v1.9\nv1.10\nv2.0\nv2.0-rc1\n"},
+	{Description: "release candidates first", Args: []string{"-c", "versionsort.suffix=-rc", "tag", "--sort=v:refname"}, Expected: "v1.9\nv1.10\nv2.0-rc1\nv2.0\n"},
+	{Description: "latest version first", Args: []string{"tag", "--sort=-v:refname", "-l", "v1*"}, Expected: "v1.10\nv1.9\n"},
+	{Description: "with their message", Args: []string{"tag", "-n", "-l", "v2*"}, Expected: "v2.0            merge\nv2.0-rc1        Release 2.0-rc1\n"},
+	{Description: "containing a commit", Args: []string{"tag", "--contains", "48bc9ef9"}, Expected: "v1.10\nv2.0\nv2.0-rc1\n"},
+	{Description: "pointing at a commit", Args: []string{"tag", "--points-at", "932b6c9b"}, Expected: "v2.0\nv2.0-rc1\n"},
+	{Description: "refuse an existing tag", Args: []string{"tag", "v1.9", "48bc9ef9"}, Fails: true},
+	{Description: "force an existing tag", Args: []string{"tag", "-f", "v1.9", "48bc9ef9"}, Expected: "Updated tag 'v1.9' (was bddfc7d)\n"},
+	{Description: "refuse an invalid name", Args: []string{"tag", "v1..0"}, Fails: true},
+	{Description: "delete", Args: []string{"tag", "-d", "v1.9"}, Expected: "Deleted tag 'v1.9' (was 48bc9ef)\n"},
+	{Description: "delete a missing tag", Args: []string{"tag", "-d", "v1.9"}, Fails: true},
+}
+
+// Test that tag creates, sorts, filters and deletes tags
+// This test relies on the commits written by the commit-tree test
+func TestMyGit_Tag(t *testing.T) {
+	for _, tc := range TestCaseTag {
+		t.Run(tc.Description, func(t *testing.T) {
+			out, err := useMyGit(tc.Args...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			if out != tc.Expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, tc.Expected)
+			}
+		})
+	}
+	hash, err := useMyGit("rev-parse", "v2.0-rc1")
+	util.Check(err)
+	out, err := useMyGit("cat-file", "-t", strings.TrimSpace(hash))
+	util.Check(err)
+	if out != "tag" {
+		log.Fatalf("expected v2.0-rc1 to be a tag object, got: %q", out)
+	}
+}
+
+var TestCaseForEachRef = []struct {
+	Description string
+	Args        []string
+	Expected    string
+	Fails       bool
+}{
+	{Description: "default format", Args: []string{"for-each-ref", "refs/heads"}, Expected: "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71 commit\trefs/heads/copy\n" +
+		"bddfc7d0c478fa3738272cfbb1dbcdbca8058e71 commit\trefs/heads/main\n48bc9ef9f98bd4bef2597cb2ab74b5ba9f49667a commit\trefs/heads/renamed\n"},
+	{Description: "short names and subjects", Args: []string{"for-each-ref", "--format=%(refname:short) %(objectname:short) %(subject)", "refs/tags/v2*"},
+		Expected: "v2.0 932b6c9 merge\nv2.0-rc1 %s Release 2.0-rc1\n"},
+	{Description: "peeled tags", Args: []string{"for-each-ref", "--format=%(if)%(*objectname)%(then)%(*objectname:short) %(*objecttype)%(else)-%(end)", "refs/tags"},
+		Expected: "-\n-\n932b6c9 commit\n"},
+	{Description: "sorted and counted", Args: []string{"for-each-ref", "--sort=-refname", "--count=2", "--format=%(refname)"}, Expected: "refs/tags/v2.0-rc1\nrefs/tags/v2.0\n"},
+	{Description: "committer date", Args: []string{"for-each-ref", "--format=%(committerdate:iso)|%(contents:body)|", "refs/heads/main"}, Expected: "2000-01-01 00:00:00 +0000||\n"},
+	{Description: "merged", Args: []string{"for-each-ref", "--merged", "bddfc7d0", "--format=%(refname)"}, Expected: "refs/heads/copy\nrefs/heads/main\n"},
+	{Description: "containing a commit", Args: []string{"for-each-ref", "--contains", "932b6c9b", "--format=%(refname:short)"}, Expected: "v2.0\nv2.0-rc1\n"},
+	{Description: "pointing at a commit", Args: []string{"for-each-ref", "--points-at", "48bc9ef9", "--format=%(refname)"}, Expected: "refs/heads/renamed\nrefs/tags/v1.10\n"},
+	{Description: "shell quoting", Args: []string{"for-each-ref", "--shell", "--format=%(refname) %(subject)", "refs/heads/renamed"}, Expected: "'refs/heads/renamed' 'second'\n"},
+	{Description: "refuse an unknown atom", Args: []string{"for-each-ref", "--format=%(bogus)"}, Fails: true},
+	{Description: "refuse an unclosed if", Args: []string{"for-each-ref", "--format=%(if)%(refname)%(then)x"}, Fails: true},
+}
+
+// Test that for-each-ref formats, sorts and filters the refs
+// This test relies on the branches and tags written by the branch and tag tests
+func TestMyGit_ForEachRef(t *testing.T) {
+	tagHash, err := useMyGit("rev-parse", "v2.0-rc1")
+	util.Check(err)
+	for _, tc := range TestCaseForEachRef {
+		t.Run(tc.Description, func(t *testing.T) {
+			out, err := useMyGit(tc.Args...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			// The annotated tag object depends on when it was written
+			expected := strings.ReplaceAll(tc.Expected, "%s", strings.TrimSpace(tagHash)[:7])
+			if out != expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, expected)
+			}
+		})
+	}
+}
+
+var TestCaseUpdateIndex = []struct {
+	Description string
+	Args        []string
+	Expected    string
+	Fails       bool
+}{
+	{Description: "refuse a new path without --add", Args: []string{"update-index", "test.txt"}, Fails: true},
+	{Description: "add files", Args: []string{"update-index", "--add", "test.txt", "tree_test/a.txt"}},
+	{Description: "add an object", Args: []string{"update-index", "--add", "--cacheinfo", "100644,0501091fcf64fe2b351473f1abb3a6fcb967ee93,other.txt"}},
+	{Description: "make executable", Args: []string{"update-index", "--chmod=+x", "other.txt"}, Fails: true},
+	{Description: "make a staged file executable", Args: []string{"update-index", "--chmod=+x", "test.txt"}},
+	{Description: "refuse a file under a file", Args: []string{"update-index", "--add", "--cacheinfo", "100644", "0501091fcf64fe2b351473f1abb3a6fcb967ee93", "test.txt/x"}, Fails: true},
+	{Description: "list the stages", Args: []string{"ls-files", "--stage", "other.txt", "test.txt", "tree_test/a.txt"}, Expected: "100644 0501091fcf64fe2b351473f1abb3a6fcb967ee93 0\tother.txt\n" +
+		"100755 3b18e512dba79e4c8300dd08aeb37f8e728b8dad 0\ttest.txt\n100644 ce013625030ba8dba906f756967f9e9ca394464a 0\ttree_test/a.txt\n"},
+	{Description: "list a directory", Args: []string{"ls-files", "tree_test/sub"}, Expected: "tree_test/sub/deep/d.txt\n"},
+	{Description: "keep a missing path without --remove", Args: []string{"update-index", "other.txt"}, Fails: true},
+	{Description: "remove a missing path", Args: []string{"update-index", "--remove", "other.txt"}},
+	{Description: "force the removal", Args: []string{"update-index", "--force-remove", "tree_test/a.txt"}},
+	{Description: "list what is left", Args: []string{"ls-files", "other.txt", "test.txt", "tree_test/a.txt"}, Expected: "test.txt\n"},
+}
+
+// Test that update-index stages files and objects, and that ls-files lists them
+// This test relies on the files written by the hash-object and write-tree tests
+func TestMyGit_UpdateIndex(t *testing.T) {
+	for _, tc := range TestCaseUpdateIndex {
+		t.Run(tc.Description, func(t *testing.T) {
+			out, err := useMyGit(tc.Args...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			if out != tc.Expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, tc.Expected)
+			}
+		})
+	}
+	if _, err := os.Stat(TEMPDIR1 + "/.git/index.lock"); !os.IsNotExist(err) {
+		log.Fatalf("expected the index lock to be released")
+	}
+}
+
+// Test that add stages new, changed and deleted files, and that write-tree writes what it staged
+func TestMyGit_Add(t *testing.T) {
+	dir := TEMPDIR1 + "/add_test"
+	util.Check(util.Mkdir(0755, dir+"/sub"))
+	util.Check(util.Mkfile([]string{dir + "/a.txt", dir + "/sub/b.txt"}, [][]byte{[]byte("a\n"), []byte("b\n")}, 0644))
+	steps := []struct {
+		Description string
+		Args        []string
+		Expected    string
+		Fails       bool
+		// Run before the command
+		Prepare func()
+	}{
+		{Description: "nothing specified", Args: []string{"add"}},
+		{Description: "refuse an unknown path", Args: []string{"add", "add_test/missing"}, Fails: true},
+		{Description: "dry run", Args: []string{"add", "-n", "add_test"}, Expected: "add 'add_test/a.txt'\nadd 'add_test/sub/b.txt'\n"},
+		{Description: "dry run stages nothing", Args: []string{"ls-files", "add_test"}},
+		{Description: "add a directory", Args: []string{"add", "-v", "add_test"}, Expected: "add 'add_test/a.txt'\nadd 'add_test/sub/b.txt'\n"},
+		{Description: "unchanged files", Args: []string{"add", "-v", "add_test"}},
+		{
+			Description: "tracked files only", Args: []string{"add", "-u", "-v", "add_test"}, Expected: "add 'add_test/a.txt'\nremove 'add_test/sub/b.txt'\n",
+			Prepare: func() {
+				util.Check(os.WriteFile(dir+"/a.txt", []byte("changed\n"), 0644))
+				util.Check(os.WriteFile(dir+"/c.txt", []byte("c\n"), 0644))
+				util.Check(os.Remove(dir + "/sub/b.txt"))
+			},
+		},
+		{
+			Description: "the tracked files come first", Args: []string{"add", "-n", "add_test/0.txt", "add_test/a.txt"},
+			Expected: "add 'add_test/a.txt'\nadd 'add_test/0.txt'\n",
+			Prepare: func() {
+				util.Check(os.WriteFile(dir+"/a.txt", []byte("changed again\n"), 0644))
+				util.Check(os.WriteFile(dir+"/0.txt", []byte("0\n"), 0644))
+			},
+		},
+		{
+			Description: "intent to add", Args: []string{"add", "-N", "add_test/c.txt"},
+			Prepare: func() {
+				util.Check(os.WriteFile(dir+"/a.txt", []byte("changed\n"), 0644))
+				util.Check(os.Remove(dir + "/0.txt"))
+			},
+		},
+		{Description: "executable", Args: []string{"add", "--chmod=+x", "add_test/a.txt"}},
+		{Description: "list", Args: []string{"ls-files", "--stage", "add_test"}, Expected: "100755 5ea2ed416fbd4a4cbe227b75fe255dd7fa6bd4d6 0\tadd_test/a.txt\n" +
+			"100644 e69de29bb2d1d6434b8b29ae775ad8c2e48c5391 0\tadd_test/c.txt\n"},
+		{Description: "write the tree", Args: []string{"write-tree", "--prefix=add_test"}, Fails: true},
+		{Description: "stage the content", Args: []string{"add", "-v", "add_test/c.txt"}, Expected: "add 'add_test/c.txt'\n"},
+		// Hash given by git for the same tree
+		{Description: "write the staged tree", Args: []string{"write-tree", "--prefix=add_test"}, Expected: "29367a0d6bf7fd43237257f80a856ab184d056bb"},
+	}
+	for _, tc := range steps {
+		t.Run(tc.Description, func(t *testing.T) {
+			if tc.Prepare != nil {
+				tc.Prepare()
+			}
+			out, err := useMyGit(tc.Args...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			if out != tc.Expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, tc.Expected)
+			}
+		})
+	}
+}
+
+var TestCasePathspec = []struct {
+	Description string
+	Args        []string
+	Expected    string
+	Fails       bool
+}{
+	{Description: "wildcards match slashes", Args: []string{"ls-files", "tree_test/*.sh", ":(icase)ADD_TEST/A.TXT"}, Expected: "add_test/a.txt\ntree_test/run.sh\n"},
+	{Description: "glob and exclude", Args: []string{"ls-files", ":(glob)*/*", ":!tree_test"}, Expected: "add_test/a.txt\nadd_test/c.txt\n"},
+	{Description: "error unmatch", Args: []string{"ls-files", "--error-unmatch", "missing"}, Fails: true},
+	{Description: "invalid magic", Args: []string{"ls-files", ":(unknown)a"}, Fails: true},
+	{Description: "list a tree", Args: []string{"ls-tree", "b15bd7e866f3e6455b167e20eb29466d22680233"}, Expected: "100644 blob ce013625030ba8dba906f756967f9e9ca394464a\ta.txt\n" +
+		"120000 blob 8d14cbf983b3fad683171c9418998d9f68340823\tlink\n" +
+		"100755 blob 1a2485251c33a70432394c93fb89330ef214bfc9\trun.sh\n" +
+		"100644 blob 975fbec8256d3e8a3797e7a3611380f27c49f4ac\tsub-file\n" +
+		"040000 tree e8b9b37da269d30e9d583c5736dc6e83a792a424\tsub\n"},
+	{Description: "walk into the trees of the paths", Args: []string{"ls-tree", "b15bd7e866f3e6455b167e20eb29466d22680233", "sub/"}, Expected: "040000 tree b14616dd40a3fc8c9ec7e77253ef69e23ba04e33\tsub/deep\n"},
+	{Description: "sizes", Args: []string{"ls-tree", "-l", "b15bd7e866f3e6455b167e20eb29466d22680233", "link", "run.sh"}, Expected: "120000 blob 8d14cbf983b3fad683171c9418998d9f68340823       5\tlink\n" +
+		"100755 blob 1a2485251c33a70432394c93fb89330ef214bfc9      10\trun.sh\n"},
+	{Description: "recursive trees", Args: []string{"ls-tree", "-r", "-d", "--name-only", "b15bd7e866f3e6455b167e20eb29466d22680233"}, Expected: "sub\nsub/deep\n"},
+	{Description: "paths are literal", Args: []string{"ls-tree", "b15bd7e866f3e6455b167e20eb29466d22680233", "*.txt"}},
+	{Description: "not a tree", Args: []string{"ls-tree", "ce013625030ba8dba906f756967f9e9ca394464a"}, Fails: true},
+}
+
+func TestMyGit_Pathspec(t *testing.T) {
+	for _, tc := range TestCasePathspec {
+		t.Run(tc.Description, func(t *testing.T) {
+			out, err := useMyGit(tc.Args...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			if out != tc.Expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestMyGit_Status(t *testing.T) {
+	dir := TEMPDIR + "status_test"
+	util.Check(initRepo(dir))
+	lines := "line1\nline2\nline3\nline4\nline5\nline6\nline7\nline8\nline9\nline10\n"
+	util.Check(util.Mkfile([]string{dir + "/a.txt", dir + "/big.txt", dir + "/same.txt"}, [][]byte{[]byte("a\n"), []byte(lines), []byte("same\n")}, 0644))
+	status := func(args ...string) string {
+		out, err := useMyGit(append([]string{"-C", dir, "status"}, args...)...)
+		util.Check(err)
+		return out
+	}
+	if out := status("--porcelain"); out != "?? a.txt\n?? big.txt\n?? same.txt\n" {
+		log.Fatalf("unexpected untracked files, got: %q", out)
+	}
+	if out := status("--porcelain=v2", "--branch"); out != "# branch.oid (initial)\n# branch.head main\n? a.txt\n? big.txt\n? same.txt\n" {
+		log.Fatalf("unexpected initial branch, got: %q", out)
+	}
+	_, err := useMyGit("-C", dir, "add", ".")
+	util.Check(err)
+	tree, err := useMyGit("-C", dir, "write-tree")
+	util.Check(err)
+	cmd := exec.Command(APP, "-C", dir, "commit-tree", "-m", "first", strings.TrimSpace(tree))
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Valentin", "GIT_AUTHOR_EMAIL=valentinwissler42@outlook.com",
+		"GIT_COMMITTER_NAME=Valentin", "GIT_COMMITTER_EMAIL=valentinwissler42@outlook.com")
+	commit, err := cmd.Output()
+	util.Check(err)
+	_, err = useMyGit("-C", dir, "update-ref", "HEAD", strings.TrimSpace(string(commit)))
+	util.Check(err)
+	if out := status(); out != "On branch main\nnothing to commit, working tree clean\n" {
+		log.Fatalf("unexpected clean status, got: %q", out)
+	}
+
+	// Rename same.txt, rename big.txt with a change, and modify a.txt without staging it
+	util.Check(os.Rename(dir+"/same.txt", dir+"/renamed.txt"))
+	util.Check(os.Rename(dir+"/big.txt", dir+"/big2.txt"))
+	util.Check(os.WriteFile(dir+"/big2.txt", []byte(lines+"line11\n"), 0644))
+	_, err = useMyGit("-C", dir, "add", "-A")
+	util.Check(err)
+	util.Check(os.WriteFile(dir+"/a.txt", []byte("b\n"), 0644))
+	util.Check(util.Mkdir(0755, dir+"/u/v"))
+	util.Check(os.WriteFile(dir+"/u/v/u.txt", []byte("u\n"), 0644))
+	// Outputs given by git for the same changes
+	expected := "1 .M N... 100644 100644 100644 78981922613b2afb6025042ff6bd878ac1994e85 78981922613b2afb6025042ff6bd878ac1994e85 a.txt\n" +
+		"2 R. N... 100644 100644 100644 4083766a98b7d3e5e8e276f0f09c27ba1efe4d5c fa74a28a2ca8423179748c9fa18ceda028386481 R89 big2.txt\tbig.txt\n" +
+		"2 R. N... 100644 100644 100644 1275430f1765c63e539cb0452565563bd6aef6a6 1275430f1765c63e539cb0452565563bd6aef6a6 R100 renamed.txt\tsame.txt\n" +
+		"? u/\n"
+	if out := status("--porcelain=v2"); out != expected {
+		log.Fatalf("unexpected porcelain v2 status, got: %q expected: %q", out, expected)
+	}
+	expected = " M a.txt\nR  big.txt -> big2.txt\nR  same.txt -> renamed.txt\n?? u/v/u.txt\n"
+	if out := status("-s", "-uall"); out != expected {
+		log.Fatalf("unexpected short status, got: %q expected: %q", out, expected)
+	}
+	expected = " M a.txt\x00R  big2.txt\x00big.txt\x00R  renamed.txt\x00same.txt\x00?? u/\x00"
+	if out := status("-z"); out != expected {
+		log.Fatalf("unexpected -z status, got: %q expected: %q", out, expected)
+	}
+	if out := status("--no-renames", "--porcelain", "-uno", "big.txt", "big2.txt"); out != "D  big.txt\nA  big2.txt\n" {
+		log.Fatalf("unexpected status without renames, got: %q", out)
+	}
+	// A path holding a space is quoted where it could be taken for two paths
+	util.Check(os.WriteFile(dir+"/sp ace", []byte("space\n"), 0644))
+	for _, format := range []string{"--short", "--porcelain"} {
+		if out := status(format, "sp ace"); out != "?? \"sp ace\"\n" {
+			log.Fatalf("unexpected %s status of a path with a space, got: %q", format, out)
+		}
+	}
+	if out := status("--porcelain=v2", "sp ace"); out != "? sp ace\n" {
+		log.Fatalf("unexpected porcelain v2 status of a path with a space, got: %q", out)
+	}
+	if out := status("--porcelain", "-z", "sp ace"); out != "?? sp ace\x00" {
+		log.Fatalf("unexpected -z status of a path with a space, got: %q", out)
+	}
+}
+
+func TestMyGit_Ignore(t *testing.T) {
+	dir := TEMPDIR + "ignore_test"
+	util.Check(initRepo(dir))
+	util.Check(util.Mkdir(0755, dir+"/build", dir+"/logs", dir+"/sub/deep", dir+"/src", dir+"/.git/info"))
+	files := map[string]string{
+		".gitignore":         "*.o\nbuild/\n/root.txt\n!keep.o\nlogs\n!logs/important.log\n",
+		"sub/.gitignore":     "*.txt\n!keep.txt\n",
+		".git/info/exclude":  "# local\nsub/deep/\n",
+		"a.c":                "a\n",
+		"a.o":                "o\n",
+		"keep.o":             "k\n",
+		"root.txt":           "r\n",
+		"build/out":          "b\n",
+		"logs/important.log": "l\n",
+		"sub/a.txt":          "t\n",
+		"sub/keep.txt":       "t\n",
+		"sub/deep/b.c":       "b\n",
+		"src/root.txt":       "r\n",
+		"src/x.o":            "x\n",
+	}
+	for name, content := range files {
+		util.Check(os.WriteFile(dir+"/"+name, []byte(content), 0644))
+	}
+	steps := []struct {
+		Description string
+		// The files written before running the step
+		Write    map[string]string
+		Args     []string
+		Expected string
+		Fails    bool
+	}{
+		{Description: "ignored files aren't untracked", Args: []string{"status", "--porcelain"}, Expected: "?? .gitignore\n?? a.c\n?? keep.o\n?? src/\n?? sub/\n"},
+		// Outputs given by git for the same files
+		{Description: "ignored files", Args: []string{"status", "--porcelain", "--ignored=matching", "-uall"}, Expected: "?? .gitignore\n?? a.c\n?? keep.o\n" +
+			"?? src/root.txt\n?? sub/.gitignore\n?? sub/keep.txt\n!! a.o\n!! build/\n!! logs/\n!! root.txt\n!! src/x.o\n!! sub/a.txt\n!! sub/deep/\n"},
+		{Description: "explain the rules", Args: []string{"check-ignore", "-v", "-n", "a.o", "keep.o", "logs/important.log", "sub/a.txt", "sub/deep/b.c", "a.c"},
+			Expected: ".gitignore:1:*.o\ta.o\n.gitignore:4:!keep.o\tkeep.o\n.gitignore:5:logs\tlogs/important.log\n" +
+				"sub/.gitignore:1:*.txt\tsub/a.txt\n.git/info/exclude:2:sub/deep/\tsub/deep/b.c\n::\ta.c\n"},
+		{Description: "nothing ignored", Args: []string{"check-ignore", "a.c", "keep.o"}, Fails: true},
+		{Description: "refuse an ignored path", Args: []string{"add", "a.o", "a.c"}, Fails: true},
+		{Description: "the other paths are staged", Args: []string{"ls-files"}, Expected: "a.c\n"},
+		{Description: "skip the ignored files", Args: []string{"add", "-v", "."}, Expected: "add '.gitignore'\nadd 'keep.o'\nadd 'src/root.txt'\n" +
+			"add 'sub/.gitignore'\nadd 'sub/keep.txt'\n"},
+		{Description: "force", Args: []string{"add", "-f", "-v", "a.o"}, Expected: "add 'a.o'\n"},
+		{Description: "tracked files aren't ignored", Args: []string{"check-ignore", "a.o"}, Fails: true},
+		{Description: "refuse to clean without force", Args: []string{"clean"}, Fails: true},
+		{Description: "clean the ignored files", Args: []string{"clean", "-n", "-X", "-d"}, Expected: "Would remove build/\nWould remove logs/\n" +
+			"Would remove root.txt\nWould remove src/x.o\nWould remove sub/a.txt\nWould remove sub/deep/\n"},
+		{Description: "the ignored files of an untracked directory", Write: map[string]string{"gen/.gitignore": "*.gen\n", "gen/x.gen": "x\n",
+			"gen/y.c": "y\n", "gen/g/1.gen": "1\n"}, Args: []string{"clean", "-nX"}, Expected: "Would remove gen/x.gen\n" +
+			"Would remove root.txt\nWould remove src/x.o\nWould remove sub/a.txt\n"},
+		{Description: "bundled flags", Args: []string{"clean", "-ndX"}, Expected: "Would remove build/\nWould remove gen/g/\n" +
+			"Would remove gen/x.gen\nWould remove logs/\nWould remove root.txt\nWould remove src/x.o\nWould remove sub/a.txt\n" +
+			"Would remove sub/deep/\n"},
+		{Description: "the untracked files", Args: []string{"clean", "-nd"}, Expected: "Would remove gen/.gitignore\nWould remove gen/y.c\n"},
+		{Description: "clean the ignored files", Args: []string{"clean", "-fX"}, Expected: "Removing gen/x.gen\nRemoving root.txt\n" +
+			"Removing src/x.o\nRemoving sub/a.txt\n"},
+		{Description: "clean the untracked files", Args: []string{"clean", "-fd"}, Expected: "Removing gen/.gitignore\nRemoving gen/y.c\n"},
+		{Description: "clean everything", Args: []string{"clean", "-fdx", "-e", "root.txt"}, Expected: "Removing build/\nRemoving gen/\n" +
+			"Removing logs/\nRemoving sub/deep/\n"},
+		{Description: "clean", Args: []string{"status", "--porcelain", "--ignored"}, Expected: "A  .gitignore\nA  a.c\nA  a.o\nA  keep.o\n" +
+			"A  src/root.txt\nA  sub/.gitignore\nA  sub/keep.txt\n"},
+	}
+	for _, tc := range steps {
+		t.Run(tc.Description, func(t *testing.T) {
+			for name, content := range tc.Write {
+				util.Check(os.MkdirAll(filepath.Dir(dir+"/"+name), 0755))
+				util.Check(os.WriteFile(dir+"/"+name, []byte(content), 0644))
+			}
+			out, err := useMyGit(append([]string{"-C", dir}, tc.Args...)...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			if out != tc.Expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestMyGit_Attributes(t *testing.T) {
+	dir := TEMPDIR + "attributes_test"
+	util.Check(initRepo(dir))
+	files := map[string]string{
+		".gitattributes": "[attr]crlf-text text eol=crlf\n*.txt text\n*.bin binary\n*.win crlf-text\n",
+		"crlf.txt":       "a\r\nb\r\n",
+		"data.bin":       "a\r\nb\r\n",
+		"lf.win":         "a\nb\n",
+	}
+	for name, content := range files {
+		util.Check(os.WriteFile(dir+"/"+name, []byte(content), 0644))
+	}
+	steps := []struct {
+		Description string
+		Args        []string
+		Expected    string
+		Fails       bool
+	}{
+		// Outputs given by git for the same files
+		{Description: "all the attributes", Args: []string{"check-attr", "-a", "crlf.txt", "data.bin", "lf.win"}, Expected: "crlf.txt: text: set\n" +
+			"data.bin: binary: set\ndata.bin: diff: unset\ndata.bin: merge: unset\ndata.bin: text: unset\n" +
+			"lf.win: text: set\nlf.win: crlf-text: set\nlf.win: eol: crlf\n"},
+		{Description: "some attributes", Args: []string{"check-attr", "text", "eol", "other", "--", "lf.win"}, Expected: "lf.win: text: set\n" +
+			"lf.win: eol: crlf\nlf.win: other: unspecified\n"},
+		{Description: "no file", Args: []string{"check-attr", "text"}, Fails: true},
+		{Description: "refuse to lose LF", Args: []string{"-c", "core.safecrlf=true", "add", "lf.win"}, Fails: true},
+		{Description: "normalize the line endings", Args: []string{"add", "."}},
+		{Description: "the text is stored with LF", Args: []string{"ls-files", "-s"}, Expected: "100644 c9653b2bd88d13ffbcaec32f2c9ae060344d4de6 0\t.gitattributes\n" +
+			"100644 422c2b7ab3b3c668038da977e4e93a5fc623169c 0\tcrlf.txt\n100644 c30dea8a3641ea99b125d04d599d843712292759 0\tdata.bin\n" +
+			"100644 422c2b7ab3b3c668038da977e4e93a5fc623169c 0\tlf.win\n"},
+		{Description: "written back with CRLF", Args: []string{"cat-file", "--filters", "--path=lf.win", "422c2b7ab3b3c668038da977e4e93a5fc623169c"}, Expected: "a\r\nb\r\n"},
+		{Description: "written back with LF", Args: []string{"cat-file", "--filters", "--path=crlf.txt", "422c2b7ab3b3c668038da977e4e93a5fc623169c"}, Expected: "a\nb\n"},
+		{Description: "nothing changed", Args: []string{"status", "--porcelain"}, Expected: "A  .gitattributes\nA  crlf.txt\nA  data.bin\nA  lf.win\n"},
+		{Description: "attr magic", Args: []string{"ls-files", ":(attr:binary)"}, Expected: "data.bin\n"},
+	}
+	for _, tc := range steps {
+		t.Run(tc.Description, func(t *testing.T) {
+			out, err := useMyGit(append([]string{"-C", dir}, tc.Args...)...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			if out != tc.Expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestMyGit_Filters(t *testing.T) {
+	dir := TEMPDIR + "filters_test"
+	util.Check(initRepo(dir))
+	files := map[string]string{
+		".gitattributes": "*.txt filter=up\n*.key filter=strict\n",
+		"a.txt":          "hello\n",
+		"s.key":          "k\n",
+	}
+	for name, content := range files {
+		util.Check(os.WriteFile(dir+"/"+name, []byte(content), 0644))
+	}
+	clean := []string{"-c", "filter.up.clean=tr a-z A-Z"}
+	steps := []struct {
+		Description string
+		Args        []string
+		Expected    string
+		Fails       bool
+	}{
+		// Outputs given by git for the same files
+		{Description: "clean", Args: append(clean, "add", "a.txt", ".gitattributes")},
+		{Description: "the blob is cleaned", Args: []string{"ls-files", "-s"}, Expected: "100644 74489c96c74822d3974517761ef1df19a08a25e9 0\t.gitattributes\n" +
+			"100644 e427984d4a2c1904681f2e2ee5980f37640d353f 0\ta.txt\n"},
+		{Description: "compare the cleaned file", Args: append(clean, "status", "--porcelain"), Expected: "A  .gitattributes\nA  a.txt\n?? s.key\n"},
+		{Description: "smudge", Args: []string{"-c", "filter.up.smudge=tr A-Z a-z", "cat-file", "--filters", "--path=a.txt",
+			"e427984d4a2c1904681f2e2ee5980f37640d353f"}, Expected: "hello\n"},
+		{Description: "a failing required filter", Args: []string{"-c", "filter.strict.clean=false", "-c", "filter.strict.required=true",
+			"add", "s.key"}, Fails: true},
+		{Description: "a missing required filter", Args: []string{"-c", "filter.strict.required=true", "add", "s.key"}, Fails: true},
+		{Description: "a failing filter", Args: []string{"-c", "filter.strict.clean=false", "add", "s.key"}},
+		{Description: "the file is added as it is", Args: []string{"ls-files", "-s", "s.key"}, Expected: "100644 b68fde2a051d9af2fe3ff4c96c0898e5a3212e4d 0\ts.key\n"},
+	}
+	for _, tc := range steps {
+		t.Run(tc.Description, func(t *testing.T) {
+			out, err := useMyGit(append([]string{"-C", dir}, tc.Args...)...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			if out != tc.Expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestMyGit_Encoding(t *testing.T) {
+	dir := TEMPDIR + "encoding_test"
+	util.Check(initRepo(dir))
+	files := map[string]string{
+		".gitattributes": "a.txt working-tree-encoding=UTF-16\nb.txt working-tree-encoding=UTF-16LE\ns.txt working-tree-encoding=SHIFT-JIS\n",
+		"a.txt":          "\xff\xfeh\x00\xe9\x00l\x00l\x00o\x00\n\x00",
+		"b.txt":          "\xff\xfeh\x00\xe9\x00l\x00l\x00o\x00\n\x00",
+		"s.txt":          "\x82\xb1\x82\xf1\\\n",
+	}
+	for name, content := range files {
+		util.Check(os.WriteFile(dir+"/"+name, []byte(content), 0644))
+	}
+	steps := []struct {
+		Description string
+		Args        []string
+		Expected    string
+		Fails       bool
+	}{
+		// Outputs given by git for the same files
+		{Description: "add", Args: []string{"add", "a.txt", "s.txt", ".gitattributes"}},
+		{Description: "the blobs are UTF-8", Args: []string{"ls-files", "-s"}, Expected: "100644 d4a4133993c824babe823450bb51e41639b7c05c 0\t.gitattributes\n" +
+			"100644 5fb50d3c93474f139362304b663fe44e9d17a26e 0\ta.txt\n100644 eb79918b8b9e1d5c5241e63b4fd4c4db4d5bbb63 0\ts.txt\n"},
+		{Description: "compare the converted files", Args: []string{"status", "--porcelain"}, Expected: "A  .gitattributes\nA  a.txt\nA  s.txt\n?? b.txt\n"},
+		{Description: "a prohibited BOM", Args: []string{"add", "b.txt"}, Fails: true},
+		{Description: "a content that changes back and forth", Args: []string{"-c", "core.checkRoundtripEncoding=UTF-16", "add", "a.txt"}},
+		{Description: "checkout", Args: []string{"cat-file", "--filters", "--path=s.txt", "eb79918b8b9e1d5c5241e63b4fd4c4db4d5bbb63"},
+			Expected: "\x82\xb1\x82\xf1\\\n"},
+		{Description: "checkout with a BOM", Args: []string{"cat-file", "--filters", "--path=a.txt", "5fb50d3c93474f139362304b663fe44e9d17a26e"},
+			Expected: "\xff\xfeh\x00\xe9\x00l\x00l\x00o\x00\n\x00"},
+	}
+	for _, tc := range steps {
+		t.Run(tc.Description, func(t *testing.T) {
+			out, err := useMyGit(append([]string{"-C", dir}, tc.Args...)...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			if out != tc.Expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestMyGit_Checkout(t *testing.T) {
+	dir := TEMPDIR + "checkout_test"
+	util.Check(initRepo(dir))
+	commit := func(message string) string {
+		_, err := useMyGit("-C", dir, "add", "-A")
+		util.Check(err)
+		tree, err := useMyGit("-C", dir, "write-tree")
+		util.Check(err)
+		args := []string{"-C", dir, "commit-tree", "-m", message, strings.TrimSpace(tree)}
+		if parent, err := useMyGit("-C", dir, "rev-parse", "HEAD"); err == nil {
+			args = append(args, "-p", strings.TrimSpace(parent))
+		}
+		cmd := exec.Command(APP, args...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Valentin", "GIT_AUTHOR_EMAIL=valentinwissler42@outlook.com",
+			"GIT_COMMITTER_NAME=Valentin", "GIT_COMMITTER_EMAIL=valentinwissler42@outlook.com")
+		hash, err := cmd.Output()
+		util.Check(err)
+		_, err = useMyGit("-C", dir, "update-ref", "HEAD", strings.TrimSpace(string(hash)))
+		util.Check(err)
+		return strings.TrimSpace(string(hash))
+	}
+	util.Check(util.Mkdir(0755, dir+"/d"))
+	util.Check(util.Mkfile([]string{dir + "/a.txt", dir + "/d/b.txt"}, [][]byte{[]byte("a\n"), []byte("b\n")}, 0644))
+	util.Check(os.WriteFile(dir+"/x.sh", []byte("x\n"), 0755))
+	util.Check(os.Symlink("a.txt", dir+"/link"))
+	first := commit("first")
+	_, err := useMyGit("-C", dir, "branch", "other")
+	util.Check(err)
+	util.Check(os.WriteFile(dir+"/a.txt", []byte("a2\n"), 0644))
+	util.Check(os.WriteFile(dir+"/c.txt", []byte("c\n"), 0644))
+	util.Check(os.RemoveAll(dir + "/d"))
+	commit("second")
+
+	firstFiles := "100644 78981922613b2afb6025042ff6bd878ac1994e85 0\ta.txt\n100644 61780798228d17af2d34fce4cfbdf35556832472 0\td/b.txt\n" +
+		"120000 8d14cbf983b3fad683171c9418998d9f68340823 0\tlink\n100755 587be6b4c3f93f93c489c0111bba5596147a26cb 0\tx.sh\n"
+	steps := []struct {
+		Description string
+		Setup       func()
+		Args        []string
+		Expected    string
+		Fails       bool
+	}{
+		// Outputs given by git for the same commits
+		{Description: "switch", Args: []string{"switch", "-q", "other"}},
+		{Description: "the index is the first commit", Args: []string{"ls-files", "-s"}, Expected: firstFiles},
+		{Description: "the work tree too", Args: []string{"status", "--porcelain"}},
+		{Description: "local changes would be overwritten",
+			Setup: func() { util.Check(os.WriteFile(dir+"/a.txt", []byte("changed\n"), 0644)) },
+			Args:  []string{"switch", "main"}, Fails: true},
+		{Description: "nothing was switched", Args: []string{"symbolic-ref", "HEAD"}, Expected: "refs/heads/other\n"},
+		{Description: "checkout the file from the index", Args: []string{"checkout", "a.txt"}},
+		{Description: "untracked file in the way",
+			Setup: func() { util.Check(os.WriteFile(dir+"/c.txt", []byte("untracked\n"), 0644)) },
+			Args:  []string{"switch", "main"}, Fails: true},
+		{Description: "throw it away", Args: []string{"switch", "-f", "main"}},
+		{Description: "the untracked file was overwritten", Args: []string{"status", "--porcelain"}},
+		{Description: "keep the local changes the commits don't touch",
+			Setup: func() { util.Check(os.WriteFile(dir+"/new.txt", []byte("new\n"), 0644)) },
+			Args:  []string{"add", "new.txt"}},
+		{Description: "create a branch", Args: []string{"switch", "-c", "topic", "other"}, Expected: "A\tnew.txt\n"},
+		{Description: "the branch", Args: []string{"rev-parse", "topic"}, Expected: first + "\n"},
+		{Description: "the files of the new commit", Args: []string{"ls-files", "-s"},
+			Expected: "100644 78981922613b2afb6025042ff6bd878ac1994e85 0\ta.txt\n100644 61780798228d17af2d34fce4cfbdf35556832472 0\td/b.txt\n" +
+				"120000 8d14cbf983b3fad683171c9418998d9f68340823 0\tlink\n100644 3e757656cf36eca53338e520d134963a44f793f8 0\tnew.txt\n" +
+				"100755 587be6b4c3f93f93c489c0111bba5596147a26cb 0\tx.sh\n"},
+		{Description: "restore a file from a commit", Args: []string{"restore", "--source=main", "--staged", "--worktree", "a.txt"}},
+		{Description: "the file is staged", Args: []string{"status", "--porcelain", "a.txt"}, Expected: "M  a.txt\n"},
+		{Description: "unstage it", Args: []string{"restore", "--staged", "a.txt"}},
+		{Description: "the change is left in the work tree", Args: []string{"status", "--porcelain", "a.txt"}, Expected: " M a.txt\n"},
+		{Description: "the change would be lost", Args: []string{"switch", "--detach", "main"}, Fails: true},
+		{Description: "throw the change away", Args: []string{"checkout", "--", "a.txt"}},
+		{Description: "detach", Args: []string{"switch", "--detach", "main"}, Expected: "A\tnew.txt\n"},
+		{Description: "HEAD is detached", Args: []string{"symbolic-ref", "HEAD"}, Fails: true},
+		{Description: "a commit is no branch", Args: []string{"switch", first}, Fails: true},
+	}
+	for _, tc := range steps {
+		t.Run(tc.Description, func(t *testing.T) {
+			if tc.Setup != nil {
+				tc.Setup()
+			}
+			out, err := useMyGit(append([]string{"-C", dir}, tc.Args...)...)
+			if tc.Fails {
+				if err == nil {
+					log.Fatalf("expected %v to fail", tc.Args)
+				}
+				return
+			}
+			util.Check(err)
+			if out != tc.Expected {
+				log.Fatalf("unexpected output of %v, got: %q expected: %q", tc.Args, out, tc.Expected)
+			}
+		})
+	}
+	for name, expected := range map[string]string{"a.txt": "a2\n", "c.txt": "c\n", "new.txt": "new\n"} {
+		if content, err := os.ReadFile(dir + "/" + name); err != nil || string(content) != expected {
+			log.Fatalf("unexpected content of %s, got: %q expected: %q", name, content, expected)
+		}
+	}
+	if _, err := os.Lstat(dir + "/d"); !os.IsNotExist(err) {
+		log.Fatalf("expected d to be removed")
+	}
+
+	// A directory holding an untracked file where a file goes
+	util.Check(os.WriteFile(dir+"/d", []byte("file\n"), 0644))
+	withFile := commit("file d")
+	util.Check(os.Remove(dir + "/d"))
+	util.Check(util.Mkdir(0755, dir+"/d"))
+	util.Check(os.WriteFile(dir+"/d/x", []byte("x\n"), 0644))
+	commit("directory d")
+	util.Check(os.WriteFile(dir+"/d/untr", []byte("untracked\n"), 0644))
+	cmd := exec.Command(APP, "-C", dir, "switch", "--detach", withFile)
+	stderr := new(strings.Builder)
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err == nil {
+		log.Fatalf("expected the switch to fail")
+	}
+	if expected := "error: Updating the following directories would lose untracked files in them:\n\td\n\nAborting\n"; stderr.String() != expected {
+		log.Fatalf("unexpected error, got: %q expected: %q", stderr.String(), expected)
+	}
+}
+
+func TestMyGit_ParallelCheckout(t *testing.T) {
+	dir := TEMPDIR + "parallel_test"
+	util.Check(initRepo(dir))
+	git := func(args ...string) string {
+		cmd := exec.Command(APP, append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Valentin", "GIT_AUTHOR_EMAIL=valentinwissler42@outlook.com",
+			"GIT_COMMITTER_NAME=Valentin", "GIT_COMMITTER_EMAIL=valentinwissler42@outlook.com")
+		out, err := cmd.Output()
+		util.Check(err)
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(content string) {
+		for i := 0; i < 20; i++ {
+			util.Check(util.Mkdir(0755, fmt.Sprintf("%s/d%d", dir, i%3)))
+			util.Check(os.WriteFile(fmt.Sprintf("%s/d%d/f%d.txt", dir, i%3, i), []byte(content), 0644))
+		}
+		git("add", ".")
+		args := []string{"commit-tree", "-m", content, git("write-tree")}
+		if parent, err := useMyGit("-C", dir, "rev-parse", "HEAD"); err == nil {
+			args = append(args, "-p", strings.TrimSpace(parent))
+		}
+		git("update-ref", "HEAD", git(args...))
+	}
+	util.Check(os.WriteFile(dir+"/.gitattributes", []byte("d1/* eol=crlf\n"), 0644))
+	commit("first\n")
+	git("branch", "first")
+	commit("second\n")
+
+	// The files are written by 4 workers, the index only once they are all written
+	git("-c", "checkout.workers=4", "-c", "checkout.thresholdForParallelism=2", "switch", "-q", "first")
+	for i := 0; i < 20; i++ {
+		expected := "first\n"
+		if i%3 == 1 {
+			expected = "first\r\n"
+		}
+		name := fmt.Sprintf("%s/d%d/f%d.txt", dir, i%3, i)
+		if content, err := os.ReadFile(name); err != nil || string(content) != expected {
+			log.Fatalf("unexpected content of %s, got: %q expected: %q", name, content, expected)
+		}
+	}
+	if out := git("status", "--porcelain"); out != "" {
+		log.Fatalf("expected a clean work tree, got: %q", out)
+	}
+	// The index isn't written when a file can't be
+	staged := git("ls-files", "-s")
+	util.Check(os.Remove(dir + "/.git/objects/e0/19be006cf33489e2d0177a3837a2384eddebc5"))
+	if _, err := useMyGit("-C", dir, "-c", "checkout.workers=4", "-c", "checkout.thresholdForParallelism=2", "switch", "-q", "main"); err == nil {
+		log.Fatalf("expected the switch to fail")
+	}
+	if out := git("ls-files", "-s"); out != staged {
+		log.Fatalf("expected the index to be left alone, got: %q", out)
+	}
+}
+
+func TestMyGit_Collisions(t *testing.T) {
+	dir := TEMPDIR + "collisions_test"
+	util.Check(initRepo(dir))
+	files := map[string]string{"a.txt": "a\n", "A.txt": "A\n", "caf\u00e9": "nfc\n", "cafe\u0301": "nfd\n"}
+	for name, content := range files {
+		util.Check(os.WriteFile(dir+"/"+name, []byte(content), 0644))
+	}
+	run := func(args ...string) (string, string) {
+		cmd := exec.Command(APP, append([]string{"-C", dir}, args...)...)
+		stderr := new(strings.Builder)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		util.Check(err)
+		return string(out), stderr.String()
+	}
+	expected := "warning: the following paths have collided (e.g. case-sensitive paths\non a case-insensitive filesystem) " +
+		"and only one from the same\ncolliding group is in the %s:\n  'A.txt'\n  'a.txt'\n  'cafe\u0301'\n  'caf\u00e9'\n"
+
+	// With core.ignoreCase and core.precomposeUnicode the first file of each group is staged, the others are left out
+	folding := []string{"-c", "core.ignoreCase=true", "-c", "core.precomposeUnicode=true"}
+	if _, errOut := run(append(folding, "add", ".")...); errOut != fmt.Sprintf(expected, "index") {
+		log.Fatalf("unexpected warning of add, got: %q", errOut)
+	}
+	if out, _ := run("ls-files", "-s"); out != "100644 f70f10e4db19068f79bc43844b49f3eece45c4e8 0\tA.txt\n"+
+		"100644 60800a56cbd66a5b8ee8e1d373a9646949aa8d32 0\t\"cafe\\314\\201\"\n" {
+		log.Fatalf("unexpected aliased entries, got: %q", out)
+	}
+	// A path differing only in case naming the file of the tracked one is staged as it, as on a case-insensitive file
+	// system; a hard link stands for it
+	util.Check(os.Remove(dir + "/A.txt"))
+	util.Check(os.WriteFile(dir+"/a.txt", []byte("changed\n"), 0644))
+	util.Check(os.Link(dir+"/a.txt", dir+"/A.txt"))
+	run(append(folding, "add", "a.txt")...)
+	if out, _ := run("ls-files", "-s", "*.txt"); out != "100644 5ea2ed416fbd4a4cbe227b75fe255dd7fa6bd4d6 0\tA.txt\n" {
+		log.Fatalf("unexpected entry, got: %q", out)
+	}
+
+	// Checking out the colliding paths staged without the settings
+	util.Check(os.Remove(dir + "/A.txt"))
+	util.Check(os.WriteFile(dir+"/A.txt", []byte("A\n"), 0644))
+	run("-c", "core.ignoreCase=false", "-c", "core.precomposeUnicode=false", "add", ".")
+	for name := range files {
+		util.Check(os.Remove(dir + "/" + name))
+	}
+	if _, errOut := run(append(folding, "checkout", "--", ".")...); errOut != fmt.Sprintf(expected, "working tree") {
+		log.Fatalf("unexpected warning of checkout, got: %q", errOut)
+	}
+	if _, errOut := run("-c", "core.ignoreCase=false", "-c", "core.precomposeUnicode=false", "restore", "."); errOut != "" {
+		log.Fatalf("expected no warning, got: %q", errOut)
+	}
+}
+
+// Test that init leaves core.ignoreCase and core.precomposeUnicode unset on a case-sensitive file system, and that a
+// file differing in case from a tracked path never replaces its content
+func TestMyGit_CaseSensitiveFileSystem(t *testing.T) {
+	dir := TEMPDIR + "case_sensitive_test"
+	util.Check(os.RemoveAll(dir))
+	util.Check(util.Mkdir(0755, dir))
+	util.Check(os.WriteFile(dir+"/probe", nil, 0644))
+	if _, err := os.Lstat(dir + "/PROBE"); err == nil {
+		t.Skip("the file system folds case")
+	}
+	util.Check(os.Remove(dir + "/probe"))
+	util.Check(initRepo(dir))
+	run := func(args ...string) string {
+		out, _ := exec.Command(APP, append([]string{"-C", dir}, args...)...).Output()
+		return string(out)
+	}
+
+	for _, key := range []string{"core.ignorecase", "core.precomposeunicode"} {
+		if out := run("config", "--get", key); out != "" {
+			log.Fatalf("unexpected %s, got: %q", key, out)
+		}
+	}
+	util.Check(os.WriteFile(dir+"/readme", []byte("lower\n"), 0644))
+	run("add", "readme")
+	util.Check(os.WriteFile(dir+"/README", []byte("upper\n"), 0644))
+	tracked := "100644 3f2d9cedc75ad2766b40a4158022fcc9f5dfe9b1 0\treadme\n"
+	// Even with core.ignoreCase, README is another file: readme keeps its content
+	run("-c", "core.ignoreCase=true", "add", "README")
+	if out := run("ls-files", "-s"); out != tracked {
+		log.Fatalf("unexpected entries, got: %q", out)
+	}
+	run("add", "README")
+	if out := run("ls-files", "-s"); out != "100644 5225f47da9b3a2d2529c70329d56424b573726cb 0\tREADME\n"+tracked {
+		log.Fatalf("unexpected entries, got: %q", out)
+	}
+}
+
 // Clears the tempdir where we create our test files and folders
 func clearTempDir() error {
 	if err := os.RemoveAll(TEMPDIR); err != nil {
@@ -214,6 +1383,56 @@ func useHashObject(path string) (string, error) {
 	return string(hash), nil
 }
 
+// Use the app to write the tree of the working directory
+func useWriteTree(args ...string) (string, error) {
+	cmd := exec.Command(APP, append([]string{"write-tree"}, args...)...)
+	cmd.Dir = TEMPDIR1
+	hash, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Use the app to write a commit, feeding stdin to its standard input
+func useCommitTree(stdin string, args ...string) (string, error) {
+	cmd := exec.Command(APP, append([]string{"commit-tree"}, args...)...)
+	cmd.Dir = TEMPDIR1
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Valentin", "GIT_AUTHOR_EMAIL=valentinwissler42@outlook.com", "GIT_AUTHOR_DATE=946684800 +0000",
+		"GIT_COMMITTER_NAME=Valentin", "GIT_COMMITTER_EMAIL=valentinwissler42@outlook.com", "GIT_COMMITTER_DATE=@946684800 +0000",
+	)
+	hash, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Use the app to run any command in the test repository
+func useMyGit(args ...string) (string, error) {
+	cmd := exec.Command(APP, args...)
+	cmd.Dir = TEMPDIR1
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// Use the app to run any command in the test repository, feeding stdin to its standard input
+func useMyGitStdin(stdin string, args ...string) (string, error) {
+	cmd := exec.Command(APP, args...)
+	cmd.Dir = TEMPDIR1
+	cmd.Stdin = strings.NewReader(stdin)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
 // Use the app to init a new git repo in the given path
 func initRepo(path string) error {
 	if err := util.Mkdir(0755, path); err != nil {
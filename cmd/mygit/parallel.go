@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"runtime"
+	"sync"
+
+	index "github.com/codecrafters-io/git-starter-go/index"
+)
+
+// Return the number of workers writing the files of a checkout, checkout.workers, as many as the CPUs when it is less
+// than one, and the least number of files written in parallel, checkout.thresholdForParallelism
+func parallelCheckoutConfig() (int, int, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return 0, 0, err
+	}
+	workers, err := cfg.Int("checkout.workers", 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if workers < 1 {
+		workers = int64(runtime.NumCPU())
+	}
+	threshold, err := cfg.Int("checkout.thresholdforparallelism", 100)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(workers), int(threshold), nil
+}
+
+// Write the files of entries to the work tree, replacing whatever is in the way, and return the entries with the stat
+// data of the files written, in the same order
+// With more than one worker and at least as many entries as the threshold, the paths are all prepared first, then the
+// regular files without a filter driver are read, converted and written by the workers while the others are written
+// one by one; a file is never overwritten by a worker, one already written at its path means the path collides with
+// another, as two paths differing in case do on a case-insensitive filesystem, and the colliding files are written
+// again one by one once the workers are done, in order
+// Nothing is staged: the callers write the index only when all the files were written
+func checkoutEntries(entries []index.Entry) ([]index.Entry, error) {
+	workers, threshold, err := parallelCheckoutConfig()
+	if err != nil {
+		return nil, err
+	}
+	written := make([]index.Entry, len(entries))
+	if workers <= 1 || len(entries) < threshold {
+		for i, e := range entries {
+			if written[i], err = checkoutEntry(e); err != nil {
+				return nil, err
+			}
+		}
+		return written, nil
+	}
+
+	conversions := make([]worktreeConversion, len(entries))
+	errs := make([]error, len(entries))
+	queued := make([]int, 0, len(entries))
+	for i, e := range entries {
+		if err := prepareCheckout(e); err != nil {
+			return nil, err
+		}
+		// The attributes and the config are read here, the workers share nothing
+		if conversions[i], err = worktreeConversionFor(e.Path); err != nil {
+			return nil, err
+		}
+		if (e.Mode == index.ModeFile || e.Mode == index.ModeExecutable) && conversions[i].driver == nil {
+			queued = append(queued, i)
+		} else {
+			written[i], errs[i] = writeCheckout(e, conversions[i])
+		}
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(queued)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				written[i], errs[i] = writeCheckout(entries[i], conversions[i])
+			}
+		}()
+	}
+	for _, i := range queued {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	collided := make([]int, 0)
+	for i, err := range errs {
+		switch {
+		case errors.Is(err, fs.ErrExist):
+			collided = append(collided, i)
+		case err != nil:
+			return nil, err
+		}
+	}
+	for _, i := range collided {
+		if written[i], err = checkoutEntry(entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+	refs "github.com/codecrafters-io/git-starter-go/refs"
+)
+
+// Which refs a listing keeps, by the objects they point to and the history of these commits
+type refFilter struct {
+	// The refs reachable from every one of these commits
+	merged []string
+	// The refs reachable from none of these commits
+	noMerged []string
+	// The refs whose history contains one of these commits
+	contains   []string
+	noContains []string
+	// The refs pointing to one of these objects, directly or through tags
+	pointsAt []string
+}
+
+// Parse the filter option at args[*i], moving i past its value, return false when it isn't a filter option
+// The commit of --merged, --no-merged, --contains and --no-contains is optional, HEAD when it is the last argument
+func (f *refFilter) parseOption(args []string, i *int) (bool, error) {
+	name, value, hasValue := strings.Cut(args[*i], "=")
+	var list *[]string
+	switch name {
+	case "--merged":
+		list = &f.merged
+	case "--no-merged":
+		list = &f.noMerged
+	case "--contains":
+		list = &f.contains
+	case "--no-contains":
+		list = &f.noContains
+	case "--points-at":
+		list = &f.pointsAt
+	default:
+		return false, nil
+	}
+	switch {
+	case hasValue:
+	case *i+1 < len(args):
+		*i++
+		value = args[*i]
+	default:
+		value = "HEAD"
+	}
+	if list == &f.pointsAt {
+		hash, err := resolveRevision(value)
+		if err != nil {
+			return true, fmt.Errorf("malformed object name %s", value)
+		}
+		f.pointsAt = append(f.pointsAt, hash)
+		return true, nil
+	}
+	hash, err := resolveCommit(value)
+	if err != nil {
+		return true, err
+	}
+	*list = append(*list, hash)
+	return true, nil
+}
+
+// Whether a filter is set, listing commands switch to list mode then
+func (f *refFilter) active() bool {
+	return len(f.merged)+len(f.noMerged)+len(f.contains)+len(f.noContains)+len(f.pointsAt) > 0
+}
+
+// Whether the filter keeps a ref pointing to hash, tags being peeled to what they tag
+func (f *refFilter) keep(hash string) bool {
+	if !f.active() {
+		return true
+	}
+	if len(f.pointsAt) > 0 {
+		peeled, _ := peelTag(hash)
+		found := false
+		for _, object := range f.pointsAt {
+			found = found || object == hash || object == peeled
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.merged)+len(f.noMerged)+len(f.contains)+len(f.noContains) == 0 {
+		return true
+	}
+	commit := peelToCommit(hash)
+	if commit == "" {
+		// Only commits have a history to filter on
+		return false
+	}
+	for _, merged := range f.merged {
+		if !newReachability(merged).contains(commit) {
+			return false
+		}
+	}
+	for _, notMerged := range f.noMerged {
+		if newReachability(notMerged).contains(commit) {
+			return false
+		}
+	}
+	history := newReachability(commit)
+	if len(f.contains) > 0 {
+		found := false
+		for _, c := range f.contains {
+			found = found || history.contains(c)
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, c := range f.noContains {
+		if history.contains(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the commit a revision stands for, following annotated tags
+func resolveCommit(revision string) (string, error) {
+	hash, err := resolveRevision(revision)
+	if err != nil {
+		return "", fmt.Errorf("malformed object name %s", revision)
+	}
+	commit := peelToCommit(hash)
+	if commit == "" {
+		return "", fmt.Errorf("object %s is not a commit", hash)
+	}
+	return commit, nil
+}
+
+// Return the commit hash points to, following annotated tags, or "" when it isn't a commit
+func peelToCommit(hash string) string {
+	if peeled, err := peelTag(hash); err == nil && peeled != "" {
+		hash = peeled
+	}
+	objectType, _, err := readObject(hash)
+	if err != nil || objectType != "commit" {
+		return ""
+	}
+	return hash
+}
+
+// Return the number of commits reachable from a but not b, and from b but not a
+func aheadBehind(a, b string) (ahead, behind int) {
+	fromA := newReachability(a)
+	fromB := newReachability(b)
+	fromA.contains(a)
+	fromB.contains(b)
+	for hash := range fromA.visited {
+		if !fromB.visited[hash] {
+			ahead++
+		}
+	}
+	for hash := range fromB.visited {
+		if !fromA.visited[hash] {
+			behind++
+		}
+	}
+	return ahead, behind
+}
+
+// Return the subject of a commit or tag message: its first paragraph on one line
+func messageSubject(message []byte) string {
+	paragraph, _, _ := strings.Cut(strings.TrimLeft(string(message), "\n"), "\n\n")
+	lines := strings.Split(strings.TrimRight(paragraph, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, " ")
+}
+
+// Return the subject of the commit hash points to, "" when it isn't a commit
+func commitSubject(hash string) string {
+	objectType, content, err := readObject(hash)
+	if err != nil || objectType != "commit" {
+		return ""
+	}
+	commit, err := objects.ParseCommit(content)
+	if err != nil {
+		return ""
+	}
+	return messageSubject(commit.Message)
+}
+
+// Return the ref an upstream or start point names: a local branch, a remote-tracking branch or a full ref name
+func expandBranchName(store *refs.Store, name string) (string, bool) {
+	for _, candidate := range []string{name, "refs/heads/" + name, "refs/remotes/" + name} {
+		if !strings.HasPrefix(candidate, "refs/") {
+			continue
+		}
+		if _, err := store.Read(candidate); err == nil {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// A ref of a listing, the object it points to is read when first needed
+type refItem struct {
+	name string
+	hash string
+	// Set for a symbolic ref, hash is then the object of its target
+	symbolic   string
+	loaded     bool
+	objectType string
+	content    []byte
+}
+
+// Return the type and content of the object the ref points to
+func (r *refItem) object() (string, []byte) {
+	if !r.loaded {
+		r.loaded = true
+		r.objectType, r.content, _ = readObject(r.hash)
+	}
+	return r.objectType, r.content
+}
+
+// Return the message of the tag or commit the ref points to, nil for other objects
+func (r *refItem) message() []byte {
+	switch objectType, content := r.object(); objectType {
+	case "tag":
+		if tag, err := objects.ParseTag(content); err == nil {
+			return tag.Message
+		}
+	case "commit":
+		if commit, err := objects.ParseCommit(content); err == nil {
+			return commit.Message
+		}
+	}
+	return nil
+}
+
+// Return the ref items of the refs under the prefixes, in that order, symbolic refs resolved
+func listRefItems(prefixes ...string) ([]*refItem, error) {
+	store := refStore()
+	items := make([]*refItem, 0)
+	for _, prefix := range prefixes {
+		list, err := store.List(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range list {
+			item := &refItem{name: ref.Name, hash: ref.Target, symbolic: ref.Symbolic}
+			if ref.IsSymbolic() {
+				resolved, err := store.Resolve(ref.Name)
+				if err != nil {
+					// A dangling symbolic ref isn't listed
+					continue
+				}
+				item.hash = resolved.Target
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// Sort the refs by the keys given to --sort, the last one first, then by name
+func (f *refFormatter) sort(items []*refItem, keys []string) error {
+	compares := make([]func(a, b *refItem) int, 0, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		compare, err := f.comparison(keys[i])
+		if err != nil {
+			return err
+		}
+		compares = append(compares, compare)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		for _, compare := range compares {
+			if c := compare(items[i], items[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return items[i].name < items[j].name
+	})
+	return nil
+}
+
+// Return the prerelease suffixes of versionsort.suffix, or of the older versionsort.prereleaseSuffix
+func versionSortSuffixes() []string {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil
+	}
+	entries := cfg.GetAll("versionsort.suffix")
+	if len(entries) == 0 {
+		entries = cfg.GetAll("versionsort.prereleasesuffix")
+	}
+	suffixes := make([]string, 0, len(entries))
+	for _, e := range entries {
+		suffixes = append(suffixes, e.Value)
+	}
+	return suffixes
+}
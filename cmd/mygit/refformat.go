@@ -0,0 +1,908 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	ident "github.com/codecrafters-io/git-starter-go/ident"
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+	versioncmp "github.com/codecrafters-io/git-starter-go/versioncmp"
+	wildmatch "github.com/codecrafters-io/git-starter-go/wildmatch"
+)
+
+// The default --format of for-each-ref
+const defaultRefFormat = "%(objectname) %(objecttype)\t%(refname)"
+
+// The fields of the atoms, those not listed are refused
+var refAtomFields = map[string]bool{
+	"refname": true, "symref": true, "upstream": true, "HEAD": true,
+	"objectname": true, "objecttype": true, "objectsize": true,
+	"tree": true, "parent": true, "numparent": true,
+	"object": true, "type": true, "tag": true,
+	"author": true, "authorname": true, "authoremail": true, "authordate": true,
+	"committer": true, "committername": true, "committeremail": true, "committerdate": true,
+	"tagger": true, "taggername": true, "taggeremail": true, "taggerdate": true,
+	"creator": true, "creatordate": true,
+	"subject": true, "body": true, "contents": true,
+	"color": true,
+}
+
+// An atom like %(refname:short) or %(*objectname): its field, the text after the colon,
+// and whether it applies to the object a tag points to rather than to the tag
+type refAtom struct {
+	deref    bool
+	field    string
+	modifier string
+}
+
+func (a refAtom) String() string {
+	s := a.field
+	if a.deref {
+		s = "*" + s
+	}
+	if a.modifier != "" {
+		s += ":" + a.modifier
+	}
+	return s
+}
+
+// The kinds of the parts of a format
+type formatNodeKind int
+
+const (
+	formatText formatNodeKind = iota
+	formatAtom
+	// %(align:<width>[,<position>])...%(end)
+	formatAlign
+	// %(if[:equals=<s> | :notequals=<s>])...%(then)...[%(else)...]%(end)
+	formatIf
+)
+
+// A part of a parsed format
+type formatNode struct {
+	kind formatNodeKind
+	text string
+	atom refAtom
+	// The content of %(align), or the condition of %(if)
+	children []formatNode
+	// The branches of %(if)
+	then      []formatNode
+	otherwise []formatNode
+	// The comparison of %(if:equals=...) and %(if:notequals=...), "" for a test of non-blank content
+	compare  string
+	operand  string
+	width    int
+	position string
+}
+
+// Formats refs with the atoms of for-each-ref, the values of the atoms quoted for a language with --shell and the like
+type refFormatter struct {
+	nodes []formatNode
+	quote func(string) string
+	// The ref HEAD points to, for %(HEAD)
+	head string
+	now  time.Time
+}
+
+// Parse a format, refusing unknown fields and unbalanced %(if) and %(align)
+func newRefFormatter(format string) (*refFormatter, error) {
+	f := &refFormatter{now: time.Now()}
+	if head, err := refStore().Read("HEAD"); err == nil {
+		f.head = head.Symbolic
+	}
+	tokens, err := tokenizeFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	nodes, end, _, err := f.parseNodes(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if end != "" {
+		return nil, unexpectedAtom(end, "")
+	}
+	f.nodes = nodes
+	return f, nil
+}
+
+// Split a format into text and atoms, %% standing for % and %xx for the byte of hex code xx
+func tokenizeFormat(format string) ([]formatNode, error) {
+	tokens := make([]formatNode, 0)
+	text := new(strings.Builder)
+	flush := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, formatNode{kind: formatText, text: text.String()})
+			text.Reset()
+		}
+	}
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 >= len(format) {
+			text.WriteByte(c)
+			continue
+		}
+		switch next := format[i+1]; {
+		case next == '%':
+			text.WriteByte('%')
+			i++
+		case next == '(':
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 {
+				return nil, fmt.Errorf("malformed format string %s", format[i:])
+			}
+			flush()
+			tokens = append(tokens, formatNode{kind: formatAtom, atom: parseRefAtom(format[i+2 : i+end])})
+			i += end
+		default:
+			if b, err := hex.DecodeString(format[i+1 : min(i+3, len(format))]); err == nil && len(b) == 1 {
+				text.WriteByte(b[0])
+				i += 2
+			} else {
+				text.WriteByte(c)
+			}
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+func parseRefAtom(s string) refAtom {
+	a := refAtom{}
+	s, a.deref = strings.CutPrefix(s, "*")
+	a.field, a.modifier, _ = strings.Cut(s, ":")
+	return a
+}
+
+// Parse nodes up to one of the atoms closing a block, return the nodes, that atom and the tokens after it
+func (f *refFormatter) parseNodes(tokens []formatNode) ([]formatNode, string, []formatNode, error) {
+	nodes := make([]formatNode, 0)
+	for len(tokens) > 0 {
+		token := tokens[0]
+		tokens = tokens[1:]
+		if token.kind == formatText {
+			nodes = append(nodes, token)
+			continue
+		}
+		switch a := token.atom; a.field {
+		case "then", "else", "end":
+			return nodes, a.field, tokens, nil
+		case "align":
+			node, err := parseAlign(a.modifier)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			var end string
+			if node.children, end, tokens, err = f.parseNodes(tokens); err != nil {
+				return nil, "", nil, err
+			}
+			if end != "end" {
+				return nil, "", nil, unexpectedAtom(end, "align")
+			}
+			nodes = append(nodes, node)
+		case "if":
+			node, rest, err := f.parseIf(a.modifier, tokens)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			tokens = rest
+			nodes = append(nodes, node)
+		default:
+			if !refAtomFields[a.field] {
+				return nil, "", nil, fmt.Errorf("unknown field name: %s", a.field)
+			}
+			// The modifiers are checked on a ref without any object
+			if _, _, err := f.atomValue(&refItem{loaded: true}, a); err != nil {
+				return nil, "", nil, err
+			}
+			nodes = append(nodes, token)
+		}
+	}
+	return nodes, "", nil, nil
+}
+
+// Return the error of a format where the atom closing a block isn't the expected one, block being the atom the
+// current block started with: "align", "if" for its condition, "then" for its branches, or "" outside any block
+func unexpectedAtom(atom, block string) error {
+	switch {
+	case atom == "":
+		return fmt.Errorf("format: %%(end) atom missing")
+	case block == "if" && atom == "end":
+		return fmt.Errorf("format: %%(if) atom used without a %%(then) atom")
+	case block == "if":
+		return fmt.Errorf("format: %%(else) atom used without a %%(then) atom")
+	case block == "then" && atom == "then":
+		return fmt.Errorf("format: %%(then) atom used more than once")
+	case atom == "end":
+		return fmt.Errorf("format: %%(end) atom used without corresponding atom")
+	}
+	return fmt.Errorf("format: %%(%s) atom used without a %%(if) atom", atom)
+}
+
+// Parse "<width>[,<position>]" or "width=<width>,position=<position>"
+func parseAlign(modifier string) (formatNode, error) {
+	node := formatNode{kind: formatAlign, position: "left", width: -1}
+	parts := strings.Split(modifier, ",")
+	if modifier == "" {
+		parts = nil
+	}
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		value, named := strings.CutPrefix(part, "width=")
+		if n, err := strconv.Atoi(value); err == nil {
+			node.width = n
+			continue
+		} else if named {
+			return formatNode{}, fmt.Errorf("unrecognized width:%s in %%(align)", value)
+		}
+		switch position := strings.TrimPrefix(part, "position="); position {
+		case "left", "middle", "right":
+			node.position = position
+		default:
+			return formatNode{}, fmt.Errorf("unrecognized %%(align) argument: %s", part)
+		}
+	}
+	if node.width < 0 {
+		return formatNode{}, fmt.Errorf("expected format: %%(align:<width>,<position>)")
+	}
+	return node, nil
+}
+
+// Parse the condition and branches of %(if), the tokens following it
+func (f *refFormatter) parseIf(modifier string, tokens []formatNode) (formatNode, []formatNode, error) {
+	node := formatNode{kind: formatIf}
+	if modifier != "" {
+		var found bool
+		node.compare, node.operand, found = strings.Cut(modifier, "=")
+		if !found || node.compare != "equals" && node.compare != "notequals" {
+			return formatNode{}, nil, fmt.Errorf("unrecognized %%(if) argument: %s", modifier)
+		}
+	}
+	var end string
+	var err error
+	if node.children, end, tokens, err = f.parseNodes(tokens); err != nil {
+		return formatNode{}, nil, err
+	}
+	if end != "then" {
+		return formatNode{}, nil, unexpectedAtom(end, "if")
+	}
+	if node.then, end, tokens, err = f.parseNodes(tokens); err != nil {
+		return formatNode{}, nil, err
+	}
+	if end == "else" {
+		if node.otherwise, end, tokens, err = f.parseNodes(tokens); err != nil {
+			return formatNode{}, nil, err
+		}
+		if end == "else" {
+			return formatNode{}, nil, fmt.Errorf("format: %%(else) atom used more than once")
+		}
+	}
+	if end != "end" {
+		return formatNode{}, nil, unexpectedAtom(end, "then")
+	}
+	return node, tokens, nil
+}
+
+// Return the formatted ref
+func (f *refFormatter) format(item *refItem) (string, error) {
+	return f.render(f.nodes, item, f.quote)
+}
+
+// Render nodes, quote applying to the values of the atoms and of the blocks at the top level
+func (f *refFormatter) render(nodes []formatNode, item *refItem, quote func(string) string) (string, error) {
+	out := new(strings.Builder)
+	for _, node := range nodes {
+		var value string
+		var err error
+		switch node.kind {
+		case formatText:
+			out.WriteString(node.text)
+			continue
+		case formatAtom:
+			value, _, err = f.atomValue(item, node.atom)
+		case formatAlign:
+			if value, err = f.render(node.children, item, nil); err == nil {
+				value = align(value, node.width, node.position)
+			}
+		case formatIf:
+			value, err = f.renderIf(node, item)
+		}
+		if err != nil {
+			return "", err
+		}
+		if quote != nil {
+			value = quote(value)
+		}
+		out.WriteString(value)
+	}
+	return out.String(), nil
+}
+
+func (f *refFormatter) renderIf(node formatNode, item *refItem) (string, error) {
+	condition, err := f.render(node.children, item, nil)
+	if err != nil {
+		return "", err
+	}
+	holds := strings.TrimSpace(condition) != ""
+	switch node.compare {
+	case "equals":
+		holds = condition == node.operand
+	case "notequals":
+		holds = condition != node.operand
+	}
+	if holds {
+		return f.render(node.then, item, nil)
+	}
+	return f.render(node.otherwise, item, nil)
+}
+
+// Pad s with spaces to width, placing it at the position
+func align(s string, width int, position string) string {
+	pad := width - len([]rune(s))
+	if pad <= 0 {
+		return s
+	}
+	switch position {
+	case "right":
+		return strings.Repeat(" ", pad) + s
+	case "middle":
+		return strings.Repeat(" ", pad/2) + s + strings.Repeat(" ", pad-pad/2)
+	}
+	return s + strings.Repeat(" ", pad)
+}
+
+// Return the value of an atom for a ref, with the number it sorts by for the numeric atoms: dates, sizes and counts
+func (f *refFormatter) atomValue(item *refItem, a refAtom) (string, int64, error) {
+	switch a.field {
+	case "refname":
+		value, err := f.refnameValue(item.name, a)
+		return value, 0, err
+	case "symref":
+		value, err := f.refnameValue(item.symbolic, a)
+		return value, 0, err
+	case "upstream":
+		value, err := f.upstreamValue(item, a)
+		return value, 0, err
+	case "HEAD":
+		if item.name != "" && item.name == f.head {
+			return "*", 0, nil
+		}
+		return " ", 0, nil
+	case "color":
+		// The output is never a terminal the colors would show on
+		return "", 0, nil
+	}
+	if a.deref {
+		item = item.tagged()
+	}
+	switch a.field {
+	case "objectname":
+		switch {
+		case a.modifier == "":
+			return item.hash, 0, nil
+		case a.modifier == "short":
+			return abbreviate(item.hash), 0, nil
+		case strings.HasPrefix(a.modifier, "short="):
+			n, err := strconv.Atoi(strings.TrimPrefix(a.modifier, "short="))
+			if err != nil || n <= 0 {
+				return "", 0, fmt.Errorf("positive value expected '%s' in %%(%s)", strings.TrimPrefix(a.modifier, "short="), a)
+			}
+			return item.hash[:min(max(n, minAbbrev), len(item.hash))], 0, nil
+		}
+		return "", 0, fmt.Errorf("unrecognized %%(%s) argument: %s", a, a.modifier)
+	case "objecttype":
+		objectType, _ := item.object()
+		return objectType, 0, noModifier(a)
+	case "objectsize":
+		_, content := item.object()
+		if item.hash == "" {
+			return "", 0, noModifier(a)
+		}
+		return strconv.Itoa(len(content)), int64(len(content)), noModifier(a)
+	case "subject", "body", "contents":
+		value, err := item.contentsValue(a)
+		return value, 0, err
+	}
+	if err := noModifierUnlessDate(a); err != nil {
+		return "", 0, err
+	}
+	objectType, content := item.object()
+	switch objectType {
+	case "commit":
+		commit, err := objects.ParseCommit(content)
+		if err != nil {
+			return "", 0, nil
+		}
+		return f.commitValue(commit, a)
+	case "tag":
+		tag, err := objects.ParseTag(content)
+		if err != nil {
+			return "", 0, nil
+		}
+		return f.tagValue(tag, a)
+	}
+	return "", 0, nil
+}
+
+// Refuse a modifier on the atoms that take none
+func noModifier(a refAtom) error {
+	if a.modifier != "" {
+		return fmt.Errorf("%%(%s) does not take arguments", a.field)
+	}
+	return nil
+}
+
+// Check the modifier of the fields of commits and tags: a date format for the dates, trim or localpart for the emails
+func noModifierUnlessDate(a refAtom) error {
+	switch {
+	case a.modifier == "":
+		return nil
+	case strings.HasSuffix(a.field, "date"):
+		_, err := ident.FormatDate(time.Time{}, a.modifier, time.Time{})
+		return err
+	case strings.HasSuffix(a.field, "email"):
+		if a.modifier != "trim" && a.modifier != "localpart" {
+			return fmt.Errorf("unrecognized email option: %s", a.modifier)
+		}
+		return nil
+	}
+	return noModifier(a)
+}
+
+func (f *refFormatter) commitValue(commit objects.Commit, a refAtom) (string, int64, error) {
+	switch a.field {
+	case "tree":
+		return string(commit.TreeSha), 0, nil
+	case "parent":
+		parents := make([]string, 0, len(commit.ParentShas))
+		for _, p := range commit.ParentShas {
+			parents = append(parents, string(p))
+		}
+		return strings.Join(parents, " "), 0, nil
+	case "numparent":
+		return strconv.Itoa(len(commit.ParentShas)), int64(len(commit.ParentShas)), nil
+	case "author", "authorname", "authoremail", "authordate":
+		return f.personValue(commit.Author, strings.TrimPrefix(a.field, "author"), a.modifier)
+	case "committer", "committername", "committeremail", "committerdate", "creator", "creatordate":
+		part := strings.TrimPrefix(strings.TrimPrefix(a.field, "committer"), "creator")
+		return f.personValue(commit.Committer, part, a.modifier)
+	}
+	return "", 0, nil
+}
+
+func (f *refFormatter) tagValue(tag objects.Tag, a refAtom) (string, int64, error) {
+	switch a.field {
+	case "object":
+		return string(tag.Object), 0, nil
+	case "type":
+		return tag.TargetType, 0, nil
+	case "tag":
+		return tag.Name, 0, nil
+	case "tagger", "taggername", "taggeremail", "taggerdate", "creator", "creatordate":
+		part := strings.TrimPrefix(strings.TrimPrefix(a.field, "tagger"), "creator")
+		return f.personValue(tag.Tagger, part, a.modifier)
+	}
+	return "", 0, nil
+}
+
+// Return a part of a "<name> <<email>> <timestamp> <timezone>" signature: all of it, "name", "email" or "date"
+func (f *refFormatter) personValue(signature []byte, part, modifier string) (string, int64, error) {
+	if part == "" {
+		return string(signature), 0, nil
+	}
+	sig, err := objects.ParseSignature(signature)
+	if err != nil {
+		return "", 0, nil
+	}
+	switch part {
+	case "name":
+		return sig.Name, 0, nil
+	case "email":
+		switch modifier {
+		case "trim":
+			return sig.Email, 0, nil
+		case "localpart":
+			local, _, _ := strings.Cut(sig.Email, "@")
+			return local, 0, nil
+		}
+		return "<" + sig.Email + ">", 0, nil
+	}
+	date, err := ident.FormatDate(sig.When, modifier, f.now)
+	return date, sig.When.Unix(), err
+}
+
+// Return a ref name as the modifier asks: whole, short, or with components stripped by lstrip=<n> or rstrip=<n>
+func (f *refFormatter) refnameValue(name string, a refAtom) (string, error) {
+	switch {
+	case a.modifier == "":
+		return name, nil
+	case a.modifier == "short":
+		if name == "" {
+			return "", nil
+		}
+		return refStore().ShortenUnambiguous(name), nil
+	case strings.HasPrefix(a.modifier, "lstrip=") || strings.HasPrefix(a.modifier, "strip="):
+		_, value, _ := strings.Cut(a.modifier, "=")
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("Integer value expected refname:lstrip=%s", value)
+		}
+		return stripComponents(name, n, false), nil
+	case strings.HasPrefix(a.modifier, "rstrip="):
+		n, err := strconv.Atoi(strings.TrimPrefix(a.modifier, "rstrip="))
+		if err != nil {
+			return "", fmt.Errorf("Integer value expected refname:rstrip=%s", strings.TrimPrefix(a.modifier, "rstrip="))
+		}
+		return stripComponents(name, n, true), nil
+	}
+	return "", fmt.Errorf("unrecognized %%(%s) argument: %s", a, a.modifier)
+}
+
+// Remove n components of a ref name from its start, or from its end when fromEnd is set,
+// a negative n keeping -n components instead
+func stripComponents(name string, n int, fromEnd bool) string {
+	if name == "" {
+		return ""
+	}
+	components := strings.Split(name, "/")
+	if n < 0 {
+		n = max(len(components)+n, 0)
+	}
+	if n >= len(components) {
+		return ""
+	}
+	if fromEnd {
+		return strings.Join(components[:len(components)-n], "/")
+	}
+	return strings.Join(components[n:], "/")
+}
+
+// Return the upstream of a branch, its name by the refname modifiers, or how the branch compares to it with track,
+// track,nobracket and trackshort; remotename and remoteref are the configuration it comes from
+func (f *refFormatter) upstreamValue(item *refItem, a refAtom) (string, error) {
+	branch, isBranch := strings.CutPrefix(item.name, "refs/heads/")
+	modifiers := strings.Split(a.modifier, ",")
+	switch modifiers[0] {
+	case "track", "trackshort":
+		noBracket := false
+		for _, m := range modifiers[1:] {
+			if m != "nobracket" || modifiers[0] == "trackshort" {
+				return "", fmt.Errorf("unrecognized %%(%s) argument: %s", a, a.modifier)
+			}
+			noBracket = true
+		}
+		if !isBranch {
+			return "", nil
+		}
+		state, ok := branchUpstreamState(branch)
+		if !ok {
+			return "", nil
+		}
+		if modifiers[0] == "trackshort" {
+			return state.short(), nil
+		}
+		track := state.String()
+		if track == "" || noBracket {
+			return track, nil
+		}
+		return "[" + track + "]", nil
+	case "remotename", "remoteref":
+		if !isBranch {
+			return "", nil
+		}
+		if _, ok := branchUpstream(branch); !ok {
+			return "", nil
+		}
+		key := "remote"
+		if modifiers[0] == "remoteref" {
+			key = "merge"
+		}
+		value, _ := configValue("branch." + branch + "." + key)
+		return value, nil
+	}
+	upstream := ""
+	if isBranch {
+		upstream, _ = branchUpstream(branch)
+	}
+	return f.refnameValue(upstream, a)
+}
+
+// How a branch compares to its upstream
+type upstreamState struct {
+	ref           string
+	ahead, behind int
+	// The upstream ref doesn't exist anymore
+	gone bool
+}
+
+// Return the upstream of a branch and how far the branch is from it, false when the branch has no upstream
+func branchUpstreamState(branch string) (upstreamState, bool) {
+	upstream, ok := branchUpstream(branch)
+	if !ok {
+		return upstreamState{}, false
+	}
+	state := upstreamState{ref: upstream}
+	store := refStore()
+	upstreamRef, err := store.Resolve(upstream)
+	if err != nil {
+		state.gone = true
+		return state, true
+	}
+	if local, err := store.Resolve("refs/heads/" + branch); err == nil {
+		state.ahead, state.behind = aheadBehind(local.Target, upstreamRef.Target)
+	}
+	return state, true
+}
+
+// Return "ahead 1, behind 2", "gone", or "" when the branch and its upstream are the same
+func (s upstreamState) String() string {
+	if s.gone {
+		return "gone"
+	}
+	counts := make([]string, 0, 2)
+	if s.ahead > 0 {
+		counts = append(counts, fmt.Sprintf("ahead %d", s.ahead))
+	}
+	if s.behind > 0 {
+		counts = append(counts, fmt.Sprintf("behind %d", s.behind))
+	}
+	return strings.Join(counts, ", ")
+}
+
+// Return ">" when ahead, "<" when behind, "<>" when both and "=" when neither, "" when the upstream is gone
+func (s upstreamState) short() string {
+	switch {
+	case s.gone:
+		return ""
+	case s.ahead > 0 && s.behind > 0:
+		return "<>"
+	case s.ahead > 0:
+		return ">"
+	case s.behind > 0:
+		return "<"
+	}
+	return "="
+}
+
+// Return the object a tag points to as a ref item of the same name, the item itself when it isn't a tag
+func (r *refItem) tagged() *refItem {
+	objectType, content := r.object()
+	if objectType != "tag" {
+		return &refItem{name: r.name, loaded: true}
+	}
+	tag, err := objects.ParseTag(content)
+	if err != nil {
+		return &refItem{name: r.name, loaded: true}
+	}
+	return &refItem{name: r.name, hash: string(tag.Object)}
+}
+
+// The parts of the message of a commit or tag
+type messageParts struct {
+	// From the subject to the end, signature included
+	contents string
+	subject  string
+	// From the paragraph after the subject, with and without the signature of a signed tag
+	body, bodyWithoutSignature string
+	signature                  string
+	// From the subject to the signature
+	withoutSignature string
+}
+
+// Split a message: the subject is its first paragraph, the body what follows the blank lines after it
+func splitMessage(message []byte) messageParts {
+	msg := strings.TrimLeft(string(message), "\n")
+	sigStart := signatureStart([]byte(msg))
+	parts := messageParts{contents: msg, signature: msg[sigStart:], withoutSignature: msg[:sigStart]}
+	end := sigStart
+	if i := strings.Index(msg, "\n\n"); i >= 0 && i < end {
+		end = i
+	} else if i := strings.Index(msg, "\r\n\r\n"); i >= 0 && i < end {
+		end = i
+	}
+	subject := strings.TrimRight(msg[:end], "\r\n")
+	parts.subject = strings.ReplaceAll(strings.ReplaceAll(subject, "\r\n", "\n"), "\n", " ")
+	bodyStart := end
+	for bodyStart < len(msg) && (msg[bodyStart] == '\n' || msg[bodyStart] == '\r') {
+		bodyStart++
+	}
+	parts.body = msg[bodyStart:]
+	parts.bodyWithoutSignature = msg[bodyStart:max(bodyStart, sigStart)]
+	return parts
+}
+
+// Return where the signature appended to a tag message starts, the length of the message when it has none
+func signatureStart(message []byte) int {
+	start := len(message)
+	for line := 0; line < len(message); {
+		for _, header := range signatureHeaders {
+			if bytes.HasPrefix(message[line:], []byte(header)) {
+				start = line
+			}
+		}
+		next := bytes.IndexByte(message[line:], '\n')
+		if next < 0 {
+			break
+		}
+		line += next + 1
+	}
+	return start
+}
+
+// Return the value of %(subject), %(body) and %(contents:<part>)
+func (r *refItem) contentsValue(a refAtom) (string, error) {
+	part := a.field
+	if a.field == "contents" && a.modifier != "" {
+		part = a.modifier
+	} else if a.modifier != "" {
+		return "", fmt.Errorf("unrecognized %%(%s) argument: %s", a.field, a.modifier)
+	}
+	lines := -1
+	if value, found := strings.CutPrefix(part, "lines="); found {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("positive value expected contents:lines=%s", value)
+		}
+		lines = n
+		part = "lines"
+	}
+	parts := splitMessage(r.message())
+	switch part {
+	case "contents":
+		return parts.contents, nil
+	case "subject":
+		return parts.subject, nil
+	case "body":
+		if a.field == "body" {
+			return parts.body, nil
+		}
+		return parts.bodyWithoutSignature, nil
+	case "signature":
+		return parts.signature, nil
+	case "lines":
+		return messageLines(parts.withoutSignature, lines), nil
+	}
+	return "", fmt.Errorf("unrecognized %%(contents) argument: %s", a.modifier)
+}
+
+// Return the first lines of a message, the lines past the first one indented by 4 spaces
+func messageLines(message string, lines int) string {
+	out := new(strings.Builder)
+	for i := 0; i < lines && message != ""; i++ {
+		if i > 0 {
+			out.WriteString("\n    ")
+		}
+		line, next, found := strings.Cut(message, "\n")
+		out.WriteString(line)
+		if !found {
+			break
+		}
+		message = next
+	}
+	return out.String()
+}
+
+// The quoting of the values for the languages of --shell, --perl, --python and --tcl
+var refFormatQuotes = map[string]func(string) string{
+	"--shell":  shellQuote,
+	"--perl":   perlQuote,
+	"--python": pythonQuote,
+	"--tcl":    tclQuote,
+}
+
+// Quote s between single quotes, closing them around the single quotes and the exclamation marks it holds
+func shellQuote(s string) string {
+	out := new(strings.Builder)
+	out.WriteByte('\'')
+	for _, c := range []byte(s) {
+		if c == '\'' || c == '!' {
+			out.WriteString("'\\" + string(c) + "'")
+			continue
+		}
+		out.WriteByte(c)
+	}
+	out.WriteByte('\'')
+	return out.String()
+}
+
+func perlQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func pythonQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(s) + "'"
+}
+
+func tclQuote(s string) string {
+	replacer := strings.NewReplacer(
+		"[", `\[`, "]", `\]`, "{", `\{`, "}", `\}`, "$", `\$`, `\`, `\\`, `"`, `\"`,
+		"\f", `\f`, "\r", `\r`, "\n", `\n`, "\t", `\t`, "\v", `\v`,
+	)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+// Return the comparison of a sort key: an atom like refname or creatordate, compared as a version with a
+// version: or v: prefix, in reverse order with a "-" prefix; dates, sizes and counts are compared as numbers
+func (f *refFormatter) comparison(key string) (func(a, b *refItem) int, error) {
+	key, reverse := strings.CutPrefix(key, "-")
+	version := false
+	for _, prefix := range []string{"version:", "v:"} {
+		if rest, found := strings.CutPrefix(key, prefix); found {
+			key, version = rest, true
+		}
+	}
+	a := parseRefAtom(key)
+	if !refAtomFields[a.field] {
+		return nil, fmt.Errorf("unknown field name: %s", a.field)
+	}
+	if _, _, err := f.atomValue(&refItem{loaded: true}, a); err != nil {
+		return nil, err
+	}
+	numeric := strings.HasSuffix(a.field, "date") || a.field == "objectsize" || a.field == "numparent"
+	suffixes := versionSortSuffixes()
+	compare := func(x, y *refItem) int {
+		valueX, numberX, _ := f.atomValue(x, a)
+		valueY, numberY, _ := f.atomValue(y, a)
+		switch {
+		case numeric:
+			return cmpInt64(numberX, numberY)
+		case version:
+			return versioncmp.Compare(valueX, valueY, suffixes)
+		}
+		return strings.Compare(valueX, valueY)
+	}
+	if reverse {
+		return func(x, y *refItem) int { return compare(y, x) }, nil
+	}
+	return compare, nil
+}
+
+func cmpInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Parse the format of a listing and sort its refs by the keys, the last key first, then by name
+func formatRefItems(items []*refItem, format string, sortKeys []string, quote func(string) string) ([]string, error) {
+	f, err := newRefFormatter(format)
+	if err != nil {
+		return nil, err
+	}
+	f.quote = quote
+	if err := f.sort(items, sortKeys); err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		line, err := f.format(item)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// Whether name is one of the refs a for-each-ref pattern selects: a glob, or a prefix ending at a slash
+func matchesRefPattern(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if wildmatch.Match(pattern, name, wildmatch.Pathname) {
+			return true
+		}
+		if rest, found := strings.CutPrefix(name, pattern); found && (rest == "" || rest[0] == '/' || strings.HasSuffix(pattern, "/")) {
+			return true
+		}
+	}
+	return false
+}
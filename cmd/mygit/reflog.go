@@ -0,0 +1,462 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	ident "github.com/codecrafters-io/git-starter-go/ident"
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+	refs "github.com/codecrafters-io/git-starter-go/refs"
+)
+
+// How long the reflog entries are kept by reflog expire, unless gc.reflogExpire and gc.reflogExpireUnreachable say otherwise
+const (
+	defaultReflogExpire            = "90 days ago"
+	defaultReflogExpireUnreachable = "30 days ago"
+)
+
+/*
+Command: mygit reflog [show] [-n <count>] [<ref>]
+Command: mygit reflog exists <ref>
+Command: mygit reflog delete [--rewrite] [--updateref] [--dry-run] <ref>@{<n>}...
+Command: mygit reflog expire [--expire=<time>] [--expire-unreachable=<time>] [--rewrite] [--updateref] [--dry-run] (--all | <ref>...)
+
+Show and edit the reflogs: where the refs pointed to before, newest entry first
+*/
+func reflogCommand(args []string) (string, error) {
+	if len(args) == 0 {
+		return reflogShow(args)
+	}
+	switch args[0] {
+	case "show":
+		return reflogShow(args[1:])
+	case "exists":
+		if len(args) != 2 {
+			return "", fmt.Errorf("usage: mygit reflog exists <ref>")
+		}
+		name, err := reflogName(args[1])
+		if err != nil || !refStore().HasLog(name) {
+			return "", errSilentFailure
+		}
+		return "", nil
+	case "delete":
+		return reflogDelete(args[1:])
+	case "expire":
+		return reflogExpire(args[1:])
+	}
+	return reflogShow(args)
+}
+
+// Return the name of the ref whose reflog is asked for: "" is the current branch, HEAD is HEAD itself,
+// and a short name like main is expanded
+func reflogName(name string) (string, error) {
+	store := refStore()
+	switch name {
+	case "":
+		return store.ResolveName("HEAD")
+	case "HEAD", "@":
+		return "HEAD", nil
+	}
+	if refs.IsPseudoRef(name) || strings.HasPrefix(name, "refs/") {
+		return name, nil
+	}
+	full, err := store.Expand(name)
+	if err == refs.ErrNotFound {
+		return "", fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree.", name)
+	}
+	return full, err
+}
+
+func reflogShow(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit reflog [show] [-n <count>] [<ref>]")
+	count := -1
+	operands := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-n" || arg == "--max-count":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				return "", usage
+			}
+			count = n
+		case strings.HasPrefix(arg, "--max-count="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-count="))
+			if err != nil {
+				return "", usage
+			}
+			count = n
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			n, err := strconv.Atoi(arg[1:])
+			if err != nil {
+				return "", usage
+			}
+			count = n
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	if len(operands) > 1 {
+		return "", usage
+	}
+	display := "HEAD"
+	if len(operands) == 1 {
+		display = operands[0]
+	}
+	name, err := reflogName(display)
+	if err != nil {
+		return "", err
+	}
+	entries, err := refStore().ReadLog(name)
+	if err == refs.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	out := new(strings.Builder)
+	for i := 0; i < len(entries) && i != count; i++ {
+		entry := entries[len(entries)-1-i]
+		fmt.Fprintf(out, "%s %s@{%d}: %s\n", abbreviate(entry.New), display, i, entry.Message)
+	}
+	return out.String(), nil
+}
+
+// Return the short form of an object name shown by log-like commands
+func abbreviate(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+// Parse "<ref>@{<n>}", the nth newest entry of a reflog
+func parseReflogEntryName(arg string) (string, int, error) {
+	base, selector, found := cutReflogSelector(arg)
+	if !found {
+		return "", 0, fmt.Errorf("'%s' is not a reflog entry, expected <ref>@{<n>}", arg)
+	}
+	n, err := strconv.Atoi(selector)
+	if err != nil || n < 0 {
+		return "", 0, fmt.Errorf("'%s' is not a reflog entry, expected <ref>@{<n>}", arg)
+	}
+	name, err := reflogName(base)
+	return name, n, err
+}
+
+func reflogDelete(args []string) (string, error) {
+	rewrite := false
+	updateRef := false
+	dryRun := false
+	byName := make(map[string][]int)
+	names := make([]string, 0)
+	for _, arg := range args {
+		switch arg {
+		case "--rewrite":
+			rewrite = true
+		case "--updateref":
+			updateRef = true
+		case "-n", "--dry-run":
+			dryRun = true
+		case "--verbose":
+		default:
+			name, n, err := parseReflogEntryName(arg)
+			if err != nil {
+				return "", err
+			}
+			if _, seen := byName[name]; !seen {
+				names = append(names, name)
+			}
+			byName[name] = append(byName[name], n)
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no reflog specified to delete")
+	}
+	for _, name := range names {
+		entries, err := refStore().ReadLog(name)
+		if err != nil {
+			return "", fmt.Errorf("reflog for '%s' not found", name)
+		}
+		remove := make([]bool, len(entries))
+		for _, n := range byName[name] {
+			if n >= len(entries) {
+				return "", fmt.Errorf("reflog for '%s' has no entry %d", name, n)
+			}
+			remove[len(entries)-1-n] = true
+		}
+		if err := rewriteReflog(name, entries, remove, rewrite, updateRef, dryRun); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func reflogExpire(args []string) (string, error) {
+	expire, _ := configValue("gc.reflogexpire")
+	if expire == "" {
+		expire = defaultReflogExpire
+	}
+	expireUnreachable, _ := configValue("gc.reflogexpireunreachable")
+	if expireUnreachable == "" {
+		expireUnreachable = defaultReflogExpireUnreachable
+	}
+	all := false
+	rewrite := false
+	updateRef := false
+	dryRun := false
+	names := make([]string, 0)
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--expire="):
+			expire = strings.TrimPrefix(arg, "--expire=")
+		case strings.HasPrefix(arg, "--expire-unreachable="):
+			expireUnreachable = strings.TrimPrefix(arg, "--expire-unreachable=")
+		case arg == "--all":
+			all = true
+		case arg == "--rewrite":
+			rewrite = true
+		case arg == "--updateref":
+			updateRef = true
+		case arg == "-n" || arg == "--dry-run":
+			dryRun = true
+		case arg == "--verbose" || arg == "--stale-fix":
+		case strings.HasPrefix(arg, "-"):
+			return "", fmt.Errorf("usage: mygit reflog expire [--expire=<time>] [--expire-unreachable=<time>] [--rewrite] [--updateref] [--dry-run] (--all | <ref>...)")
+		default:
+			name, err := reflogName(arg)
+			if err != nil {
+				return "", err
+			}
+			names = append(names, name)
+		}
+	}
+	now := time.Now()
+	before, err := parseExpiry(expire, now)
+	if err != nil {
+		return "", err
+	}
+	beforeUnreachable, err := parseExpiry(expireUnreachable, now)
+	if err != nil {
+		return "", err
+	}
+	store := refStore()
+	if all {
+		listed, err := store.List("refs/")
+		if err != nil {
+			return "", err
+		}
+		names = append(names, "HEAD")
+		for _, ref := range listed {
+			names = append(names, ref.Name)
+		}
+	}
+	for _, name := range names {
+		entries, err := store.ReadLog(name)
+		if err == refs.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		tip := ""
+		if ref, err := store.Resolve(name); err == nil {
+			tip = ref.Target
+		}
+		reachable := newReachability(tip)
+		remove := make([]bool, len(entries))
+		for i, entry := range entries {
+			when := entry.Committer.When
+			remove[i] = when.Before(before) || when.Before(beforeUnreachable) && !reachable.contains(entry.New)
+		}
+		if err := rewriteReflog(name, entries, remove, rewrite, updateRef, dryRun); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Return the time before which the entries expire: "never" keeps every entry, "now" or "all" drops every one
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	switch strings.ToLower(value) {
+	case "never", "false":
+		return time.Time{}, nil
+	case "now", "all":
+		// Entries written during this second expire too
+		return now.Add(time.Second), nil
+	}
+	t, err := parseApproxidate(value, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry date: %s", value)
+	}
+	return t, nil
+}
+
+// Parse a date like ParseDate, also accepting the dotted forms like 2.weeks.ago
+func parseApproxidate(value string, now time.Time) (time.Time, error) {
+	t, err := ident.ParseDate(value, now)
+	if err != nil && strings.Contains(value, ".") {
+		return ident.ParseDate(strings.ReplaceAll(value, ".", " "), now)
+	}
+	return t, err
+}
+
+// Write the reflog without the removed entries
+// With rewrite, an entry following a removed one starts from where the entry now preceding it ends,
+// with updateRef, the ref is moved to the newest entry left
+func rewriteReflog(name string, entries []refs.LogEntry, remove []bool, rewrite, updateRef, dryRun bool) error {
+	kept := make([]refs.LogEntry, 0, len(entries))
+	for i, entry := range entries {
+		if remove[i] {
+			if dryRun {
+				fmt.Printf("would prune %s\n", entry.Message)
+			}
+			continue
+		}
+		if rewrite && i > 0 && remove[i-1] {
+			if len(kept) > 0 {
+				entry.Old = kept[len(kept)-1].New
+			} else {
+				entry.Old = strings.Repeat("0", len(entry.Old))
+			}
+		}
+		kept = append(kept, entry)
+	}
+	if dryRun || len(kept) == len(entries) {
+		return nil
+	}
+	store := refStore()
+	if err := store.WriteLog(name, kept); err != nil {
+		return err
+	}
+	// The ref follows its newest entry when it was removed, the reflog already says where the ref is
+	if updateRef && remove[len(entries)-1] && len(kept) > 0 {
+		return store.Update(refs.Update{Name: name, New: kept[len(kept)-1].New, NoLog: true}, true)
+	}
+	return nil
+}
+
+// Find whether commits are reachable from a tip, walking its history once
+type reachability struct {
+	tip     string
+	visited map[string]bool
+	walked  bool
+}
+
+func newReachability(tip string) *reachability {
+	return &reachability{tip: tip, visited: make(map[string]bool)}
+}
+
+// Whether the commit is the tip or one of its ancestors
+func (r *reachability) contains(hash string) bool {
+	if !r.walked {
+		r.walked = true
+		r.walk()
+	}
+	return r.visited[hash]
+}
+
+func (r *reachability) walk() {
+	if r.tip == "" {
+		return
+	}
+	pending := []string{r.tip}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if r.visited[hash] {
+			continue
+		}
+		r.visited[hash] = true
+		objectType, content, err := readObject(hash)
+		if err != nil || objectType != "commit" {
+			continue
+		}
+		commit, err := objects.ParseCommit(content)
+		if err != nil {
+			continue
+		}
+		for _, parent := range commit.ParentShas {
+			pending = append(pending, string(parent))
+		}
+	}
+}
+
+// Split "<ref>@{<selector>}" into its ref and selector
+func cutReflogSelector(revision string) (string, string, bool) {
+	if !strings.HasSuffix(revision, "}") {
+		return "", "", false
+	}
+	open := strings.LastIndex(revision, "@{")
+	if open < 0 {
+		return "", "", false
+	}
+	return revision[:open], revision[open+2 : len(revision)-1], true
+}
+
+// Return the object a ref pointed to according to its reflog: "<ref>@{<n>}" is the nth previous value,
+// "<ref>@{<date>}" the value it had at that date, and without a ref the current branch is used
+func resolveReflogRevision(base, selector string) (string, error) {
+	name, err := reflogName(base)
+	if err != nil {
+		return "", err
+	}
+	display := base
+	if display == "" {
+		display = refs.ShortName(name)
+	}
+	if strings.HasPrefix(selector, "-") {
+		return "", fmt.Errorf("previously checked out branches are not supported: @{%s}", selector)
+	}
+	entries, err := refStore().ReadLog(name)
+	if err != nil && err != refs.ErrNotFound {
+		return "", err
+	}
+	if n, err := strconv.Atoi(selector); err == nil {
+		if n == 0 && len(entries) == 0 {
+			// The reflog may be off, @{0} is where the ref is now
+			ref, err := refStore().Resolve(name)
+			if err != nil {
+				return "", fmt.Errorf("log for '%s' is empty", display)
+			}
+			return ref.Target, nil
+		}
+		if n >= len(entries) {
+			if len(entries) == 0 {
+				return "", fmt.Errorf("log for '%s' is empty", display)
+			}
+			return "", fmt.Errorf("log for '%s' only has %d entries", display, len(entries))
+		}
+		return entries[len(entries)-1-n].New, nil
+	}
+	at, err := parseApproxidate(selector, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("invalid reflog selector: @{%s}", selector)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("log for '%s' is empty", display)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Committer.When.After(at) {
+			return entries[i].New, nil
+		}
+	}
+	first := entries[0]
+	fmt.Fprintf(os.Stderr, "warning: log for '%s' only goes back to %s\n", display, formatReflogDate(first.Committer))
+	if refs.IsZeroHash(first.Old) {
+		return first.New, nil
+	}
+	return first.Old, nil
+}
+
+// Return the date of a signature the way git prints it in its warnings: "Mon, 2 Jan 2006 15:04:05 -0700"
+func formatReflogDate(sig objects.Signature) string {
+	return sig.When.Format("Mon, 2 Jan 2006 15:04:05 ") + objects.FormatTimezone(sig.When)
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+	ident "github.com/codecrafters-io/git-starter-go/ident"
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+	refs "github.com/codecrafters-io/git-starter-go/refs"
+)
+
+// Return the refs of the repository, recording the updates in the reflogs as core.logAllRefUpdates asks
+func refStore() *refs.Store {
+	logAll := "false"
+	cfg, err := loadConfig()
+	if err == nil {
+		// The reflogs are on by default in a repository with a work tree
+		value, found := cfg.Get("core.logallrefupdates")
+		switch {
+		case !found:
+			logAll = strconv.FormatBool(!repo.Bare())
+		case strings.EqualFold(value, "always"):
+			logAll = "always"
+		default:
+			if b, err := config.ParseBool(value); err == nil {
+				logAll = strconv.FormatBool(b)
+			}
+		}
+	}
+	return refs.Open(repo.GitDir, refs.Options{
+		LogAllRefUpdates: logAll,
+		Committer: func() (objects.Signature, error) {
+			return ident.Get(ident.Committer, configValue)
+		},
+	})
+}
+
+/*
+Command: mygit update-ref [-m <reason>] [--no-deref] (-d <ref> [<old>] | <ref> <new> [<old>])
+Command: mygit update-ref [-m <reason>] [--no-deref] --stdin [-z]
+
+Point a ref to an object, or delete it, checking its current value first when <old> is given
+An empty or all-zero <old> means the ref must not exist yet
+With --stdin, the updates are read from the standard input and applied all together, see updateRefStdin
+*/
+func updateRef(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit update-ref [-m <reason>] [--no-deref] (-d <ref> [<old>] | <ref> <new> [<old>] | --stdin [-z])")
+	message := ""
+	noDeref := false
+	remove := false
+	stdin := false
+	nulTerminated := false
+	operands := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-m":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			i++
+			message = args[i]
+		case arg == "--no-deref":
+			noDeref = true
+		case arg == "-d":
+			remove = true
+		case arg == "--stdin":
+			stdin = true
+		case arg == "-z":
+			nulTerminated = true
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return "", usage
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	if stdin {
+		if remove || len(operands) != 0 {
+			return "", usage
+		}
+		return "", updateRefStdin(os.Stdin, os.Stdout, message, noDeref, nulTerminated)
+	}
+	if nulTerminated {
+		return "", usage
+	}
+	u := refs.Update{Delete: remove, Message: message}
+	switch {
+	case remove && (len(operands) == 1 || len(operands) == 2):
+		u.Name = operands[0]
+		operands = operands[1:]
+	case !remove && (len(operands) == 2 || len(operands) == 3):
+		u.Name = operands[0]
+		hash, err := resolveObject(operands[1])
+		if err != nil {
+			return "", err
+		}
+		u.New = hash
+		operands = operands[2:]
+	default:
+		return "", usage
+	}
+	if len(operands) == 1 {
+		old, err := resolveOldValue(operands[0])
+		if err != nil {
+			return "", err
+		}
+		u.Old = old
+	}
+	return "", refStore().Update(u, noDeref)
+}
+
+/*
+The commands of update-ref --stdin, one per line, or with -z each field terminated by a NUL byte:
+
+	update <ref> <new> [<old>]
+	create <ref> <new>
+	delete <ref> [<old>]
+	verify <ref> [<old>]
+	option no-deref
+	start
+	prepare
+	commit
+	abort
+
+The updates queued before a commit, or before the end of the input, are applied all together or not at all
+start, prepare, commit and abort answer "<command>: ok" on out
+*/
+func updateRefStdin(in io.Reader, out io.Writer, message string, noDeref, nulTerminated bool) error {
+	reader := bufio.NewReader(in)
+	store := refStore()
+	tx := store.NewTransaction()
+	// Whether the updates read so far are in a transaction opened by start
+	explicit := false
+	pending := false
+	nextNoDeref := false
+	for {
+		command, fields, err := readUpdateRefCommand(reader, nulTerminated)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			tx.Abort()
+			return err
+		}
+		switch command {
+		case "start":
+			if explicit || pending {
+				tx.Abort()
+				return fmt.Errorf("cannot start a transaction while another one is open")
+			}
+			explicit = true
+			fmt.Fprintln(out, "start: ok")
+			continue
+		case "prepare":
+			if err := tx.Prepare(); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "prepare: ok")
+			continue
+		case "commit":
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "commit: ok")
+			tx = store.NewTransaction()
+			explicit, pending = false, false
+			continue
+		case "abort":
+			tx.Abort()
+			fmt.Fprintln(out, "abort: ok")
+			tx = store.NewTransaction()
+			explicit, pending = false, false
+			continue
+		case "option":
+			if len(fields) != 1 || fields[0] != "no-deref" {
+				tx.Abort()
+				return fmt.Errorf("option unknown: %s", strings.Join(fields, " "))
+			}
+			nextNoDeref = true
+			continue
+		}
+		if err := queueUpdateRefCommand(tx, command, fields, message, noDeref || nextNoDeref); err != nil {
+			tx.Abort()
+			return err
+		}
+		nextNoDeref = false
+		pending = true
+	}
+	if explicit {
+		// A transaction opened by start is only applied by commit, it is dropped at the end of the input
+		tx.Abort()
+		return nil
+	}
+	return tx.Commit()
+}
+
+// Read one command of update-ref --stdin and its fields
+func readUpdateRefCommand(reader *bufio.Reader, nulTerminated bool) (string, []string, error) {
+	if !nulTerminated {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return "", nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return "", nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return "", nil, fmt.Errorf("empty command in input")
+		}
+		fields := strings.Split(line, " ")
+		return fields[0], fields[1:], nil
+	}
+	// With -z the command and the ref end with a space, or a NUL without arguments, then each value ends with a NUL
+	readField := func() (string, error) {
+		field, err := reader.ReadString(0)
+		if err == io.EOF {
+			return "", fmt.Errorf("unexpected end of input")
+		}
+		return strings.TrimSuffix(field, "\x00"), err
+	}
+	command, err := reader.ReadString(0)
+	if err == io.EOF && command == "" {
+		return "", nil, io.EOF
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("unexpected end of input")
+	}
+	command, ref, hasRef := strings.Cut(strings.TrimSuffix(command, "\x00"), " ")
+	if !hasRef {
+		return command, nil, nil
+	}
+	fields := []string{ref}
+	for i := 1; i < updateRefArity[command][1]; i++ {
+		value, err := readField()
+		if err != nil {
+			return "", nil, err
+		}
+		fields = append(fields, value)
+	}
+	return command, fields, nil
+}
+
+// The smallest and largest number of fields of the update-ref --stdin commands changing refs
+var updateRefArity = map[string][2]int{"update": {2, 3}, "create": {2, 2}, "delete": {1, 2}, "verify": {1, 2}}
+
+// Queue the update, create, delete or verify command of update-ref --stdin in the transaction
+func queueUpdateRefCommand(tx *refs.Transaction, command string, fields []string, message string, noDeref bool) error {
+	arity, found := updateRefArity[command]
+	if !found {
+		return fmt.Errorf("unknown command: %s", command)
+	}
+	min, max := arity[0], arity[1]
+	// An empty value is a missing one, like the old value of "update <ref> NUL <new> NUL NUL"
+	for len(fields) > min && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) < min || len(fields) > max {
+		return fmt.Errorf("%s: wrong number of arguments", command)
+	}
+	name := fields[0]
+	old := ""
+	if len(fields) > min {
+		var err error
+		if old, err = resolveOldValue(fields[min]); err != nil {
+			return err
+		}
+	}
+	switch command {
+	case "update", "create":
+		new, err := resolveObject(fields[1])
+		if err != nil {
+			return err
+		}
+		if command == "create" {
+			return tx.Create(name, new, message, noDeref)
+		}
+		return tx.Update(name, new, old, message, noDeref)
+	case "delete":
+		if refs.IsZeroHash(old) {
+			return fmt.Errorf("delete %s: zero <old-oid>", name)
+		}
+		return tx.Delete(name, old, message, noDeref)
+	}
+	// A missing old value means the ref must not exist
+	if old == "" {
+		old, _ = resolveOldValue("")
+	}
+	return tx.Verify(name, old, noDeref)
+}
+
+// Return the object name of a revision, refusing names of missing objects
+func resolveObject(revision string) (string, error) {
+	hash, err := resolveRevision(revision)
+	if err != nil {
+		return "", fmt.Errorf("%s: not a valid SHA1", revision)
+	}
+	if _, err := verifyObjectHash(hash); err != nil {
+		return "", fmt.Errorf("%s: not a valid SHA1", revision)
+	}
+	return hash, nil
+}
+
+// Return the value a ref is expected to have, all zeros when it must not exist
+func resolveOldValue(revision string) (string, error) {
+	zero := strings.Repeat("0", newObjectHash().Size()*2)
+	if revision == "" || refs.IsZeroHash(revision) {
+		return zero, nil
+	}
+	if refs.IsHash(revision) {
+		return revision, nil
+	}
+	hash, err := resolveRevision(revision)
+	if err != nil {
+		return "", fmt.Errorf("%s: not a valid old SHA1", revision)
+	}
+	return hash, nil
+}
+
+/*
+Command: mygit symbolic-ref [-m <reason>] <name> <ref>
+Command: mygit symbolic-ref [-q] [--short] <name>
+Command: mygit symbolic-ref --delete [-q] <name>
+
+Read, write or delete a symbolic ref
+*/
+func symbolicRef(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit symbolic-ref [-m <reason>] <name> <ref> | [-q] [--short] <name> | --delete [-q] <name>")
+	message := ""
+	quiet := false
+	short := false
+	remove := false
+	operands := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-m":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			i++
+			message = args[i]
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--short":
+			short = true
+		case arg == "-d" || arg == "--delete":
+			remove = true
+		case strings.HasPrefix(arg, "-"):
+			return "", usage
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	store := refStore()
+	switch {
+	case len(operands) == 2 && !remove:
+		if operands[0] == "HEAD" && !strings.HasPrefix(operands[1], "refs/") {
+			return "", fmt.Errorf("Refusing to point HEAD outside of refs/")
+		}
+		return "", store.SetSymbolic(operands[0], operands[1], message)
+	case len(operands) != 1:
+		return "", usage
+	}
+	ref, err := store.Read(operands[0])
+	if err == refs.ErrNotFound || err == nil && !ref.IsSymbolic() {
+		if quiet {
+			return "", errSilentFailure
+		}
+		return "", fmt.Errorf("ref %s is not a symbolic ref", operands[0])
+	}
+	if err != nil {
+		return "", err
+	}
+	if remove {
+		return "", store.Update(refs.Update{Name: operands[0], Delete: true, Message: message}, true)
+	}
+	if short {
+		return refs.ShortName(ref.Symbolic) + "\n", nil
+	}
+	return ref.Symbolic + "\n", nil
+}
+
+/*
+Command: mygit show-ref [--head] [--heads] [--tags] [-d] [-s] [-q] [--] [<pattern>...]
+Command: mygit show-ref --verify [-d] [-s] [-q] [--] [<ref>...]
+
+List the refs, or only those matching a pattern: "main" matches refs/heads/main and refs/remotes/origin/main
+*/
+func showRef(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit show-ref [--head] [--heads] [--tags] [-d] [-s] [-q] [--verify] [--] [<pattern>...]")
+	head := false
+	heads := false
+	tags := false
+	dereference := false
+	hashOnly := false
+	quiet := false
+	verify := false
+	patterns := make([]string, 0)
+	for i, arg := range args {
+		if arg == "--" {
+			patterns = append(patterns, args[i+1:]...)
+			break
+		}
+		switch {
+		case arg == "--head":
+			head = true
+		case arg == "--heads" || arg == "--branches":
+			heads = true
+		case arg == "--tags":
+			tags = true
+		case arg == "-d" || arg == "--dereference":
+			dereference = true
+		case arg == "-s" || arg == "--hash":
+			hashOnly = true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--verify":
+			verify = true
+		case strings.HasPrefix(arg, "-"):
+			return "", usage
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+	store := refStore()
+	found := make([]refs.Ref, 0)
+	if verify {
+		if len(patterns) == 0 {
+			return "", fmt.Errorf("--verify requires a reference")
+		}
+		for _, name := range patterns {
+			if name != "HEAD" && !strings.HasPrefix(name, "refs/") {
+				if quiet {
+					return "", errSilentFailure
+				}
+				return "", fmt.Errorf("'%s' - not a valid ref", name)
+			}
+			ref, err := store.Resolve(name)
+			if err != nil {
+				if quiet {
+					return "", errSilentFailure
+				}
+				return "", fmt.Errorf("'%s' - not a valid ref", name)
+			}
+			ref.Name = name
+			found = append(found, ref)
+		}
+	} else {
+		if head {
+			if ref, err := store.Resolve("HEAD"); err == nil {
+				ref.Name = "HEAD"
+				found = append(found, ref)
+			}
+		}
+		all, err := store.List("refs/")
+		if err != nil {
+			return "", err
+		}
+		for _, ref := range all {
+			if heads || tags {
+				isHead := strings.HasPrefix(ref.Name, "refs/heads/")
+				isTag := strings.HasPrefix(ref.Name, "refs/tags/")
+				if !(heads && isHead || tags && isTag) {
+					continue
+				}
+			}
+			if !matchesShowRefPattern(ref.Name, patterns) {
+				continue
+			}
+			if ref.IsSymbolic() {
+				resolved, err := store.Resolve(ref.Name)
+				if err != nil {
+					continue
+				}
+				ref.Target = resolved.Target
+			}
+			found = append(found, ref)
+		}
+	}
+	if len(found) == 0 {
+		return "", errSilentFailure
+	}
+	if quiet {
+		return "", nil
+	}
+	out := new(strings.Builder)
+	for _, ref := range found {
+		writeShowRefLine(out, ref.Target, ref.Name, hashOnly)
+		if !dereference {
+			continue
+		}
+		peeled := ref.Peeled
+		if peeled == "" {
+			var err error
+			if peeled, err = peelTag(ref.Target); err != nil {
+				return "", err
+			}
+		}
+		if peeled != "" {
+			writeShowRefLine(out, peeled, ref.Name+"^{}", hashOnly)
+		}
+	}
+	return out.String(), nil
+}
+
+func writeShowRefLine(out *strings.Builder, hash, name string, hashOnly bool) {
+	if hashOnly {
+		out.WriteString(hash + "\n")
+		return
+	}
+	out.WriteString(hash + " " + name + "\n")
+}
+
+// Whether name matches one of the show-ref patterns, by its whole name or its last components
+func matchesShowRefPattern(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if name == pattern || strings.HasSuffix(name, "/"+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Command: mygit pack-refs [--all] [--no-prune]
+
+Move the loose tags, or every loose ref with --all, into the packed-refs file
+*/
+func packRefs(args []string) (string, error) {
+	all := false
+	for _, arg := range args {
+		switch arg {
+		case "--all":
+			all = true
+		case "--prune":
+		case "--no-prune":
+			// Loose refs are always pruned once packed, there is no reason to keep both copies
+		default:
+			return "", fmt.Errorf("usage: mygit pack-refs [--all] [--no-prune]")
+		}
+	}
+	return "", refStore().Pack(all, peelTag)
+}
+
+/*
+Command: mygit check-ref-format [--normalize] [--[no-]allow-onelevel] [--refspec-pattern] <refname>
+Command: mygit check-ref-format --branch <branchname>
+
+Exit with 1 when the name isn't a valid ref name
+*/
+func checkRefFormat(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit check-ref-format [--normalize] [--[no-]allow-onelevel] [--refspec-pattern] <refname> | --branch <branchname>")
+	flags := refs.FormatFlags(0)
+	normalize := false
+	branch := false
+	operands := make([]string, 0)
+	for _, arg := range args {
+		switch arg {
+		case "--normalize", "--print":
+			normalize = true
+		case "--allow-onelevel":
+			flags |= refs.AllowOneLevel
+		case "--no-allow-onelevel":
+			flags &^= refs.AllowOneLevel
+		case "--refspec-pattern":
+			flags |= refs.RefspecPattern
+		case "--branch":
+			branch = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return "", usage
+			}
+			operands = append(operands, arg)
+		}
+	}
+	if len(operands) != 1 {
+		return "", usage
+	}
+	name := operands[0]
+	if branch {
+		if strings.HasPrefix(name, "-") || refs.CheckRefFormat("refs/heads/"+name, 0) != nil {
+			return "", fmt.Errorf("'%s' is not a valid branch name", name)
+		}
+		return name + "\n", nil
+	}
+	if normalize {
+		name = refs.NormalizeRefName(name)
+	}
+	if refs.CheckRefFormat(name, flags) != nil {
+		return "", errSilentFailure
+	}
+	if normalize {
+		return name + "\n", nil
+	}
+	return "", nil
+}
+
+// The commands reading and writing refs, by name
+var refCommands = map[string]func(args []string) (string, error){
+	"update-ref":       updateRef,
+	"symbolic-ref":     symbolicRef,
+	"show-ref":         showRef,
+	"pack-refs":        packRefs,
+	"check-ref-format": checkRefFormat,
+	"reflog":           reflogCommand,
+	"branch":           branchCommand,
+	"tag":              tagCommand,
+	"for-each-ref":     forEachRef,
+}
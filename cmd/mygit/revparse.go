@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	refs "github.com/codecrafters-io/git-starter-go/refs"
+)
+
+// Returned by the commands that fail without a message, exiting with 1 like git
+var errSilentFailure = errors.New("silent failure")
+
+// Hex object names shorter than this are not looked up
+const minAbbrev = 4
+
+/*
+Command: mygit rev-parse [--show-toplevel | --show-cdup | --show-prefix | --git-dir | --absolute-git-dir | --is-inside-work-tree | --is-bare-repository]...
+Command: mygit rev-parse [--verify [-q]] <revision>...
+
+Show where the repository and the current directory are, or the object names of revisions
+*/
+func revParse(args []string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	usage := fmt.Errorf("usage: mygit rev-parse [--show-toplevel | --show-cdup | --show-prefix | --git-dir | --absolute-git-dir | --is-inside-work-tree | --is-bare-repository | --verify [-q] <revision> | <revision>]...")
+	out := new(strings.Builder)
+	verify := false
+	quiet := false
+	revisions := make([]string, 0)
+	for _, arg := range args {
+		switch arg {
+		case "--verify":
+			verify = true
+		case "-q", "--quiet":
+			quiet = true
+		case "--show-toplevel":
+			if repo.Bare() {
+				return "", fmt.Errorf("this operation must be run in a work tree")
+			}
+			out.WriteString(repo.WorkTree + "\n")
+		case "--show-cdup":
+			out.WriteString(strings.Repeat("../", strings.Count(repo.Prefix, "/")) + "\n")
+		case "--show-prefix":
+			out.WriteString(repo.Prefix + "\n")
+		case "--git-dir":
+			out.WriteString(repo.DisplayGitDir(cwd) + "\n")
+		case "--absolute-git-dir":
+			out.WriteString(repo.GitDir + "\n")
+		case "--is-inside-work-tree":
+			inside := !repo.Bare() && (cwd == repo.WorkTree || strings.HasPrefix(cwd, repo.WorkTree+"/"))
+			out.WriteString(fmt.Sprintf("%t\n", inside))
+		case "--is-bare-repository":
+			out.WriteString(fmt.Sprintf("%t\n", repo.Bare()))
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return "", usage
+			}
+			revisions = append(revisions, arg)
+		}
+	}
+	if verify && len(revisions) != 1 {
+		if quiet {
+			return "", errSilentFailure
+		}
+		return "", fmt.Errorf("Needed a single revision")
+	}
+	for _, revision := range revisions {
+		hash, err := resolveRevision(revision)
+		switch {
+		case err != nil && verify && quiet:
+			return "", errSilentFailure
+		case err != nil && verify:
+			return "", fmt.Errorf("Needed a single revision")
+		case err != nil:
+			return "", err
+		}
+		out.WriteString(hash + "\n")
+	}
+	return out.String(), nil
+}
+
+// Return the object name a revision stands for: a full or abbreviated object name, a ref name like
+// HEAD, main, tags/v1.0 or refs/heads/main, or a reflog entry like main@{1} or HEAD@{yesterday}
+func resolveRevision(revision string) (string, error) {
+	unknown := fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree.", revision)
+	if refs.IsHash(revision) && len(revision) == newObjectHash().Size()*2 {
+		return revision, nil
+	}
+	if base, selector, found := cutReflogSelector(revision); found {
+		return resolveReflogRevision(base, selector)
+	}
+	// "@" alone is a shortcut for HEAD
+	if revision == "@" {
+		revision = "HEAD"
+	}
+	store := refStore()
+	name, err := store.Expand(revision)
+	if err == nil {
+		ref, err := store.Resolve(name)
+		if err != nil {
+			return "", err
+		}
+		return ref.Target, nil
+	}
+	if err != refs.ErrNotFound {
+		return "", err
+	}
+	matches, err := findObjectsByPrefix(revision)
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", unknown
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("short object ID %s is ambiguous", revision)
+}
+
+// Return the names of the objects starting with an abbreviated hex name
+func findObjectsByPrefix(prefix string) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < minAbbrev || len(prefix) > newObjectHash().Size()*2 {
+		return nil, nil
+	}
+	for _, c := range prefix {
+		if !('0' <= c && c <= '9') && !('a' <= c && c <= 'f') {
+			return nil, nil
+		}
+	}
+	entries, err := os.ReadDir(repo.Path("objects", prefix[:2]))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]string, 0)
+	for _, entry := range entries {
+		name := prefix[:2] + entry.Name()
+		if strings.HasPrefix(name, prefix) && filepath.Ext(name) == "" {
+			matches = append(matches, name)
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,920 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+	index "github.com/codecrafters-io/git-starter-go/index"
+	pathspec "github.com/codecrafters-io/git-starter-go/pathspec"
+	refs "github.com/codecrafters-io/git-starter-go/refs"
+	renames "github.com/codecrafters-io/git-starter-go/renames"
+)
+
+// The output formats of status
+const (
+	statusLong = iota
+	statusShort
+	statusPorcelain
+	statusPorcelainV2
+)
+
+type statusOptions struct {
+	format int
+	branch bool
+	// Separate the entries with NUL bytes, without quoting the paths
+	nul bool
+	// "no", "normal" to show the untracked directories as a whole, or "all"
+	untracked string
+	// "no", "traditional" to show the ignored files like the untracked ones, or "matching" to show the paths
+	// matching the ignore rules
+	ignored string
+	// The similarity a staged rename needs, 0 not to detect renames
+	renameScore int
+	showStash   bool
+}
+
+// The changes of a path: between HEAD and the index, the staged changes, and between the index and the work tree,
+// the unstaged changes
+type statusEntry struct {
+	path string
+	// The path in HEAD of a staged rename
+	origPath string
+	// ' ' unchanged, 'M' modified, 'T' type changed, 'A' added, 'D' deleted or 'R' renamed
+	// An unmerged path has the two letters of its conflict instead, like "UU" when both sides modified it
+	staged, unstaged byte
+	// The similarity of a rename, out of renames.MaxScore
+	score                             int
+	headMode, indexMode, worktreeMode uint32
+	headHash, indexHash               string
+	// The entries of the base, ours and theirs stages of an unmerged path
+	stages [3]*index.Entry
+	// The commit of a gitlink differs from the one checked out in its repository
+	submoduleChanged bool
+}
+
+// What status shows
+type repoStatus struct {
+	// The short name of the current branch, "" when HEAD is detached
+	branch string
+	// The commit of HEAD, "" before the first commit
+	head    string
+	entries []*statusEntry
+	// The untracked paths, the directories ending with a slash
+	untracked []string
+	// The ignored paths, shown with --ignored
+	ignored    []string
+	stashCount int
+}
+
+/*
+Command: mygit status [-s | --short | --long | --porcelain[=v1|v2]] [-b | --branch] [-z] [--show-stash]
+
+	[-u[<mode>] | --untracked-files[=<mode>]] [--ignored[=<mode>]] [--no-renames | --find-renames[=<n>]]
+	[--] [<pathspec>...]
+
+Show the changes staged for the next commit, the changes of the work tree not staged yet and the untracked files,
+the ignored files too with --ignored
+--short shows a line per path with the letters of its staged and unstaged changes, --porcelain does the same with
+paths from the top of the work tree, and --porcelain=v2 adds the modes and objects of HEAD, the index and the work tree
+*/
+func statusCommand(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit status [-s | --short | --long | --porcelain[=v1|v2]] [-b | --branch] [-z] [--show-stash] [-u[<mode>] | --untracked-files[=<mode>]] [--ignored[=<mode>]] [--no-renames | --find-renames[=<n>]] [--] [<pathspec>...]")
+	opts := statusOptions{untracked: "normal", ignored: "no", renameScore: renames.DefaultMinScore}
+	if value, found := configValue("status.showuntrackedfiles"); found {
+		opts.untracked = value
+	}
+	if value, found := configValue("status.short"); found {
+		if short, err := config.ParseBool(value); err == nil && short {
+			opts.format = statusShort
+		}
+	}
+	if value, found := configValue("status.branch"); found {
+		opts.branch, _ = config.ParseBool(value)
+	}
+	if value, found := configValue("status.showstash"); found {
+		opts.showStash, _ = config.ParseBool(value)
+	}
+	for _, key := range []string{"diff.renames", "status.renames"} {
+		if value, found := configValue(key); found {
+			if detect, err := config.ParseBool(value); err == nil && !detect {
+				opts.renameScore = 0
+			} else if err == nil {
+				opts.renameScore = renames.DefaultMinScore
+			}
+		}
+	}
+	pathspecs := make([]string, 0)
+	formatGiven := false
+	for i, arg := range args {
+		if arg == "--" {
+			pathspecs = append(pathspecs, args[i+1:]...)
+			break
+		}
+		switch {
+		case arg == "-s" || arg == "--short":
+			opts.format, formatGiven = statusShort, true
+		case arg == "--long":
+			opts.format, formatGiven = statusLong, true
+		case arg == "--porcelain" || arg == "--porcelain=v1":
+			opts.format, formatGiven = statusPorcelain, true
+		case arg == "--porcelain=v2":
+			opts.format, formatGiven = statusPorcelainV2, true
+		case strings.HasPrefix(arg, "--porcelain="):
+			return "", fmt.Errorf("unsupported porcelain version '%s'", strings.TrimPrefix(arg, "--porcelain="))
+		case arg == "-b" || arg == "--branch":
+			opts.branch = true
+		case arg == "--no-branch":
+			opts.branch = false
+		case arg == "-z":
+			opts.nul = true
+		case arg == "--show-stash":
+			opts.showStash = true
+		case arg == "--no-show-stash":
+			opts.showStash = false
+		case arg == "-u" || arg == "--untracked-files":
+			opts.untracked = "all"
+		case strings.HasPrefix(arg, "-u"):
+			opts.untracked = strings.TrimPrefix(arg, "-u")
+		case strings.HasPrefix(arg, "--untracked-files="):
+			opts.untracked = strings.TrimPrefix(arg, "--untracked-files=")
+		case arg == "--ignored":
+			opts.ignored = "traditional"
+		case strings.HasPrefix(arg, "--ignored="):
+			opts.ignored = strings.TrimPrefix(arg, "--ignored=")
+			if opts.ignored != "no" && opts.ignored != "traditional" && opts.ignored != "matching" {
+				return "", fmt.Errorf("Invalid ignored mode '%s'", opts.ignored)
+			}
+		case arg == "--no-renames":
+			opts.renameScore = 0
+		case arg == "--renames" || arg == "--find-renames":
+			opts.renameScore = renames.DefaultMinScore
+		case strings.HasPrefix(arg, "--find-renames=") || strings.HasPrefix(arg, "-M"):
+			value := strings.TrimPrefix(strings.TrimPrefix(arg, "--find-renames="), "-M")
+			score, err := parseRenameScore(value)
+			if err != nil {
+				return "", err
+			}
+			opts.renameScore = score
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return "", usage
+		default:
+			pathspecs = append(pathspecs, arg)
+		}
+	}
+	switch opts.untracked {
+	case "no", "normal", "all":
+	case "false":
+		opts.untracked = "no"
+	case "true":
+		opts.untracked = "normal"
+	default:
+		return "", fmt.Errorf("Invalid untracked files mode '%s'", opts.untracked)
+	}
+	// -z alone is the porcelain format
+	if opts.nul && !formatGiven && opts.format == statusLong {
+		opts.format = statusPorcelain
+	}
+	if repo.Bare() {
+		return "", fmt.Errorf("this operation must be run in a work tree")
+	}
+	ps, err := parsePathspec(pathspecs, repo.Prefix, pathspec.Options{})
+	if err != nil {
+		return "", err
+	}
+	st, err := collectStatus(ps, opts)
+	if err != nil {
+		return "", err
+	}
+	out := new(strings.Builder)
+	switch opts.format {
+	case statusLong:
+		st.writeLong(out, opts)
+	case statusPorcelainV2:
+		st.writePorcelainV2(out, opts)
+	default:
+		st.writeShort(out, opts)
+	}
+	return out.String(), nil
+}
+
+// Parse the minimum similarity of a rename: a number of tenths, like 5 for 50%, or a percentage like 75%
+func parseRenameScore(value string) (int, error) {
+	if value == "" {
+		return renames.DefaultMinScore, nil
+	}
+	invalid := fmt.Errorf("invalid argument to --find-renames: %s", value)
+	if percent, found := strings.CutSuffix(value, "%"); found {
+		n, err := strconv.ParseFloat(percent, 64)
+		if err != nil || n < 0 || n > 100 {
+			return 0, invalid
+		}
+		return int(n * renames.MaxScore / 100), nil
+	}
+	// The digits are the decimals of a fraction: 5 is 0.5 and 75 is 0.75
+	n, err := strconv.ParseFloat("0."+value, 64)
+	if err != nil {
+		return 0, invalid
+	}
+	return int(n * renames.MaxScore), nil
+}
+
+// Compare HEAD, the index and the work tree for the paths matching the pathspec
+// The stat data of the entries found unchanged is refreshed in the index when it can be locked
+func collectStatus(ps *pathspec.Pathspec, opts statusOptions) (*repoStatus, error) {
+	st := &repoStatus{}
+	store := refStore()
+	if branch, ok := currentBranch(); ok {
+		st.branch = refs.ShortName(branch)
+	}
+	if head, err := store.Resolve("HEAD"); err == nil {
+		st.head = head.Target
+	}
+	if entries, err := store.ReadLog("refs/stash"); err == nil {
+		st.stashCount = len(entries)
+	}
+	headEntries := make([]index.Entry, 0)
+	if st.head != "" {
+		tree, err := resolveTree(st.head)
+		if err != nil {
+			return nil, err
+		}
+		if headEntries, err = readTreeEntries(tree); err != nil {
+			return nil, err
+		}
+	}
+	// The index is only written back when it can be locked, another command may be using it
+	idx, lock, err := lockIndex()
+	if err != nil {
+		if idx, err = readIndex(); err != nil {
+			return nil, err
+		}
+	}
+	refreshed := false
+
+	byPath := make(map[string]*statusEntry)
+	entry := func(name string) *statusEntry {
+		if e, found := byPath[name]; found {
+			return e
+		}
+		e := &statusEntry{path: name, staged: ' ', unstaged: ' '}
+		byPath[name] = e
+		return e
+	}
+	for _, h := range headEntries {
+		if !ps.Match(h.Path, false) {
+			continue
+		}
+		e := entry(h.Path)
+		e.headMode, e.headHash = h.Mode, h.Hash
+	}
+	for i := range idx.Entries {
+		ie := &idx.Entries[i]
+		if !ps.Match(ie.Path, false) {
+			continue
+		}
+		e := entry(ie.Path)
+		if ie.Stage > 0 {
+			e.stages[ie.Stage-1] = ie
+			continue
+		}
+		e.indexMode, e.indexHash = ie.Mode, ie.Hash
+		change, mode, stat, err := worktreeChange(idx, *ie)
+		if err != nil {
+			return nil, err
+		}
+		e.unstaged, e.worktreeMode = change, mode
+		if change == 'M' && ie.Mode == index.ModeGitlink {
+			e.submoduleChanged = true
+		}
+		if stat != nil {
+			ie.Stat = *stat
+			refreshed = true
+		}
+		if ie.IntentToAdd {
+			// The path is tracked, but none of its content is staged
+			e.indexMode, e.indexHash = 0, ""
+			e.unstaged = 'A'
+		}
+	}
+
+	deleted := make([]renames.File, 0)
+	added := make([]renames.File, 0)
+	for _, e := range byPath {
+		if e.stages != [3]*index.Entry{} {
+			e.staged, e.unstaged = unmergedLetters(e.stages)
+			e.indexMode, e.indexHash = 0, ""
+			if info, err := os.Lstat(filepath.Join(repo.WorkTree, e.path)); err == nil {
+				e.worktreeMode = index.ModeFromFileMode(info.Mode())
+			}
+			continue
+		}
+		switch {
+		case e.indexHash == "" && e.headHash != "":
+			e.staged = 'D'
+			deleted = append(deleted, renames.File{Path: e.path, Hash: e.headHash, Mode: e.headMode})
+		case e.indexHash != "" && e.headHash == "":
+			e.staged = 'A'
+			added = append(added, renames.File{Path: e.path, Hash: e.indexHash, Mode: e.indexMode})
+		case e.indexHash == "":
+		case e.headMode&0o170000 != e.indexMode&0o170000:
+			e.staged = 'T'
+		case e.headHash != e.indexHash || e.headMode != e.indexMode:
+			e.staged = 'M'
+		}
+	}
+	if opts.renameScore > 0 && len(deleted) > 0 && len(added) > 0 {
+		sort.Slice(deleted, func(i, j int) bool { return deleted[i].Path < deleted[j].Path })
+		sort.Slice(added, func(i, j int) bool { return added[i].Path < added[j].Path })
+		pairs, err := renames.Detect(deleted, added, opts.renameScore, readBlob)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range pairs {
+			e := byPath[pair.Dst.Path]
+			e.staged, e.origPath, e.score = 'R', pair.Src.Path, pair.Score
+			e.headMode, e.headHash = pair.Src.Mode, pair.Src.Hash
+			delete(byPath, pair.Src.Path)
+		}
+	}
+	for _, e := range byPath {
+		if e.staged != ' ' || e.unstaged != ' ' {
+			st.entries = append(st.entries, e)
+		}
+	}
+	sort.Slice(st.entries, func(i, j int) bool { return st.entries[i].path < st.entries[j].path })
+
+	if opts.untracked != "no" {
+		if st.untracked, st.ignored, err = untrackedFiles(idx, ps, opts); err != nil {
+			return nil, err
+		}
+	}
+	if lock != nil {
+		if refreshed {
+			if err := commitIndex(lock, idx); err != nil {
+				return nil, err
+			}
+		} else {
+			lock.Rollback()
+		}
+	}
+	return st, nil
+}
+
+// Return the content of a blob
+func readBlob(hash string) ([]byte, error) {
+	objectType, content, err := readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != "blob" {
+		return nil, fmt.Errorf("object %s is a %s, not a blob", hash, objectType)
+	}
+	return content, nil
+}
+
+// Return the letters of a conflict from the stages the path has: "UU" when both sides modified it, "AA" when both
+// added it, "DD" when both deleted it, "AU" or "UA" when one side added it, "UD" or "DU" when one side deleted it
+func unmergedLetters(stages [3]*index.Entry) (byte, byte) {
+	mask := 0
+	for i, stage := range stages {
+		if stage != nil {
+			mask |= 1 << i
+		}
+	}
+	letters := map[int]string{1: "DD", 2: "AU", 3: "UD", 4: "UA", 5: "DU", 6: "AA", 7: "UU"}[mask]
+	return letters[0], letters[1]
+}
+
+// Compare a merged entry of the index with its file in the work tree: return ' ' when it is unchanged, 'M' when it
+// was modified, 'T' when its type changed and 'D' when it was deleted, with the mode of the file
+// The stat data the entry should be refreshed with is also returned when only the stat data changed
+// The stat data of an entry is only trusted when the entry isn't racily clean, the content is compared otherwise
+func worktreeChange(idx *index.Index, e index.Entry) (byte, uint32, *index.Stat, error) {
+	if e.AssumeValid || e.SkipWorktree {
+		return ' ', e.Mode, nil, nil
+	}
+	file := filepath.Join(repo.WorkTree, e.Path)
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+		return 'D', 0, nil, nil
+	}
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if info.IsDir() {
+		switch {
+		case e.Mode == index.ModeGitlink:
+			// A submodule not checked out is unchanged
+			commit, err := resolveGitlink(file)
+			if err != nil || fmt.Sprintf("%x", commit) == e.Hash {
+				return ' ', e.Mode, nil, nil
+			}
+			return 'M', e.Mode, nil, nil
+		case isNestedRepository(file):
+			return 'T', index.ModeGitlink, nil, nil
+		}
+		// A directory where a file was is only untracked content, the file is deleted
+		return 'D', 0, nil, nil
+	}
+	mode := worktreeMode(e, info)
+	if mode&0o170000 != e.Mode&0o170000 {
+		return 'T', mode, nil, nil
+	}
+	stat := index.StatFromFileInfo(info)
+	if e.Stat == stat && mode == e.Mode && !idx.IsRacy(e) {
+		return ' ', mode, nil, nil
+	}
+	if e.Stat.Size != stat.Size && e.Stat.Size != 0 && e.Mode != index.ModeSymlink {
+		// Not worth reading, unless a filter may change the size, or the entry has no stat data
+		return 'M', mode, nil, nil
+	}
+	current, err := hashFile(e.Path, info)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if current.Hash != e.Hash || mode != e.Mode {
+		return 'M', mode, nil, nil
+	}
+	if e.Stat == stat {
+		return ' ', mode, nil, nil
+	}
+	return ' ', mode, &stat, nil
+}
+
+// Return the mode of the file of an entry, keeping the executable bit of the entry when core.fileMode is false, and
+// its symlink mode when core.symlinks is false and the symlink was checked out as a plain file
+func worktreeMode(e index.Entry, info os.FileInfo) uint32 {
+	mode := index.ModeFromFileMode(info.Mode())
+	if value, found := configValue("core.symlinks"); found && e.Mode == index.ModeSymlink && mode&0o170000 == 0o100000 {
+		if symlinks, err := config.ParseBool(value); err == nil && !symlinks {
+			return e.Mode
+		}
+	}
+	if value, found := configValue("core.filemode"); found {
+		if trust, err := config.ParseBool(value); err == nil && !trust && mode&0o170000 == 0o100000 && e.Mode&0o170000 == 0o100000 {
+			return e.Mode
+		}
+	}
+	return mode
+}
+
+// Return the untracked files and the ignored files of the work tree matching the pathspec, sorted, the ignored ones
+// only with --ignored
+// Unless the untracked files are all shown, a directory holding no tracked file is shown as a whole, as its path
+// ending with a slash: untracked when it holds an untracked file, ignored when all its files are ignored, its ignored
+// content being shown apart otherwise; the repositories nested in the work tree are shown the same way
+// The ignored directories are shown as a whole too, unless all the ignored files are shown in the traditional mode
+func untrackedFiles(idx *index.Index, ps *pathspec.Pathspec, opts statusOptions) ([]string, []string, error) {
+	tracked := make(map[string]bool)
+	trackedDirs := make(map[string]bool)
+	for _, e := range idx.Entries {
+		tracked[e.Path] = true
+		for dir := path.Dir(e.Path); dir != "."; dir = path.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+	m, err := newIgnoreMatcher()
+	if err != nil {
+		return nil, nil, err
+	}
+	all := opts.untracked == "all"
+	showIgnored := opts.ignored != "no"
+	// Walk a directory whose content is ignored when excluded is set
+	var walk func(dir string, excluded bool) ([]string, []string, error)
+	walk = func(dir string, excluded bool) ([]string, []string, error) {
+		untracked, ignored := make([]string, 0), make([]string, 0)
+		entries, err := os.ReadDir(filepath.Join(repo.WorkTree, dir))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, e := range entries {
+			if e.Name() == ".git" || !e.IsDir() && !e.Type().IsRegular() && e.Type()&os.ModeSymlink == 0 {
+				continue
+			}
+			name := path.Join(dir, e.Name())
+			nested := e.IsDir() && isNestedRepository(filepath.Join(repo.WorkTree, name))
+			if (!e.IsDir() || nested) && tracked[name] {
+				continue
+			}
+			isIgnored := excluded
+			if !isIgnored {
+				p := m.MatchName(name, e.IsDir())
+				isIgnored = p != nil && !p.Negated
+			}
+			if isIgnored && !showIgnored {
+				continue
+			}
+			if !e.IsDir() || nested {
+				suffix := ""
+				if nested {
+					suffix = "/"
+				}
+				switch {
+				case !ps.Match(name, e.IsDir()):
+				case isIgnored:
+					ignored = append(ignored, name+suffix)
+				default:
+					untracked = append(untracked, name+suffix)
+				}
+				continue
+			}
+			if !ps.Match(name, true) && !ps.MayMatchUnder(name) {
+				continue
+			}
+			collapse := !trackedDirs[name] && ps.Match(name, true)
+			if isIgnored && !excluded && collapse && (!all || opts.ignored == "matching") {
+				if found, err := holdsFiles(name); err != nil {
+					return nil, nil, err
+				} else if found {
+					ignored = append(ignored, name+"/")
+				}
+				continue
+			}
+			subUntracked, subIgnored, err := walk(name, isIgnored)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch {
+			case !collapse || all:
+				untracked = append(untracked, subUntracked...)
+				ignored = append(ignored, subIgnored...)
+			case len(subUntracked) > 0:
+				untracked = append(untracked, name+"/")
+				ignored = append(ignored, subIgnored...)
+			case len(subIgnored) > 0 && opts.ignored == "traditional":
+				ignored = append(ignored, name+"/")
+			default:
+				ignored = append(ignored, subIgnored...)
+			}
+		}
+		return untracked, ignored, nil
+	}
+	untracked, ignored, err := walk("", false)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(untracked)
+	sort.Strings(ignored)
+	return untracked, ignored, nil
+}
+
+// Whether a directory of the work tree holds a file, in it or in its subdirectories
+func holdsFiles(dir string) (bool, error) {
+	entries, err := os.ReadDir(filepath.Join(repo.WorkTree, dir))
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+		if !e.IsDir() || isNestedRepository(filepath.Join(repo.WorkTree, name)) {
+			return true, nil
+		}
+		if found, err := holdsFiles(name); err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// Return a path as status shows it: relative to the current directory unless status.relativePaths is false or the
+// format is porcelain v1, and quoted unless the entries are separated with NUL bytes, the paths holding a space too
+// in the short format and porcelain v1
+func (opts statusOptions) displayPath(name string) string {
+	if opts.format != statusPorcelain {
+		relative := true
+		if value, found := configValue("status.relativepaths"); found {
+			relative, _ = config.ParseBool(value)
+		}
+		if relative {
+			trailing := strings.HasSuffix(name, "/")
+			name = displayPath(name)
+			if trailing && !strings.HasSuffix(name, "/") {
+				name += "/"
+			}
+		}
+	}
+	if opts.nul {
+		return name
+	}
+	return quotePath(name, opts.format == statusShort || opts.format == statusPorcelain)
+}
+
+func (opts statusOptions) terminator() string {
+	if opts.nul {
+		return "\x00"
+	}
+	return "\n"
+}
+
+// Write the short format, also the porcelain v1 format: "XY path", X the staged change and Y the unstaged one,
+// "XY orig -> path" for a rename, "?? path" for an untracked file
+func (st *repoStatus) writeShort(out *strings.Builder, opts statusOptions) {
+	if opts.branch {
+		out.WriteString("## " + st.branchSummary() + opts.terminator())
+	}
+	for _, e := range st.entries {
+		fmt.Fprintf(out, "%c%c ", e.staged, e.unstaged)
+		switch {
+		case e.origPath != "" && opts.nul:
+			out.WriteString(opts.displayPath(e.path) + "\x00" + opts.displayPath(e.origPath) + "\x00")
+		case e.origPath != "":
+			out.WriteString(opts.displayPath(e.origPath) + " -> " + opts.displayPath(e.path) + "\n")
+		default:
+			out.WriteString(opts.displayPath(e.path) + opts.terminator())
+		}
+	}
+	for _, name := range st.untracked {
+		out.WriteString("?? " + opts.displayPath(name) + opts.terminator())
+	}
+	for _, name := range st.ignored {
+		out.WriteString("!! " + opts.displayPath(name) + opts.terminator())
+	}
+}
+
+// Return the branch line of the short format, without its "## ": "main...origin/main [ahead 1, behind 2]",
+// "No commits yet on main" or "HEAD (no branch)"
+func (st *repoStatus) branchSummary() string {
+	switch {
+	case st.branch == "":
+		return "HEAD (no branch)"
+	case st.head == "":
+		return "No commits yet on " + st.branch
+	}
+	state, ok := branchUpstreamState(st.branch)
+	if !ok {
+		return st.branch
+	}
+	summary := st.branch + "..." + refs.ShortName(state.ref)
+	if track := state.String(); track != "" {
+		summary += " [" + track + "]"
+	}
+	return summary
+}
+
+// Write the porcelain v2 format: the branch headers, then a line per changed path with the modes and objects of HEAD,
+// the index and the work tree, "2" lines for renames, "u" lines for unmerged paths and "?" lines for untracked files
+func (st *repoStatus) writePorcelainV2(out *strings.Builder, opts statusOptions) {
+	zero := strings.Repeat("0", newObjectHash().Size()*2)
+	orZero := func(hash string) string {
+		if hash == "" {
+			return zero
+		}
+		return hash
+	}
+	if opts.branch {
+		oid, head := st.head, st.branch
+		if oid == "" {
+			oid = "(initial)"
+		}
+		if head == "" {
+			head = "(detached)"
+		}
+		fmt.Fprintf(out, "# branch.oid %s%s# branch.head %s%s", oid, opts.terminator(), head, opts.terminator())
+		if state, ok := branchUpstreamState(st.branch); ok && st.branch != "" {
+			fmt.Fprintf(out, "# branch.upstream %s%s", refs.ShortName(state.ref), opts.terminator())
+			if !state.gone {
+				fmt.Fprintf(out, "# branch.ab +%d -%d%s", state.ahead, state.behind, opts.terminator())
+			}
+		}
+	}
+	if opts.showStash && st.stashCount > 0 {
+		fmt.Fprintf(out, "# stash %d%s", st.stashCount, opts.terminator())
+	}
+	dot := func(c byte) byte {
+		if c == ' ' {
+			return '.'
+		}
+		return c
+	}
+	for _, e := range st.entries {
+		// Whether it is a submodule, and then whether its commit changed
+		submodule := "N..."
+		if e.headMode == index.ModeGitlink || e.indexMode == index.ModeGitlink || e.worktreeMode == index.ModeGitlink {
+			submodule = "S..."
+			if e.submoduleChanged {
+				submodule = "SC.."
+			}
+		}
+		if e.stages != [3]*index.Entry{} {
+			modes := make([]string, 3)
+			hashes := make([]string, 3)
+			for i, stage := range e.stages {
+				modes[i], hashes[i] = "000000", zero
+				if stage != nil {
+					modes[i], hashes[i] = fmt.Sprintf("%06o", stage.Mode), stage.Hash
+				}
+			}
+			fmt.Fprintf(out, "u %c%c %s %s %06o %s %s%s", e.staged, e.unstaged, submodule, strings.Join(modes, " "),
+				e.worktreeMode, strings.Join(hashes, " "), opts.displayPath(e.path), opts.terminator())
+			continue
+		}
+		fields := fmt.Sprintf("%c%c %s %06o %06o %06o %s %s", dot(e.staged), dot(e.unstaged), submodule,
+			e.headMode, e.indexMode, e.worktreeMode, orZero(e.headHash), orZero(e.indexHash))
+		if e.origPath != "" {
+			separator := "\t"
+			if opts.nul {
+				separator = "\x00"
+			}
+			fmt.Fprintf(out, "2 %s R%d %s%s%s%s", fields, e.score*100/renames.MaxScore, opts.displayPath(e.path),
+				separator, opts.displayPath(e.origPath), opts.terminator())
+			continue
+		}
+		fmt.Fprintf(out, "1 %s %s%s", fields, opts.displayPath(e.path), opts.terminator())
+	}
+	for _, name := range st.untracked {
+		out.WriteString("? " + opts.displayPath(name) + opts.terminator())
+	}
+	for _, name := range st.ignored {
+		out.WriteString("! " + opts.displayPath(name) + opts.terminator())
+	}
+}
+
+// The labels of the changes in the long format, padded to the same width
+var statusLabels = map[byte]string{
+	'A': "new file:", 'D': "deleted:", 'M': "modified:", 'R': "renamed:", 'T': "typechange:",
+}
+
+var unmergedLabels = map[string]string{
+	"DD": "both deleted:", "AU": "added by us:", "UD": "deleted by them:", "UA": "added by them:",
+	"DU": "deleted by us:", "AA": "both added:", "UU": "both modified:",
+}
+
+// Write the long format, the sections of the staged, unmerged, unstaged and untracked changes with hints on the
+// commands changing them
+func (st *repoStatus) writeLong(out *strings.Builder, opts statusOptions) {
+	if st.branch != "" {
+		fmt.Fprintf(out, "On branch %s\n", st.branch)
+	} else if st.head != "" {
+		fmt.Fprintf(out, "HEAD detached at %s\n", abbreviate(st.head))
+	} else {
+		out.WriteString("Not currently on any branch.\n")
+	}
+	if st.branch != "" && st.head != "" {
+		st.writeTracking(out)
+	}
+	if st.head == "" {
+		out.WriteString("\nNo commits yet\n\n")
+	}
+	_, err := os.Stat(repo.Path("MERGE_HEAD"))
+	merging := err == nil
+	staged, unstaged, unmerged := false, false, false
+	unstagedDeletion, unmergedDeletion := false, false
+	for _, e := range st.entries {
+		if e.stages != [3]*index.Entry{} {
+			unmerged = true
+			unmergedDeletion = unmergedDeletion || e.staged == 'D' || e.unstaged == 'D'
+			continue
+		}
+		staged = staged || e.staged != ' '
+		unstaged = unstaged || e.unstaged != ' '
+		unstagedDeletion = unstagedDeletion || e.unstaged == 'D'
+	}
+	if merging && unmerged {
+		out.WriteString("You have unmerged paths.\n  (fix conflicts and run \"git commit\")\n" +
+			"  (use \"git merge --abort\" to abort the merge)\n\n")
+	} else if merging {
+		out.WriteString("All conflicts fixed but you are still merging.\n  (use \"git commit\" to conclude merge)\n\n")
+	}
+	label := func(what string, width int) string {
+		return what + strings.Repeat(" ", width-len(what))
+	}
+	if staged {
+		out.WriteString("Changes to be committed:\n")
+		switch {
+		case merging:
+		case st.head == "":
+			out.WriteString("  (use \"git rm --cached <file>...\" to unstage)\n")
+		default:
+			out.WriteString("  (use \"git restore --staged <file>...\" to unstage)\n")
+		}
+		for _, e := range st.entries {
+			if e.staged == ' ' || e.stages != [3]*index.Entry{} {
+				continue
+			}
+			name := opts.displayPath(e.path)
+			if e.origPath != "" {
+				name = opts.displayPath(e.origPath) + " -> " + name
+			}
+			fmt.Fprintf(out, "\t%s%s\n", label(statusLabels[e.staged], 12), name)
+		}
+		out.WriteString("\n")
+	}
+	if unmerged {
+		out.WriteString("Unmerged paths:\n")
+		switch {
+		case merging:
+		case st.head == "":
+			out.WriteString("  (use \"git rm --cached <file>...\" to unstage)\n")
+		default:
+			out.WriteString("  (use \"git restore --staged <file>...\" to unstage)\n")
+		}
+		if unmergedDeletion {
+			out.WriteString("  (use \"git add/rm <file>...\" as appropriate to mark resolution)\n")
+		} else {
+			out.WriteString("  (use \"git add <file>...\" to mark resolution)\n")
+		}
+		for _, e := range st.entries {
+			if e.stages != [3]*index.Entry{} {
+				fmt.Fprintf(out, "\t%s%s\n", label(unmergedLabels[string([]byte{e.staged, e.unstaged})], 17), opts.displayPath(e.path))
+			}
+		}
+		out.WriteString("\n")
+	}
+	if unstaged {
+		out.WriteString("Changes not staged for commit:\n")
+		if unstagedDeletion {
+			out.WriteString("  (use \"git add/rm <file>...\" to update what will be committed)\n")
+		} else {
+			out.WriteString("  (use \"git add <file>...\" to update what will be committed)\n")
+		}
+		out.WriteString("  (use \"git restore <file>...\" to discard changes in working directory)\n")
+		for _, e := range st.entries {
+			if e.unstaged == ' ' || e.stages != [3]*index.Entry{} {
+				continue
+			}
+			name := opts.displayPath(e.path)
+			if e.submoduleChanged {
+				name += " (new commits)"
+			}
+			fmt.Fprintf(out, "\t%s%s\n", label(statusLabels[e.unstaged], 12), name)
+		}
+		out.WriteString("\n")
+	}
+	if len(st.untracked) > 0 {
+		out.WriteString("Untracked files:\n  (use \"git add <file>...\" to include in what will be committed)\n")
+		for _, name := range st.untracked {
+			fmt.Fprintf(out, "\t%s\n", opts.displayPath(name))
+		}
+		out.WriteString("\n")
+	}
+	if len(st.ignored) > 0 {
+		out.WriteString("Ignored files:\n  (use \"git add -f <file>...\" to include in what will be committed)\n")
+		for _, name := range st.ignored {
+			fmt.Fprintf(out, "\t%s\n", opts.displayPath(name))
+		}
+		out.WriteString("\n")
+	}
+	if opts.untracked == "no" && staged {
+		out.WriteString("Untracked files not listed (use -u option to show untracked files)\n")
+	}
+	switch {
+	case staged:
+	case unstaged || unmerged:
+		out.WriteString("no changes added to commit (use \"git add\" and/or \"git commit -a\")\n")
+	case len(st.untracked) > 0:
+		out.WriteString("nothing added to commit but untracked files present (use \"git add\" to track)\n")
+	case st.head == "":
+		out.WriteString("nothing to commit (create/copy files and use \"git add\" to track)\n")
+	case opts.untracked == "no":
+		out.WriteString("nothing to commit (use -u to show untracked files)\n")
+	default:
+		out.WriteString("nothing to commit, working tree clean\n")
+	}
+	if opts.showStash && st.stashCount > 0 {
+		plural := "entries"
+		if st.stashCount == 1 {
+			plural = "entry"
+		}
+		fmt.Fprintf(out, "Your stash currently has %d %s\n", st.stashCount, plural)
+	}
+}
+
+// Write how the current branch compares to its upstream, followed by an empty line
+func (st *repoStatus) writeTracking(out *strings.Builder) {
+	state, ok := branchUpstreamState(st.branch)
+	if !ok {
+		return
+	}
+	upstream := refs.ShortName(state.ref)
+	commits := func(n int) string {
+		if n == 1 {
+			return "1 commit"
+		}
+		return fmt.Sprintf("%d commits", n)
+	}
+	switch {
+	case state.gone:
+		fmt.Fprintf(out, "Your branch is based on '%s', but the upstream is gone.\n"+
+			"  (use \"git branch --unset-upstream\" to fixup)\n", upstream)
+	case state.ahead == 0 && state.behind == 0:
+		fmt.Fprintf(out, "Your branch is up to date with '%s'.\n", upstream)
+	case state.behind == 0:
+		fmt.Fprintf(out, "Your branch is ahead of '%s' by %s.\n  (use \"git push\" to publish your local commits)\n",
+			upstream, commits(state.ahead))
+	case state.ahead == 0:
+		fmt.Fprintf(out, "Your branch is behind '%s' by %s, and can be fast-forwarded.\n"+
+			"  (use \"git pull\" to update your local branch)\n", upstream, commits(state.behind))
+	default:
+		fmt.Fprintf(out, "Your branch and '%s' have diverged,\nand have %d and %d different commits each, respectively.\n"+
+			"  (use \"git pull\" to merge the remote branch into yours)\n", upstream, state.ahead, state.behind)
+	}
+	out.WriteString("\n")
+}
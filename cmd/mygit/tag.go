@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	ident "github.com/codecrafters-io/git-starter-go/ident"
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+	refs "github.com/codecrafters-io/git-starter-go/refs"
+)
+
+// The first lines of the signatures appended to the message of a signed tag
+var signatureHeaders = []string{
+	"-----BEGIN PGP SIGNATURE-----",
+	"-----BEGIN PGP MESSAGE-----",
+	"-----BEGIN SIGNED MESSAGE-----",
+	"-----BEGIN SSH SIGNATURE-----",
+}
+
+type tagOptions struct {
+	list     bool
+	remove   bool
+	force    bool
+	annotate bool
+	// The number of lines of the messages -n shows, 0 without -n
+	lines    int
+	sortKeys []string
+	// The --format of the listing
+	format   string
+	filter   refFilter
+	operands []string
+	message  *bytes.Buffer
+}
+
+/*
+Command: mygit tag [-a] [-f] (-m <msg> | -F <file>)... <name> [<object>]
+Command: mygit tag [-f] <name> [<object>]
+Command: mygit tag -d <name>...
+Command: mygit tag [-n[<num>]] [-l] [--sort=<key>] [--format=<format>] [--contains [<commit>]] [--no-contains [<commit>]]
+
+	[--merged [<commit>]] [--no-merged [<commit>]] [--points-at [<object>]] [<pattern>...]
+
+Create, delete or list the tags, a tag with a message is an annotated tag: a tag object the ref points to
+The tags are listed by name, or by the keys of --sort or tag.sort, version:refname comparing them as versions
+*/
+func tagCommand(args []string) (string, error) {
+	usage := fmt.Errorf("usage: mygit tag [-a] [-f] [-m <msg> | -F <file>] <name> [<object>] | -d <name>... | [-n[<num>]] [-l] [--sort=<key>] [--format=<format>] [--contains <commit>] [--points-at <object>] [<pattern>...]")
+	opts := tagOptions{message: new(bytes.Buffer)}
+	hasMessage := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			opts.operands = append(opts.operands, args[i+1:]...)
+			break
+		}
+		if ok, err := opts.filter.parseOption(args, &i); ok {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		switch arg {
+		case "-m", "-F", "--sort", "--format":
+			if i+1 >= len(args) {
+				return "", usage
+			}
+			i++
+		}
+		switch {
+		case arg == "-a" || arg == "--annotate":
+			opts.annotate = true
+		case arg == "-m":
+			appendMessageParagraph(opts.message, args[i])
+			hasMessage = true
+		case strings.HasPrefix(arg, "--message="):
+			appendMessageParagraph(opts.message, strings.TrimPrefix(arg, "--message="))
+			hasMessage = true
+		case arg == "-F" || strings.HasPrefix(arg, "--file="):
+			file := strings.TrimPrefix(arg, "--file=")
+			if arg == "-F" {
+				file = args[i]
+			}
+			if opts.message.Len() > 0 {
+				opts.message.WriteByte('\n')
+			}
+			if err := readMessageFile(file, opts.message); err != nil {
+				return "", err
+			}
+			hasMessage = true
+		case arg == "-f" || arg == "--force":
+			opts.force = true
+		case arg == "-d" || arg == "--delete":
+			opts.remove = true
+		case arg == "-l" || arg == "--list":
+			opts.list = true
+		case arg == "--sort":
+			opts.sortKeys = append(opts.sortKeys, args[i])
+		case strings.HasPrefix(arg, "--sort="):
+			opts.sortKeys = append(opts.sortKeys, strings.TrimPrefix(arg, "--sort="))
+		case arg == "--format" || strings.HasPrefix(arg, "--format="):
+			opts.format = strings.TrimPrefix(arg, "--format=")
+			if arg == "--format" {
+				opts.format = args[i]
+			}
+		case strings.HasPrefix(arg, "-n"):
+			opts.lines = 1
+			if arg != "-n" {
+				n, err := strconv.Atoi(arg[2:])
+				if err != nil {
+					return "", usage
+				}
+				opts.lines = n
+			}
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return "", usage
+		default:
+			opts.operands = append(opts.operands, arg)
+		}
+	}
+	// A message makes an annotated tag
+	opts.annotate = opts.annotate || hasMessage
+	listing := opts.list || opts.lines > 0 || opts.format != "" || opts.filter.active() || len(opts.operands) == 0
+	switch {
+	case opts.remove && (listing && len(opts.operands) == 0 || opts.annotate):
+		return "", usage
+	case opts.remove:
+		return deleteTags(opts.operands)
+	case listing && !opts.annotate && !opts.force:
+		return listTags(opts)
+	case len(opts.operands) == 0 || len(opts.operands) > 2:
+		return "", usage
+	}
+	if opts.annotate && !hasMessage {
+		return "", fmt.Errorf("no tag message given, use -m or -F")
+	}
+	target := "HEAD"
+	if len(opts.operands) == 2 {
+		target = opts.operands[1]
+	}
+	return createTag(opts, opts.operands[0], target)
+}
+
+// Point refs/tags/<name> to an object, through a new tag object for an annotated tag
+func createTag(opts tagOptions, name, target string) (string, error) {
+	ref := "refs/tags/" + name
+	if strings.HasPrefix(name, "-") || refs.CheckRefFormat(ref, 0) != nil {
+		return "", fmt.Errorf("'%s' is not a valid tag name.", name)
+	}
+	hash, err := resolveObject(target)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve '%s' as a valid ref.", target)
+	}
+	store := refStore()
+	existing, readErr := store.Read(ref)
+	exists := readErr == nil
+	if exists && !opts.force {
+		return "", fmt.Errorf("tag '%s' already exists", name)
+	}
+	if opts.annotate {
+		objectType, _, err := readObject(hash)
+		if err != nil {
+			return "", err
+		}
+		tagger, err := ident.Get(ident.Committer, configValue)
+		if err != nil {
+			return "", err
+		}
+		tag := objects.Tag{
+			Object:     []byte(hash),
+			TargetType: objectType,
+			Name:       name,
+			Tagger:     []byte(tagger.String()),
+			Message:    cleanupMessage(opts.message.Bytes()),
+		}
+		if hash, err = writeObject(tag.ToByteSlice()); err != nil {
+			return "", err
+		}
+	}
+	old, _ := resolveOldValue("")
+	if exists {
+		old = existing.Target
+	}
+	if err := store.Update(refs.Update{Name: ref, New: hash, Old: old}, true); err != nil {
+		return "", err
+	}
+	if exists && existing.Target != hash {
+		return fmt.Sprintf("Updated tag '%s' (was %s)\n", name, abbreviate(existing.Target)), nil
+	}
+	return "", nil
+}
+
+// Delete tags, the deletions are reported even when some of the names fail
+func deleteTags(names []string) (string, error) {
+	store := refStore()
+	out := new(strings.Builder)
+	failed := false
+	for _, name := range names {
+		ref := "refs/tags/" + name
+		existing, err := store.Read(ref)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: tag '%s' not found.\n", name)
+			failed = true
+			continue
+		}
+		if err := store.Update(refs.Update{Name: ref, Delete: true, Old: existing.Target}, true); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(out, "Deleted tag '%s' (was %s)\n", name, abbreviate(existing.Target))
+	}
+	if failed {
+		return out.String(), errSilentFailure
+	}
+	return out.String(), nil
+}
+
+// List the tags matching the patterns and the filter, with the first lines of their message for -n
+func listTags(opts tagOptions) (string, error) {
+	items, err := listRefItems("refs/tags/")
+	if err != nil {
+		return "", err
+	}
+	kept := make([]*refItem, 0, len(items))
+	for _, item := range items {
+		if matchesBranchPattern(strings.TrimPrefix(item.name, "refs/tags/"), opts.operands) && opts.filter.keep(item.hash) {
+			kept = append(kept, item)
+		}
+	}
+	keys := opts.sortKeys
+	if len(keys) == 0 {
+		if cfg, err := loadConfig(); err == nil {
+			for _, e := range cfg.GetAll("tag.sort") {
+				keys = append(keys, e.Value)
+			}
+		}
+	}
+	format := opts.format
+	switch {
+	case format != "":
+	case opts.lines > 0:
+		format = fmt.Sprintf("%%(align:15)%%(refname:lstrip=2)%%(end) %%(contents:lines=%d)", opts.lines)
+	default:
+		format = "%(refname:lstrip=2)"
+	}
+	lines, err := formatRefItems(kept, format, keys, nil)
+	if err != nil {
+		return "", err
+	}
+	out := new(strings.Builder)
+	for _, line := range lines {
+		out.WriteString(line + "\n")
+	}
+	return out.String(), nil
+}
+
+// Clean up a message the way git does without an editor: strip the trailing spaces of the lines and the blank lines
+// at the start and the end, squeeze consecutive blank lines into one, and end the last line with a newline
+func cleanupMessage(message []byte) []byte {
+	out := new(bytes.Buffer)
+	blank := false
+	for _, line := range strings.Split(string(message), "\n") {
+		line = strings.TrimRight(line, " \t\r\v\f")
+		if line == "" {
+			blank = out.Len() > 0
+			continue
+		}
+		if blank {
+			out.WriteByte('\n')
+			blank = false
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.Bytes()
+}
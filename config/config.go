@@ -0,0 +1,430 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/wildmatch"
+)
+
+// Where a variable comes from, a later scope takes precedence over an earlier one
+type Scope int
+
+const (
+	ScopeSystem Scope = iota
+	ScopeGlobal
+	ScopeLocal
+	ScopeWorktree
+	ScopeCommand
+)
+
+func (s Scope) String() string {
+	switch s {
+	case ScopeSystem:
+		return "system"
+	case ScopeGlobal:
+		return "global"
+	case ScopeLocal:
+		return "local"
+	case ScopeWorktree:
+		return "worktree"
+	case ScopeCommand:
+		return "command"
+	}
+	return "unknown"
+}
+
+// Includes nested deeper than this are considered a loop
+const maxIncludeDepth = 10
+
+// A variable with its value and where it comes from
+type Entry struct {
+	// "<section>[.<subsection>].<name>", with its section and name lowercased
+	Key   string
+	Value string
+	// A variable without "=" is an implicit true
+	NoValue bool
+	Scope   Scope
+	// "file:<path>" or "command line:"
+	Origin string
+}
+
+// All the variables of all the scopes, in increasing precedence order
+type Config struct {
+	entries []Entry
+	gitDir  string
+	// Whether include.path and includeIf are ignored
+	noIncludes bool
+}
+
+// What to read the configuration from
+type Options struct {
+	// The repository git directory, the local and worktree scopes are skipped when empty
+	GitDir string
+	// The "<key>[=<value>]" given with -c
+	CommandLine []string
+}
+
+// Return the paths of the files of a scope, the ones read when the config is loaded
+func ScopePaths(scope Scope, gitDir string) []string {
+	switch scope {
+	case ScopeSystem:
+		if os.Getenv("GIT_CONFIG_NOSYSTEM") != "" {
+			return nil
+		}
+		if path := os.Getenv("GIT_CONFIG_SYSTEM"); path != "" {
+			return []string{path}
+		}
+		return []string{"/etc/gitconfig"}
+	case ScopeGlobal:
+		if path, found := os.LookupEnv("GIT_CONFIG_GLOBAL"); found {
+			return []string{path}
+		}
+		paths := make([]string, 0)
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		home, err := os.UserHomeDir()
+		if xdg == "" && err == nil {
+			xdg = filepath.Join(home, ".config")
+		}
+		if xdg != "" {
+			paths = append(paths, filepath.Join(xdg, "git", "config"))
+		}
+		if err == nil {
+			paths = append(paths, filepath.Join(home, ".gitconfig"))
+		}
+		return paths
+	case ScopeLocal:
+		if gitDir == "" {
+			return nil
+		}
+		return []string{filepath.Join(gitDir, "config")}
+	case ScopeWorktree:
+		if gitDir == "" {
+			return nil
+		}
+		return []string{filepath.Join(gitDir, "config.worktree")}
+	}
+	return nil
+}
+
+// Return the path of the file written for a scope
+func ScopeWritePath(scope Scope, gitDir string) (string, error) {
+	paths := ScopePaths(scope, gitDir)
+	if scope == ScopeCommand || len(paths) == 0 {
+		return "", fmt.Errorf("cannot write to the %s scope", scope)
+	}
+	if scope == ScopeGlobal && len(paths) > 1 {
+		// ~/.gitconfig is written unless only the XDG file exists
+		if _, err := os.Stat(paths[1]); err != nil {
+			if _, err := os.Stat(paths[0]); err == nil {
+				return paths[0], nil
+			}
+		}
+		return paths[1], nil
+	}
+	return paths[0], nil
+}
+
+// Read the configuration of every scope
+func Load(opts Options) (*Config, error) {
+	c := &Config{gitDir: opts.GitDir}
+	if opts.GitDir != "" {
+		if abs, err := filepath.Abs(opts.GitDir); err == nil {
+			c.gitDir = abs
+		}
+	}
+	for _, scope := range []Scope{ScopeSystem, ScopeGlobal, ScopeLocal} {
+		for _, path := range ScopePaths(scope, opts.GitDir) {
+			if err := c.readFile(path, scope, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// The worktree config is only read once the repository opts in
+	if enabled, _ := c.Bool("extensions.worktreeconfig", false); enabled {
+		for _, path := range ScopePaths(ScopeWorktree, opts.GitDir) {
+			if err := c.readFile(path, ScopeWorktree, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	params, err := environmentParameters()
+	if err != nil {
+		return nil, err
+	}
+	for _, param := range append(params, opts.CommandLine...) {
+		key, value, hasValue := strings.Cut(param, "=")
+		canonical, err := CanonicalKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("bogus config parameter %s: %s", param, err)
+		}
+		c.entries = append(c.entries, Entry{
+			Key:     canonical,
+			Value:   value,
+			NoValue: !hasValue,
+			Scope:   ScopeCommand,
+			Origin:  "command line:",
+		})
+	}
+	return c, nil
+}
+
+// Read the variables of a single file, without following its includes
+func LoadFile(path string, scope Scope) (*Config, error) {
+	c := &Config{noIncludes: true}
+	if err := c.readFile(path, scope, 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Return the "<key>=<value>" given through GIT_CONFIG_COUNT, GIT_CONFIG_KEY_<n> and GIT_CONFIG_VALUE_<n>
+func environmentParameters() ([]string, error) {
+	count := os.Getenv("GIT_CONFIG_COUNT")
+	if count == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("bogus GIT_CONFIG_COUNT: %s", count)
+	}
+	params := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		key, found := os.LookupEnv(fmt.Sprintf("GIT_CONFIG_KEY_%d", i))
+		if !found {
+			return nil, fmt.Errorf("missing config key GIT_CONFIG_KEY_%d", i)
+		}
+		params = append(params, key+"="+os.Getenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", i)))
+	}
+	return params, nil
+}
+
+// Read the variables of a file, following its includes
+func (c *Config) readFile(path string, scope Scope, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("exceeded maximum include depth (%d) while including %s", maxIncludeDepth, path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) || (depth > 0 && os.IsPermission(err)) {
+			return nil
+		}
+		return fmt.Errorf("unable to read config file %s: %s", path, err)
+	}
+	_, entries, err := parse(content, path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		c.entries = append(c.entries, Entry{
+			Key:     e.Key(),
+			Value:   e.Value,
+			NoValue: e.NoValue,
+			Scope:   scope,
+			Origin:  "file:" + path,
+		})
+		include := ""
+		switch {
+		case e.Key() == "include.path":
+			include = e.Value
+		case e.Section == "includeif" && e.Name == "path" && c.includeConditionHolds(e.Subsection, path):
+			include = e.Value
+		}
+		if include == "" || e.NoValue || c.noIncludes {
+			continue
+		}
+		include = ExpandPath(include)
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if err := c.readFile(include, scope, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Whether the condition of an includeIf section holds, relative paths are relative to the including file
+func (c *Config) includeConditionHolds(condition, path string) bool {
+	kind, pattern, found := strings.Cut(condition, ":")
+	if !found {
+		return false
+	}
+	switch kind {
+	case "gitdir", "gitdir/i":
+		if c.gitDir == "" {
+			return false
+		}
+		flags := wildmatch.Pathname
+		if kind == "gitdir/i" {
+			flags |= wildmatch.CaseFold
+		}
+		// A trailing slash matches everything below the directory
+		directory := strings.HasSuffix(pattern, "/")
+		pattern = ExpandPath(pattern)
+		if strings.HasPrefix(pattern, "./") {
+			pattern = filepath.Join(filepath.Dir(path), pattern[2:])
+		} else if !filepath.IsAbs(pattern) {
+			pattern = "**/" + pattern
+		}
+		if directory {
+			pattern = strings.TrimSuffix(pattern, "/") + "/**"
+		}
+		gitDir := c.gitDir
+		if resolved, err := filepath.EvalSymlinks(gitDir); err == nil && resolved != gitDir {
+			if wildmatch.Match(pattern, resolved, flags) {
+				return true
+			}
+		}
+		return wildmatch.Match(pattern, gitDir, flags)
+	case "onbranch":
+		if c.gitDir == "" {
+			return false
+		}
+		head, err := os.ReadFile(filepath.Join(c.gitDir, "HEAD"))
+		if err != nil {
+			return false
+		}
+		branch, found := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+		if !found {
+			return false
+		}
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		return wildmatch.Match(pattern, branch, wildmatch.Pathname)
+	}
+	return false
+}
+
+// Return the path with a leading "~/" replaced by the home directory
+func ExpandPath(path string) string {
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// Return all the variables, in increasing precedence order
+func (c *Config) Entries() []Entry {
+	return c.entries
+}
+
+// Return the value of key with the highest precedence, and whether it is set
+func (c *Config) Get(key string) (string, bool) {
+	entry, found := c.Lookup(key)
+	return entry.Value, found
+}
+
+// Return the variable of key with the highest precedence
+func (c *Config) Lookup(key string) (Entry, bool) {
+	canonical, err := CanonicalKey(key)
+	if err != nil {
+		return Entry{}, false
+	}
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		if c.entries[i].Key == canonical {
+			return c.entries[i], true
+		}
+	}
+	return Entry{}, false
+}
+
+// Return all the variables of a multi-valued key
+func (c *Config) GetAll(key string) []Entry {
+	canonical, err := CanonicalKey(key)
+	if err != nil {
+		return nil
+	}
+	entries := make([]Entry, 0)
+	for _, e := range c.entries {
+		if e.Key == canonical {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Return the boolean value of key, or def when it isn't set
+func (c *Config) Bool(key string, def bool) (bool, error) {
+	entry, found := c.Lookup(key)
+	if !found {
+		return def, nil
+	}
+	if entry.NoValue {
+		return true, nil
+	}
+	b, err := ParseBool(entry.Value)
+	if err != nil {
+		return def, fmt.Errorf("bad boolean config value '%s' for '%s'", entry.Value, key)
+	}
+	return b, nil
+}
+
+// Return the integer value of key, or def when it isn't set
+func (c *Config) Int(key string, def int64) (int64, error) {
+	entry, found := c.Lookup(key)
+	if !found {
+		return def, nil
+	}
+	i, err := ParseInt(entry.Value)
+	if err != nil {
+		return def, fmt.Errorf("bad numeric config value '%s' for '%s'", entry.Value, key)
+	}
+	return i, nil
+}
+
+// Return the path value of key with "~/" expanded
+func (c *Config) Path(key string) (string, bool) {
+	value, found := c.Get(key)
+	if !found {
+		return "", false
+	}
+	return ExpandPath(value), true
+}
+
+// Parse a git boolean: true/yes/on/1 or false/no/off/0/""
+func ParseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	if i, err := ParseInt(value); err == nil {
+		return i != 0, nil
+	}
+	return false, fmt.Errorf("invalid boolean: %s", value)
+}
+
+// Parse a git integer, with an optional k, m or g unit suffix
+func ParseInt(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	factor := int64(1)
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'k', 'K':
+			factor = 1 << 10
+		case 'm', 'M':
+			factor = 1 << 20
+		case 'g', 'G':
+			factor = 1 << 30
+		}
+		if factor != 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	i, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer: %s", value)
+	}
+	if i > 0 && i > (1<<63-1)/factor || i < 0 && i < -(1<<63)/factor {
+		return 0, fmt.Errorf("integer out of range: %s", value)
+	}
+	return i * factor, nil
+}
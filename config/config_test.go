@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `# a comment
+[core]
+	bare = false ; trailing comment
+	editor = "vim -c \"set tw=72\"" # quoted
+	autocrlf
+[Remote "Origin"]
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+[branch.Main]
+	remote = origin
+[pack]
+	windowMemory = 1g
+	long = first \
+second
+	tabs = a		b
+	folded = \
+  cont
+`
+
+var TestCaseGet = []struct {
+	Key, Expected string
+}{
+	{"core.bare", "false"},
+	{"CORE.Editor", `vim -c "set tw=72"`},
+	{"remote.Origin.fetch", "+refs/tags/*:refs/tags/*"},
+	{"branch.main.remote", "origin"},
+	{"pack.long", "first second"},
+	{"pack.tabs", "a  b"},
+	{"pack.folded", "cont"},
+}
+
+// Write content to a file in a temporary dir and return its path
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unable to write %s: %s", path, err)
+	}
+	return path
+}
+
+// Test the git-config syntax: comments, quotes, escapes, subsections and continuation lines
+func TestConfig_Parse(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "config", testConfig)
+	cfg, err := LoadFile(path, ScopeLocal)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, tc := range TestCaseGet {
+		if got, _ := cfg.Get(tc.Key); got != tc.Expected {
+			t.Errorf("unexpected value for %s, got: %q expected: %q", tc.Key, got, tc.Expected)
+		}
+	}
+	if _, found := cfg.Get("remote.origin.fetch"); found {
+		t.Errorf("quoted subsections are case sensitive")
+	}
+	if n := len(cfg.GetAll("remote.Origin.fetch")); n != 2 {
+		t.Errorf("unexpected number of values, got: %d expected: 2", n)
+	}
+	if b, err := cfg.Bool("core.autocrlf", false); err != nil || !b {
+		t.Errorf("a variable without a value is true")
+	}
+	if i, err := cfg.Int("pack.windowmemory", 0); err != nil || i != 1<<30 {
+		t.Errorf("unexpected integer, got: %d expected: %d", i, 1<<30)
+	}
+}
+
+// Test that the scopes and the includes apply in order
+func TestConfig_Load(t *testing.T) {
+	dir := t.TempDir()
+	gitDir := filepath.Join(dir, "repo", ".git")
+	if err := os.MkdirAll(gitDir, 0755); err != nil {
+		t.Fatalf("unable to create %s: %s", gitDir, err)
+	}
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", writeTestFile(t, dir, "global", "[user]\n\tname = global\n\temail = global@example.com\n[includeIf \"gitdir:repo/\"]\n\tpath = work\n"))
+	writeTestFile(t, dir, "work", "[user]\n\temail = work@example.com\n")
+	writeTestFile(t, gitDir, "config", "[user]\n\tname = local\n[include]\n\tpath = ../../extra\n")
+	writeTestFile(t, dir, "extra", "[core]\n\tabbrev = 12\n")
+	cfg, err := Load(Options{GitDir: gitDir, CommandLine: []string{"core.abbrev=8"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]string{"user.name": "local", "user.email": "work@example.com", "core.abbrev": "8"}
+	for key, value := range expected {
+		if got, _ := cfg.Get(key); got != value {
+			t.Errorf("unexpected value for %s, got: %q expected: %q", key, got, value)
+		}
+	}
+}
+
+// Test that editing a file keeps its comments and layout
+func TestFile_Edit(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "config", "# keep me\n[core]\n\tbare = false # and me\n[user]\n\tname = old\n")
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	steps := []error{
+		f.Set("user.name", "new name"),
+		f.Set("core.filemode", "true"),
+		f.Add("remote.origin.url", " spaced "),
+		f.Write(),
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if _, err := f.Unset("core.bare", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "# keep me\n[core]\n\tfilemode = true\n[user]\n\tname = new name\n[remote \"origin\"]\n\turl = \" spaced \"\n"
+	if got := string(f.Bytes()); got != expected {
+		t.Fatalf("unexpected content\nGot:%q\nExp:%q", got, expected)
+	}
+}
+
+// Test that the sections of a branch follow its renames and copies
+func TestFile_RenameSection(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "config", "[branch \"old\"] remote = origin\n\tmerge = refs/heads/main\n[branch \"other\"]\n\tremote = .\n")
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if renamed, err := f.RenameSection("branch", "old", "new"); !renamed || err != nil {
+		t.Fatalf("expected the section to be renamed, got %t (%v)", renamed, err)
+	}
+	if copied, err := f.CopySection("branch", "new", "copy"); !copied || err != nil {
+		t.Fatalf("expected the section to be copied, got %t (%v)", copied, err)
+	}
+	if copied, _ := f.CopySection("branch", "none", "copy"); copied {
+		t.Fatalf("expected nothing to copy from a missing section")
+	}
+	expected := "[branch \"new\"] remote = origin\n\tmerge = refs/heads/main\n[branch \"other\"]\n\tremote = .\n" +
+		"[branch \"copy\"]\n\tremote = origin\n\tmerge = refs/heads/main\n"
+	if got := string(f.Bytes()); got != expected {
+		t.Fatalf("unexpected content\nGot:%q\nExp:%q", got, expected)
+	}
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A config file opened for writing, edits keep its comments and layout untouched
+type File struct {
+	Path    string
+	content []byte
+}
+
+// Read the config file at path, a missing file is empty
+func OpenFile(path string) (*File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read %s: %s", path, err)
+	}
+	f := &File{Path: path, content: content}
+	if _, _, err := parse(content, path); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Return the content of the file
+func (f *File) Bytes() []byte {
+	return f.content
+}
+
+// Return the variables of the file matching key
+func (f *File) find(key string) (section, subsection, name string, sections []rawSection, matches []rawEntry, err error) {
+	section, subsection, name, err = SplitKey(key)
+	if err != nil {
+		return
+	}
+	sections, entries, err := parse(f.content, f.Path)
+	if err != nil {
+		return
+	}
+	want := joinKey(section, subsection, name)
+	for _, e := range entries {
+		if e.Key() == want {
+			matches = append(matches, e)
+		}
+	}
+	return
+}
+
+// Set the value of key, failing if it has more than one value
+func (f *File) Set(key, value string) error {
+	_, _, name, _, matches, err := f.find(key)
+	if err != nil {
+		return err
+	}
+	if len(matches) > 1 {
+		return fmt.Errorf("cannot overwrite multiple values of %s with a single value", key)
+	}
+	if len(matches) == 1 {
+		f.replace(matches[0].Start, matches[0].End, entryLine(name, value))
+		return nil
+	}
+	return f.Add(key, value)
+}
+
+// Replace all the values of key with value
+func (f *File) ReplaceAll(key, value string) error {
+	if _, err := f.Unset(key, true); err != nil {
+		return err
+	}
+	return f.Add(key, value)
+}
+
+// Add a value to key, after the last variable of its section
+func (f *File) Add(key, value string) error {
+	section, subsection, name, sections, _, err := f.find(key)
+	if err != nil {
+		return err
+	}
+	_, entries, _ := parse(f.content, f.Path)
+	// Insert after the last variable of the last matching section, or after its header
+	insertAt := -1
+	for i, s := range sections {
+		if s.Section != section || s.Subsection != subsection {
+			continue
+		}
+		insertAt = s.End
+		next := len(f.content) + 1
+		if i+1 < len(sections) {
+			next = sections[i+1].Start
+		}
+		for _, e := range entries {
+			if e.Start >= s.End && e.Start < next && e.End > insertAt {
+				insertAt = e.End
+			}
+		}
+	}
+	line := entryLine(name, value)
+	if insertAt < 0 {
+		line = sectionHeader(section, subsection) + line
+		insertAt = len(f.content)
+	}
+	// Make sure the line before ends
+	if insertAt > 0 && f.content[insertAt-1] != '\n' {
+		line = "\n" + line
+	}
+	f.replace(insertAt, insertAt, line)
+	return nil
+}
+
+// Remove the values of key, failing if it has more than one unless all is set
+// Return the number of removed values
+func (f *File) Unset(key string, all bool) (int, error) {
+	_, _, _, _, matches, err := f.find(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(matches) > 1 && !all {
+		return 0, fmt.Errorf("%s has multiple values", key)
+	}
+	for i := len(matches) - 1; i >= 0; i-- {
+		f.replace(matches[i].Start, matches[i].End, "")
+	}
+	return len(matches), nil
+}
+
+// Remove a section with all of its variables
+func (f *File) RemoveSection(section, subsection string) (bool, error) {
+	sections, _, err := parse(f.content, f.Path)
+	if err != nil {
+		return false, err
+	}
+	section = strings.ToLower(section)
+	removed := false
+	for i := len(sections) - 1; i >= 0; i-- {
+		s := sections[i]
+		if s.Section != section || s.Subsection != subsection {
+			continue
+		}
+		end := len(f.content)
+		if i+1 < len(sections) {
+			end = sections[i+1].Start
+		}
+		f.replace(s.Start, end, "")
+		removed = true
+	}
+	return removed, nil
+}
+
+// Rename the sections with a subsection, like [branch "old"] to [branch "new"]
+func (f *File) RenameSection(section, oldSubsection, newSubsection string) (bool, error) {
+	sections, _, err := parse(f.content, f.Path)
+	if err != nil {
+		return false, err
+	}
+	section = strings.ToLower(section)
+	renamed := false
+	for i := len(sections) - 1; i >= 0; i-- {
+		s := sections[i]
+		if s.Section != section || s.Subsection != oldSubsection {
+			continue
+		}
+		header := sectionHeader(section, newSubsection)
+		// Variables may follow the header on its line
+		if f.content[s.End-1] != '\n' {
+			header = strings.TrimSuffix(header, "\n")
+		}
+		f.replace(s.Start, s.End, header)
+		renamed = true
+	}
+	return renamed, nil
+}
+
+// Append a copy of the variables of a section under another subsection
+func (f *File) CopySection(section, fromSubsection, toSubsection string) (bool, error) {
+	_, entries, err := parse(f.content, f.Path)
+	if err != nil {
+		return false, err
+	}
+	section = strings.ToLower(section)
+	copied := sectionHeader(section, toSubsection)
+	found := false
+	for _, e := range entries {
+		if e.Section != section || e.Subsection != fromSubsection {
+			continue
+		}
+		found = true
+		if e.NoValue {
+			copied += "\t" + e.Name + "\n"
+		} else {
+			copied += entryLine(e.Name, e.Value)
+		}
+	}
+	if !found {
+		return false, nil
+	}
+	if len(f.content) > 0 && f.content[len(f.content)-1] != '\n' {
+		copied = "\n" + copied
+	}
+	f.replace(len(f.content), len(f.content), copied)
+	return true, nil
+}
+
+func (f *File) replace(start, end int, s string) {
+	content := make([]byte, 0, len(f.content)+len(s))
+	content = append(content, f.content[:start]...)
+	content = append(content, s...)
+	f.content = append(content, f.content[end:]...)
+}
+
+func entryLine(name, value string) string {
+	return fmt.Sprintf("\t%s = %s\n", name, quoteValue(value))
+}
+
+// Write the file through a lock file, so that readers never see it half written
+func (f *File) Write() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	lock := f.Path + ".lock"
+	handle, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("could not lock config file %s: %s exists", f.Path, lock)
+		}
+		return fmt.Errorf("could not lock config file %s: %s", f.Path, err)
+	}
+	if _, err := handle.Write(f.content); err != nil {
+		handle.Close()
+		os.Remove(lock)
+		return err
+	}
+	if err := handle.Close(); err != nil {
+		os.Remove(lock)
+		return err
+	}
+	if err := os.Rename(lock, f.Path); err != nil {
+		os.Remove(lock)
+		return err
+	}
+	return nil
+}
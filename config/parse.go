@@ -0,0 +1,360 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A variable as found in a config file
+type rawEntry struct {
+	Section, Subsection, Name string
+	Value                     string
+	// A variable without "=" is an implicit true
+	NoValue bool
+	// Offsets of the lines holding the variable in the file content
+	Start, End int
+}
+
+// A section header as found in a config file
+type rawSection struct {
+	Section, Subsection string
+	// Offsets of the header in the file content
+	Start, End int
+}
+
+// Return the key of the variable: the section and the name are case-insensitive, the subsection is not
+func (e *rawEntry) Key() string {
+	return joinKey(e.Section, e.Subsection, e.Name)
+}
+
+func joinKey(section, subsection, name string) string {
+	if subsection == "" {
+		return section + "." + name
+	}
+	return section + "." + subsection + "." + name
+}
+
+// Split a "<section>[.<subsection>].<name>" key, lowercasing its section and name
+func SplitKey(key string) (section, subsection, name string, err error) {
+	first := strings.IndexByte(key, '.')
+	last := strings.LastIndexByte(key, '.')
+	if first <= 0 || last == len(key)-1 {
+		return "", "", "", fmt.Errorf("key does not contain a section: %s", key)
+	}
+	section = strings.ToLower(key[:first])
+	name = strings.ToLower(key[last+1:])
+	if first != last {
+		subsection = key[first+1 : last]
+	}
+	for _, c := range []byte(section) {
+		if !isKeyChar(c) && c != '.' {
+			return "", "", "", fmt.Errorf("invalid key: %s", key)
+		}
+	}
+	if !isAlpha(name[0]) {
+		return "", "", "", fmt.Errorf("invalid key: %s", key)
+	}
+	for _, c := range []byte(name) {
+		if !isKeyChar(c) {
+			return "", "", "", fmt.Errorf("invalid key: %s", key)
+		}
+	}
+	if strings.ContainsAny(subsection, "\n\x00") {
+		return "", "", "", fmt.Errorf("invalid key: %s", key)
+	}
+	return section, subsection, name, nil
+}
+
+// Return the key with its section and name lowercased
+func CanonicalKey(key string) (string, error) {
+	section, subsection, name, err := SplitKey(key)
+	if err != nil {
+		return "", err
+	}
+	return joinKey(section, subsection, name), nil
+}
+
+func isAlpha(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isKeyChar(c byte) bool {
+	return isAlpha(c) || ('0' <= c && c <= '9') || c == '-'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// Reads the git-config syntax
+type parser struct {
+	content []byte
+	pos     int
+	line    int
+	origin  string
+}
+
+// Parse the content of a config file, origin names it in errors
+func parse(content []byte, origin string) ([]rawSection, []rawEntry, error) {
+	p := &parser{content: content, line: 1, origin: origin}
+	// Skip a UTF-8 byte order mark
+	if bytes.HasPrefix(content, []byte("\xef\xbb\xbf")) {
+		p.pos = 3
+	}
+	sections := make([]rawSection, 0)
+	entries := make([]rawEntry, 0)
+	var current *rawSection
+	for {
+		lineStart := p.pos
+		p.skipSpaces()
+		c, ok := p.peek()
+		switch {
+		case !ok:
+			return sections, entries, nil
+		case c == '\n':
+			p.next()
+		case c == '#' || c == ';':
+			p.skipLine()
+		case c == '[':
+			section, err := p.parseSection()
+			if err != nil {
+				return nil, nil, err
+			}
+			section.Start = lineStart
+			section.End = p.pos
+			sections = append(sections, section)
+			current = &sections[len(sections)-1]
+			// Variables may follow the header on the same line
+			p.skipSpaces()
+			if c, ok := p.peek(); ok && c != '\n' && c != '#' && c != ';' {
+				continue
+			}
+			p.skipLine()
+			sections[len(sections)-1].End = p.pos
+		case isAlpha(c):
+			if current == nil {
+				return nil, nil, p.errorf("variable outside of a section")
+			}
+			entry, err := p.parseEntry()
+			if err != nil {
+				return nil, nil, err
+			}
+			entry.Section, entry.Subsection = current.Section, current.Subsection
+			entry.Start, entry.End = lineStart, p.pos
+			entries = append(entries, entry)
+		default:
+			return nil, nil, p.errorf("unexpected character %q", c)
+		}
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("bad config line %d in %s: %s", p.line, p.origin, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) peek() (byte, bool) {
+	if p.pos >= len(p.content) {
+		return 0, false
+	}
+	return p.content[p.pos], true
+}
+
+func (p *parser) next() (byte, bool) {
+	c, ok := p.peek()
+	if ok {
+		p.pos++
+		if c == '\n' {
+			p.line++
+		}
+	}
+	return c, ok
+}
+
+func (p *parser) skipSpaces() {
+	for c, ok := p.peek(); ok && isSpace(c); c, ok = p.peek() {
+		p.pos++
+	}
+}
+
+// Skip until after the end of the line
+func (p *parser) skipLine() {
+	for c, ok := p.next(); ok && c != '\n'; c, ok = p.next() {
+	}
+}
+
+// Parse "[section]", "[section "subsection"]" or the legacy "[section.subsection]"
+func (p *parser) parseSection() (rawSection, error) {
+	p.next()
+	name := make([]byte, 0)
+	for {
+		c, ok := p.next()
+		if !ok || c == '\n' {
+			return rawSection{}, p.errorf("unterminated section header")
+		}
+		if c == ']' {
+			section := strings.ToLower(string(name))
+			if section == "" {
+				return rawSection{}, p.errorf("empty section name")
+			}
+			// The legacy syntax lowercases the subsection too
+			section, subsection, _ := strings.Cut(section, ".")
+			return rawSection{Section: section, Subsection: subsection}, nil
+		}
+		if isSpace(c) {
+			break
+		}
+		if !isKeyChar(c) && c != '.' {
+			return rawSection{}, p.errorf("invalid section name")
+		}
+		name = append(name, c)
+	}
+	p.skipSpaces()
+	if c, _ := p.next(); c != '"' {
+		return rawSection{}, p.errorf("invalid section header")
+	}
+	subsection := make([]byte, 0)
+	for {
+		c, ok := p.next()
+		if !ok || c == '\n' {
+			return rawSection{}, p.errorf("unterminated subsection")
+		}
+		if c == '"' {
+			break
+		}
+		if c == '\\' {
+			// Only quotes and backslashes are escaped, other backslashes are dropped
+			if c, ok = p.next(); !ok || c == '\n' {
+				return rawSection{}, p.errorf("unterminated subsection")
+			}
+		}
+		subsection = append(subsection, c)
+	}
+	if c, _ := p.next(); c != ']' {
+		return rawSection{}, p.errorf("invalid section header")
+	}
+	return rawSection{Section: strings.ToLower(string(name)), Subsection: string(subsection)}, nil
+}
+
+// Parse "name [= value]" until the end of the line
+func (p *parser) parseEntry() (rawEntry, error) {
+	name := make([]byte, 0)
+	for c, ok := p.peek(); ok && isKeyChar(c); c, ok = p.peek() {
+		name = append(name, c)
+		p.pos++
+	}
+	entry := rawEntry{Name: strings.ToLower(string(name))}
+	p.skipSpaces()
+	c, ok := p.peek()
+	if !ok || c == '\n' || c == '#' || c == ';' {
+		entry.NoValue = true
+		p.skipLine()
+		return entry, nil
+	}
+	if c != '=' {
+		return rawEntry{}, p.errorf("invalid variable name")
+	}
+	p.next()
+	value, err := p.parseValue()
+	if err != nil {
+		return rawEntry{}, err
+	}
+	entry.Value = value
+	return entry, nil
+}
+
+// Parse a value until the end of the line, unquoting and unescaping it
+func (p *parser) parseValue() (string, error) {
+	value := make([]byte, 0)
+	quoted := false
+	// Number of unquoted whitespace characters held back, each written as one space once more of a non-empty value
+	// follows them
+	spaces := 0
+	p.skipSpaces()
+	for {
+		c, ok := p.next()
+		if !ok || c == '\n' {
+			if quoted {
+				return "", p.errorf("unterminated quoted value")
+			}
+			return string(value), nil
+		}
+		if !quoted && isSpace(c) {
+			if len(value) > 0 {
+				spaces++
+			}
+			continue
+		}
+		if !quoted && (c == '#' || c == ';') {
+			p.skipLine()
+			return string(value), nil
+		}
+		for ; spaces > 0; spaces-- {
+			value = append(value, ' ')
+		}
+		switch c {
+		case '\\':
+			c, ok = p.next()
+			switch c {
+			case '\n':
+				// Line continuation
+				continue
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case '\\', '"':
+			default:
+				if !ok {
+					return "", p.errorf("unterminated escape")
+				}
+				return "", p.errorf("invalid escape sequence \\%c", c)
+			}
+			value = append(value, c)
+		case '"':
+			quoted = !quoted
+		default:
+			value = append(value, c)
+		}
+	}
+}
+
+// Return value quoted and escaped for a config file
+func quoteValue(value string) string {
+	b := new(strings.Builder)
+	needsQuotes := value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;")
+	if needsQuotes {
+		b.WriteByte('"')
+	}
+	for _, c := range []byte(value) {
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if needsQuotes {
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// Return the header of a section, its subsection quoted and escaped
+func sectionHeader(section, subsection string) string {
+	if subsection == "" {
+		return fmt.Sprintf("[%s]\n", section)
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(subsection)
+	return fmt.Sprintf("[%s \"%s\"]\n", section, escaped)
+}
@@ -0,0 +1,235 @@
+// Conversions between the content of the files of the work tree and the content of their blobs, like git's convert.c:
+// the line endings normalized to LF in the repository and written as the text and eol attributes, core.autocrlf and
+// core.eol ask in the work tree
+package convert
+
+import (
+	"bytes"
+)
+
+// What is done with the line endings of a file
+type Action int
+
+const (
+	// Nothing is converted
+	Binary Action = iota
+	// CRLF are stored as LF, the work tree keeps LF
+	TextInput
+	// CRLF are stored as LF, LF are written as CRLF in the work tree
+	TextCRLF
+	// Like TextInput and TextCRLF, only for the files that look like text and weren't stored with CRLF
+	AutoInput
+	AutoCRLF
+)
+
+// The settings deciding the line endings of the text files without an eol attribute
+type Settings struct {
+	// core.autocrlf: "true", "false" or "input"
+	AutoCRLF string
+	// core.eol: "lf", "crlf" or "native", which is lf
+	EOL string
+}
+
+// Whether the text files are written with CRLF in the work tree
+func (s Settings) textEOLIsCRLF() bool {
+	switch s.AutoCRLF {
+	case "true":
+		return true
+	case "input":
+		return false
+	}
+	return s.EOL == "crlf"
+}
+
+// Return the action on the line endings of a file with the attributes given, by name: "set", "unset" or their value,
+// the unspecified ones left out
+func Decide(attrs map[string]string, s Settings) Action {
+	const (
+		undefined = iota
+		text
+		binary
+		textInput
+		auto
+	)
+	textAttr := func(value string) int {
+		switch value {
+		case "set":
+			return text
+		case "unset":
+			return binary
+		case "input":
+			return textInput
+		case "auto":
+			return auto
+		}
+		return undefined
+	}
+	crlf := textAttr(attrs["text"])
+	if crlf == undefined {
+		// crlf is the old name of text
+		crlf = textAttr(attrs["crlf"])
+	}
+	if crlf == binary {
+		return Binary
+	}
+	eol := attrs["eol"]
+	switch {
+	case crlf == auto && eol == "lf":
+		return AutoInput
+	case crlf == auto && eol == "crlf":
+		return AutoCRLF
+	case eol == "lf":
+		return TextInput
+	case eol == "crlf":
+		return TextCRLF
+	case crlf == textInput:
+		return TextInput
+	case crlf == text && s.textEOLIsCRLF():
+		return TextCRLF
+	case crlf == text:
+		return TextInput
+	case crlf == auto && s.textEOLIsCRLF():
+		return AutoCRLF
+	case crlf == auto:
+		return AutoInput
+	}
+	switch s.AutoCRLF {
+	case "true":
+		return AutoCRLF
+	case "input":
+		return AutoInput
+	}
+	return Binary
+}
+
+// The kinds of characters of a content
+type Stats struct {
+	// CR followed by LF, CR alone and LF alone
+	CRLF, LoneCR, LoneLF int
+	NUL                  int
+	Printable            int
+	NonPrintable         int
+}
+
+// Count the line endings and the characters of a content
+func GatherStats(content []byte) Stats {
+	s := Stats{}
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\r' && i+1 < len(content) && content[i+1] == '\n':
+			s.CRLF++
+			i++
+		case c == '\r':
+			s.LoneCR++
+		case c == '\n':
+			s.LoneLF++
+		case c == 127:
+			s.NonPrintable++
+		case c == '\b' || c == '\t' || c == '\033' || c == '\014':
+			s.Printable++
+		case c == 0:
+			s.NUL++
+			s.NonPrintable++
+		case c < 32:
+			s.NonPrintable++
+		default:
+			s.Printable++
+		}
+	}
+	// A trailing ^Z, the end of file of old systems, doesn't make a file binary
+	if len(content) > 0 && content[len(content)-1] == '\032' {
+		s.NonPrintable--
+	}
+	return s
+}
+
+// Whether the content looks binary: a lone CR, a NUL or more than a non-printable character for 128 printable ones
+func (s Stats) IsBinary() bool {
+	return s.LoneCR > 0 || s.NUL > 0 || s.Printable>>7 < s.NonPrintable
+}
+
+func (a Action) auto() bool {
+	return a == AutoInput || a == AutoCRLF
+}
+
+// Whether LF are written as CRLF in the work tree for a content with these stats
+func (a Action) lfToCRLF(s Stats) bool {
+	if a != TextCRLF && a != AutoCRLF || s.LoneLF == 0 {
+		return false
+	}
+	return !a.auto() || s.LoneCR == 0 && s.CRLF == 0 && !s.IsBinary()
+}
+
+// The line endings a conversion can't give back as they were
+type Loss int
+
+const (
+	NoLoss Loss = iota
+	// The CRLF of the file are stored as LF and written back as LF
+	CRLFLost
+	// The LF of the file are written back as CRLF
+	LFLost
+)
+
+// Return the content of a file of the work tree as stored in a blob, and whether a checkout of the blob would give
+// the file back with other line endings
+// indexHasCRLF tells whether the blob of the path in the index has CRLF, which the automatic conversions leave alone;
+// it is nil to renormalize whatever the index has
+func ToGit(content []byte, a Action, indexHasCRLF func() bool) ([]byte, Loss) {
+	if a == Binary || len(content) == 0 {
+		return content, NoLoss
+	}
+	s := GatherStats(content)
+	convert := s.CRLF > 0
+	if a.auto() {
+		if s.IsBinary() {
+			return content, NoLoss
+		}
+		if convert && indexHasCRLF != nil && indexHasCRLF() {
+			convert = false
+		}
+	}
+	// The line endings after an add, then after a checkout
+	after := s
+	if convert {
+		after.LoneLF += after.CRLF
+		after.CRLF = 0
+	}
+	if a.lfToCRLF(after) {
+		after.CRLF += after.LoneLF
+		after.LoneLF = 0
+	}
+	loss := NoLoss
+	switch {
+	case s.CRLF > 0 && after.CRLF == 0:
+		loss = CRLFLost
+	case s.LoneLF > 0 && after.LoneLF == 0:
+		loss = LFLost
+	}
+	if !convert {
+		return content, loss
+	}
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")), loss
+}
+
+// Return the content of a blob as written to the work tree
+func ToWorkTree(content []byte, a Action) []byte {
+	if !a.lfToCRLF(GatherStats(content)) {
+		return content
+	}
+	out := make([]byte, 0, len(content)+len(content)/16)
+	for i, c := range content {
+		if c == '\n' && (i == 0 || content[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Whether a blob has CRLF line endings the automatic conversions would leave alone
+func HasCRLF(content []byte) bool {
+	s := GatherStats(content)
+	return s.CRLF > 0 && !s.IsBinary()
+}
@@ -0,0 +1,83 @@
+package convert
+
+import (
+	"testing"
+)
+
+var TestCaseDecide = []struct {
+	Attrs    map[string]string
+	Settings Settings
+	Expected Action
+}{
+	{Attrs: map[string]string{}, Expected: Binary},
+	{Attrs: map[string]string{}, Settings: Settings{AutoCRLF: "true"}, Expected: AutoCRLF},
+	{Attrs: map[string]string{}, Settings: Settings{AutoCRLF: "input"}, Expected: AutoInput},
+	{Attrs: map[string]string{}, Settings: Settings{EOL: "crlf"}, Expected: Binary},
+	{Attrs: map[string]string{"text": "set"}, Expected: TextInput},
+	{Attrs: map[string]string{"text": "set"}, Settings: Settings{EOL: "crlf"}, Expected: TextCRLF},
+	{Attrs: map[string]string{"text": "set"}, Settings: Settings{AutoCRLF: "input", EOL: "crlf"}, Expected: TextInput},
+	{Attrs: map[string]string{"text": "unset", "eol": "crlf"}, Settings: Settings{AutoCRLF: "true"}, Expected: Binary},
+	{Attrs: map[string]string{"text": "auto"}, Expected: AutoInput},
+	{Attrs: map[string]string{"text": "auto", "eol": "crlf"}, Expected: AutoCRLF},
+	{Attrs: map[string]string{"text": "input"}, Settings: Settings{AutoCRLF: "true"}, Expected: TextInput},
+	{Attrs: map[string]string{"eol": "crlf"}, Expected: TextCRLF},
+	{Attrs: map[string]string{"crlf": "unset"}, Settings: Settings{AutoCRLF: "true"}, Expected: Binary},
+}
+
+func TestDecide(t *testing.T) {
+	for _, tc := range TestCaseDecide {
+		if got := Decide(tc.Attrs, tc.Settings); got != tc.Expected {
+			t.Fatalf("%v %+v: expected %d, got %d", tc.Attrs, tc.Settings, tc.Expected, got)
+		}
+	}
+}
+
+func TestGatherStats(t *testing.T) {
+	s := GatherStats([]byte("a\r\nb\rc\n\x00\x7f\x1a"))
+	if s.CRLF != 1 || s.LoneCR != 1 || s.LoneLF != 1 || s.NUL != 1 || s.NonPrintable != 2 || s.Printable != 3 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if !s.IsBinary() || GatherStats([]byte("text\r\n\t\x1a")).IsBinary() {
+		t.Fatalf("expected only the content with a NUL to be binary")
+	}
+}
+
+var TestCaseToGit = []struct {
+	Content     string
+	Action      Action
+	IndexCRLF   bool
+	Expected    string
+	ExpectedErr Loss
+}{
+	{Content: "a\r\nb\r\n", Action: TextInput, Expected: "a\nb\n", ExpectedErr: CRLFLost},
+	{Content: "a\r\nb\r\n", Action: TextCRLF, Expected: "a\nb\n"},
+	{Content: "a\nb\r\n", Action: TextCRLF, Expected: "a\nb\n", ExpectedErr: LFLost},
+	{Content: "a\r\nb\r\n", Action: Binary, Expected: "a\r\nb\r\n"},
+	{Content: "a\r\n\x00", Action: AutoInput, Expected: "a\r\n\x00"},
+	{Content: "a\r\nb\n", Action: AutoInput, IndexCRLF: true, Expected: "a\r\nb\n"},
+	{Content: "a\r\nb\n", Action: AutoCRLF, Expected: "a\nb\n", ExpectedErr: LFLost},
+	{Content: "a\r\r\n", Action: TextInput, Expected: "a\r\n", ExpectedErr: CRLFLost},
+}
+
+func TestToGit(t *testing.T) {
+	for _, tc := range TestCaseToGit {
+		got, loss := ToGit([]byte(tc.Content), tc.Action, func() bool { return tc.IndexCRLF })
+		if string(got) != tc.Expected || loss != tc.ExpectedErr {
+			t.Fatalf("%q with %d: expected %q and %d, got %q and %d", tc.Content, tc.Action, tc.Expected, tc.ExpectedErr, got, loss)
+		}
+	}
+}
+
+func TestToWorkTree(t *testing.T) {
+	for content, expected := range map[string]string{"a\nb\n": "a\r\nb\r\n", "a\r\nb\n": "a\r\nb\r\n", "\n": "\r\n", "": ""} {
+		if got := string(ToWorkTree([]byte(content), TextCRLF)); got != expected {
+			t.Fatalf("%q: expected %q, got %q", content, expected, got)
+		}
+	}
+	if got := string(ToWorkTree([]byte("a\r\nb\n"), AutoCRLF)); got != "a\r\nb\n" {
+		t.Fatalf("expected the automatic conversion to leave a content with CRLF alone, got %q", got)
+	}
+	if got := string(ToWorkTree([]byte("a\nb\n"), TextInput)); got != "a\nb\n" {
+		t.Fatalf("expected LF to be kept, got %q", got)
+	}
+}
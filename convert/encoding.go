@@ -0,0 +1,309 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The errors of the conversions between the encodings of the working-tree-encoding attribute and UTF-8, the
+// encoding of the blobs
+var (
+	ErrUnknownEncoding = errors.New("unknown encoding")
+	ErrInvalidContent  = errors.New("invalid content for the encoding")
+	// A UTF-16 or UTF-32 content without BOM when its encoding doesn't give its byte order, or with a BOM when it does
+	ErrBOMRequired   = errors.New("BOM required")
+	ErrBOMProhibited = errors.New("BOM prohibited")
+)
+
+var (
+	bomUTF16BE = []byte{0xFE, 0xFF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF32BE = []byte{0x00, 0x00, 0xFE, 0xFF}
+	bomUTF32LE = []byte{0xFF, 0xFE, 0x00, 0x00}
+)
+
+// The encodings known, by the names they are given
+var encodingNames = map[string]string{
+	"UTF-16": "UTF-16", "UTF16": "UTF-16", "UTF-16LE": "UTF-16LE", "UTF16LE": "UTF-16LE", "UTF-16BE": "UTF-16BE",
+	"UTF16BE": "UTF-16BE", "UTF-32": "UTF-32", "UTF32": "UTF-32", "UTF-32LE": "UTF-32LE", "UTF32LE": "UTF-32LE",
+	"UTF-32BE": "UTF-32BE", "UTF32BE": "UTF-32BE", "SHIFT-JIS": "SHIFT-JIS", "SHIFT_JIS": "SHIFT-JIS",
+	"SJIS": "SHIFT-JIS", "CSSHIFTJIS": "SHIFT-JIS", "MS_KANJI": "SHIFT-JIS", "ISO-8859-1": "ISO-8859-1",
+	"ISO8859-1": "ISO-8859-1", "ISO_8859-1": "ISO-8859-1", "LATIN1": "ISO-8859-1", "L1": "ISO-8859-1",
+	"US-ASCII": "US-ASCII", "ASCII": "US-ASCII", "ANSI_X3.4-1968": "US-ASCII", "UTF-16LE-BOM": "UTF-16LE-BOM",
+	"UTF16LE-BOM": "UTF-16LE-BOM", "UTF-16BE-BOM": "UTF-16BE-BOM", "UTF16BE-BOM": "UTF-16BE-BOM",
+	"UTF-32LE-BOM": "UTF-32LE-BOM", "UTF32LE-BOM": "UTF-32LE-BOM", "UTF-32BE-BOM": "UTF-32BE-BOM",
+	"UTF32BE-BOM": "UTF-32BE-BOM",
+}
+
+// The BOM of the encodings giving the byte order that are written with a BOM all the same, like UTF-16LE-BOM
+var encodingBOMs = map[string][]byte{
+	"UTF-16LE-BOM": bomUTF16LE, "UTF-16BE-BOM": bomUTF16BE, "UTF-32LE-BOM": bomUTF32LE, "UTF-32BE-BOM": bomUTF32BE,
+}
+
+// Whether an encoding is UTF-8, the encoding of the blobs, whatever its spelling
+func IsUTF8(enc string) bool {
+	return strings.EqualFold(enc, "UTF-8") || strings.EqualFold(enc, "UTF8")
+}
+
+// Check the byte order mark of a content in a UTF-16 or UTF-32 encoding: required when the encoding doesn't give
+// the byte order, like UTF-16, prohibited when it does, like UTF-16LE, and required to match it when the encoding
+// carries one, like UTF-16LE-BOM
+func CheckBOM(content []byte, enc string) error {
+	hasBOM := func(boms ...[]byte) bool {
+		for _, bom := range boms {
+			if bytes.HasPrefix(content, bom) {
+				return true
+			}
+		}
+		return false
+	}
+	name := encodingNames[strings.ToUpper(enc)]
+	if bom, found := encodingBOMs[name]; found {
+		if !hasBOM(bom) {
+			return ErrBOMRequired
+		}
+		return nil
+	}
+	switch name {
+	case "UTF-16":
+		if !hasBOM(bomUTF16BE, bomUTF16LE) {
+			return ErrBOMRequired
+		}
+	case "UTF-32":
+		if !hasBOM(bomUTF32BE, bomUTF32LE) {
+			return ErrBOMRequired
+		}
+	case "UTF-16LE", "UTF-16BE":
+		if hasBOM(bomUTF16BE, bomUTF16LE) {
+			return ErrBOMProhibited
+		}
+	case "UTF-32LE", "UTF-32BE":
+		if hasBOM(bomUTF32BE, bomUTF32LE) {
+			return ErrBOMProhibited
+		}
+	}
+	return nil
+}
+
+// Return a content in an encoding converted to UTF-8
+// The BOM of UTF-16 and UTF-32 gives the byte order and is left out, big endian without one; the encodings carrying
+// a BOM, like UTF-16LE-BOM, require it
+func Decode(content []byte, enc string) ([]byte, error) {
+	name, found := encodingNames[strings.ToUpper(enc)]
+	if !found {
+		return nil, ErrUnknownEncoding
+	}
+	if bom, found := encodingBOMs[name]; found {
+		if !bytes.HasPrefix(content, bom) {
+			return nil, ErrBOMRequired
+		}
+		name, content = strings.TrimSuffix(name, "-BOM"), content[len(bom):]
+	}
+	out := make([]byte, 0, len(content))
+	switch name {
+	case "UTF-16", "UTF-16LE", "UTF-16BE":
+		var order binary.ByteOrder = binary.BigEndian
+		switch {
+		case name == "UTF-16LE":
+			order = binary.LittleEndian
+		case name == "UTF-16" && bytes.HasPrefix(content, bomUTF16LE):
+			order, content = binary.LittleEndian, content[2:]
+		case name == "UTF-16" && bytes.HasPrefix(content, bomUTF16BE):
+			content = content[2:]
+		}
+		if len(content)%2 != 0 {
+			return nil, ErrInvalidContent
+		}
+		for i := 0; i < len(content); i += 2 {
+			r := rune(order.Uint16(content[i:]))
+			if utf16.IsSurrogate(r) {
+				if r >= 0xDC00 || i+4 > len(content) {
+					return nil, ErrInvalidContent
+				}
+				r = utf16.DecodeRune(r, rune(order.Uint16(content[i+2:])))
+				if r == utf8.RuneError {
+					return nil, ErrInvalidContent
+				}
+				i += 2
+			}
+			out = utf8.AppendRune(out, r)
+		}
+	case "UTF-32", "UTF-32LE", "UTF-32BE":
+		var order binary.ByteOrder = binary.BigEndian
+		switch {
+		case name == "UTF-32LE":
+			order = binary.LittleEndian
+		case name == "UTF-32" && bytes.HasPrefix(content, bomUTF32LE):
+			order, content = binary.LittleEndian, content[4:]
+		case name == "UTF-32" && bytes.HasPrefix(content, bomUTF32BE):
+			content = content[4:]
+		}
+		if len(content)%4 != 0 {
+			return nil, ErrInvalidContent
+		}
+		for i := 0; i < len(content); i += 4 {
+			r := rune(order.Uint32(content[i:]))
+			if r > utf8.MaxRune || utf16.IsSurrogate(r) {
+				return nil, ErrInvalidContent
+			}
+			out = utf8.AppendRune(out, r)
+		}
+	case "SHIFT-JIS":
+		for i := 0; i < len(content); i++ {
+			r, size := decodeShiftJIS(content[i:])
+			if size == 0 {
+				return nil, ErrInvalidContent
+			}
+			out = utf8.AppendRune(out, r)
+			i += size - 1
+		}
+	case "ISO-8859-1":
+		for _, c := range content {
+			out = utf8.AppendRune(out, rune(c))
+		}
+	case "US-ASCII":
+		for _, c := range content {
+			if c >= 0x80 {
+				return nil, ErrInvalidContent
+			}
+		}
+		out = append(out, content...)
+	}
+	return out, nil
+}
+
+// Return a UTF-8 content converted to an encoding
+// UTF-16 and UTF-32 are written little endian after a BOM, the encodings carrying a BOM in their byte order after it
+func Encode(content []byte, enc string) ([]byte, error) {
+	name, found := encodingNames[strings.ToUpper(enc)]
+	if !found {
+		return nil, ErrUnknownEncoding
+	}
+	if !utf8.Valid(content) {
+		return nil, ErrInvalidContent
+	}
+	out := make([]byte, 0, len(content)*2)
+	if bom, found := encodingBOMs[name]; found {
+		name, out = strings.TrimSuffix(name, "-BOM"), append(out, bom...)
+	}
+	var order binary.AppendByteOrder = binary.LittleEndian
+	switch name {
+	case "UTF-16":
+		out = append(out, bomUTF16LE...)
+	case "UTF-32":
+		out = append(out, bomUTF32LE...)
+	case "UTF-16BE", "UTF-32BE":
+		order = binary.BigEndian
+	}
+	for _, r := range string(content) {
+		switch name {
+		case "UTF-16", "UTF-16LE", "UTF-16BE":
+			if r >= 0x10000 {
+				high, low := utf16.EncodeRune(r)
+				out = order.AppendUint16(out, uint16(high))
+				out = order.AppendUint16(out, uint16(low))
+			} else {
+				out = order.AppendUint16(out, uint16(r))
+			}
+		case "UTF-32", "UTF-32LE", "UTF-32BE":
+			out = order.AppendUint32(out, uint32(r))
+		case "SHIFT-JIS":
+			code, ok := encodeShiftJIS(r)
+			if !ok {
+				return nil, ErrInvalidContent
+			}
+			if code > 0xFF {
+				out = append(out, byte(code>>8))
+			}
+			out = append(out, byte(code))
+		case "ISO-8859-1":
+			if r > 0xFF {
+				return nil, ErrInvalidContent
+			}
+			out = append(out, byte(r))
+		case "US-ASCII":
+			if r >= 0x80 {
+				return nil, ErrInvalidContent
+			}
+			out = append(out, byte(r))
+		}
+	}
+	return out, nil
+}
+
+// Return the character of the Shift-JIS code at the start of a content and its size, 0 when it isn't valid
+// The single bytes are JIS X 0201: ASCII with a yen sign and an overline for the backslash and the tilde, and the
+// half-width katakana
+func decodeShiftJIS(content []byte) (rune, int) {
+	c := content[0]
+	switch {
+	case c == 0x5C:
+		return 0xA5, 1
+	case c == 0x7E:
+		return 0x203E, 1
+	case c < 0x80:
+		return rune(c), 1
+	case c >= 0xA1 && c <= 0xDF:
+		return 0xFF61 + rune(c-0xA1), 1
+	case len(content) < 2 || content[1] < 0x40 || content[1] > 0xFC:
+		return 0, 0
+	}
+	var lead int
+	switch {
+	case c >= 0x81 && c <= 0x9F:
+		lead = int(c) - 0x81
+	case c >= 0xE0 && c <= 0xFC:
+		lead = int(c) - 0xE0 + 31
+	default:
+		return 0, 0
+	}
+	r := shiftJISDecode[lead][content[1]-0x40]
+	if r == 0 {
+		return 0, 0
+	}
+	return rune(r), 2
+}
+
+// The codes of the characters of the double-byte Shift-JIS codes, built when first needed
+var (
+	shiftJISEncode     map[rune]uint16
+	shiftJISEncodeOnce sync.Once
+)
+
+// Return the Shift-JIS code of a character, and whether it has one
+func encodeShiftJIS(r rune) (uint16, bool) {
+	switch {
+	case r < 0x80 && r != 0x5C && r != 0x7E:
+		return uint16(r), true
+	case r == 0xA5:
+		return 0x5C, true
+	case r == 0x203E:
+		return 0x7E, true
+	case r >= 0xFF61 && r <= 0xFF9F:
+		return uint16(r-0xFF61) + 0xA1, true
+	}
+	shiftJISEncodeOnce.Do(func() {
+		shiftJISEncode = make(map[rune]uint16)
+		for i, trails := range shiftJISDecode {
+			lead := uint16(0x81 + i)
+			if i >= 31 {
+				lead = uint16(0xE0 + i - 31)
+			}
+			for j, c := range trails {
+				if c != 0 {
+					shiftJISEncode[rune(c)] = lead<<8 | uint16(0x40+j)
+				}
+			}
+		}
+		for c, code := range shiftJISEncodeExtra {
+			shiftJISEncode[c] = code
+		}
+	})
+	code, found := shiftJISEncode[r]
+	return code, found
+}
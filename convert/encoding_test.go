@@ -0,0 +1,111 @@
+package convert
+
+import (
+	"errors"
+	"testing"
+)
+
+var TestCaseDecode = []struct {
+	Content     string
+	Encoding    string
+	Expected    string
+	ExpectedErr error
+}{
+	{Content: "\xff\xfeh\x00\xe9\x00\n\x00", Encoding: "UTF-16", Expected: "hé\n"},
+	{Content: "\xfe\xff\x00h\x00\xe9\x00\n", Encoding: "utf16", Expected: "hé\n"},
+	{Content: "\x00h\x00\xe9", Encoding: "UTF-16", Expected: "hé"},
+	{Content: "h\x00\xe9\x00", Encoding: "utf-16le", Expected: "hé"},
+	{Content: "\x3d\xd8\x00\xde", Encoding: "UTF-16LE", Expected: "\U0001F600"},
+	{Content: "\xff\xfe\x00\xd8", Encoding: "UTF-16", ExpectedErr: ErrInvalidContent},
+	{Content: "h\x00\xe9", Encoding: "UTF-16LE", ExpectedErr: ErrInvalidContent},
+	{Content: "\xff\xfe\x00\x00h\x00\x00\x00", Encoding: "UTF-32", Expected: "h"},
+	{Content: "\x00\x00\x00h", Encoding: "UTF-32BE", Expected: "h"},
+	{Content: "h\x00", Encoding: "UTF-16LE-BOM", ExpectedErr: ErrBOMRequired},
+	{Content: "\xff\xfe\x00\x00h\x00\x00\x00", Encoding: "UTF-32BE-BOM", ExpectedErr: ErrBOMRequired},
+	{Content: "\x82\xb1\x82\xf1\\~\xb1\n", Encoding: "Shift-JIS", Expected: "こん¥‾ｱ\n"},
+	{Content: "\x85\x40", Encoding: "SJIS", ExpectedErr: ErrInvalidContent},
+	{Content: "\x80", Encoding: "SJIS", ExpectedErr: ErrInvalidContent},
+	{Content: "\x82", Encoding: "SJIS", ExpectedErr: ErrInvalidContent},
+	{Content: "caf\xe9", Encoding: "latin1", Expected: "café"},
+	{Content: "caf\xe9", Encoding: "ASCII", ExpectedErr: ErrInvalidContent},
+	{Content: "x", Encoding: "NOPE", ExpectedErr: ErrUnknownEncoding},
+}
+
+func TestDecode(t *testing.T) {
+	for _, tc := range TestCaseDecode {
+		got, err := Decode([]byte(tc.Content), tc.Encoding)
+		if string(got) != tc.Expected || !errors.Is(err, tc.ExpectedErr) {
+			t.Fatalf("%q from %s: expected %q and %v, got %q and %v", tc.Content, tc.Encoding, tc.Expected, tc.ExpectedErr, got, err)
+		}
+	}
+}
+
+var TestCaseEncode = []struct {
+	Content     string
+	Encoding    string
+	Expected    string
+	ExpectedErr error
+}{
+	{Content: "hé\n", Encoding: "UTF-16", Expected: "\xff\xfeh\x00\xe9\x00\n\x00"},
+	{Content: "hé", Encoding: "UTF-16BE", Expected: "\x00h\x00\xe9"},
+	{Content: "\U0001F600", Encoding: "UTF-16LE", Expected: "\x3d\xd8\x00\xde"},
+	{Content: "h", Encoding: "UTF-32", Expected: "\xff\xfe\x00\x00h\x00\x00\x00"},
+	{Content: "こん¥‾ｱ\\\n", Encoding: "SHIFT_JIS", Expected: "\x82\xb1\x82\xf1\\~\xb1\\\n"},
+	{Content: "한", Encoding: "SHIFT-JIS", ExpectedErr: ErrInvalidContent},
+	{Content: "€", Encoding: "ISO-8859-1", ExpectedErr: ErrInvalidContent},
+	{Content: "\xff", Encoding: "UTF-16", ExpectedErr: ErrInvalidContent},
+	{Content: "x", Encoding: "NOPE", ExpectedErr: ErrUnknownEncoding},
+}
+
+func TestEncode(t *testing.T) {
+	for _, tc := range TestCaseEncode {
+		got, err := Encode([]byte(tc.Content), tc.Encoding)
+		if string(got) != tc.Expected || !errors.Is(err, tc.ExpectedErr) {
+			t.Fatalf("%q to %s: expected %q and %v, got %q and %v", tc.Content, tc.Encoding, tc.Expected, tc.ExpectedErr, got, err)
+		}
+	}
+}
+
+func TestCheckBOM(t *testing.T) {
+	for _, tc := range []struct {
+		Content  string
+		Encoding string
+		Expected error
+	}{
+		{Content: "\xff\xfeh\x00", Encoding: "UTF-16"},
+		{Content: "h\x00", Encoding: "UTF-16", Expected: ErrBOMRequired},
+		{Content: "h\x00\x00\x00", Encoding: "utf32", Expected: ErrBOMRequired},
+		{Content: "\xff\xfeh\x00", Encoding: "UTF-16LE", Expected: ErrBOMProhibited},
+		{Content: "\x00\x00\xfe\xff", Encoding: "UTF-32BE", Expected: ErrBOMProhibited},
+		{Content: "\xff\xfe", Encoding: "SHIFT-JIS"},
+		{Content: "\xff\xfeh\x00", Encoding: "UTF-16LE-BOM"},
+		{Content: "h\x00", Encoding: "UTF-16LE-BOM", Expected: ErrBOMRequired},
+		{Content: "\xfe\xff\x00h", Encoding: "utf16le-bom", Expected: ErrBOMRequired},
+	} {
+		if err := CheckBOM([]byte(tc.Content), tc.Encoding); err != tc.Expected {
+			t.Fatalf("%q as %s: expected %v, got %v", tc.Content, tc.Encoding, tc.Expected, err)
+		}
+	}
+}
+
+// Test that the encodings carrying a BOM write it, and read it back
+func TestBOMRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		Encoding string
+		Encoded  string
+	}{
+		{Encoding: "UTF-16LE-BOM", Encoded: "\xff\xfeh\x00\xe9\x00\n\x00"},
+		{Encoding: "utf16be-bom", Encoded: "\xfe\xff\x00h\x00\xe9\x00\n"},
+		{Encoding: "UTF-32LE-BOM", Encoded: "\xff\xfe\x00\x00h\x00\x00\x00\xe9\x00\x00\x00\n\x00\x00\x00"},
+		{Encoding: "UTF-32BE-BOM", Encoded: "\x00\x00\xfe\xff\x00\x00\x00h\x00\x00\x00\xe9\x00\x00\x00\n"},
+	} {
+		encoded, err := Encode([]byte("hé\n"), tc.Encoding)
+		if string(encoded) != tc.Encoded || err != nil {
+			t.Fatalf("to %s: expected %q, got %q and %v", tc.Encoding, tc.Encoded, encoded, err)
+		}
+		decoded, err := Decode(encoded, tc.Encoding)
+		if string(decoded) != "hé\n" || err != nil {
+			t.Fatalf("from %s: expected %q, got %q and %v", tc.Encoding, "hé\n", decoded, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+//go:build ignore
+
+// Generate shiftjis_table.go from the SHIFT-JIS converter of iconv, the one git uses on glibc systems
+//
+//	go run shiftjis_gen.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Convert text with iconv, "" when it can't be converted
+func iconv(from, to string, text []byte) string {
+	cmd := exec.Command("iconv", "-f", from, "-t", to)
+	cmd.Stdin = bytes.NewReader(text)
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+func main() {
+	// The double-byte codes: 60 lead bytes and the trail bytes from 0x40 to 0xFC
+	leads := make([]byte, 0, 60)
+	for b := 0x81; b <= 0xFC; b++ {
+		if b <= 0x9F || b >= 0xE0 {
+			leads = append(leads, byte(b))
+		}
+	}
+	decode := make([][189]uint16, len(leads))
+	var wg sync.WaitGroup
+	limit := make(chan bool, 32)
+	for i, lead := range leads {
+		for trail := 0x40; trail <= 0xFC; trail++ {
+			wg.Add(1)
+			limit <- true
+			go func(i int, lead, trail byte) {
+				defer func() { <-limit; wg.Done() }()
+				s := iconv("SHIFT-JIS", "UTF-8", []byte{lead, trail})
+				if r, size := utf8.DecodeRuneInString(s); size > 0 && size == len(s) && r <= 0xFFFF {
+					decode[i][trail-0x40] = uint16(r)
+				}
+			}(i, lead, byte(trail))
+		}
+	}
+	wg.Wait()
+
+	// The characters iconv encodes to a code that decodes to another character
+	decoded := func(code []byte) rune {
+		switch {
+		case len(code) == 1 && code[0] == 0x5C:
+			return 0xA5
+		case len(code) == 1 && code[0] == 0x7E:
+			return 0x203E
+		case len(code) == 1 && code[0] >= 0xA1 && code[0] <= 0xDF:
+			return 0xFF61 + rune(code[0]-0xA1)
+		case len(code) == 1:
+			return rune(code[0])
+		}
+		for i, lead := range leads {
+			if lead == code[0] {
+				return rune(decode[i][code[1]-0x40])
+			}
+		}
+		return 0
+	}
+	all := new(bytes.Buffer)
+	for r := rune(1); r <= 0xFFFF; r++ {
+		if r == '\n' || r >= 0xD800 && r <= 0xDFFF {
+			continue
+		}
+		all.WriteRune(r)
+		all.WriteByte('\n')
+	}
+	cmd := exec.Command("iconv", "-c", "-f", "UTF-8", "-t", "SHIFT-JIS")
+	cmd.Stdin = all
+	out, _ := cmd.Output()
+	lines := bytes.Split(out, []byte("\n"))
+	extra := make(map[rune]uint16)
+	r := rune(0)
+	for _, line := range lines {
+		r++
+		if r == '\n' {
+			r++
+		}
+		if r == 0xD800 {
+			r = 0xE000
+		}
+		if len(line) == 0 || decoded(line) == r {
+			continue
+		}
+		code := uint16(line[0])
+		if len(line) == 2 {
+			code = code<<8 | uint16(line[1])
+		}
+		extra[r] = code
+	}
+
+	b := new(strings.Builder)
+	b.WriteString("// Code generated by shiftjis_gen.go from the SHIFT-JIS converter of iconv; DO NOT EDIT.\n\npackage convert\n\n")
+	b.WriteString("// The characters of the double-byte codes of Shift-JIS, 0 for the invalid codes, by lead byte from 0x81 to 0x9F\n")
+	b.WriteString("// then from 0xE0 to 0xFC, and by trail byte from 0x40 to 0xFC\n")
+	b.WriteString("var shiftJISDecode = [60][189]uint16{\n")
+	for i := range decode {
+		fmt.Fprintf(b, "\t{ // 0x%02X\n", leads[i])
+		for j := 0; j < 189; j += 12 {
+			b.WriteString("\t\t")
+			for k := j; k < j+12 && k < 189; k++ {
+				if k > j {
+					b.WriteString(" ")
+				}
+				fmt.Fprintf(b, "0x%04X,", decode[i][k])
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\t},\n")
+	}
+	b.WriteString("}\n\n")
+	b.WriteString("// The characters encoded to a code decoding to another character\n")
+	b.WriteString("var shiftJISEncodeExtra = map[rune]uint16{\n")
+	runes := make([]rune, 0, len(extra))
+	for r := range extra {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	for _, r := range runes {
+		fmt.Fprintf(b, "\t0x%04X: 0x%X,\n", r, extra[r])
+	}
+	b.WriteString("}\n")
+	if err := os.WriteFile("shiftjis_table.go", []byte(b.String()), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
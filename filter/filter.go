@@ -0,0 +1,317 @@
+// Filter drivers: the commands the filter attribute names in filter.<driver>.clean and filter.<driver>.smudge, run
+// once per file, and the long-running filter.<driver>.process speaking git's pkt-line protocol for every file, like
+// git's convert.c and sub-process.c
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// The capabilities of a filter: converting the files of the work tree to blobs, and the blobs to files
+const (
+	Clean  = "clean"
+	Smudge = "smudge"
+)
+
+// The characters making git run a command through the shell instead of on its own
+const shellMetacharacters = "|&;<>()$`\\\"' \t\n*?[#~=%"
+
+// A command that couldn't be started
+type StartError struct {
+	Command string
+	Err     error
+}
+
+func (e *StartError) Error() string {
+	if errors.Is(e.Err, exec.ErrNotFound) {
+		return fmt.Sprintf("cannot run %s: No such file or directory", e.Command)
+	}
+	err := e.Err
+	if cause := errors.Unwrap(err); cause != nil {
+		err = cause
+	}
+	return fmt.Sprintf("cannot run %s: %s", e.Command, err)
+}
+
+// A command that exited with a status other than 0
+type ExitError struct {
+	Command string
+	Status  int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("external filter '%s' failed %d", e.Command, e.Status)
+}
+
+// Return the command running a filter from dir, through the shell when it needs one
+func command(text, dir string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if strings.ContainsAny(text, shellMetacharacters) {
+		cmd = exec.Command("sh", "-c", text)
+	} else {
+		cmd = exec.Command(text)
+	}
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// Quote a string for the shell, between single quotes
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Run a filter command on the content of a file, from dir, and return its output
+// Each %f of the command is replaced by the quoted path of the file
+func Run(text, path, dir string, content []byte) ([]byte, error) {
+	expanded := strings.ReplaceAll(text, "%f", shellQuote(path))
+	cmd := command(expanded, dir)
+	cmd.Stdin = bytes.NewReader(content)
+	out := new(bytes.Buffer)
+	cmd.Stdout = out
+	if err := cmd.Start(); err != nil {
+		return nil, &StartError{Command: expanded, Err: err}
+	}
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, &ExitError{Command: text, Status: exitErr.ExitCode()}
+		}
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// The longest data of a packet: 65520 bytes, less its 4 bytes of length
+const maxPacketData = 65516
+
+// Write a packet: its length in 4 hex digits, itself included, then its data
+func writePacket(w io.Writer, data []byte) error {
+	if len(data) > maxPacketData {
+		return fmt.Errorf("packet too long")
+	}
+	if _, err := fmt.Fprintf(w, "%04x", len(data)+4); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// Write the text packets of lines, each ending with a newline, then a flush packet
+func writeLines(w io.Writer, lines ...string) error {
+	for _, line := range lines {
+		if err := writePacket(w, []byte(line+"\n")); err != nil {
+			return err
+		}
+	}
+	return writeFlush(w)
+}
+
+// Write a flush packet, "0000", ending a list of packets
+func writeFlush(w io.Writer) error {
+	_, err := io.WriteString(w, "0000")
+	return err
+}
+
+// Read a packet, nil for a flush packet
+func readPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("protocol error: bad line length character: %s", header)
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	if length < 4 {
+		return nil, fmt.Errorf("protocol error: bad line length %d", length)
+	}
+	data := make([]byte, length-4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Read text packets up to a flush packet, without their trailing newlines
+func readLines(r io.Reader) ([]string, error) {
+	lines := make([]string, 0)
+	for {
+		data, err := readPacket(r)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			return lines, nil
+		}
+		lines = append(lines, strings.TrimSuffix(string(data), "\n"))
+	}
+}
+
+// The status a process gave for a file other than success: "error" when it failed on the file, "abort" when it
+// won't run the capability anymore
+type StatusError struct {
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return "filter status " + e.Status
+}
+
+// A long-running filter, started once and given the files one after the other
+type Process struct {
+	Command      string
+	cmd          *exec.Cmd
+	in           io.WriteCloser
+	out          *bufio.Reader
+	capabilities map[string]bool
+}
+
+// Start a filter process from dir and negotiate the version 2 of the protocol and its capabilities with it
+func Start(text, dir string) (*Process, error) {
+	p := &Process{Command: text, cmd: command(text, dir), capabilities: make(map[string]bool)}
+	in, err := p.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	p.in, p.out = in, bufio.NewReader(out)
+	if err := p.cmd.Start(); err != nil {
+		return nil, &StartError{Command: text, Err: err}
+	}
+	if err := p.handshake(); err != nil {
+		p.Stop()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Exchange the welcome messages, the versions and the capabilities
+func (p *Process) handshake() error {
+	if err := writeLines(p.in, "git-filter-client", "version=2"); err != nil {
+		return fmt.Errorf("could not write client identification: %w", err)
+	}
+	lines, err := readLines(p.out)
+	if err != nil {
+		return fmt.Errorf("could not read server identification: %w", err)
+	}
+	if len(lines) == 0 || lines[0] != "git-filter-server" {
+		return fmt.Errorf("unexpected line, expected git-filter-server")
+	}
+	version := false
+	for _, line := range lines[1:] {
+		version = version || line == "version=2"
+	}
+	if !version {
+		return fmt.Errorf("filter does not support the version 2 of the protocol")
+	}
+	// The checkout doesn't ask to delay the files, but the capability is offered like git does
+	if err := writeLines(p.in, "capability=clean", "capability=smudge", "capability=delay"); err != nil {
+		return fmt.Errorf("could not write requested capabilities: %w", err)
+	}
+	if lines, err = readLines(p.out); err != nil {
+		return fmt.Errorf("could not read capabilities: %w", err)
+	}
+	for _, line := range lines {
+		if capability, found := strings.CutPrefix(line, "capability="); found {
+			p.capabilities[capability] = true
+		}
+	}
+	return nil
+}
+
+// Whether the process runs a capability
+func (p *Process) Supports(capability string) bool {
+	return p.capabilities[capability]
+}
+
+// Read the status list of the process, "" when it is empty and keeps the last status
+func (p *Process) readStatus() (string, error) {
+	lines, err := readLines(p.out)
+	if err != nil {
+		return "", err
+	}
+	status := ""
+	for _, line := range lines {
+		if value, found := strings.CutPrefix(line, "status="); found {
+			status = value
+		}
+	}
+	return status, nil
+}
+
+// Run a capability of the process on the content of a file and return its output
+// A *StatusError tells the process refused the file, any other error that the protocol failed and the process is
+// to be stopped
+func (p *Process) Filter(capability, path string, content []byte) ([]byte, error) {
+	if err := writeLines(p.in, "command="+capability, "pathname="+path); err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(content); start += maxPacketData {
+		end := min(start+maxPacketData, len(content))
+		if err := writePacket(p.in, content[start:end]); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFlush(p.in); err != nil {
+		return nil, err
+	}
+	status, err := p.readStatus()
+	if err != nil {
+		return nil, err
+	}
+	if status != "success" {
+		return nil, p.statusError(capability, status)
+	}
+	out := new(bytes.Buffer)
+	for {
+		data, err := readPacket(p.out)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			break
+		}
+		out.Write(data)
+	}
+	// The status after the content, an empty list keeping the success
+	if status, err = p.readStatus(); err != nil {
+		return nil, err
+	}
+	if status != "" && status != "success" {
+		return nil, p.statusError(capability, status)
+	}
+	return out.Bytes(), nil
+}
+
+// Return the error of a status other than success, the process losing the capability it aborted
+func (p *Process) statusError(capability, status string) error {
+	switch status {
+	case "abort":
+		delete(p.capabilities, capability)
+	case "error":
+	default:
+		return fmt.Errorf("unexpected filter status '%s'", status)
+	}
+	return &StatusError{Status: status}
+}
+
+// Stop the process: close its input, which ends it, and wait for it
+func (p *Process) Stop() error {
+	p.in.Close()
+	return p.cmd.Wait()
+}
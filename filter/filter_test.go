@@ -0,0 +1,131 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPacket(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := writeLines(buf, "git-filter-client", "version=2"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if buf.String() != "0016git-filter-client\n000eversion=2\n0000" {
+		t.Fatalf("unexpected packets %q", buf.String())
+	}
+	lines, err := readLines(buf)
+	if err != nil || strings.Join(lines, ",") != "git-filter-client,version=2" {
+		t.Fatalf("unexpected lines %v, %v", lines, err)
+	}
+	if _, err := readPacket(strings.NewReader("00zz")); err == nil {
+		t.Fatalf("expected a bad length to fail")
+	}
+}
+
+func TestRun(t *testing.T) {
+	out, err := Run("tr a-z A-Z; echo %f", "a b.txt", t.TempDir(), []byte("hello\n"))
+	if err != nil || string(out) != "HELLO\na b.txt\n" {
+		t.Fatalf("unexpected output %q, %v", out, err)
+	}
+	var exitErr *ExitError
+	if _, err := Run("exit 3", "a", t.TempDir(), nil); !errors.As(err, &exitErr) || exitErr.Status != 3 {
+		t.Fatalf("expected the exit status 3, got %v", err)
+	}
+	var startErr *StartError
+	if _, err := Run("no-such-filter-command", "a", t.TempDir(), nil); !errors.As(err, &startErr) {
+		t.Fatalf("expected the command not to start, got %v", err)
+	}
+}
+
+// Run as the filter process of the tests: the test binary runs itself with FILTER_TEST_PROCESS set
+// It upper-cases the files it cleans and lower-cases those it smudges, fails on error.txt and aborts on abort.txt
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("FILTER_TEST_PROCESS") == "" {
+		return
+	}
+	in, out := bufio.NewReader(os.Stdin), bufio.NewWriter(os.Stdout)
+	defer os.Exit(0)
+	if _, err := readLines(in); err != nil {
+		return
+	}
+	writeLines(out, "git-filter-server", "version=2")
+	out.Flush()
+	if _, err := readLines(in); err != nil {
+		return
+	}
+	writeLines(out, "capability=clean", "capability=smudge")
+	out.Flush()
+	for {
+		request, err := readLines(in)
+		if err != nil {
+			return
+		}
+		content := new(bytes.Buffer)
+		for {
+			data, err := readPacket(in)
+			if err != nil {
+				return
+			}
+			if data == nil {
+				break
+			}
+			content.Write(data)
+		}
+		switch {
+		case request[1] == "pathname=error.txt":
+			writeLines(out, "status=error")
+		case request[1] == "pathname=abort.txt":
+			writeLines(out, "status=abort")
+		default:
+			filtered := bytes.ToLower(content.Bytes())
+			if request[0] == "command=clean" {
+				filtered = bytes.ToUpper(content.Bytes())
+			}
+			writeLines(out, "status=success")
+			for len(filtered) > 0 {
+				n := min(len(filtered), maxPacketData)
+				writePacket(out, filtered[:n])
+				filtered = filtered[n:]
+			}
+			writeFlush(out)
+			writeFlush(out)
+		}
+		out.Flush()
+	}
+}
+
+func TestProcess(t *testing.T) {
+	t.Setenv("FILTER_TEST_PROCESS", "1")
+	p, err := Start(os.Args[0]+" -test.run=^TestHelperProcess$", t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer p.Stop()
+	if !p.Supports(Clean) || !p.Supports(Smudge) || p.Supports("delay") {
+		t.Fatalf("unexpected capabilities %v", p.capabilities)
+	}
+	if out, err := p.Filter(Clean, "a.txt", []byte("hello\n")); err != nil || string(out) != "HELLO\n" {
+		t.Fatalf("unexpected clean output %q, %v", out, err)
+	}
+	large := bytes.Repeat([]byte("X"), 3*maxPacketData+10)
+	if out, err := p.Filter(Smudge, "large.txt", large); err != nil || !bytes.Equal(out, bytes.ToLower(large)) {
+		t.Fatalf("unexpected smudge output of %d bytes, %v", len(out), err)
+	}
+	var statusErr *StatusError
+	if _, err := p.Filter(Clean, "error.txt", []byte("x")); !errors.As(err, &statusErr) || statusErr.Status != "error" {
+		t.Fatalf("expected the error status, got %v", err)
+	}
+	if _, err := p.Filter(Smudge, "abort.txt", []byte("x")); !errors.As(err, &statusErr) || statusErr.Status != "abort" {
+		t.Fatalf("expected the abort status, got %v", err)
+	}
+	if p.Supports(Smudge) || !p.Supports(Clean) {
+		t.Fatalf("expected the aborted capability to be dropped, got %v", p.capabilities)
+	}
+	if out, err := p.Filter(Clean, "b.txt", []byte("still running")); err != nil || string(out) != "STILL RUNNING" {
+		t.Fatalf("unexpected clean output %q, %v", out, err)
+	}
+}
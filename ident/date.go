@@ -0,0 +1,195 @@
+package ident
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+)
+
+// Layouts of the absolute dates accepted by ParseDate, the ones without a timezone are in local time
+var dateLayouts = []string{
+	// RFC 2822
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"Mon, 2 Jan 2006 15:04:05",
+	"Mon, 2 Jan 2006 15:04",
+	"2 Jan 2006 15:04:05",
+	"Mon Jan 2 15:04:05 2006",
+	// ISO 8601
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05 Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006.01.02 15:04:05",
+}
+
+// Layouts of dates without a time of day, the current one is used
+var dayLayouts = []string{
+	"2006-01-02",
+	"2006.01.02",
+	"Jan 2 2006",
+	"2 Jan 2006",
+}
+
+var (
+	rawDate      = regexp.MustCompile(`^@?(\d+)(?:\s+([+-]\d{4}))?$`)
+	relativeUnit = regexp.MustCompile(`^(\d+|an?|one|two|three|four|five|six|seven|eight|nine|ten)\s+(second|minute|hour|day|week|month|year)s?\b`)
+)
+
+var numberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+// Parse a date in one of the formats git accepts for --date and GIT_*_DATE:
+// "@<epoch> <tz>", "<epoch> <tz>", RFC 2822, ISO 8601, or relative to now like "2 days ago" or "yesterday"
+func ParseDate(date string, now time.Time) (time.Time, error) {
+	date = strings.TrimSpace(date)
+	if matches := rawDate.FindStringSubmatch(date); matches != nil {
+		epoch, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date: %s", date)
+		}
+		loc := now.Location()
+		if matches[2] != "" {
+			if loc, err = objects.ParseTimezone(matches[2]); err != nil {
+				return time.Time{}, err
+			}
+		}
+		return time.Unix(epoch, 0).In(loc), nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, date, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range dayLayouts {
+		if t, err := time.ParseInLocation(layout, date, now.Location()); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), now.Hour(), now.Minute(), now.Second(), 0, now.Location()), nil
+		}
+	}
+	if t, ok := parseRelativeDate(strings.ToLower(date), now); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %s", date)
+}
+
+// Parse "now", "today", "yesterday" or "<n> <unit>[s] [<n> <unit>[s]...] ago"
+func parseRelativeDate(date string, now time.Time) (time.Time, bool) {
+	switch date {
+	case "now", "today":
+		return now, true
+	case "yesterday":
+		return now.AddDate(0, 0, -1), true
+	}
+	rest, found := strings.CutSuffix(date, "ago")
+	if !found {
+		return time.Time{}, false
+	}
+	rest = strings.TrimSpace(rest)
+	t := now
+	for rest != "" {
+		matches := relativeUnit.FindStringSubmatch(rest)
+		if matches == nil {
+			return time.Time{}, false
+		}
+		n, isWord := numberWords[matches[1]]
+		if !isWord {
+			n, _ = strconv.Atoi(matches[1])
+		}
+		switch matches[2] {
+		case "second":
+			t = t.Add(-time.Duration(n) * time.Second)
+		case "minute":
+			t = t.Add(-time.Duration(n) * time.Minute)
+		case "hour":
+			t = t.Add(-time.Duration(n) * time.Hour)
+		case "day":
+			t = t.AddDate(0, 0, -n)
+		case "week":
+			t = t.AddDate(0, 0, -7*n)
+		case "month":
+			t = t.AddDate(0, -n, 0)
+		case "year":
+			t = t.AddDate(-n, 0, 0)
+		}
+		rest = strings.TrimLeft(rest[len(matches[0]):], " ,")
+	}
+	return t, true
+}
+
+// Format a date in one of the formats of --date: default, iso (or iso8601), iso-strict, rfc (or rfc2822), short,
+// unix, raw and relative to now
+func FormatDate(t time.Time, format string, now time.Time) (string, error) {
+	tz := objects.FormatTimezone(t)
+	switch format {
+	case "", "default":
+		return t.Format("Mon Jan 2 15:04:05 2006 ") + tz, nil
+	case "iso", "iso8601":
+		return t.Format("2006-01-02 15:04:05 ") + tz, nil
+	case "iso-strict", "iso8601-strict":
+		return t.Format(time.RFC3339), nil
+	case "rfc", "rfc2822":
+		return t.Format("Mon, 2 Jan 2006 15:04:05 ") + tz, nil
+	case "short":
+		return t.Format("2006-01-02"), nil
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	case "raw":
+		return fmt.Sprintf("%d %s", t.Unix(), tz), nil
+	case "relative":
+		return formatRelativeDate(t, now), nil
+	}
+	return "", fmt.Errorf("unknown date format %s", format)
+}
+
+// Return how long ago t was, rounded the way git does: "5 minutes ago", "3 weeks ago", "1 year, 2 months ago"
+func formatRelativeDate(t, now time.Time) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	diff := now.Unix() - t.Unix()
+	if diff < 0 {
+		return "in the future"
+	}
+	if diff < 90 {
+		return plural(diff, "second") + " ago"
+	}
+	// Rounded to the nearest minute, hour and day
+	if diff = (diff + 30) / 60; diff < 90 {
+		return plural(diff, "minute") + " ago"
+	}
+	if diff = (diff + 30) / 60; diff < 36 {
+		return plural(diff, "hour") + " ago"
+	}
+	diff = (diff + 12) / 24
+	switch {
+	case diff < 14:
+		return plural(diff, "day") + " ago"
+	case diff < 70:
+		return plural((diff+3)/7, "week") + " ago"
+	case diff < 365:
+		return plural((diff+15)/30, "month") + " ago"
+	case diff < 1825:
+		totalMonths := (diff*12*2 + 365) / (365 * 2)
+		if months := totalMonths % 12; months > 0 {
+			return plural(totalMonths/12, "year") + ", " + plural(months, "month") + " ago"
+		}
+		return plural(totalMonths/12, "year") + " ago"
+	}
+	return plural((diff+183)/365, "year") + " ago"
+}
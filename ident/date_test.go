@@ -0,0 +1,79 @@
+package ident
+
+import (
+	"testing"
+	"time"
+
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+)
+
+var TestCaseParseDate = []struct {
+	Description string
+	Date        string
+	Expected    string
+}{
+	{Description: "raw", Date: "1112911993 -0700", Expected: "1112911993 -0700"},
+	{Description: "raw with @", Date: "@1112911993 +0200", Expected: "1112911993 +0200"},
+	{Description: "rfc 2822", Date: "Thu, 07 Apr 2005 22:13:13 +0200", Expected: "1112904793 +0200"},
+	{Description: "rfc 2822 local time", Date: "Thu, 7 Apr 2005 22:13:13", Expected: "1112911993 +0000"},
+	{Description: "iso 8601", Date: "2005-04-07T22:13:13+02:00", Expected: "1112904793 +0200"},
+	{Description: "iso 8601 with a space", Date: "2005-04-07 22:13:13 -0230", Expected: "1112920993 -0230"},
+	{Description: "iso 8601 local time", Date: "2005-04-07 22:13:13", Expected: "1112911993 +0000"},
+	{Description: "relative", Date: "2 days ago", Expected: "1112739193 +0000"},
+	{Description: "relative with many units", Date: "1 hour, 30 minutes ago", Expected: "1112906593 +0000"},
+	{Description: "yesterday", Date: "yesterday", Expected: "1112825593 +0000"},
+}
+
+// Test the date formats accepted by --date and the GIT_*_DATE variables
+func TestParseDate(t *testing.T) {
+	now := time.Unix(1112911993, 0).In(time.UTC)
+	for _, tc := range TestCaseParseDate {
+		t.Run(tc.Description, func(t *testing.T) {
+			when, err := ParseDate(tc.Date, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			sig := objects.Signature{When: when}
+			if got := sig.String()[len(" <> "):]; got != tc.Expected {
+				t.Fatalf("unexpected date, got: %s expected: %s", got, tc.Expected)
+			}
+		})
+	}
+	if _, err := ParseDate("not a date", now); err == nil {
+		t.Fatalf("expected an error for an invalid date")
+	}
+}
+
+var TestCaseFormatDate = []struct {
+	Format   string
+	Expected string
+}{
+	{"default", "Thu Apr 7 15:13:13 2005 -0700"},
+	{"iso", "2005-04-07 15:13:13 -0700"},
+	{"iso-strict", "2005-04-07T15:13:13-07:00"},
+	{"rfc", "Thu, 7 Apr 2005 15:13:13 -0700"},
+	{"short", "2005-04-07"},
+	{"unix", "1112911993"},
+	{"raw", "1112911993 -0700"},
+	{"relative", "1 year, 2 months ago"},
+}
+
+// Test the date formats of --date and of the date atoms of for-each-ref
+func TestFormatDate(t *testing.T) {
+	when := time.Unix(1112911993, 0).In(time.FixedZone("", -7*3600))
+	now := when.AddDate(1, 2, 3)
+	for _, tc := range TestCaseFormatDate {
+		got, err := FormatDate(when, tc.Format, now)
+		if err != nil || got != tc.Expected {
+			t.Fatalf("unexpected %s date, got: %q (%v) expected: %q", tc.Format, got, err, tc.Expected)
+		}
+	}
+	for _, ago := range []struct {
+		Seconds  int64
+		Expected string
+	}{{1, "1 second ago"}, {89, "89 seconds ago"}, {90, "2 minutes ago"}, {3 * 86400, "3 days ago"}, {20 * 86400, "3 weeks ago"}} {
+		if got := formatRelativeDate(when, when.Add(time.Duration(ago.Seconds)*time.Second)); got != ago.Expected {
+			t.Fatalf("unexpected relative date, got: %q expected: %q", got, ago.Expected)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ident
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+)
+
+// Whose identity is resolved, it prefixes the GIT_<role>_NAME, GIT_<role>_EMAIL and GIT_<role>_DATE variables
+type Role string
+
+const (
+	Author    Role = "AUTHOR"
+	Committer Role = "COMMITTER"
+)
+
+// Return the value of a config key such as user.name, and whether it is set
+type ConfigLookup func(key string) (string, bool)
+
+// Return the signature of role, taken from the environment, then from the config, then guessed from the system
+// The date is now in the local timezone unless GIT_<role>_DATE is set
+func Get(role Role, config ConfigLookup) (objects.Signature, error) {
+	return get(role, config, time.Now())
+}
+
+func get(role Role, config ConfigLookup, now time.Time) (objects.Signature, error) {
+	lower := strings.ToLower(string(role))
+	sig := objects.Signature{
+		Name:  lookup("GIT_"+string(role)+"_NAME", config, lower+".name", "user.name"),
+		Email: lookup("GIT_"+string(role)+"_EMAIL", config, lower+".email", "user.email"),
+		When:  now,
+	}
+	if sig.Email == "" {
+		sig.Email = os.Getenv("EMAIL")
+	}
+	if sig.Name == "" || sig.Email == "" {
+		// Fall back on the account running the command, like git does
+		username := "unknown"
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+			if sig.Name == "" && u.Name != "" {
+				sig.Name = strings.Split(u.Name, ",")[0]
+			}
+		}
+		if sig.Name == "" {
+			sig.Name = username
+		}
+		if sig.Email == "" {
+			host, err := os.Hostname()
+			if err != nil || host == "" {
+				host = "(none)"
+			}
+			sig.Email = username + "@" + host
+		}
+	}
+	if strings.ContainsAny(sig.Name, "<>\n") || strings.ContainsAny(sig.Email, "<>\n") {
+		return objects.Signature{}, fmt.Errorf("invalid %s identity: %s <%s>", lower, sig.Name, sig.Email)
+	}
+	if date := os.Getenv("GIT_" + string(role) + "_DATE"); date != "" {
+		when, err := ParseDate(date, now)
+		if err != nil {
+			return objects.Signature{}, fmt.Errorf("invalid GIT_%s_DATE: %s", role, err)
+		}
+		sig.When = when
+	}
+	return sig, nil
+}
+
+// Return the first value set among the env variable and the config keys
+func lookup(env string, config ConfigLookup, keys ...string) string {
+	if v, found := os.LookupEnv(env); found {
+		return strings.TrimSpace(v)
+	}
+	if config == nil {
+		return ""
+	}
+	for _, key := range keys {
+		if v, found := config(key); found {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
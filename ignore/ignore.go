@@ -0,0 +1,266 @@
+// Ignore rules: the patterns of the .gitignore files of the work tree, of info/exclude and of core.excludesFile
+// choosing the untracked files git leaves alone, like git's dir.c
+package ignore
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	wildmatch "github.com/codecrafters-io/git-starter-go/wildmatch"
+)
+
+// The name of the files of per-directory patterns
+const FileName = ".gitignore"
+
+// A line of an ignore file
+type Pattern struct {
+	// The line as written, without its trailing spaces
+	Text string
+	// The file the pattern comes from, "" for the patterns given on the command line
+	Source string
+	Line   int
+	// The directory of the .gitignore file, "" for the top of the work tree
+	Base string
+	// "!" re-includes the paths matching the pattern
+	Negated bool
+	// The pattern without its "!", its leading slash and its trailing slash
+	pattern string
+	// A trailing slash only matches directories
+	dirOnly bool
+	// Without a slash the pattern matches the names at any depth, otherwise the paths from Base
+	basename bool
+}
+
+// Parse a line of an ignore file, return false for the blank lines and the comments
+func ParsePattern(line, source string, lineNumber int, base string) (Pattern, bool) {
+	line = trimTrailingSpaces(line)
+	if line == "" || line[0] == '#' {
+		return Pattern{}, false
+	}
+	p := Pattern{Text: line, Source: source, Line: lineNumber, Base: base}
+	text := line
+	if text[0] == '!' {
+		p.Negated = true
+		text = text[1:]
+	}
+	if strings.HasSuffix(text, "/") {
+		p.dirOnly = true
+		text = text[:len(text)-1]
+	}
+	p.basename = !strings.Contains(text, "/")
+	p.pattern = strings.TrimPrefix(text, "/")
+	if p.pattern == "" {
+		return Pattern{}, false
+	}
+	return p, true
+}
+
+// Remove the trailing spaces of a line, unless escaped with a backslash
+func trimTrailingSpaces(line string) string {
+	lastSpace := -1
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			if lastSpace < 0 {
+				lastSpace = i
+			}
+		case '\\':
+			i++
+			if i == len(line) {
+				return line
+			}
+			lastSpace = -1
+		default:
+			lastSpace = -1
+		}
+	}
+	if lastSpace >= 0 {
+		return line[:lastSpace]
+	}
+	return line
+}
+
+// Parse the lines of an ignore file
+func ParsePatterns(content []byte, source, base string) []Pattern {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	patterns := make([]Pattern, 0)
+	for i, line := range strings.Split(string(content), "\n") {
+		if p, ok := ParsePattern(line, source, i+1, base); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// Whether the pattern matches a path from the top of the work tree, under the directory of the pattern, for the files
+// sharing the syntax of the ignore patterns like .gitattributes
+func (p Pattern) Matches(name string, isDir, ignoreCase bool) bool {
+	flags := wildmatch.Flags(0)
+	if ignoreCase {
+		flags = wildmatch.CaseFold
+	}
+	return p.matches(name, isDir, flags)
+}
+
+func (p Pattern) matches(name string, isDir bool, flags wildmatch.Flags) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.Base != "" {
+		rest, found := strings.CutPrefix(name, p.Base+"/")
+		if !found {
+			return false
+		}
+		name = rest
+	}
+	if p.basename {
+		return wildmatch.Match(p.pattern, path.Base(name), flags)
+	}
+	return wildmatch.Match(p.pattern, name, flags|wildmatch.Pathname)
+}
+
+// The ignore rules of a work tree, by decreasing precedence: the patterns given on the command line, those of the
+// .gitignore files from the deepest directory up to the top, then those of the exclude files
+// In each list the last pattern matching a path decides
+type Matcher struct {
+	workTree string
+	flags    wildmatch.Flags
+	command  []Pattern
+	// The patterns of the exclude files, the last file added first
+	files [][]Pattern
+	// The patterns of the .gitignore files by directory, read when first needed
+	dirs map[string][]Pattern
+	// Whether to read the .gitignore files
+	perDirectory bool
+	// The pattern excluding a directory, nil when it isn't, by directory
+	excludedDirs map[string]*Pattern
+}
+
+// Return the rules of a work tree, with the .gitignore files of its directories; the patterns match case-insensitively
+// with ignoreCase
+func New(workTree string, ignoreCase bool) *Matcher {
+	m := &Matcher{
+		workTree:     workTree,
+		dirs:         make(map[string][]Pattern),
+		perDirectory: true,
+		excludedDirs: make(map[string]*Pattern),
+	}
+	if ignoreCase {
+		m.flags = wildmatch.CaseFold
+	}
+	return m
+}
+
+// Return rules without any pattern, only the command line patterns added later are used
+func NewEmpty(ignoreCase bool) *Matcher {
+	m := New("", ignoreCase)
+	m.perDirectory = false
+	return m
+}
+
+// Add the patterns of a file, shown as source, with precedence over the files added before; a missing file has no
+// pattern
+func (m *Matcher) AddFile(file, source string) error {
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.files = append([][]Pattern{ParsePatterns(content, source, "")}, m.files...)
+	return nil
+}
+
+// Add a pattern given on the command line, with precedence over the patterns of the files
+func (m *Matcher) AddPattern(text string) {
+	if p, ok := ParsePattern(text, "", 0, ""); ok {
+		m.command = append(m.command, p)
+	}
+}
+
+// Return the patterns of the .gitignore file of a directory of the work tree
+func (m *Matcher) directoryPatterns(dir string) []Pattern {
+	if patterns, found := m.dirs[dir]; found {
+		return patterns
+	}
+	source := path.Join(dir, FileName)
+	content, err := os.ReadFile(filepath.Join(m.workTree, source))
+	patterns := make([]Pattern, 0)
+	if err == nil {
+		patterns = ParsePatterns(content, source, dir)
+	}
+	m.dirs[dir] = patterns
+	return patterns
+}
+
+// Return the last pattern of a list matching a path
+func (m *Matcher) lastMatch(patterns []Pattern, name string, isDir bool) *Pattern {
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if patterns[i].matches(name, isDir, m.flags) {
+			return &patterns[i]
+		}
+	}
+	return nil
+}
+
+// Return the pattern deciding whether a path is ignored, nil when none matches it, without looking at the directories
+// leading to it: for the walks of the work tree, which don't enter the ignored directories
+// The path is ignored when the pattern isn't negated
+func (m *Matcher) MatchName(name string, isDir bool) *Pattern {
+	if p := m.lastMatch(m.command, name, isDir); p != nil {
+		return p
+	}
+	if m.perDirectory {
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			if dir == "." {
+				dir = ""
+			}
+			if p := m.lastMatch(m.directoryPatterns(dir), name, isDir); p != nil {
+				return p
+			}
+			if dir == "" {
+				break
+			}
+		}
+	}
+	for _, patterns := range m.files {
+		if p := m.lastMatch(patterns, name, isDir); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// Return the pattern deciding whether a path is ignored, nil when none matches it
+// A path in an ignored directory is ignored by the pattern of the directory, a negated pattern can't re-include it
+func (m *Matcher) Match(name string, isDir bool) *Pattern {
+	if dir := path.Dir(name); dir != "." {
+		if p := m.excludedDir(dir); p != nil {
+			return p
+		}
+	}
+	return m.MatchName(name, isDir)
+}
+
+// Return the pattern excluding a directory or one of the directories leading to it
+func (m *Matcher) excludedDir(dir string) *Pattern {
+	if p, found := m.excludedDirs[dir]; found {
+		return p
+	}
+	p := m.Match(dir, true)
+	if p != nil && p.Negated {
+		p = nil
+	}
+	m.excludedDirs[dir] = p
+	return p
+}
+
+// Whether a path is ignored, itself or through one of the directories leading to it
+func (m *Matcher) Ignored(name string, isDir bool) bool {
+	p := m.Match(name, isDir)
+	return p != nil && !p.Negated
+}
@@ -0,0 +1,113 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	file := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestParsePattern(t *testing.T) {
+	for line, expected := range map[string]bool{"": false, "# comment": false, "   ": false, "\\#hash": true, "!": false, "a": true} {
+		if _, ok := ParsePattern(line, "", 1, ""); ok != expected {
+			t.Fatalf("%q: expected %v, got %v", line, expected, ok)
+		}
+	}
+	if p, _ := ParsePattern("trail  ", "", 1, ""); p.Text != "trail" {
+		t.Fatalf("expected the trailing spaces to be removed, got %q", p.Text)
+	}
+	if p, _ := ParsePattern("trail\\  ", "", 1, ""); p.Text != "trail\\ " {
+		t.Fatalf("expected an escaped trailing space to be kept, got %q", p.Text)
+	}
+	if p, _ := ParsePattern("!/build/", "", 1, ""); !p.Negated || !p.dirOnly || p.basename || p.pattern != "build" {
+		t.Fatalf("unexpected pattern %+v", p)
+	}
+}
+
+var TestCaseMatch = []struct {
+	Path     string
+	IsDir    bool
+	Expected string
+}{
+	{Path: "a.o", Expected: "*.o"},
+	{Path: "src/a.o", Expected: "*.o"},
+	{Path: "keep.o", Expected: "!keep.o"},
+	{Path: "build", Expected: ""},
+	{Path: "build", IsDir: true, Expected: "build/"},
+	{Path: "build/out", Expected: "build/"},
+	{Path: "root.txt", Expected: "/root.txt"},
+	{Path: "src/root.txt", Expected: ""},
+	{Path: "doc/a/b/x.pdf", Expected: "doc/**/*.pdf"},
+	{Path: "doc/x.pdf", Expected: "doc/**/*.pdf"},
+	{Path: "#hash", Expected: "\\#hash"},
+	{Path: "logs/important.log", Expected: "logs"},
+	{Path: "sub/a.txt", Expected: "*.txt"},
+	{Path: "sub/keep.txt", Expected: "!keep.txt"},
+	{Path: "a.txt", Expected: ""},
+	{Path: "sub/deep/b.c", Expected: "sub/deep/"},
+	{Path: "A.O", Expected: ""},
+}
+
+func TestMatch(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, ".gitignore", "*.o\nbuild/\n/root.txt\n!keep.o\ndoc/**/*.pdf\n\\#hash\nlogs\n!logs/important.log\n")
+	writeTestFile(t, dir, "sub/.gitignore", "*.txt\n!keep.txt\n")
+	writeTestFile(t, dir, "exclude", "# comment\nsub/deep/\n")
+	m := New(dir, false)
+	if err := m.AddFile(filepath.Join(dir, "exclude"), "exclude"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, tc := range TestCaseMatch {
+		p := m.Match(tc.Path, tc.IsDir)
+		text := ""
+		if p != nil {
+			text = p.Text
+		}
+		if text != tc.Expected {
+			t.Fatalf("%s: expected the pattern %q, got %q", tc.Path, tc.Expected, text)
+		}
+	}
+	if p := m.Match("sub/deep/b.c", false); p.Source != "exclude" || p.Line != 2 {
+		t.Fatalf("expected the second line of exclude, got %s:%d", p.Source, p.Line)
+	}
+	if p := m.Match("sub/a.txt", false); p.Source != "sub/.gitignore" || p.Line != 1 {
+		t.Fatalf("expected the first line of sub/.gitignore, got %s:%d", p.Source, p.Line)
+	}
+	if !New(dir, true).Ignored("A.O", false) {
+		t.Fatalf("expected the patterns to ignore the case")
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, ".gitignore", "!*.log\n")
+	writeTestFile(t, dir, "global", "*.log\n*.tmp\n")
+	m := New(dir, false)
+	if err := m.AddFile(filepath.Join(dir, "global"), "global"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if m.Ignored("a.log", false) {
+		t.Fatalf("expected .gitignore to take precedence over the exclude files")
+	}
+	if !m.Ignored("a.tmp", false) {
+		t.Fatalf("expected the exclude files to ignore a.tmp")
+	}
+	m.AddPattern("a.log")
+	if !m.Ignored("a.log", false) {
+		t.Fatalf("expected the command line patterns to take precedence")
+	}
+	empty := NewEmpty(false)
+	empty.AddPattern("*.c")
+	if empty.Ignored("a.log", false) || !empty.Ignored("x/a.c", false) {
+		t.Fatalf("expected only the command line patterns without the .gitignore files")
+	}
+}
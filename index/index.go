@@ -0,0 +1,578 @@
+package index
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The signature starting every index file
+const signature = "DIRC"
+
+// The versions of the index file format understood, 2 unless an entry needs the extended flags of version 3
+const (
+	MinVersion     = 2
+	MaxVersion     = 4
+	DefaultVersion = 2
+)
+
+// The bits of the flags of an entry
+const (
+	flagAssumeValid = 0x8000
+	flagExtended    = 0x4000
+	flagStageMask   = 0x3000
+	flagStageShift  = 12
+	// The length of the path, saturated when it doesn't fit
+	flagNameMask = 0x0fff
+
+	extendedSkipWorktree = 0x4000
+	extendedIntentToAdd  = 0x2000
+	// The bits of the extended flags no version defines, an index using them is refused
+	extendedUnknown = 0x9fff
+)
+
+// The modes of the entries, the file types of the tree entries
+const (
+	ModeFile       = 0o100644
+	ModeExecutable = 0o100755
+	ModeSymlink    = 0o120000
+	ModeGitlink    = 0o160000
+)
+
+// Returned for an index file that can't be parsed
+var ErrCorrupt = errors.New("index file corrupt")
+
+// The time of a stat, as an index entry stores it
+type Time struct {
+	Sec, Nsec uint32
+}
+
+// The stat data of a file, used to tell when it may have changed since it was staged
+type Stat struct {
+	CTime, MTime Time
+	Dev, Ino     uint32
+	UID, GID     uint32
+	// The size, truncated to 32 bits
+	Size uint32
+}
+
+// A staged file: its path, the object of its content and the stat data of the file it was read from
+type Entry struct {
+	Stat
+	Mode uint32
+	// The hex name of the blob, or of the commit for a gitlink
+	Hash string
+	Path string
+	// 0 for a merged entry, 1 to 3 for the base, ours and theirs sides of a conflict
+	Stage int
+	// Don't compare the file with the entry, assume it is unchanged
+	AssumeValid bool
+	// The file isn't checked out in a sparse checkout
+	SkipWorktree bool
+	// Added by add --intent-to-add: the path is tracked but its content isn't staged yet
+	IntentToAdd bool
+}
+
+// An extension of the index, kept as read
+type Extension struct {
+	Signature string
+	Data      []byte
+}
+
+// The index, also called the staging area or the dircache: the sorted entries of the next commit
+type Index struct {
+	Version    uint32
+	Entries    []Entry
+	Extensions []Extension
+	// The modification time of the index file when it was read, zero for a new index
+	Timestamp Time
+	// The size of the object names and of the trailing checksum
+	hashSize int
+}
+
+// Return an empty index of the default version, for object names of hashSize bytes
+func New(hashSize int) *Index {
+	return &Index{Version: DefaultVersion, Entries: make([]Entry, 0), hashSize: hashSize}
+}
+
+// Read the index file at path, a missing file being an empty index
+func Read(path string, hashSize int) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return New(hashSize), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	idx, err := Parse(data, hashSize)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		idx.Timestamp = StatFromFileInfo(info).MTime
+	}
+	return idx, nil
+}
+
+// Parse the content of an index file, checking its trailing checksum
+func Parse(data []byte, hashSize int) (*Index, error) {
+	if len(data) < 12+hashSize {
+		return nil, fmt.Errorf("%w: too short", ErrCorrupt)
+	}
+	if string(data[:4]) != signature {
+		return nil, fmt.Errorf("%w: bad signature", ErrCorrupt)
+	}
+	body := data[:len(data)-hashSize]
+	h := newHash(hashSize)
+	h.Write(body)
+	if !bytes.Equal(h.Sum(nil), data[len(body):]) {
+		return nil, fmt.Errorf("%w: bad index file sha1 signature", ErrCorrupt)
+	}
+	idx := &Index{Version: binary.BigEndian.Uint32(data[4:8]), hashSize: hashSize}
+	if idx.Version < MinVersion || idx.Version > MaxVersion {
+		return nil, fmt.Errorf("%w: bad index version %d", ErrCorrupt, idx.Version)
+	}
+	count := binary.BigEndian.Uint32(data[8:12])
+	idx.Entries = make([]Entry, 0, count)
+	offset := 12
+	previous := ""
+	for i := uint32(0); i < count; i++ {
+		entry, n, err := idx.parseEntry(body[offset:], previous)
+		if err != nil {
+			return nil, err
+		}
+		idx.Entries = append(idx.Entries, entry)
+		previous = entry.Path
+		offset += n
+	}
+	for offset < len(body) {
+		if len(body)-offset < 8 {
+			return nil, fmt.Errorf("%w: truncated extension", ErrCorrupt)
+		}
+		sig := string(body[offset : offset+4])
+		size := int(binary.BigEndian.Uint32(body[offset+4 : offset+8]))
+		if size > len(body)-offset-8 {
+			return nil, fmt.Errorf("%w: truncated extension %s", ErrCorrupt, sig)
+		}
+		// An extension starting with a lowercase letter changes how the entries are read, it can't be skipped
+		if sig[0] < 'A' || sig[0] > 'Z' {
+			return nil, fmt.Errorf("index uses %s extension, which we do not understand", sig)
+		}
+		idx.Extensions = append(idx.Extensions, Extension{Signature: sig, Data: body[offset+8 : offset+8+size]})
+		offset += 8 + size
+	}
+	return idx, nil
+}
+
+// Parse the entry at the start of data, return it with its length
+// The path of an entry of version 4 is stored as the part of the previous path it keeps and the rest of its path
+func (idx *Index) parseEntry(data []byte, previous string) (Entry, int, error) {
+	fixed := 40 + idx.hashSize + 2
+	if len(data) < fixed {
+		return Entry{}, 0, fmt.Errorf("%w: truncated entry", ErrCorrupt)
+	}
+	field := func(i int) uint32 { return binary.BigEndian.Uint32(data[i*4:]) }
+	e := Entry{
+		Stat: Stat{
+			CTime: Time{Sec: field(0), Nsec: field(1)},
+			MTime: Time{Sec: field(2), Nsec: field(3)},
+			Dev:   field(4),
+			Ino:   field(5),
+			UID:   field(7),
+			GID:   field(8),
+			Size:  field(9),
+		},
+		Mode: field(6),
+		Hash: hex.EncodeToString(data[40 : 40+idx.hashSize]),
+	}
+	flags := binary.BigEndian.Uint16(data[40+idx.hashSize:])
+	e.AssumeValid = flags&flagAssumeValid != 0
+	e.Stage = int(flags&flagStageMask) >> flagStageShift
+	n := fixed
+	if flags&flagExtended != 0 {
+		if idx.Version < 3 {
+			return Entry{}, 0, fmt.Errorf("%w: extended flags in an index of version %d", ErrCorrupt, idx.Version)
+		}
+		if len(data) < n+2 {
+			return Entry{}, 0, fmt.Errorf("%w: truncated entry", ErrCorrupt)
+		}
+		extended := binary.BigEndian.Uint16(data[n:])
+		if extended&extendedUnknown != 0 {
+			return Entry{}, 0, fmt.Errorf("%w: unknown index entry format 0x%08x", ErrCorrupt, uint32(flags)<<16|uint32(extended))
+		}
+		e.SkipWorktree = extended&extendedSkipWorktree != 0
+		e.IntentToAdd = extended&extendedIntentToAdd != 0
+		n += 2
+	}
+	if idx.Version == 4 {
+		strip, size := decodeVarint(data[n:])
+		if size == 0 || int(strip) > len(previous) {
+			return Entry{}, 0, fmt.Errorf("%w: malformed name field in the index", ErrCorrupt)
+		}
+		n += size
+		end := bytes.IndexByte(data[n:], 0)
+		if end < 0 {
+			return Entry{}, 0, fmt.Errorf("%w: unterminated path", ErrCorrupt)
+		}
+		e.Path = previous[:len(previous)-int(strip)] + string(data[n:n+end])
+		return e, n + end + 1, nil
+	}
+	end := bytes.IndexByte(data[n:], 0)
+	if end < 0 {
+		return Entry{}, 0, fmt.Errorf("%w: unterminated path", ErrCorrupt)
+	}
+	e.Path = string(data[n : n+end])
+	// The entries of versions 2 and 3 are padded with 1 to 8 NULs to a multiple of 8 bytes
+	size := (n + end + 8) &^ 7
+	if size > len(data) {
+		return Entry{}, 0, fmt.Errorf("%w: truncated entry", ErrCorrupt)
+	}
+	return e, size, nil
+}
+
+// Return the content of the index file, with its trailing checksum
+// Version 2 is written as version 3 when an entry has extended flags
+func (idx *Index) Bytes() []byte {
+	version := idx.Version
+	if version < 4 {
+		version = 2
+		for _, e := range idx.Entries {
+			if e.extended() {
+				version = 3
+			}
+		}
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString(signature)
+	binary.Write(buf, binary.BigEndian, version)
+	binary.Write(buf, binary.BigEndian, uint32(len(idx.Entries)))
+	previous := ""
+	for _, e := range idx.Entries {
+		start := buf.Len()
+		for _, v := range []uint32{
+			e.CTime.Sec, e.CTime.Nsec, e.MTime.Sec, e.MTime.Nsec,
+			e.Dev, e.Ino, e.Mode, e.UID, e.GID, e.Size,
+		} {
+			binary.Write(buf, binary.BigEndian, v)
+		}
+		hash, _ := hex.DecodeString(e.Hash)
+		buf.Write(hash)
+		flags := uint16(min(len(e.Path), flagNameMask)) | uint16(e.Stage<<flagStageShift)&flagStageMask
+		if e.AssumeValid {
+			flags |= flagAssumeValid
+		}
+		if e.extended() {
+			flags |= flagExtended
+		}
+		binary.Write(buf, binary.BigEndian, flags)
+		if e.extended() {
+			var extended uint16
+			if e.SkipWorktree {
+				extended |= extendedSkipWorktree
+			}
+			if e.IntentToAdd {
+				extended |= extendedIntentToAdd
+			}
+			binary.Write(buf, binary.BigEndian, extended)
+		}
+		if version == 4 {
+			common := commonPrefix(previous, e.Path)
+			buf.Write(encodeVarint(uint64(len(previous) - common)))
+			buf.WriteString(e.Path[common:])
+			buf.WriteByte(0)
+			previous = e.Path
+			continue
+		}
+		buf.WriteString(e.Path)
+		size := (buf.Len() - start + 8) &^ 7
+		buf.Write(make([]byte, size-(buf.Len()-start)))
+	}
+	for _, ext := range idx.Extensions {
+		buf.WriteString(ext.Signature)
+		binary.Write(buf, binary.BigEndian, uint32(len(ext.Data)))
+		buf.Write(ext.Data)
+	}
+	h := newHash(idx.hashSize)
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes()
+}
+
+// Whether the stat data of an entry can't be trusted: the file was modified no earlier than the index was written, so
+// it may have changed again within the same timestamp after it was staged, without its stat data changing
+// Such a racily clean entry has to be compared by content
+func (idx *Index) IsRacy(e Entry) bool {
+	if idx.Timestamp == (Time{}) || e.Mode == ModeGitlink {
+		return false
+	}
+	ts := idx.Timestamp
+	return ts.Sec < e.MTime.Sec || ts.Sec == e.MTime.Sec && ts.Nsec <= e.MTime.Nsec
+}
+
+// Whether the entry has flags only the extended flags of version 3 hold
+func (e Entry) extended() bool {
+	return e.SkipWorktree || e.IntentToAdd
+}
+
+// Return the position of the entry of path at stage, or where it would be inserted and false
+func (idx *Index) Find(path string, stage int) (int, bool) {
+	i := sort.Search(len(idx.Entries), func(i int) bool {
+		return compareEntry(idx.Entries[i].Path, idx.Entries[i].Stage, path, stage) >= 0
+	})
+	found := i < len(idx.Entries) && idx.Entries[i].Path == path && idx.Entries[i].Stage == stage
+	return i, found
+}
+
+// Return the entry of path at stage 0, or its conflicting entries, nil when the path isn't in the index
+func (idx *Index) Get(path string) []Entry {
+	i, _ := idx.Find(path, 0)
+	j := i
+	for j < len(idx.Entries) && idx.Entries[j].Path == path {
+		j++
+	}
+	if i == j {
+		return nil
+	}
+	return idx.Entries[i:j]
+}
+
+// Add or replace an entry, a merged entry replacing the conflicting entries of its path
+// A path can't be both a file and a directory of the index: the entries conflicting that way are removed when replace
+// is set, and refused otherwise
+func (idx *Index) Add(e Entry, replace bool) error {
+	if err := checkPath(e.Path); err != nil {
+		return err
+	}
+	conflicts := idx.directoryConflicts(e.Path)
+	if len(conflicts) > 0 && !replace {
+		return fmt.Errorf("'%s' appears as both a file and as a directory", e.Path)
+	}
+	for _, path := range conflicts {
+		idx.Remove(path)
+	}
+	if e.Stage == 0 {
+		for stage := 1; stage <= 3; stage++ {
+			if i, found := idx.Find(e.Path, stage); found {
+				idx.Entries = append(idx.Entries[:i], idx.Entries[i+1:]...)
+			}
+		}
+	}
+	i, found := idx.Find(e.Path, e.Stage)
+	if found {
+		idx.Entries[i] = e
+	} else {
+		idx.Entries = append(idx.Entries, Entry{})
+		copy(idx.Entries[i+1:], idx.Entries[i:])
+		idx.Entries[i] = e
+	}
+	idx.InvalidateTree()
+	return nil
+}
+
+// Remove every entry of path, return whether there was any
+func (idx *Index) Remove(path string) bool {
+	kept := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if e.Path != path {
+			kept = append(kept, e)
+		}
+	}
+	removed := len(kept) != len(idx.Entries)
+	idx.Entries = kept
+	if removed {
+		idx.InvalidateTree()
+	}
+	return removed
+}
+
+// Drop the cached trees of the TREE extension, they don't match the entries anymore once these changed
+func (idx *Index) InvalidateTree() {
+	kept := idx.Extensions[:0]
+	for _, ext := range idx.Extensions {
+		if ext.Signature != "TREE" {
+			kept = append(kept, ext)
+		}
+	}
+	idx.Extensions = kept
+}
+
+// Return the paths of the entries that are a directory of path or under path as a directory
+func (idx *Index) directoryConflicts(path string) []string {
+	conflicts := make([]string, 0)
+	for dir := path; ; {
+		slash := strings.LastIndexByte(dir, '/')
+		if slash < 0 {
+			break
+		}
+		dir = dir[:slash]
+		if len(idx.Get(dir)) > 0 {
+			conflicts = append(conflicts, dir)
+		}
+	}
+	i, _ := idx.Find(path+"/", 0)
+	for ; i < len(idx.Entries) && strings.HasPrefix(idx.Entries[i].Path, path+"/"); i++ {
+		if len(conflicts) == 0 || conflicts[len(conflicts)-1] != idx.Entries[i].Path {
+			conflicts = append(conflicts, idx.Entries[i].Path)
+		}
+	}
+	return conflicts
+}
+
+// Refuse the paths an index can't hold: empty, absolute, with empty, "." or ".." components, or inside .git
+func checkPath(path string) error {
+	if path == "" || strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		return fmt.Errorf("invalid path '%s'", path)
+	}
+	for _, component := range strings.Split(path, "/") {
+		if component == "" || component == "." || component == ".." || strings.EqualFold(component, ".git") {
+			return fmt.Errorf("invalid path '%s'", path)
+		}
+	}
+	return nil
+}
+
+// Order the entries by path, bytewise, then by stage
+func compareEntry(pathA string, stageA int, pathB string, stageB int) int {
+	if c := strings.Compare(pathA, pathB); c != 0 {
+		return c
+	}
+	return stageA - stageB
+}
+
+// Sort the entries by path and stage
+func (idx *Index) Sort() {
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		a, b := idx.Entries[i], idx.Entries[j]
+		return compareEntry(a.Path, a.Stage, b.Path, b.Stage) < 0
+	})
+}
+
+// Return the mode of an entry for a file of the mode: a symlink, an executable file or a regular file
+func ModeFromFileMode(mode os.FileMode) uint32 {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return ModeSymlink
+	case mode.IsDir():
+		return ModeGitlink
+	case mode&0o111 != 0:
+		return ModeExecutable
+	}
+	return ModeFile
+}
+
+// An index file locked for writing, the only writer of the index is the one holding its lock
+type Lockfile struct {
+	path string
+	file *os.File
+}
+
+// Take the lock of the index file at path by creating path.lock
+func Lock(path string) (*Lockfile, error) {
+	file, err := os.OpenFile(path+".lock", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("Unable to create '%s.lock': File exists.\n\n"+
+			"Another git process seems to be running in this repository, or a git process crashed earlier:\n"+
+			"remove the file manually to continue", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create '%s.lock': %s", path, err)
+	}
+	return &Lockfile{path: path, file: file}, nil
+}
+
+// Write the index to the lock file and move it over the index file, releasing the lock
+func (l *Lockfile) Commit(idx *Index) error {
+	if _, err := l.file.Write(idx.Bytes()); err != nil {
+		l.Rollback()
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		os.Remove(l.file.Name())
+		return err
+	}
+	if err := os.Rename(l.file.Name(), l.path); err != nil {
+		os.Remove(l.file.Name())
+		return err
+	}
+	return nil
+}
+
+// Release the lock, leaving the index file unchanged
+func (l *Lockfile) Rollback() {
+	l.file.Close()
+	os.Remove(l.file.Name())
+}
+
+// Lock the index file at path and read it, the caller commits or rolls back the lock
+func LockAndRead(path string, hashSize int) (*Index, *Lockfile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, nil, err
+	}
+	lock, err := Lock(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	idx, err := Read(path, hashSize)
+	if err != nil {
+		lock.Rollback()
+		return nil, nil, err
+	}
+	return idx, lock, nil
+}
+
+func newHash(size int) hash.Hash {
+	if size == sha256.Size {
+		return sha256.New()
+	}
+	return sha1.New()
+}
+
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// Decode the variable length integer of the paths of version 4: 7 bits per byte, the high bit set on every byte
+// but the last, one being added to the value for each byte past the first
+func decodeVarint(data []byte) (uint64, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	c := data[0]
+	value := uint64(c & 0x7f)
+	n := 1
+	for c&0x80 != 0 {
+		if n >= len(data) {
+			return 0, 0
+		}
+		value++
+		c = data[n]
+		value = value<<7 | uint64(c&0x7f)
+		n++
+	}
+	return value, n
+}
+
+func encodeVarint(value uint64) []byte {
+	var buf [16]byte
+	pos := len(buf) - 1
+	buf[pos] = byte(value & 0x7f)
+	for value >>= 7; value != 0; value >>= 7 {
+		value--
+		pos--
+		buf[pos] = 0x80 | byte(value&0x7f)
+	}
+	return buf[pos:]
+}
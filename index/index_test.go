@@ -0,0 +1,146 @@
+package index
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testHash  = "3b18e512dba79e4c8300dd08aeb37f8e728b8dad"
+	testHash2 = "0501091fcf64fe2b351473f1abb3a6fcb967ee93"
+)
+
+func testIndex(t *testing.T) *Index {
+	idx := New(20)
+	entries := []Entry{
+		{Stat: Stat{MTime: Time{Sec: 946684800, Nsec: 1}, Size: 12}, Mode: ModeFile, Hash: testHash, Path: "a.txt"},
+		{Mode: ModeExecutable, Hash: testHash2, Path: "dir/run.sh", AssumeValid: true},
+		{Mode: ModeFile, Hash: testHash, Path: "dir/sub/" + strings.Repeat("x", 5000)},
+		{Mode: ModeSymlink, Hash: testHash2, Path: "link", SkipWorktree: true},
+		{Mode: ModeFile, Hash: testHash, Path: "new.txt", IntentToAdd: true},
+	}
+	for _, e := range entries {
+		if err := idx.Add(e, false); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	return idx
+}
+
+// Every version reads back the entries it was written with
+func TestRoundTrip(t *testing.T) {
+	for _, version := range []uint32{2, 3, 4} {
+		idx := testIndex(t)
+		idx.Version = version
+		idx.Extensions = []Extension{{Signature: "REUC", Data: []byte("data")}}
+		read, err := Parse(idx.Bytes(), 20)
+		if err != nil {
+			t.Fatalf("unexpected error reading version %d: %s", version, err)
+		}
+		// Extended flags need version 3
+		if expected := max(version, 3); read.Version != expected {
+			t.Fatalf("expected version %d, got %d", expected, read.Version)
+		}
+		if len(read.Entries) != len(idx.Entries) {
+			t.Fatalf("expected %d entries, got %d", len(idx.Entries), len(read.Entries))
+		}
+		for i, e := range read.Entries {
+			if e != idx.Entries[i] {
+				t.Fatalf("version %d: expected %+v, got %+v", version, idx.Entries[i], e)
+			}
+		}
+		if len(read.Extensions) != 1 || string(read.Extensions[0].Data) != "data" {
+			t.Fatalf("expected the extension to be kept, got %+v", read.Extensions)
+		}
+	}
+}
+
+func TestCorruptIndex(t *testing.T) {
+	data := testIndex(t).Bytes()
+	data[20]++
+	if _, err := Parse(data, 20); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected a checksum error, got %v", err)
+	}
+}
+
+// A merged entry replaces the conflicts of its path, and a path can't be both a file and a directory
+func TestAdd(t *testing.T) {
+	idx := testIndex(t)
+	for stage := 1; stage <= 3; stage++ {
+		if err := idx.Add(Entry{Mode: ModeFile, Hash: testHash, Path: "a.txt", Stage: stage}, false); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if entries := idx.Get("a.txt"); len(entries) != 4 {
+		t.Fatalf("expected 4 stages of a.txt, got %+v", entries)
+	}
+	if err := idx.Add(Entry{Mode: ModeFile, Hash: testHash2, Path: "a.txt"}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if entries := idx.Get("a.txt"); len(entries) != 1 || entries[0].Hash != testHash2 {
+		t.Fatalf("expected the conflict to be resolved, got %+v", entries)
+	}
+	if err := idx.Add(Entry{Mode: ModeFile, Hash: testHash, Path: "dir"}, false); err == nil {
+		t.Fatalf("expected a file over a directory to be refused")
+	}
+	if err := idx.Add(Entry{Mode: ModeFile, Hash: testHash, Path: "a.txt/b"}, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if idx.Get("a.txt") != nil || idx.Get("a.txt/b") == nil {
+		t.Fatalf("expected a.txt to be replaced by a.txt/b")
+	}
+	if err := idx.Add(Entry{Mode: ModeFile, Hash: testHash, Path: "../x"}, false); err == nil {
+		t.Fatalf("expected an invalid path to be refused")
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	idx, lock, err := LockAndRead(path, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, _, err := LockAndRead(path, 20); err == nil {
+		t.Fatalf("expected the index to be locked")
+	}
+	idx.Add(Entry{Mode: ModeFile, Hash: testHash, Path: "a.txt"}, false)
+	if err := lock.Commit(idx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("expected the lock to be released")
+	}
+	read, err := Read(path, 20)
+	if err != nil || len(read.Entries) != 1 {
+		t.Fatalf("expected the written entry, got %+v (%v)", read, err)
+	}
+}
+
+func TestVarint(t *testing.T) {
+	for _, value := range []uint64{0, 1, 127, 128, 255, 16383, 16384, 1 << 40} {
+		decoded, n := decodeVarint(encodeVarint(value))
+		if decoded != value || n != len(encodeVarint(value)) {
+			t.Fatalf("expected %d, got %d", value, decoded)
+		}
+	}
+}
+
+// An entry modified in the same timestamp as the index file can't be trusted
+func TestIsRacy(t *testing.T) {
+	idx := testIndex(t)
+	entry := idx.Entries[0]
+	if idx.IsRacy(entry) {
+		t.Fatalf("expected an index never written not to be racy")
+	}
+	idx.Timestamp = entry.MTime
+	if !idx.IsRacy(entry) {
+		t.Fatalf("expected an entry modified with the index to be racy")
+	}
+	idx.Timestamp.Sec++
+	if idx.IsRacy(entry) {
+		t.Fatalf("expected an entry modified before the index not to be racy")
+	}
+}
@@ -0,0 +1,18 @@
+package index
+
+import (
+	"os"
+)
+
+// Return the stat data of a file as an index entry records it, from the result of os.Lstat
+// The change time, device, inode and owner are only known on the systems exposing them
+func StatFromFileInfo(info os.FileInfo) Stat {
+	mtime := info.ModTime()
+	s := Stat{
+		MTime: Time{Sec: uint32(mtime.Unix()), Nsec: uint32(mtime.Nanosecond())},
+		Size:  uint32(info.Size()),
+	}
+	s.CTime = s.MTime
+	fillSysStat(&s, info.Sys())
+	return s
+}
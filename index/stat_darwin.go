@@ -0,0 +1,17 @@
+//go:build darwin
+
+package index
+
+import "syscall"
+
+func fillSysStat(s *Stat, sys any) {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	s.CTime = Time{Sec: uint32(st.Ctimespec.Sec), Nsec: uint32(st.Ctimespec.Nsec)}
+	s.Dev = uint32(st.Dev)
+	s.Ino = uint32(st.Ino)
+	s.UID = st.Uid
+	s.GID = st.Gid
+}
@@ -0,0 +1,17 @@
+//go:build linux
+
+package index
+
+import "syscall"
+
+func fillSysStat(s *Stat, sys any) {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	s.CTime = Time{Sec: uint32(st.Ctim.Sec), Nsec: uint32(st.Ctim.Nsec)}
+	s.Dev = uint32(st.Dev)
+	s.Ino = uint32(st.Ino)
+	s.UID = st.Uid
+	s.GID = st.Gid
+}
@@ -0,0 +1,6 @@
+//go:build !linux && !darwin
+
+package index
+
+// Only the modification time and the size are known here
+func fillSysStat(s *Stat, sys any) {}
@@ -1,34 +1,112 @@
 package objects
 
 import (
+	"bytes"
 	"fmt"
 )
 
-const (
-	AUTHOR       = "Valentin"
-	AUTHOR_EMAIL = "valentinwissler42@outlook.com"
-	A_DATE_SEC   = "946684800"
-	A_TIMEZONE   = "+0000"
-)
-
 // https://stackoverflow.com/questions/22968856/what-is-the-file-format-of-a-git-commit-object-data-structure
 type Commit struct {
 	ObjectHeader
-	TreeSha   []byte
-	ParentSha []byte
-	Message   []byte
+	TreeSha []byte
+	// Zero parents for a root commit, more than one for a merge
+	ParentShas [][]byte
+	// The "<name> <<email>> <timestamp> <timezone>" of the author and committer, see Signature
+	Author, Committer []byte
+	// Headers following the committer such as encoding, mergetag or gpgsig
+	ExtraHeaders []CommitHeader
+	// The raw message, including its trailing newline
+	Message []byte
+}
+
+// An extra header of a commit, multi-line values are stored without the leading space of their continuation lines
+type CommitHeader struct {
+	Key   string
+	Value []byte
 }
 
 func (c *Commit) ToByteSlice() []byte {
 	content := make([]byte, 0)
 	content = append(content, []byte(fmt.Sprintf("tree %s\n", string(c.TreeSha)))...)
-	content = append(content, []byte(fmt.Sprintf("parent %s\n", string(c.ParentSha)))...)
-	content = append(content, []byte(fmt.Sprintf("author %s <%s> %s %s\n", AUTHOR, AUTHOR_EMAIL, A_DATE_SEC, A_TIMEZONE))...)
-	content = append(content, []byte(fmt.Sprintf("commiter %s <%s> %s %s\n\n", AUTHOR, AUTHOR_EMAIL, A_DATE_SEC, A_TIMEZONE))...)
-	content = append(content, []byte(fmt.Sprintf("%s\n", c.Message))...)
+	for _, parent := range c.ParentShas {
+		content = append(content, []byte(fmt.Sprintf("parent %s\n", string(parent)))...)
+	}
+	content = append(content, []byte(fmt.Sprintf("author %s\n", c.Author))...)
+	content = append(content, []byte(fmt.Sprintf("committer %s\n", c.Committer))...)
+	for _, h := range c.ExtraHeaders {
+		value := bytes.ReplaceAll(h.Value, []byte("\n"), []byte("\n "))
+		content = append(content, []byte(fmt.Sprintf("%s %s\n", h.Key, value))...)
+	}
+	content = append(content, '\n')
+	content = append(content, c.Message...)
 	header := ObjectHeader{
 		Type:   "commit",
 		Length: fmt.Sprintf("%d", len(content)),
 	}
 	return append(header.ToByteSlice(), content...)
 }
+
+// Return the value of the first extra header named key
+func (c *Commit) Header(key string) ([]byte, bool) {
+	for _, h := range c.ExtraHeaders {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Parse the content of a commit object, without its "commit <size>\x00" header
+func ParseCommit(content []byte) (Commit, error) {
+	commit := Commit{
+		ObjectHeader: ObjectHeader{
+			Type:   "commit",
+			Length: fmt.Sprintf("%d", len(content)),
+		},
+	}
+	rest := content
+	for {
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			return Commit{}, fmt.Errorf("malformed commit: unterminated header")
+		}
+		line := rest[:end]
+		rest = rest[end+1:]
+		if len(line) == 0 {
+			break
+		}
+		key, value, found := bytes.Cut(line, []byte(" "))
+		if !found {
+			return Commit{}, fmt.Errorf("malformed commit header: %q", line)
+		}
+		// Continuation lines of a multi-line value start with a space
+		for len(rest) > 0 && rest[0] == ' ' {
+			end = bytes.IndexByte(rest, '\n')
+			if end < 0 {
+				return Commit{}, fmt.Errorf("malformed commit: unterminated header")
+			}
+			value = append(append(append([]byte{}, value...), '\n'), rest[1:end]...)
+			rest = rest[end+1:]
+		}
+		switch string(key) {
+		case "tree":
+			if commit.TreeSha != nil {
+				return Commit{}, fmt.Errorf("malformed commit: more than one tree")
+			}
+			commit.TreeSha = value
+		case "parent":
+			commit.ParentShas = append(commit.ParentShas, value)
+		case "author":
+			commit.Author = value
+		case "committer":
+			commit.Committer = value
+		default:
+			commit.ExtraHeaders = append(commit.ExtraHeaders, CommitHeader{Key: string(key), Value: value})
+		}
+	}
+	if commit.TreeSha == nil {
+		return Commit{}, fmt.Errorf("malformed commit: missing tree")
+	}
+	commit.Message = rest
+	return commit, nil
+}
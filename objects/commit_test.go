@@ -0,0 +1,74 @@
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+var TestCaseParseCommit = []struct {
+	Description string
+	Content     string
+	Parents     int
+	Headers     []string
+}{
+	{
+		Description: "root commit",
+		Content: "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+			"author A U Thor <author@example.com> 1112911993 -0700\n" +
+			"committer C O Mitter <committer@example.com> 1112911993 -0700\n" +
+			"\n" +
+			"initial\n",
+		Parents: 0,
+	},
+	{
+		Description: "signed merge with an encoding",
+		Content: "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+			"parent 3b18e512dba79e4c8300dd08aeb37f8e728b8dad\n" +
+			"parent 0501091fcf64fe2b351473f1abb3a6fcb967ee93\n" +
+			"author A U Thor <author@example.com> 1112911993 -0700\n" +
+			"committer C O Mitter <committer@example.com> 1112912053 -0700\n" +
+			"encoding ISO-8859-1\n" +
+			"mergetag object 0501091fcf64fe2b351473f1abb3a6fcb967ee93\n" +
+			" type commit\n" +
+			" tag v1.0\n" +
+			" tagger C O Mitter <committer@example.com> 1112912000 -0700\n" +
+			" \n" +
+			" v1.0\n" +
+			"gpgsig -----BEGIN PGP SIGNATURE-----\n" +
+			" \n" +
+			" iQEzBAABCAAdFiEE\n" +
+			" -----END PGP SIGNATURE-----\n" +
+			"\n" +
+			"Merge tag 'v1.0'\n\nwithout a trailing newline",
+		Parents: 2,
+		Headers: []string{"encoding", "mergetag", "gpgsig"},
+	},
+}
+
+// Test that parsing then serializing a commit gives back the exact same bytes
+func TestCommit_RoundTrip(t *testing.T) {
+	for _, tc := range TestCaseParseCommit {
+		t.Run(tc.Description, func(t *testing.T) {
+			commit, err := ParseCommit([]byte(tc.Content))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(commit.ParentShas) != tc.Parents {
+				t.Fatalf("unexpected parent count, got: %d expected: %d", len(commit.ParentShas), tc.Parents)
+			}
+			if len(commit.ExtraHeaders) != len(tc.Headers) {
+				t.Fatalf("unexpected header count, got: %d expected: %d", len(commit.ExtraHeaders), len(tc.Headers))
+			}
+			for i, key := range tc.Headers {
+				if commit.ExtraHeaders[i].Key != key {
+					t.Fatalf("unexpected header, got: %s expected: %s", commit.ExtraHeaders[i].Key, key)
+				}
+			}
+			expected := []byte(fmt.Sprintf("commit %d\x00%s", len(tc.Content), tc.Content))
+			if got := commit.ToByteSlice(); !bytes.Equal(got, expected) {
+				t.Fatalf("round trip differs\nGot:%q\nExp:%q", got, expected)
+			}
+		})
+	}
+}
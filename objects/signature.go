@@ -0,0 +1,74 @@
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The identity and time of the author or committer of a commit, or of the tagger of a tag
+type Signature struct {
+	Name, Email string
+	When        time.Time
+}
+
+// Return the "<name> <<email>> <timestamp> <timezone>" representation used in object headers
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.When.Unix(), FormatTimezone(s.When))
+}
+
+// Return the +hhmm offset of t from UTC
+func FormatTimezone(t time.Time) string {
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset%3600/60)
+}
+
+// Return the location of a +hhmm offset from UTC
+func ParseTimezone(tz string) (*time.Location, error) {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return nil, fmt.Errorf("malformed timezone: %s", tz)
+	}
+	hours, errH := strconv.Atoi(tz[1:3])
+	minutes, errM := strconv.Atoi(tz[3:])
+	if errH != nil || errM != nil {
+		return nil, fmt.Errorf("malformed timezone: %s", tz)
+	}
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone("", offset), nil
+}
+
+// Parse a "<name> <<email>> <timestamp> <timezone>" signature
+func ParseSignature(b []byte) (Signature, error) {
+	open := bytes.IndexByte(b, '<')
+	closing := bytes.LastIndexByte(b, '>')
+	if open < 0 || closing < open {
+		return Signature{}, fmt.Errorf("malformed signature: %q", b)
+	}
+	sig := Signature{
+		Name:  string(bytes.TrimSpace(b[:open])),
+		Email: string(b[open+1 : closing]),
+	}
+	fields := bytes.Fields(b[closing+1:])
+	if len(fields) < 2 {
+		return Signature{}, fmt.Errorf("malformed signature date: %q", b)
+	}
+	epoch, err := strconv.ParseInt(string(fields[0]), 10, 64)
+	if err != nil {
+		return Signature{}, fmt.Errorf("malformed signature date: %q", b)
+	}
+	loc, err := ParseTimezone(string(fields[1]))
+	if err != nil {
+		return Signature{}, err
+	}
+	sig.When = time.Unix(epoch, 0).In(loc)
+	return sig, nil
+}
@@ -0,0 +1,96 @@
+package objects
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// An annotated tag: a named pointer to another object, with a tagger and a message
+type Tag struct {
+	ObjectHeader
+	// The name and type of the object tagged
+	Object     []byte
+	TargetType string
+	// The name of the tag, without refs/tags/
+	Name string
+	// The "<name> <<email>> <timestamp> <timezone>" of the tagger, see Signature; nil in some old tags
+	Tagger []byte
+	// Headers following the tagger, like the ones of a commit
+	ExtraHeaders []CommitHeader
+	// The raw message, followed by its signature for a signed tag
+	Message []byte
+}
+
+func (t *Tag) ToByteSlice() []byte {
+	content := make([]byte, 0)
+	content = append(content, []byte(fmt.Sprintf("object %s\n", t.Object))...)
+	content = append(content, []byte(fmt.Sprintf("type %s\n", t.TargetType))...)
+	content = append(content, []byte(fmt.Sprintf("tag %s\n", t.Name))...)
+	if t.Tagger != nil {
+		content = append(content, []byte(fmt.Sprintf("tagger %s\n", t.Tagger))...)
+	}
+	for _, h := range t.ExtraHeaders {
+		value := bytes.ReplaceAll(h.Value, []byte("\n"), []byte("\n "))
+		content = append(content, []byte(fmt.Sprintf("%s %s\n", h.Key, value))...)
+	}
+	content = append(content, '\n')
+	content = append(content, t.Message...)
+	header := ObjectHeader{
+		Type:   "tag",
+		Length: fmt.Sprintf("%d", len(content)),
+	}
+	return append(header.ToByteSlice(), content...)
+}
+
+// Parse the content of a tag object, without its "tag <size>\x00" header
+func ParseTag(content []byte) (Tag, error) {
+	tag := Tag{
+		ObjectHeader: ObjectHeader{
+			Type:   "tag",
+			Length: fmt.Sprintf("%d", len(content)),
+		},
+	}
+	rest := content
+	for len(rest) > 0 {
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			// A tag without a message may end right after its headers
+			end = len(rest)
+			rest = append(append([]byte{}, rest...), '\n')
+		}
+		line := rest[:end]
+		rest = rest[end+1:]
+		if len(line) == 0 {
+			break
+		}
+		key, value, found := bytes.Cut(line, []byte(" "))
+		if !found {
+			return Tag{}, fmt.Errorf("malformed tag header: %q", line)
+		}
+		for len(rest) > 0 && rest[0] == ' ' {
+			end = bytes.IndexByte(rest, '\n')
+			if end < 0 {
+				return Tag{}, fmt.Errorf("malformed tag: unterminated header")
+			}
+			value = append(append(append([]byte{}, value...), '\n'), rest[1:end]...)
+			rest = rest[end+1:]
+		}
+		switch string(key) {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.TargetType = string(value)
+		case "tag":
+			tag.Name = string(value)
+		case "tagger":
+			tag.Tagger = value
+		default:
+			tag.ExtraHeaders = append(tag.ExtraHeaders, CommitHeader{Key: string(key), Value: value})
+		}
+	}
+	if tag.Object == nil || tag.TargetType == "" {
+		return Tag{}, fmt.Errorf("malformed tag: missing object or type")
+	}
+	tag.Message = rest
+	return tag, nil
+}
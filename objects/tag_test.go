@@ -0,0 +1,54 @@
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+var TestCaseParseTag = []struct {
+	Description string
+	Content     string
+	Tagger      bool
+}{
+	{
+		Description: "annotated tag",
+		Content: "object 3b18e512dba79e4c8300dd08aeb37f8e728b8dad\n" +
+			"type commit\n" +
+			"tag v1.0\n" +
+			"tagger C O Mitter <committer@example.com> 1112912000 -0700\n" +
+			"\n" +
+			"v1.0\n\nThe first release\n",
+		Tagger: true,
+	},
+	{
+		Description: "old tag of a tree without a tagger",
+		Content: "object 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+			"type tree\n" +
+			"tag v2.6.11-tree\n" +
+			"\n" +
+			"This is the 2.6.11 tree object.\n",
+	},
+}
+
+// Test that parsing then serializing a tag gives back the exact same bytes
+func TestTag_RoundTrip(t *testing.T) {
+	for _, tc := range TestCaseParseTag {
+		t.Run(tc.Description, func(t *testing.T) {
+			tag, err := ParseTag([]byte(tc.Content))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if (tag.Tagger != nil) != tc.Tagger {
+				t.Fatalf("unexpected tagger: %q", tag.Tagger)
+			}
+			expected := []byte(fmt.Sprintf("tag %d\x00%s", len(tc.Content), tc.Content))
+			if got := tag.ToByteSlice(); !bytes.Equal(got, expected) {
+				t.Fatalf("round trip differs\nGot:%q\nExp:%q", got, expected)
+			}
+		})
+	}
+	if _, err := ParseTag([]byte("tag v1.0\n\nno object\n")); err == nil {
+		t.Fatalf("expected a tag without an object to be refused")
+	}
+}
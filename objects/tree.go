@@ -1,10 +1,20 @@
 package objects
 
 import (
+	"bytes"
 	"fmt"
 	"sort"
 )
 
+// Modes of the entries of a tree object
+const (
+	ModeFile       = "100644"
+	ModeExecutable = "100755"
+	ModeSymlink    = "120000"
+	ModeGitlink    = "160000"
+	ModeTree       = "40000"
+)
+
 type TreeObject struct {
 	ObjectHeader
 	Items []TreeObjectItem
@@ -23,8 +33,9 @@ func NewTreeObject(header ObjectHeader, items ...TreeObjectItem) TreeObject {
 }
 
 func (t *TreeObject) ToByteSlice() []byte {
+	// git compares the names of subtrees as if they had a trailing slash
 	sort.Slice(t.Items, func(i, j int) bool {
-		return t.Items[i].Name < t.Items[j].Name
+		return t.Items[i].sortKey() < t.Items[j].sortKey()
 	})
 	content := make([]byte, 0)
 	for _, item := range t.Items {
@@ -65,3 +76,50 @@ func NewTreeObjectItem(name string, hash []byte) (TreeObjectItem, error) {
 func (tr *TreeObjectItem) ToByteSlice() []byte {
 	return append([]byte(fmt.Sprintf("%s %s\x00", tr.Permission, tr.Name)), tr.Sha1_Hash[:]...)
 }
+
+// Return the name used to order this item in its tree
+func (tr *TreeObjectItem) sortKey() string {
+	if tr.Permission == ModeTree {
+		return tr.Name + "/"
+	}
+	return tr.Name
+}
+
+// Parse the content of a tree object, without its header, into its items, hashSize being the length of the binary
+// object names: 20 for SHA-1, 32 for SHA-256
+func ParseTree(content []byte, hashSize int) ([]TreeObjectItem, error) {
+	items := make([]TreeObjectItem, 0)
+	for len(content) > 0 {
+		space := bytes.IndexByte(content, ' ')
+		if space < 0 {
+			return nil, fmt.Errorf("malformed mode in tree entry")
+		}
+		nul := bytes.IndexByte(content[space:], 0)
+		if nul < 0 || space+nul+1+hashSize > len(content) {
+			return nil, fmt.Errorf("too-short tree object")
+		}
+		nul += space
+		name := string(content[space+1 : nul])
+		if name == "" {
+			return nil, fmt.Errorf("empty filename in tree entry")
+		}
+		items = append(items, TreeObjectItem{
+			Permission: string(content[:space]),
+			Name:       name,
+			Sha1_Hash:  content[nul+1 : nul+1+hashSize],
+		})
+		content = content[nul+1+hashSize:]
+	}
+	return items, nil
+}
+
+// Return the type of the object an item points to: tree, commit for a submodule, or blob
+func (tr *TreeObjectItem) Type() string {
+	switch tr.Permission {
+	case ModeTree:
+		return "tree"
+	case ModeGitlink:
+		return "commit"
+	}
+	return "blob"
+}
@@ -0,0 +1,40 @@
+package objects
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Test that parsing a written tree gives back its items, in the order git sorts them
+func TestTree_RoundTrip(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xab}, 20)
+	tree := NewTreeObject(ObjectHeader{},
+		TreeObjectItem{Permission: ModeFile, Name: "a.txt", Sha1_Hash: hash},
+		TreeObjectItem{Permission: ModeTree, Name: "a", Sha1_Hash: hash},
+		TreeObjectItem{Permission: ModeSymlink, Name: "a-link", Sha1_Hash: hash},
+	)
+	written := tree.ToByteSlice()
+	_, content, _ := bytes.Cut(written, []byte{0})
+	items, err := ParseTree(content, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"a-link", "a.txt", "a"}
+	if len(items) != len(expected) {
+		t.Fatalf("expected %d items, got %+v", len(expected), items)
+	}
+	for i, item := range items {
+		if item.Name != expected[i] || !bytes.Equal(item.Sha1_Hash, hash) {
+			t.Fatalf("expected %s at %d, got %+v", expected[i], i, item)
+		}
+	}
+	if items[2].Type() != "tree" || items[0].Type() != "blob" {
+		t.Fatalf("unexpected types %s and %s", items[2].Type(), items[0].Type())
+	}
+}
+
+func TestTree_Truncated(t *testing.T) {
+	if _, err := ParseTree([]byte("100644 a.txt\x00abc"), 20); err == nil {
+		t.Fatalf("expected a truncated tree to be refused")
+	}
+}
@@ -0,0 +1,454 @@
+// Pathspecs: the patterns commands use to limit the paths they work on, with the magic of git's pathspec.c
+package pathspec
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	wildmatch "github.com/codecrafters-io/git-starter-go/wildmatch"
+)
+
+// The magic changing how a pathspec matches
+type Magic int
+
+const (
+	// Relative to the top of the work tree instead of the current directory
+	Top Magic = 1 << iota
+	// The wildcards are ordinary characters
+	Literal
+	// The wildcards follow the rules of wildmatch: "*" and "?" don't match slashes, "**" matches directories
+	Glob
+	// Case-insensitive
+	Icase
+	// Remove the paths it matches from the ones the other pathspecs match
+	Exclude
+	// Only match the paths having the attributes
+	Attr
+)
+
+var magicNames = []struct {
+	magic Magic
+	name  string
+	// The character of the short form, like ":!" or ":/", 0 when it has none
+	mnemonic byte
+}{
+	{Top, "top", '/'},
+	{Literal, "literal", 0},
+	{Glob, "glob", 0},
+	{Icase, "icase", 0},
+	{Exclude, "exclude", '!'},
+	{Attr, "attr", 0},
+}
+
+// How the pathspecs are parsed, like the GIT_*_PATHSPECS environment variables
+type Options struct {
+	// Every pathspec is literal, the magic included, like GIT_LITERAL_PATHSPECS
+	Literal bool
+	// Every pathspec is a glob, like GIT_GLOB_PATHSPECS
+	Glob bool
+	// Every pathspec is literal unless it has the glob magic, like GIT_NOGLOB_PATHSPECS
+	NoGlob bool
+	// Every pathspec is case-insensitive, like GIT_ICASE_PATHSPECS
+	Icase bool
+	// Without a pathspec, or with only excluding ones, only match the paths under the current directory instead of
+	// every path, like the commands limited to the current directory by default
+	PreferCwd bool
+	// The magic refused by the command, like attr for commands that don't read attributes
+	Forbidden Magic
+	// The path of the work tree, shown when a pathspec is outside of it
+	WorkTree string
+	// Return the attributes of a path for the attr magic: "set", "unset" or the value of the attributes specified
+	Attributes func(path string) map[string]string
+}
+
+// An attribute the attr magic requires: set, unset, unspecified, or set to a value
+type attrRequirement struct {
+	name  string
+	state string
+}
+
+// One pathspec
+type Item struct {
+	// The pathspec as given
+	Original string
+	// The pattern from the top of the work tree, the current directory prepended unless it has the top magic
+	Match string
+	Magic Magic
+	// The length of the leading part of Match without wildcards, the part naming a directory to look in
+	nowildcardLen int
+	attrs         []attrRequirement
+}
+
+// The pathspecs given to a command, matching every path when there is none
+type Pathspec struct {
+	Items      []Item
+	attributes func(path string) map[string]string
+}
+
+// Parse pathspecs given from the current directory, prefix being its path from the top of the work tree
+// ending with a slash, or empty at the top
+func Parse(args []string, prefix string, opts Options) (*Pathspec, error) {
+	if opts.Literal && (opts.Glob || opts.NoGlob) || opts.Glob && opts.NoGlob {
+		return nil, fmt.Errorf("global 'literal' pathspec setting is incompatible with all other global pathspec settings")
+	}
+	ps := &Pathspec{Items: make([]Item, 0, len(args)), attributes: opts.Attributes}
+	for _, arg := range args {
+		item, err := parseItem(arg, prefix, opts)
+		if err != nil {
+			return nil, err
+		}
+		ps.Items = append(ps.Items, item)
+	}
+	if opts.PreferCwd && prefix != "" && !ps.hasPositive() {
+		// The directory itself, with its trailing slash, like git's prefix pathspec
+		item, err := parseItem("./", prefix, Options{})
+		if err != nil {
+			return nil, err
+		}
+		ps.Items = append(ps.Items, item)
+	}
+	return ps, nil
+}
+
+func parseItem(arg, prefix string, opts Options) (Item, error) {
+	item := Item{Original: arg}
+	pattern := arg
+	if !opts.Literal && strings.HasPrefix(arg, ":") {
+		var err error
+		if pattern, err = item.parseMagic(arg); err != nil {
+			return Item{}, err
+		}
+	}
+	switch {
+	case opts.Literal:
+		item.Magic |= Literal
+	case opts.Glob && item.Magic&Literal == 0:
+		item.Magic |= Glob
+	case opts.NoGlob && item.Magic&Glob == 0:
+		item.Magic |= Literal
+	}
+	if opts.Icase {
+		item.Magic |= Icase
+	}
+	if item.Magic&Literal != 0 && item.Magic&Glob != 0 {
+		return Item{}, fmt.Errorf("'literal' and 'glob' are incompatible")
+	}
+	if forbidden := item.Magic & opts.Forbidden; forbidden != 0 {
+		for _, m := range magicNames {
+			if forbidden&m.magic != 0 {
+				return Item{}, fmt.Errorf("%s: pathspec magic not supported by this command: '%s'", arg, m.name)
+			}
+		}
+	}
+	if item.Magic&Top == 0 {
+		pattern = prefix + pattern
+	}
+	match, err := normalize(pattern)
+	if err != nil {
+		return Item{}, fmt.Errorf("%s: '%s' is outside repository at '%s'", arg, arg, opts.WorkTree)
+	}
+	item.Match = match
+	item.nowildcardLen = len(match)
+	if item.Magic&Literal == 0 {
+		item.nowildcardLen = wildcardIndex(match)
+	}
+	return item, nil
+}
+
+// Parse the magic of a pathspec starting with a colon, either the long form ":(top,icase)path" or the short form
+// ":/path" and ":!path", and return the pattern after it
+func (item *Item) parseMagic(arg string) (string, error) {
+	if !strings.HasPrefix(arg, ":(") {
+		i := 1
+	short:
+		for ; i < len(arg); i++ {
+			switch c := arg[i]; c {
+			case ':':
+				i++
+				break short
+			case '^':
+				item.Magic |= Exclude
+			default:
+				found := false
+				for _, m := range magicNames {
+					if m.mnemonic != 0 && m.mnemonic == c {
+						item.Magic |= m.magic
+						found = true
+					}
+				}
+				if !found {
+					break short
+				}
+			}
+		}
+		return arg[i:], nil
+	}
+	end := strings.IndexByte(arg, ')')
+	if end < 0 {
+		return "", fmt.Errorf("Missing ')' at the end of pathspec magic in '%s'", arg)
+	}
+	for _, word := range strings.Split(arg[2:end], ",") {
+		if word == "" {
+			continue
+		}
+		if value, found := strings.CutPrefix(word, "attr:"); found {
+			if item.Magic&Attr != 0 {
+				return "", fmt.Errorf("Only one 'attr:' specification is allowed.")
+			}
+			item.Magic |= Attr
+			if err := item.parseAttr(value); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if strings.HasPrefix(word, "prefix:") {
+			// Only used by git internally to pass the current directory along
+			continue
+		}
+		found := false
+		for _, m := range magicNames {
+			if m.name == word && m.magic != Attr {
+				item.Magic |= m.magic
+				found = true
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("Invalid pathspec magic '%s' in '%s'", word, arg)
+		}
+	}
+	return arg[end+1:], nil
+}
+
+// Parse the attributes of "attr:VAR -VAR !VAR VAR=value"
+func (item *Item) parseAttr(value string) error {
+	for _, word := range strings.Fields(value) {
+		req := attrRequirement{name: word, state: "set"}
+		switch {
+		case strings.HasPrefix(word, "-"):
+			req = attrRequirement{name: word[1:], state: "unset"}
+		case strings.HasPrefix(word, "!"):
+			req = attrRequirement{name: word[1:], state: ""}
+		default:
+			if name, v, found := strings.Cut(word, "="); found {
+				req = attrRequirement{name: name, state: "=" + v}
+			}
+		}
+		if req.name == "" {
+			return fmt.Errorf("invalid attribute name %s", word)
+		}
+		item.attrs = append(item.attrs, req)
+	}
+	if len(item.attrs) == 0 {
+		return fmt.Errorf("attr spec must not be empty")
+	}
+	return nil
+}
+
+// Resolve the "." and ".." components of a path from the top of the work tree, keeping a trailing slash
+func normalize(pattern string) (string, error) {
+	trailing := strings.HasSuffix(pattern, "/")
+	if pattern == "" {
+		return "", nil
+	}
+	clean := path.Clean(pattern)
+	switch {
+	case clean == ".":
+		return "", nil
+	case clean == ".." || strings.HasPrefix(clean, "../") || strings.HasPrefix(clean, "/"):
+		return "", fmt.Errorf("outside repository")
+	}
+	if trailing {
+		clean += "/"
+	}
+	return clean, nil
+}
+
+// Return the position of the first wildcard of a pattern, its length when it has none
+func wildcardIndex(pattern string) int {
+	if i := strings.IndexAny(pattern, "*?[\\"); i >= 0 {
+		return i
+	}
+	return len(pattern)
+}
+
+// Whether a pathspec doesn't exclude paths
+func (ps *Pathspec) hasPositive() bool {
+	for _, item := range ps.Items {
+		if item.Magic&Exclude == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the pathspec has no pattern and so matches every path
+func (ps *Pathspec) Empty() bool {
+	return len(ps.Items) == 0
+}
+
+// Whether a path from the top of the work tree matches: one of the pathspecs not excluding paths matches it, or there
+// is none, and none of the excluding ones matches it; isDir tells a directory, matched by a pattern ending with a slash
+func (ps *Pathspec) Match(name string, isDir bool) bool {
+	return ps.MatchSeen(name, isDir, nil)
+}
+
+// Like Match, also setting seen[i] for each pathspec i matching the path, for the commands reporting the pathspecs
+// matching nothing
+func (ps *Pathspec) MatchSeen(name string, isDir bool, seen []bool) bool {
+	positive := false
+	matched := false
+	for i, item := range ps.Items {
+		if item.Magic&Exclude != 0 {
+			continue
+		}
+		positive = true
+		if ps.matchItem(item, name, isDir) {
+			matched = true
+			if seen != nil {
+				seen[i] = true
+			}
+		}
+	}
+	if positive && !matched {
+		return false
+	}
+	for _, item := range ps.Items {
+		if item.Magic&Exclude != 0 && ps.matchItem(item, name, isDir) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ps *Pathspec) matchItem(item Item, name string, isDir bool) bool {
+	if !item.matchName(name, isDir) {
+		return false
+	}
+	if item.Magic&Attr == 0 {
+		return true
+	}
+	var attrs map[string]string
+	if ps.attributes != nil {
+		attrs = ps.attributes(name)
+	}
+	for _, req := range item.attrs {
+		state, specified := attrs[req.name]
+		switch {
+		case req.state == "" && specified:
+			return false
+		case req.state == "":
+		case strings.HasPrefix(req.state, "="):
+			if !specified || state == "set" || state == "unset" || "="+state != req.state {
+				return false
+			}
+		case state != req.state:
+			return false
+		}
+	}
+	return true
+}
+
+// Whether the path matches the pattern of the item: it is the path, a directory of it, or matches it as a wildcard
+func (item Item) matchName(name string, isDir bool) bool {
+	match := item.Match
+	if match == "" {
+		return true
+	}
+	equal := strings.HasPrefix
+	if item.Magic&Icase != 0 {
+		equal = func(s, prefix string) bool {
+			return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+		}
+	}
+	// The literal part of the pattern must be the same, the wildcards only match what follows
+	literal := match[:item.nowildcardLen]
+	if item.nowildcardLen == len(match) {
+		if dir, isDirPattern := strings.CutSuffix(match, "/"); isDirPattern {
+			return isDir && len(name) == len(dir) && equal(name, dir) || equal(name, match)
+		}
+		return len(name) == len(match) && equal(name, match) || equal(name, match+"/")
+	}
+	if !equal(name, literal) {
+		return false
+	}
+	flags := wildmatch.Flags(0)
+	if item.Magic&Glob != 0 {
+		flags |= wildmatch.Pathname
+	}
+	if item.Magic&Icase != 0 {
+		flags |= wildmatch.CaseFold
+	}
+	if wildmatch.Match(match, name, flags) {
+		return true
+	}
+	// A directory matching the pattern holds matching paths
+	for i := len(literal); i < len(name); i++ {
+		if name[i] == '/' && wildmatch.Match(match, name[:i], flags) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a path under the directory dir, a path from the top of the work tree, may match, letting tree and
+// directory walks skip the directories no pathspec reaches
+func (ps *Pathspec) MayMatchUnder(dir string) bool {
+	positive := false
+	for _, item := range ps.Items {
+		if item.Magic&Exclude != 0 {
+			continue
+		}
+		positive = true
+		literal := item.Match[:item.nowildcardLen]
+		// Either the directory is under the literal part of the pattern, or the pattern goes on under the directory
+		under := dir + "/"
+		n := min(len(literal), len(under))
+		if literal[:n] == under[:n] || item.Magic&Icase != 0 && strings.EqualFold(literal[:n], under[:n]) {
+			return true
+		}
+	}
+	return !positive
+}
+
+// Return the longest leading directory all the pathspecs not excluding paths are under, where to start walking
+func (ps *Pathspec) CommonPrefix() string {
+	common := ""
+	first := true
+	for _, item := range ps.Items {
+		if item.Magic&Exclude != 0 {
+			continue
+		}
+		literal := item.Match[:item.nowildcardLen]
+		if item.Magic&Icase != 0 {
+			literal = ""
+		}
+		// Only whole directories are a prefix
+		dir := literal[:strings.LastIndexByte(literal, '/')+1]
+		if first {
+			common, first = dir, false
+			continue
+		}
+		for !strings.HasPrefix(dir, common) {
+			common = common[:strings.LastIndexByte(strings.TrimSuffix(common, "/"), '/')+1]
+		}
+	}
+	return strings.TrimSuffix(common, "/")
+}
+
+// Return the leading part of the path of the item without wildcards
+func (item Item) LiteralPrefix() string {
+	return item.Match[:item.nowildcardLen]
+}
+
+// Return the item matching its path literally, for the commands taking paths rather than patterns but allowing magic
+func (item Item) AsLiteral() Item {
+	item.Magic = item.Magic&^Glob | Literal
+	item.nowildcardLen = len(item.Match)
+	return item
+}
+
+// Whether the item has wildcards, only literal paths can be checked against the files that exist
+func (item Item) HasWildcard() bool {
+	return item.nowildcardLen < len(item.Match)
+}
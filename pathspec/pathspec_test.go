@@ -0,0 +1,151 @@
+package pathspec
+
+import (
+	"strings"
+	"testing"
+)
+
+var TestCaseMatch = []struct {
+	Description string
+	Args        []string
+	Prefix      string
+	Path        string
+	IsDir       bool
+	Expected    bool
+}{
+	{Description: "no pathspec", Path: "a/b.txt", Expected: true},
+	{Description: "exact path", Args: []string{"a/b.txt"}, Path: "a/b.txt", Expected: true},
+	{Description: "leading directory", Args: []string{"a"}, Path: "a/b.txt", Expected: true},
+	{Description: "not a leading directory", Args: []string{"a"}, Path: "ab.txt"},
+	{Description: "directory only", Args: []string{"a/"}, Path: "a", Expected: false},
+	{Description: "directory only matches a directory", Args: []string{"a/"}, Path: "a", IsDir: true, Expected: true},
+	{Description: "star matches slashes", Args: []string{"*.txt"}, Path: "a/b.txt", Expected: true},
+	{Description: "question mark", Args: []string{"a/?.txt"}, Path: "a/b.txt", Expected: true},
+	{Description: "brackets", Args: []string{"a/[bc].txt"}, Path: "a/d.txt"},
+	{Description: "wildcard directory", Args: []string{"a*"}, Path: "ab/c/d.txt", Expected: true},
+	{Description: "glob star doesn't match slashes", Args: []string{":(glob)*.txt"}, Path: "a/b.txt"},
+	{Description: "glob double star", Args: []string{":(glob)**/b.txt"}, Path: "a/c/b.txt", Expected: true},
+	{Description: "literal", Args: []string{":(literal)*.txt"}, Path: "a.txt"},
+	{Description: "literal star", Args: []string{":(literal)*.txt"}, Path: "*.txt", Expected: true},
+	{Description: "icase", Args: []string{":(icase)A/B.TXT"}, Path: "a/b.txt", Expected: true},
+	{Description: "icase wildcard", Args: []string{":(icase)A/*.TXT"}, Path: "a/b.txt", Expected: true},
+	{Description: "relative to the current directory", Args: []string{"b.txt"}, Prefix: "a/", Path: "a/b.txt", Expected: true},
+	{Description: "parent directory", Args: []string{"../c.txt"}, Prefix: "a/", Path: "c.txt", Expected: true},
+	{Description: "top", Args: []string{":/c.txt"}, Prefix: "a/", Path: "c.txt", Expected: true},
+	{Description: "long top", Args: []string{":(top)c.txt"}, Prefix: "a/", Path: "c.txt", Expected: true},
+	{Description: "exclude", Args: []string{"a", ":!a/b.txt"}, Path: "a/b.txt"},
+	{Description: "exclude keeps the others", Args: []string{"a", ":(exclude)a/b.txt"}, Path: "a/c.txt", Expected: true},
+	{Description: "only excludes", Args: []string{":^*.txt"}, Path: "a/b.go", Expected: true},
+	{Description: "only excludes matching", Args: []string{":^*.txt"}, Path: "a/b.txt"},
+	{Description: "current directory", Args: []string{"."}, Prefix: "a/", Path: "b/c.txt"},
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range TestCaseMatch {
+		t.Run(tc.Description, func(t *testing.T) {
+			ps, err := Parse(tc.Args, tc.Prefix, Options{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if matched := ps.Match(tc.Path, tc.IsDir); matched != tc.Expected {
+				t.Fatalf("expected %v matching %s with %v, got %v", tc.Expected, tc.Path, tc.Args, matched)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for arg, expected := range map[string]string{
+		":(top":             "Missing ')'",
+		":(unknown)a":       "Invalid pathspec magic 'unknown'",
+		":(literal,glob)a":  "incompatible",
+		"../a":              "outside repository",
+		":(attr:a,attr:b)x": "Only one 'attr:'",
+		":(attr:)x":         "must not be empty",
+		"./a/../b":          "",
+	} {
+		_, err := Parse([]string{arg}, "", Options{})
+		if expected == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", arg, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("%s: expected an error with %q, got %v", arg, expected, err)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	ps, err := Parse([]string{":(top)*.txt"}, "", Options{Literal: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ps.Match(":(top)*.txt", false) || ps.Match("a.txt", false) {
+		t.Fatalf("expected the magic of a literal pathspec to be part of the path")
+	}
+	ps, _ = Parse([]string{"*.txt"}, "", Options{Glob: true})
+	if ps.Match("a/b.txt", false) {
+		t.Fatalf("expected a global glob pathspec not to match slashes")
+	}
+	if _, err := Parse([]string{":(attr:text)a"}, "", Options{Forbidden: Attr}); err == nil {
+		t.Fatalf("expected the forbidden magic to be refused")
+	}
+}
+
+func TestAttr(t *testing.T) {
+	attributes := map[string]map[string]string{
+		"a.txt": {"text": "set", "eol": "lf"},
+		"b.bin": {"text": "unset"},
+	}
+	opts := Options{Attributes: func(path string) map[string]string { return attributes[path] }}
+	for spec, expected := range map[string][]string{
+		":(attr:text)":        {"a.txt"},
+		":(attr:-text)":       {"b.bin"},
+		":(attr:!text)":       {"c.go"},
+		":(attr:eol=lf)":      {"a.txt"},
+		":(attr:text !eol)":   {},
+		":(attr:!eol)*.bin":   {"b.bin"},
+		":(attr:eol=crlf)":    {},
+		":(attr:text eol=lf)": {"a.txt"},
+	} {
+		ps, err := Parse([]string{spec}, "", opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		matched := make([]string, 0)
+		for _, path := range []string{"a.txt", "b.bin", "c.go"} {
+			if ps.Match(path, false) {
+				matched = append(matched, path)
+			}
+		}
+		if strings.Join(matched, " ") != strings.Join(expected, " ") {
+			t.Fatalf("%s: expected %v, got %v", spec, expected, matched)
+		}
+	}
+}
+
+func TestMayMatchUnder(t *testing.T) {
+	ps, _ := Parse([]string{"a/b/*.txt", ":!c"}, "", Options{})
+	for dir, expected := range map[string]bool{"a": true, "a/b": true, "a/b/c": true, "a/c": false, "b": false, "ab": false} {
+		if ps.MayMatchUnder(dir) != expected {
+			t.Fatalf("expected %v under %s", expected, dir)
+		}
+	}
+	ps, _ = Parse([]string{"a/b/*.txt", "a/c/d"}, "", Options{})
+	if prefix := ps.CommonPrefix(); prefix != "a" {
+		t.Fatalf("expected the common prefix a, got %s", prefix)
+	}
+}
+
+func TestMatchSeen(t *testing.T) {
+	ps, _ := Parse([]string{"a", "b", "*.go"}, "", Options{})
+	seen := make([]bool, len(ps.Items))
+	for _, path := range []string{"a/x.txt", "c.go"} {
+		ps.MatchSeen(path, false, seen)
+	}
+	if !seen[0] || seen[1] || !seen[2] {
+		t.Fatalf("expected a and *.go to be seen, got %v", seen)
+	}
+}
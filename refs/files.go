@@ -0,0 +1,612 @@
+package refs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// The header of the packed-refs files written, every tag is followed by its peeled value
+const packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
+// Refs stored as one file per ref under the git dir, and in the packed-refs file
+type filesBackend struct {
+	gitDir string
+	opts   Options
+	// The packed-refs file last read, nil before
+	packed *packedRefs
+}
+
+// The refs of a packed-refs file, valid as long as the stat data of the file doesn't change
+type packedRefs struct {
+	info   os.FileInfo
+	refs   []Ref
+	byName map[string]Ref
+}
+
+func newFilesBackend(gitDir string, opts Options) *filesBackend {
+	return &filesBackend{gitDir: gitDir, opts: opts}
+}
+
+func (b *filesBackend) path(name string) string {
+	return filepath.Join(b.gitDir, filepath.FromSlash(name))
+}
+
+func (b *filesBackend) Read(name string) (Ref, error) {
+	content, err := os.ReadFile(b.path(name))
+	if err == nil {
+		return parseLooseRef(name, content)
+	}
+	// A ref below a file, like refs/heads/a/b when refs/heads/a exists, doesn't exist either
+	if !os.IsNotExist(err) && !errors.Is(err, syscall.ENOTDIR) && !isDirError(b.path(name)) {
+		return Ref{}, fmt.Errorf("unable to read ref %s: %s", name, err)
+	}
+	if IsPseudoRef(name) {
+		return Ref{}, ErrNotFound
+	}
+	packed, err := b.readPacked()
+	if err != nil {
+		return Ref{}, err
+	}
+	if ref, found := packed[name]; found {
+		return ref, nil
+	}
+	return Ref{}, ErrNotFound
+}
+
+// Whether path is a directory, a ref can't be read from it
+func isDirError(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// Parse the content of a loose ref: "<hash>\n" or "ref: <name>\n"
+func parseLooseRef(name string, content []byte) (Ref, error) {
+	value := strings.TrimRight(string(content), "\n\r ")
+	if target, found := strings.CutPrefix(value, "ref:"); found {
+		return Ref{Name: name, Symbolic: strings.TrimSpace(target)}, nil
+	}
+	// Pseudo refs like FETCH_HEAD may hold more than the hash
+	if IsPseudoRef(name) && len(value) > 40 {
+		if hash, _, found := strings.Cut(value, "\t"); found {
+			value = hash
+		}
+		value, _, _ = strings.Cut(value, "\n")
+	}
+	if !IsHash(value) {
+		return Ref{}, fmt.Errorf("broken ref %s: %q", name, value)
+	}
+	return Ref{Name: name, Target: value}, nil
+}
+
+// Return the refs of the packed-refs file by name
+// The map is shared by the callers until packed-refs changes, it must not be modified
+func (b *filesBackend) readPacked() (map[string]Ref, error) {
+	packed, err := b.loadPacked()
+	if err != nil {
+		return nil, err
+	}
+	return packed.byName, nil
+}
+
+// Return the refs of the packed-refs file in order
+// The slice is shared by the callers until packed-refs changes, it must not be modified
+func (b *filesBackend) readPackedList() ([]Ref, error) {
+	packed, err := b.loadPacked()
+	if err != nil {
+		return nil, err
+	}
+	return packed.refs, nil
+}
+
+// Return the parsed packed-refs file, parsing it again only when its stat data changed since it was last read
+func (b *filesBackend) loadPacked() (*packedRefs, error) {
+	path := filepath.Join(b.gitDir, "packed-refs")
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		b.packed = nil
+		return &packedRefs{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read packed-refs: %s", err)
+	}
+	if cached := b.packed; cached != nil && os.SameFile(cached.info, info) && cached.info.Size() == info.Size() &&
+		cached.info.ModTime().Equal(info.ModTime()) {
+		return cached, nil
+	}
+	refs, err := parsePacked(path)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Ref, len(refs))
+	for _, ref := range refs {
+		byName[ref.Name] = ref
+	}
+	b.packed = &packedRefs{info: info, refs: refs, byName: byName}
+	return b.packed, nil
+}
+
+// Parse a packed-refs file: "<hash> <name>" lines, each maybe followed by a "^<peeled>" line
+func parsePacked(path string) ([]Ref, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read packed-refs: %s", err)
+	}
+	refs := make([]Ref, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "^"):
+			if len(refs) == 0 || !IsHash(line[1:]) {
+				return nil, fmt.Errorf("unexpected line %d in packed-refs: %s", lineNumber, line)
+			}
+			refs[len(refs)-1].Peeled = line[1:]
+		default:
+			hash, name, found := strings.Cut(line, " ")
+			if !found || !IsHash(hash) {
+				return nil, fmt.Errorf("unexpected line %d in packed-refs: %s", lineNumber, line)
+			}
+			refs = append(refs, Ref{Name: name, Target: hash})
+		}
+	}
+	return refs, scanner.Err()
+}
+
+func (b *filesBackend) List(prefix string) ([]Ref, error) {
+	packed, err := b.readPackedList()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Ref)
+	for _, ref := range packed {
+		if strings.HasPrefix(ref.Name, prefix) {
+			byName[ref.Name] = ref
+		}
+	}
+	// Only the directory holding the refs of the prefix is walked: refs/heads for refs/heads/ or refs/heads/ma
+	root := "refs"
+	if strings.HasPrefix(prefix, "refs/") {
+		root = prefix[:strings.LastIndex(prefix, "/")]
+	}
+	err = filepath.WalkDir(b.path(root), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The directory of the prefix may be missing, or a ref like refs/heads/a for refs/heads/a/
+			if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(b.gitDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		ref, err := parseLooseRef(name, content)
+		if err != nil {
+			// A broken loose ref is skipped like git does, with a warning
+			fmt.Fprintf(os.Stderr, "warning: ignoring %s\n", err)
+			return nil
+		}
+		// A loose ref replaces its packed copy
+		byName[name] = ref
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]Ref, 0, len(byName))
+	for _, ref := range byName {
+		refs = append(refs, ref)
+	}
+	sortRefs(refs)
+	return refs, nil
+}
+
+// Create the lock file of path: the only writer of path is the one holding its lock
+func lockFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("Unable to create '%s.lock': %s", path, err)
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("Unable to create '%s.lock': File exists.\n\n"+
+			"Another git process seems to be running in this repository, or a git process crashed earlier:\n"+
+			"remove the file manually to continue", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create '%s.lock': %s", path, err)
+	}
+	return lock, nil
+}
+
+// Return an error unless the current value of name is the expected old one
+func checkOld(name string, current Ref, readErr error, old string) error {
+	if old == "" {
+		return nil
+	}
+	exists := readErr == nil
+	if readErr != nil && readErr != ErrNotFound {
+		return readErr
+	}
+	switch {
+	case IsZeroHash(old) && exists:
+		return fmt.Errorf("cannot lock ref '%s': reference already exists", name)
+	case IsZeroHash(old):
+		return nil
+	case !exists:
+		return fmt.Errorf("cannot lock ref '%s': unable to resolve reference '%s'", name, name)
+	case current.Target != old:
+		return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", name, current.Target, old)
+	}
+	return nil
+}
+
+// A transaction of the files backend: one lock file per ref holding its new value,
+// and the lock of packed-refs holding its new content when packed refs are deleted
+type filesTransaction struct {
+	b       *filesBackend
+	updates []Update
+	// The lock files, in the order of the updates
+	locks      []string
+	packedLock string
+	// The entries to append to the reflogs once the refs are updated
+	logs map[string]LogEntry
+}
+
+func (b *filesBackend) Prepare(updates []Update) (PreparedTransaction, error) {
+	tx := &filesTransaction{b: b, updates: updates}
+	if err := tx.prepare(); err != nil {
+		tx.Abort()
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (tx *filesTransaction) prepare() error {
+	deleted := make([]string, 0)
+	current := make(map[string]string, len(tx.updates))
+	for _, u := range tx.updates {
+		lock, err := lockFile(tx.b.path(u.Name))
+		if err != nil {
+			return err
+		}
+		tx.locks = append(tx.locks, lock.Name())
+		ref, readErr := tx.b.Read(u.Name)
+		if err := checkOld(u.Name, ref, readErr, u.Old); err != nil {
+			lock.Close()
+			return err
+		}
+		current[u.Name] = resolvedTarget(tx.b, u.Name)
+		content := ""
+		switch {
+		case u.Verify:
+		case u.Delete:
+			deleted = append(deleted, u.Name)
+		case u.NewSymbolic != "":
+			content = "ref: " + u.NewSymbolic + "\n"
+		default:
+			content = u.New + "\n"
+		}
+		if _, err := lock.WriteString(content); err != nil {
+			lock.Close()
+			return err
+		}
+		if err := lock.Close(); err != nil {
+			return err
+		}
+	}
+	logs, err := tx.b.opts.logEntries(tx.updates, current, func(name string) string {
+		return resolvedTarget(tx.b, name)
+	})
+	if err != nil {
+		return err
+	}
+	tx.logs = logs
+	if len(deleted) == 0 {
+		return nil
+	}
+	// The deleted refs that are packed leave packed-refs, which is rewritten under its own lock
+	packed, err := tx.b.readPackedList()
+	if err != nil {
+		return err
+	}
+	remove := make(map[string]bool, len(deleted))
+	for _, name := range deleted {
+		remove[name] = true
+	}
+	kept := make([]Ref, 0, len(packed))
+	for _, ref := range packed {
+		if !remove[ref.Name] {
+			kept = append(kept, ref)
+		}
+	}
+	if len(kept) == len(packed) {
+		return nil
+	}
+	lock, err := tx.b.lockPacked(kept)
+	if err != nil {
+		return err
+	}
+	tx.packedLock = lock
+	return nil
+}
+
+func (tx *filesTransaction) Commit() error {
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	// The packed copies go first so that a deleted ref never shows its packed value
+	if tx.packedLock != "" {
+		if err := os.Rename(tx.packedLock, filepath.Join(tx.b.gitDir, "packed-refs")); err != nil {
+			fail(fmt.Errorf("unable to write packed-refs: %s", err))
+		}
+		tx.packedLock = ""
+	}
+	for i, u := range tx.updates {
+		path := tx.b.path(u.Name)
+		switch {
+		case u.Verify:
+			os.Remove(tx.locks[i])
+		case u.Delete:
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				fail(fmt.Errorf("unable to delete ref %s: %s", u.Name, err))
+			}
+			os.Remove(tx.locks[i])
+			// Once the lock is gone the directories of the ref may be empty
+			tx.b.removeEmptyParents(path, "refs")
+			// The reflog goes with the ref
+			logPath := tx.b.logPath(u.Name)
+			if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+				fail(fmt.Errorf("unable to delete the reflog of %s: %s", u.Name, err))
+			}
+			tx.b.removeEmptyParents(logPath, "logs/refs")
+		default:
+			if isDirError(path) {
+				// An empty directory left by deleted refs may stand where the ref goes
+				if err := os.Remove(path); err != nil {
+					fail(fmt.Errorf("cannot lock ref '%s': there is a non-empty directory '%s' blocking it", u.Name, path))
+					os.Remove(tx.locks[i])
+					continue
+				}
+			}
+			if err := os.Rename(tx.locks[i], path); err != nil {
+				fail(fmt.Errorf("unable to update ref %s: %s", u.Name, err))
+				os.Remove(tx.locks[i])
+			}
+		}
+	}
+	tx.locks = nil
+	if firstErr != nil {
+		return firstErr
+	}
+	for _, u := range tx.updates {
+		entry, found := tx.logs[u.Name]
+		if !found {
+			continue
+		}
+		if err := tx.b.appendLog(u.Name, entry); err != nil {
+			return err
+		}
+		if u.logHead {
+			if err := tx.b.appendLog("HEAD", entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (tx *filesTransaction) Abort() {
+	for _, lock := range tx.locks {
+		os.Remove(lock)
+	}
+	tx.locks = nil
+	if tx.packedLock != "" {
+		os.Remove(tx.packedLock)
+		tx.packedLock = ""
+	}
+}
+
+// Remove the directories left empty above path, keeping root and the directories right below it like refs/heads
+func (b *filesBackend) removeEmptyParents(path, root string) {
+	rootDir := filepath.Join(b.gitDir, filepath.FromSlash(root))
+	for dir := filepath.Dir(path); strings.HasPrefix(filepath.Dir(dir), rootDir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		// Only keep going while the directories are empty
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// Replace the packed-refs file through its lock file
+func (b *filesBackend) writePacked(refs []Ref) error {
+	lock, err := b.lockPacked(refs)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(lock, filepath.Join(b.gitDir, "packed-refs")); err != nil {
+		os.Remove(lock)
+		return err
+	}
+	return nil
+}
+
+// Lock the packed-refs file and write its new content to the lock, return the path of the lock
+func (b *filesBackend) lockPacked(refs []Ref) (string, error) {
+	lock, err := lockFile(filepath.Join(b.gitDir, "packed-refs"))
+	if err != nil {
+		return "", err
+	}
+	sortRefs(refs)
+	w := bufio.NewWriter(lock)
+	w.WriteString(packedRefsHeader)
+	for _, ref := range refs {
+		fmt.Fprintf(w, "%s %s\n", ref.Target, ref.Name)
+		if ref.Peeled != "" {
+			fmt.Fprintf(w, "^%s\n", ref.Peeled)
+		}
+	}
+	err = w.Flush()
+	if closeErr := lock.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(lock.Name())
+		return "", err
+	}
+	return lock.Name(), nil
+}
+
+func (b *filesBackend) Pack(all bool, peel PeelFunc) error {
+	refs, err := b.List("refs/")
+	if err != nil {
+		return err
+	}
+	packed, err := b.readPacked()
+	if err != nil {
+		return err
+	}
+	toPack := make([]Ref, 0, len(refs))
+	pruned := make([]string, 0)
+	for _, ref := range refs {
+		_, wasPacked := packed[ref.Name]
+		loose := !wasPacked || fileExists(b.path(ref.Name))
+		packable := !ref.IsSymbolic() && (all || strings.HasPrefix(ref.Name, "refs/tags/"))
+		if !packable {
+			if wasPacked && !ref.IsSymbolic() {
+				toPack = append(toPack, ref)
+			}
+			continue
+		}
+		if loose || ref.Peeled == "" {
+			// Peeling tells readers what an annotated tag points to without reading it
+			if peel != nil {
+				peeled, err := peel(ref.Target)
+				if err != nil {
+					return err
+				}
+				ref.Peeled = peeled
+			}
+		}
+		toPack = append(toPack, ref)
+		if loose {
+			pruned = append(pruned, ref.Name)
+		}
+	}
+	if err := b.writePacked(toPack); err != nil {
+		return err
+	}
+	// The packed copies now stand for the loose ones
+	for _, name := range pruned {
+		path := b.path(name)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		b.removeEmptyParents(path, "refs")
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// Return the path of the reflog of a ref
+func (b *filesBackend) logPath(name string) string {
+	return filepath.Join(b.gitDir, "logs", filepath.FromSlash(name))
+}
+
+func (b *filesBackend) HasLog(name string) bool {
+	return fileExists(b.logPath(name))
+}
+
+// Append an entry to the reflog of a ref, creating the reflog when core.logAllRefUpdates asks for it
+func (b *filesBackend) appendLog(name string, entry LogEntry) error {
+	path := b.logPath(name)
+	if !b.opts.createsLog(name) && !fileExists(path) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create the reflog of %s: %s", name, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to append to the reflog of %s: %s", name, err)
+	}
+	if _, err := f.WriteString(entry.String()); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to append to the reflog of %s: %s", name, err)
+	}
+	return f.Close()
+}
+
+func (b *filesBackend) ReadLog(name string) ([]LogEntry, error) {
+	content, err := os.ReadFile(b.logPath(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]LogEntry, 0)
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+		entry, err := ParseLogEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (b *filesBackend) WriteLog(name string, entries []LogEntry) error {
+	path := b.logPath(name)
+	lock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(lock)
+	for _, entry := range entries {
+		w.WriteString(entry.String())
+	}
+	err = w.Flush()
+	if closeErr := lock.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(lock.Name(), path)
+	}
+	if err != nil {
+		os.Remove(lock.Name())
+	}
+	return err
+}
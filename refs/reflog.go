@@ -0,0 +1,110 @@
+package refs
+
+import (
+	"fmt"
+	"strings"
+
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+)
+
+// One entry of a reflog: the ref moved from Old to New
+type LogEntry struct {
+	Old, New string
+	// Who moved the ref and when
+	Committer objects.Signature
+	Message   string
+}
+
+// Return the "<old> <new> <committer>\t<message>\n" line of the entry, without the tab when there is no message
+func (e LogEntry) String() string {
+	line := fmt.Sprintf("%s %s %s", e.Old, e.New, e.Committer)
+	if e.Message != "" {
+		line += "\t" + e.Message
+	}
+	return line + "\n"
+}
+
+// Parse one line of a reflog
+func ParseLogEntry(line string) (LogEntry, error) {
+	line = strings.TrimSuffix(line, "\n")
+	head, message, _ := strings.Cut(line, "\t")
+	old, rest, found := strings.Cut(head, " ")
+	if !found || !IsHash(old) {
+		return LogEntry{}, fmt.Errorf("malformed reflog entry: %q", line)
+	}
+	new, committer, found := strings.Cut(rest, " ")
+	if !found || !IsHash(new) {
+		return LogEntry{}, fmt.Errorf("malformed reflog entry: %q", line)
+	}
+	sig, err := objects.ParseSignature([]byte(committer))
+	if err != nil {
+		return LogEntry{}, fmt.Errorf("malformed reflog entry: %q", line)
+	}
+	return LogEntry{Old: old, New: new, Committer: sig, Message: message}, nil
+}
+
+// Return the message on a single line, its runs of whitespace collapsed to one space
+func normalizeLogMessage(message string) string {
+	return strings.Join(strings.Fields(message), " ")
+}
+
+// Whether a ref without a reflog gets one when updated
+// With core.logAllRefUpdates=true only the branches, remote-tracking branches, notes and HEAD do,
+// with always every ref does, with false none does and only the existing reflogs are appended to
+func (o Options) createsLog(name string) bool {
+	switch o.LogAllRefUpdates {
+	case "always":
+		return true
+	case "true":
+		if name == "HEAD" {
+			return true
+		}
+		for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/notes/"} {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Return the entries to append to the reflogs for the updates, by ref name
+// current holds the object each ref pointed to before the update, and resolve returns the object a ref points to
+func (o Options) logEntries(updates []Update, current map[string]string, resolve func(name string) string) (map[string]LogEntry, error) {
+	entries := make(map[string]LogEntry)
+	if o.Committer == nil {
+		return entries, nil
+	}
+	var committer *objects.Signature
+	for _, u := range updates {
+		if u.Verify || u.Delete || u.NoLog {
+			continue
+		}
+		if committer == nil {
+			sig, err := o.Committer()
+			if err != nil {
+				return nil, err
+			}
+			committer = &sig
+		}
+		entry := LogEntry{Old: current[u.Name], New: u.New, Committer: *committer, Message: normalizeLogMessage(u.Message)}
+		if u.NewSymbolic != "" {
+			entry.New = resolve(u.NewSymbolic)
+			// Pointing to an unborn branch moves nothing
+			if entry.New == "" && entry.Old == "" {
+				continue
+			}
+		}
+		if entry.New == "" {
+			entry.New = zeroHash(entry.Old)
+		}
+		if entry.Old == "" {
+			entry.Old = zeroHash(entry.New)
+		}
+		entries[u.Name] = entry
+		if u.logHead {
+			entries["HEAD"] = entry
+		}
+	}
+	return entries, nil
+}
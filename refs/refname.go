@@ -0,0 +1,116 @@
+package refs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Relax the rules of CheckRefFormat
+type FormatFlags int
+
+const (
+	// Allow names without any slash, like "main"
+	AllowOneLevel FormatFlags = 1 << iota
+	// Allow a single "*" as a whole component, like in "refs/heads/*"
+	RefspecPattern
+)
+
+// Check a ref name against the rules of git check-ref-format
+// https://git-scm.com/docs/git-check-ref-format
+func CheckRefFormat(name string, flags FormatFlags) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("invalid ref name '%s': %s", name, reason)
+	}
+	if name == "" {
+		return invalid("empty name")
+	}
+	if name == "@" {
+		return invalid("cannot be the single character @")
+	}
+	if strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
+		return invalid("cannot begin or end with a slash")
+	}
+	if strings.HasSuffix(name, ".") {
+		return invalid("cannot end with a dot")
+	}
+	if strings.Contains(name, "..") {
+		return invalid("cannot contain two consecutive dots")
+	}
+	if strings.Contains(name, "@{") {
+		return invalid("cannot contain the sequence @{")
+	}
+	for _, c := range []byte(name) {
+		if c < 0x20 || c == 0x7f {
+			return invalid("cannot contain control characters")
+		}
+		switch c {
+		case ' ', '~', '^', ':', '?', '[', '\\':
+			return invalid(fmt.Sprintf("cannot contain '%c'", c))
+		}
+	}
+	components := strings.Split(name, "/")
+	if len(components) < 2 && flags&AllowOneLevel == 0 {
+		return invalid("must contain at least one slash")
+	}
+	stars := 0
+	for _, component := range components {
+		switch {
+		case component == "":
+			return invalid("cannot contain consecutive slashes")
+		case strings.HasPrefix(component, "."):
+			return invalid("a component cannot begin with a dot")
+		case strings.HasSuffix(component, ".lock"):
+			return invalid("a component cannot end with .lock")
+		}
+		stars += strings.Count(component, "*")
+	}
+	if stars > 0 && (flags&RefspecPattern == 0 || stars > 1) {
+		return invalid("cannot contain '*'")
+	}
+	return nil
+}
+
+// Return the name with its consecutive slashes collapsed and its leading slash removed, like --normalize
+func NormalizeRefName(name string) string {
+	for strings.Contains(name, "//") {
+		name = strings.ReplaceAll(name, "//", "/")
+	}
+	return strings.TrimPrefix(name, "/")
+}
+
+// Whether name is HEAD or a pseudo ref like ORIG_HEAD, stored directly in the git dir
+func IsPseudoRef(name string) bool {
+	if name == "" || strings.Contains(name, "/") {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if (c < 'A' || c > 'Z') && c != '_' {
+			return false
+		}
+	}
+	return name == "HEAD" || strings.HasSuffix(name, "_HEAD")
+}
+
+// Check that a ref can be written: either a pseudo ref or a valid name under refs/
+func CheckWritableName(name string) error {
+	if IsPseudoRef(name) {
+		return nil
+	}
+	if !strings.HasPrefix(name, "refs/") {
+		return fmt.Errorf("refusing to update ref with bad name '%s'", name)
+	}
+	return CheckRefFormat(name, 0)
+}
+
+// Return the shortest unambiguous form of a full ref name: refs/heads/main is main
+func ShortName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+		if short, found := strings.CutPrefix(name, prefix); found {
+			return short
+		}
+	}
+	return name
+}
+
+// The rules DWIM applies to expand a short name, in order
+var dwimRules = []string{"%s", "refs/%s", "refs/tags/%s", "refs/heads/%s", "refs/remotes/%s", "refs/remotes/%s/HEAD"}
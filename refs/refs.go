@@ -0,0 +1,399 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+)
+
+// Symbolic refs nested deeper than this are considered a loop
+const maxSymrefDepth = 5
+
+// Returned when a ref doesn't exist
+var ErrNotFound = errors.New("ref not found")
+
+// A ref pointing either to an object or, when symbolic, to another ref
+type Ref struct {
+	Name string
+	// The object the ref points to, empty for a symbolic ref
+	Target string
+	// The ref a symbolic ref points to
+	Symbolic string
+	// The object an annotated tag peels to, when known
+	Peeled string
+}
+
+// Whether the ref points to another ref
+func (r Ref) IsSymbolic() bool {
+	return r.Symbolic != ""
+}
+
+// A change to one ref
+type Update struct {
+	Name string
+	// The object to point to, empty when deleting or writing a symbolic ref
+	New string
+	// The ref to point to for a symbolic ref
+	NewSymbolic string
+	Delete      bool
+	// Only check the old value, leaving the ref unchanged
+	Verify bool
+	// The expected current value: empty to skip the check, all zeros when the ref must not exist yet
+	Old string
+	// Why the ref changed, for the reflog
+	Message string
+	// Don't record the update in the reflogs
+	NoLog bool
+	// Whether HEAD points to the ref, its reflog records the update too
+	logHead bool
+}
+
+// Where and how the refs are stored
+type Backend interface {
+	// Read one ref without following it when symbolic
+	Read(name string) (Ref, error)
+	// Return the refs whose name starts with prefix, sorted by name, HEAD and pseudo refs excluded
+	List(prefix string) ([]Ref, error)
+	// Lock the refs of the updates and check their current values, nothing is changed before the commit
+	Prepare(updates []Update) (PreparedTransaction, error)
+	// Move the loose refs into the packed-refs file, all of them or only the tags
+	Pack(all bool, peel PeelFunc) error
+	// Return the reflog of a ref, oldest entry first
+	ReadLog(name string) ([]LogEntry, error)
+	// Replace the reflog of a ref, used to expire and delete entries
+	WriteLog(name string, entries []LogEntry) error
+	// Whether the ref has a reflog, maybe empty
+	HasLog(name string) bool
+}
+
+// Updates whose refs are locked and checked, waiting to be applied
+type PreparedTransaction interface {
+	// Apply the updates and release the locks
+	Commit() error
+	// Release the locks without changing anything
+	Abort()
+}
+
+// Return the object a tag object points to, or "" when hash isn't an annotated tag
+type PeelFunc func(hash string) (string, error)
+
+// How the refs are updated
+type Options struct {
+	// Which refs get a reflog, like core.logAllRefUpdates: "true", "always", or "false" to only append to existing reflogs
+	LogAllRefUpdates string
+	// Return who updates the refs, recorded in the reflogs, nothing is recorded when nil
+	Committer func() (objects.Signature, error)
+}
+
+// The refs of a repository
+type Store struct {
+	backend Backend
+	opts    Options
+}
+
+// Open the refs of gitDir, stored as loose files and packed-refs, or in a reftable stack with extensions.refStorage=reftable
+func Open(gitDir string, opts Options) *Store {
+	cfg, err := config.LoadFile(filepath.Join(gitDir, "config"), config.ScopeLocal)
+	if err == nil {
+		if format, _ := cfg.Get("extensions.refstorage"); format == "reftable" {
+			hashSize := 20
+			if objectFormat, _ := cfg.Get("extensions.objectformat"); objectFormat == "sha256" {
+				hashSize = 32
+			}
+			return &Store{backend: newReftableBackend(gitDir, hashSize, opts), opts: opts}
+		}
+	}
+	return &Store{backend: newFilesBackend(gitDir, opts), opts: opts}
+}
+
+// Read one ref without following it when symbolic
+func (s *Store) Read(name string) (Ref, error) {
+	return s.backend.Read(name)
+}
+
+// Return the refs whose name starts with prefix, sorted by name
+func (s *Store) List(prefix string) ([]Ref, error) {
+	return s.backend.List(prefix)
+}
+
+// Follow a ref through its symbolic refs and return the ref holding the object
+// The returned ref keeps the name of the last ref of the chain
+func (s *Store) Resolve(name string) (Ref, error) {
+	return resolve(s.backend, name)
+}
+
+// Read one ref without following it, the part of a backend needed to resolve refs
+type refReader interface {
+	Read(name string) (Ref, error)
+}
+
+func resolve(backend refReader, name string) (Ref, error) {
+	seen := make([]string, 0)
+	for depth := 0; ; depth++ {
+		ref, err := backend.Read(name)
+		if err != nil {
+			return Ref{}, err
+		}
+		if !ref.IsSymbolic() {
+			return ref, nil
+		}
+		seen = append(seen, name)
+		for _, previous := range seen {
+			if previous == ref.Symbolic {
+				return Ref{}, fmt.Errorf("symbolic ref loop: %s -> %s", strings.Join(seen, " -> "), ref.Symbolic)
+			}
+		}
+		if depth >= maxSymrefDepth {
+			return Ref{}, fmt.Errorf("symbolic refs nested too deeply: %s", strings.Join(seen, " -> "))
+		}
+		name = ref.Symbolic
+	}
+}
+
+// Return the object a ref points to, or "" when it doesn't exist
+func resolvedTarget(backend refReader, name string) string {
+	ref, err := resolve(backend, name)
+	if err != nil {
+		return ""
+	}
+	return ref.Target
+}
+
+// Return the name of the ref a symbolic ref chain ends on, even when that ref doesn't exist yet
+func (s *Store) ResolveName(name string) (string, error) {
+	seen := make([]string, 0)
+	for depth := 0; ; depth++ {
+		ref, err := s.backend.Read(name)
+		if err == ErrNotFound {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if !ref.IsSymbolic() {
+			return name, nil
+		}
+		seen = append(seen, name)
+		for _, previous := range seen {
+			if previous == ref.Symbolic {
+				return "", fmt.Errorf("symbolic ref loop: %s -> %s", strings.Join(seen, " -> "), ref.Symbolic)
+			}
+		}
+		if depth >= maxSymrefDepth {
+			return "", fmt.Errorf("symbolic refs nested too deeply: %s", strings.Join(seen, " -> "))
+		}
+		name = ref.Symbolic
+	}
+}
+
+// Expand a short name like "main" to the full name of an existing ref, using the rules of git rev-parse
+func (s *Store) Expand(short string) (string, error) {
+	for _, rule := range dwimRules {
+		name := fmt.Sprintf(rule, short)
+		if name != "HEAD" && !IsPseudoRef(name) && CheckRefFormat(name, AllowOneLevel) != nil {
+			continue
+		}
+		if !IsPseudoRef(name) && !strings.HasPrefix(name, "refs/") {
+			continue
+		}
+		if _, err := s.Resolve(name); err == nil {
+			return name, nil
+		} else if err != ErrNotFound {
+			return "", err
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Return the shortest name that still expands to the full ref name: refs/heads/main is main, unless a tag main also exists
+// and makes it heads/main
+func (s *Store) ShortenUnambiguous(name string) string {
+	// The rules are tried from the last one, "%s" is never a shorter form
+	for i := len(dwimRules) - 1; i > 0; i-- {
+		prefix, suffix, _ := strings.Cut(dwimRules[i], "%s")
+		short, found := strings.CutPrefix(name, prefix)
+		if !found || !strings.HasSuffix(short, suffix) || len(short) == len(suffix) {
+			continue
+		}
+		short = strings.TrimSuffix(short, suffix)
+		// No other rule may expand the short name to an existing ref, like git does with core.warnAmbiguousRefs
+		ambiguous := false
+		for j, rule := range dwimRules {
+			if j == i {
+				continue
+			}
+			if _, err := s.backend.Read(fmt.Sprintf(rule, short)); err == nil {
+				ambiguous = true
+				break
+			}
+		}
+		if !ambiguous {
+			return short
+		}
+	}
+	return name
+}
+
+// Apply one update, following symbolic refs first unless noDeref is set
+func (s *Store) Update(u Update, noDeref bool) error {
+	tx := s.NewTransaction()
+	if err := tx.Add(u, noDeref); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Point name to target, another ref
+func (s *Store) SetSymbolic(name, target, message string) error {
+	if !strings.HasPrefix(target, "refs/") && !IsPseudoRef(target) {
+		return fmt.Errorf("refusing to point %s outside of refs/: %s", name, target)
+	}
+	if err := CheckRefFormat(target, AllowOneLevel); err != nil {
+		return err
+	}
+	return s.Update(Update{Name: name, NewSymbolic: target, Message: message}, true)
+}
+
+// Rename a ref with its reflog, the new name must not exist unless force is set
+// HEAD follows the ref when it pointed to it, and both reflogs record the rename
+func (s *Store) Rename(oldName, newName, message string, force bool) error {
+	return s.move(oldName, newName, message, force, false)
+}
+
+// Copy a ref with its reflog, the new name must not exist unless force is set
+func (s *Store) Copy(oldName, newName, message string, force bool) error {
+	return s.move(oldName, newName, message, force, true)
+}
+
+func (s *Store) move(oldName, newName, message string, force, keep bool) error {
+	ref, err := s.backend.Read(oldName)
+	if err == ErrNotFound {
+		return fmt.Errorf("refname %s not found", oldName)
+	}
+	if err != nil {
+		return err
+	}
+	if ref.IsSymbolic() {
+		return fmt.Errorf("refname %s is a symbolic ref, renaming it is not supported", oldName)
+	}
+	entries, err := s.backend.ReadLog(oldName)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	hadLog := err == nil
+	head, _ := s.backend.Read("HEAD")
+	movesHead := !keep && head.Symbolic == oldName
+
+	tx := s.NewTransaction()
+	old := zeroHash(ref.Target)
+	if force {
+		old = ""
+	}
+	// The file of refs/heads/a stands where the directory of refs/heads/a/b goes: the old ref is deleted first, and
+	// put back when the new one can't be created
+	deleteFirst := !keep && strings.HasPrefix(newName, oldName+"/")
+	if oldName != newName {
+		if !keep {
+			if err := tx.Add(Update{Name: oldName, Delete: true, Old: ref.Target, NoLog: true}, true); err != nil {
+				return err
+			}
+		}
+		if deleteFirst {
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			tx = s.NewTransaction()
+		}
+		if err := tx.Add(Update{Name: newName, New: ref.Target, Old: old, NoLog: true}, true); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		if deleteFirst {
+			s.restore(oldName, ref.Target, entries, hadLog)
+		}
+		return err
+	}
+	if movesHead {
+		if err := s.Update(Update{Name: "HEAD", NewSymbolic: newName, NoLog: true}, true); err != nil {
+			return err
+		}
+	}
+	if s.opts.Committer == nil {
+		return nil
+	}
+	committer, err := s.opts.Committer()
+	if err != nil {
+		return err
+	}
+	entry := LogEntry{Old: ref.Target, New: ref.Target, Committer: committer, Message: normalizeLogMessage(message)}
+	if hadLog || s.opts.createsLog(newName) {
+		if err := s.backend.WriteLog(newName, append(entries, entry)); err != nil {
+			return err
+		}
+	}
+	if movesHead && s.backend.HasLog("HEAD") {
+		headEntries, err := s.backend.ReadLog("HEAD")
+		if err != nil {
+			return err
+		}
+		return s.backend.WriteLog("HEAD", append(headEntries, entry))
+	}
+	return nil
+}
+
+// Put back a ref deleted by a move that failed, with its reflog
+func (s *Store) restore(name, target string, entries []LogEntry, hadLog bool) {
+	if s.Update(Update{Name: name, New: target, Old: zeroHash(target), NoLog: true}, true) == nil && hadLog {
+		s.backend.WriteLog(name, entries)
+	}
+}
+
+// Return the reflog of a ref, oldest entry first
+func (s *Store) ReadLog(name string) ([]LogEntry, error) {
+	return s.backend.ReadLog(name)
+}
+
+// Replace the reflog of a ref
+func (s *Store) WriteLog(name string, entries []LogEntry) error {
+	return s.backend.WriteLog(name, entries)
+}
+
+// Whether the ref has a reflog
+func (s *Store) HasLog(name string) bool {
+	return s.backend.HasLog(name)
+}
+
+// Move the loose refs into the packed-refs file, all of them or only the tags
+func (s *Store) Pack(all bool, peel PeelFunc) error {
+	return s.backend.Pack(all, peel)
+}
+
+// Whether hash looks like the hex name of an object
+func IsHash(hash string) bool {
+	if len(hash) != 40 && len(hash) != 64 {
+		return false
+	}
+	for _, c := range []byte(hash) {
+		if !('0' <= c && c <= '9') && !('a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether hash is the all-zero name, meaning "no object"
+func IsZeroHash(hash string) bool {
+	return hash != "" && strings.Trim(hash, "0") == ""
+}
+
+func sortRefs(refs []Ref) {
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Name < refs[j].Name
+	})
+}
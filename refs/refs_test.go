@@ -0,0 +1,502 @@
+package refs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+)
+
+const (
+	testHash  = "bddfc7d0c478fa3738272cfbb1dbcdbca8058e71"
+	testHash2 = "48bc9ef9f98bd4bef2597cb2ab74b5ba9f49667a"
+)
+
+var TestCaseCheckRefFormat = []struct {
+	Name  string
+	Flags FormatFlags
+	Valid bool
+}{
+	{"refs/heads/main", 0, true},
+	{"refs/heads/feature/x-1", 0, true},
+	{"main", 0, false},
+	{"main", AllowOneLevel, true},
+	{"refs/heads/a..b", 0, false},
+	{"refs/heads/.hidden", 0, false},
+	{"refs/heads/main.lock", 0, false},
+	{"refs/heads/a//b", 0, false},
+	{"refs/heads/a b", 0, false},
+	{"refs/heads/a@{1}", 0, false},
+	{"refs/heads/end.", 0, false},
+	{"@", AllowOneLevel, false},
+	{"refs/heads/*", 0, false},
+	{"refs/heads/*", RefspecPattern, true},
+	{"refs/*/*", RefspecPattern, false},
+}
+
+func TestCheckRefFormat(t *testing.T) {
+	for _, tc := range TestCaseCheckRefFormat {
+		err := CheckRefFormat(tc.Name, tc.Flags)
+		if (err == nil) != tc.Valid {
+			t.Fatalf("CheckRefFormat(%q, %d): got %v, expected valid=%t", tc.Name, tc.Flags, err, tc.Valid)
+		}
+	}
+}
+
+// Return a store on an empty git directory, with HEAD pointing to main
+func newTestStore(t *testing.T) (*Store, string) {
+	gitDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(gitDir, "refs", "heads"), 0755); err != nil {
+		t.Fatalf("unable to create refs: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatalf("unable to write HEAD: %s", err)
+	}
+	return Open(gitDir, Options{}), gitDir
+}
+
+func TestUpdateThroughSymbolicRef(t *testing.T) {
+	store, _ := newTestStore(t)
+	if err := store.Update(Update{Name: "HEAD", New: testHash}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ref, err := store.Resolve("HEAD")
+	if err != nil || ref.Name != "refs/heads/main" || ref.Target != testHash {
+		t.Fatalf("unexpected HEAD: %+v, %v", ref, err)
+	}
+	if err := store.Update(Update{Name: "refs/heads/main", New: testHash2, Old: testHash2}, false); err == nil {
+		t.Fatalf("expected a stale old value to be refused")
+	}
+	zero := "0000000000000000000000000000000000000000"
+	if err := store.Update(Update{Name: "refs/heads/main", New: testHash2, Old: zero}, false); err == nil {
+		t.Fatalf("expected an existing ref to be refused")
+	}
+}
+
+func TestSymbolicRefLoop(t *testing.T) {
+	store, _ := newTestStore(t)
+	if err := store.SetSymbolic("refs/heads/main", "refs/heads/other", ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := store.SetSymbolic("refs/heads/other", "refs/heads/main", ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := store.Resolve("HEAD"); err == nil || err == ErrNotFound {
+		t.Fatalf("expected a loop error, got %v", err)
+	}
+}
+
+func TestPackRefs(t *testing.T) {
+	store, gitDir := newTestStore(t)
+	for name, hash := range map[string]string{"refs/heads/main": testHash, "refs/tags/v1": testHash2} {
+		if err := store.Update(Update{Name: name, New: hash}, true); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	peel := func(hash string) (string, error) {
+		if hash == testHash2 {
+			return testHash, nil
+		}
+		return "", nil
+	}
+	if err := store.Pack(true, peel); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content, err := os.ReadFile(filepath.Join(gitDir, "packed-refs"))
+	if err != nil {
+		t.Fatalf("unable to read packed-refs: %s", err)
+	}
+	expected := packedRefsHeader +
+		testHash + " refs/heads/main\n" +
+		testHash2 + " refs/tags/v1\n" +
+		"^" + testHash + "\n"
+	if string(content) != expected {
+		t.Fatalf("unexpected packed-refs:\n%s\nexpected:\n%s", content, expected)
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "refs", "heads", "main")); !os.IsNotExist(err) {
+		t.Fatalf("expected the loose ref to be pruned")
+	}
+
+	// A loose ref takes precedence over its packed copy
+	if err := store.Update(Update{Name: "refs/heads/main", New: testHash2, Old: testHash}, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	list, err := store.List("refs/")
+	if err != nil || len(list) != 2 || list[0].Target != testHash2 || list[1].Peeled != testHash {
+		t.Fatalf("unexpected refs: %+v, %v", list, err)
+	}
+	if err := store.Update(Update{Name: "refs/tags/v1", Delete: true}, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := store.Read("refs/tags/v1"); err != ErrNotFound {
+		t.Fatalf("expected the packed ref to be deleted, got %v", err)
+	}
+}
+
+func TestTransactionIsAtomic(t *testing.T) {
+	store, gitDir := newTestStore(t)
+	if err := store.Update(Update{Name: "refs/heads/a", New: testHash}, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The second update fails its check, so the first one must not be applied either
+	tx := store.NewTransaction()
+	if err := tx.Create("refs/heads/b", testHash, "", true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := tx.Update("refs/heads/a", testHash2, testHash2, "", true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatalf("expected the transaction to fail")
+	}
+	if _, err := store.Read("refs/heads/b"); err != ErrNotFound {
+		t.Fatalf("expected refs/heads/b not to be created, got %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(gitDir, "refs", "heads", "*.lock"))
+	if len(matches) != 0 {
+		t.Fatalf("expected the locks to be released, found %v", matches)
+	}
+
+	// A prepared transaction holds its locks until it is aborted
+	tx = store.NewTransaction()
+	if err := tx.Delete("refs/heads/a", testHash, "", true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := tx.Prepare(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := store.Update(Update{Name: "refs/heads/a", New: testHash2}, true); err == nil {
+		t.Fatalf("expected a locked ref to be refused")
+	}
+	tx.Abort()
+	if err := store.Update(Update{Name: "refs/heads/a", New: testHash2}, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+var TestCaseDirectoryConflict = []struct {
+	Description string
+	Existing    []string
+	Create      []string
+	Delete      []string
+	Conflict    bool
+}{
+	{"parent exists", []string{"refs/heads/a"}, []string{"refs/heads/a/b"}, nil, true},
+	{"child exists", []string{"refs/heads/a/b"}, []string{"refs/heads/a"}, nil, true},
+	{"both created", nil, []string{"refs/heads/a", "refs/heads/a/b"}, nil, true},
+	{"sibling", []string{"refs/heads/a"}, []string{"refs/heads/ab"}, nil, false},
+	{"child deleted", []string{"refs/heads/a/b"}, []string{"refs/heads/a"}, []string{"refs/heads/a/b"}, false},
+}
+
+func TestDirectoryConflicts(t *testing.T) {
+	for _, tc := range TestCaseDirectoryConflict {
+		t.Run(tc.Description, func(t *testing.T) {
+			store, _ := newTestStore(t)
+			for _, name := range tc.Existing {
+				if err := store.Update(Update{Name: name, New: testHash}, true); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			tx := store.NewTransaction()
+			for _, name := range tc.Delete {
+				if err := tx.Delete(name, "", "", true); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			for _, name := range tc.Create {
+				if err := tx.Create(name, testHash, "", true); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			err := tx.Commit()
+			if (err != nil) != tc.Conflict {
+				t.Fatalf("got %v, expected conflict=%t", err, tc.Conflict)
+			}
+		})
+	}
+}
+
+func TestReflog(t *testing.T) {
+	gitDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(gitDir, "refs", "heads"), 0755); err != nil {
+		t.Fatalf("unable to create refs: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatalf("unable to write HEAD: %s", err)
+	}
+	committer := objects.Signature{Name: "Valentin", Email: "valentin@example.com", When: time.Unix(946684800, 0).UTC()}
+	store := Open(gitDir, Options{
+		LogAllRefUpdates: "true",
+		Committer:        func() (objects.Signature, error) { return committer, nil },
+	})
+	if err := store.Update(Update{Name: "HEAD", New: testHash, Message: "commit (initial): first\n\nbody"}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Updated by its own name, the branch HEAD points to is still recorded in the reflog of HEAD
+	if err := store.Update(Update{Name: "refs/heads/main", New: testHash2, Message: "commit: second"}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Tags get no reflog with core.logAllRefUpdates=true
+	if err := store.Update(Update{Name: "refs/tags/v1", New: testHash}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []LogEntry{
+		{Old: "0000000000000000000000000000000000000000", New: testHash, Committer: committer, Message: "commit (initial): first body"},
+		{Old: testHash, New: testHash2, Committer: committer, Message: "commit: second"},
+	}
+	for _, name := range []string{"HEAD", "refs/heads/main"} {
+		entries, err := store.ReadLog(name)
+		if err != nil {
+			t.Fatalf("unable to read the reflog of %s: %s", name, err)
+		}
+		if len(entries) != len(expected) {
+			t.Fatalf("unexpected reflog of %s: %+v", name, entries)
+		}
+		for i, entry := range entries {
+			if entry.String() != expected[i].String() {
+				t.Fatalf("unexpected entry %d of %s, got: %q expected: %q", i, name, entry, expected[i])
+			}
+		}
+	}
+	if store.HasLog("refs/tags/v1") {
+		t.Fatalf("expected no reflog for a tag")
+	}
+	if err := store.Update(Update{Name: "refs/heads/main", Delete: true}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if store.HasLog("refs/heads/main") {
+		t.Fatalf("expected the reflog to be deleted with its ref")
+	}
+}
+
+// Renaming the branch HEAD points to moves HEAD and the reflog along
+func TestRename(t *testing.T) {
+	gitDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(gitDir, "refs", "heads"), 0755); err != nil {
+		t.Fatalf("unable to create refs: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatalf("unable to write HEAD: %s", err)
+	}
+	committer := objects.Signature{Name: "Valentin", Email: "valentin@example.com", When: time.Unix(946684800, 0).UTC()}
+	store := Open(gitDir, Options{
+		LogAllRefUpdates: "true",
+		Committer:        func() (objects.Signature, error) { return committer, nil },
+	})
+	if err := store.Update(Update{Name: "refs/heads/main", New: testHash, Message: "first"}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := store.Update(Update{Name: "refs/heads/topic", New: testHash2}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := store.Rename("refs/heads/main", "refs/heads/topic", "renamed", false); err == nil {
+		t.Fatalf("expected the rename onto an existing branch to fail")
+	}
+	if err := store.Rename("refs/heads/main", "refs/heads/trunk", "renamed", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := store.Read("refs/heads/main"); err != ErrNotFound {
+		t.Fatalf("expected refs/heads/main to be gone, got %v", err)
+	}
+	if head, _ := store.Read("HEAD"); head.Symbolic != "refs/heads/trunk" {
+		t.Fatalf("expected HEAD to follow the rename, got %+v", head)
+	}
+	entries, err := store.ReadLog("refs/heads/trunk")
+	if err != nil || len(entries) != 2 || entries[0].Message != "first" || entries[1].Message != "renamed" {
+		t.Fatalf("unexpected reflog of the renamed branch: %+v (%v)", entries, err)
+	}
+	if err := store.Copy("refs/heads/trunk", "refs/heads/topic", "copied", true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ref, _ := store.Read("refs/heads/topic"); ref.Target != testHash {
+		t.Fatalf("expected the copy to overwrite refs/heads/topic, got %+v", ref)
+	}
+	if head, _ := store.Read("HEAD"); head.Symbolic != "refs/heads/trunk" {
+		t.Fatalf("expected HEAD to stay on the original of a copy, got %+v", head)
+	}
+}
+
+// A branch can be renamed to a branch below it, its file standing where the directory goes, and back
+func TestRenameIntoDirectory(t *testing.T) {
+	gitDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(gitDir, "refs", "heads"), 0755); err != nil {
+		t.Fatalf("unable to create refs: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/a\n"), 0644); err != nil {
+		t.Fatalf("unable to write HEAD: %s", err)
+	}
+	committer := objects.Signature{Name: "Valentin", Email: "valentin@example.com", When: time.Unix(946684800, 0).UTC()}
+	store := Open(gitDir, Options{
+		LogAllRefUpdates: "true",
+		Committer:        func() (objects.Signature, error) { return committer, nil },
+	})
+	if err := store.Update(Update{Name: "refs/heads/a", New: testHash, Message: "first"}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := store.Rename("refs/heads/a", "refs/heads/a/b", "down", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ref, err := store.Read("refs/heads/a/b"); err != nil || ref.Target != testHash {
+		t.Fatalf("expected refs/heads/a/b at %s, got %+v (%v)", testHash, ref, err)
+	}
+	if head, _ := store.Read("HEAD"); head.Symbolic != "refs/heads/a/b" {
+		t.Fatalf("expected HEAD to follow the rename, got %+v", head)
+	}
+	if err := store.Rename("refs/heads/a/b", "refs/heads/a", "up", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := store.Read("refs/heads/a/b"); err != ErrNotFound {
+		t.Fatalf("expected refs/heads/a/b to be gone, got %v", err)
+	}
+	entries, err := store.ReadLog("refs/heads/a")
+	if err != nil || len(entries) != 3 || entries[0].Message != "first" || entries[1].Message != "down" || entries[2].Message != "up" {
+		t.Fatalf("unexpected reflog of the renamed branch: %+v (%v)", entries, err)
+	}
+	if head, _ := store.Read("HEAD"); head.Symbolic != "refs/heads/a" {
+		t.Fatalf("expected HEAD to follow the rename back, got %+v", head)
+	}
+}
+
+// A short name is only used when no other ref expands from it
+func TestShortenUnambiguous(t *testing.T) {
+	store := Open(t.TempDir(), Options{})
+	for _, name := range []string{"refs/heads/main", "refs/tags/main", "refs/heads/topic", "refs/remotes/origin/HEAD"} {
+		if err := store.Update(Update{Name: name, New: testHash}, true); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	for name, expected := range map[string]string{
+		"refs/heads/main":          "heads/main",
+		"refs/tags/main":           "tags/main",
+		"refs/heads/topic":         "topic",
+		"refs/remotes/origin/HEAD": "origin",
+		"HEAD":                     "HEAD",
+	} {
+		if short := store.ShortenUnambiguous(name); short != expected {
+			t.Fatalf("expected %s to shorten to %s, got %s", name, expected, short)
+		}
+	}
+}
+
+// The reftable backend behaves like the files one behind the same store
+func TestReftableBackend(t *testing.T) {
+	gitDir := t.TempDir()
+	configContent := "[core]\n\trepositoryformatversion = 1\n[extensions]\n\trefStorage = reftable\n"
+	if err := os.WriteFile(filepath.Join(gitDir, "config"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("unable to write the config: %s", err)
+	}
+	committer := objects.Signature{Name: "Valentin", Email: "valentin@example.com", When: time.Unix(946684800, 0).In(time.FixedZone("", 3600))}
+	store := Open(gitDir, Options{
+		LogAllRefUpdates: "true",
+		Committer:        func() (objects.Signature, error) { return committer, nil },
+	})
+	if _, ok := store.backend.(*reftableBackend); !ok {
+		t.Fatalf("expected the reftable backend, got %T", store.backend)
+	}
+	if err := store.SetSymbolic("HEAD", "refs/heads/main", ""); err != nil {
+		t.Fatalf("unable to point HEAD to main: %s", err)
+	}
+	if err := store.Update(Update{Name: "HEAD", New: testHash, Message: "commit (initial): first"}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tx := store.NewTransaction()
+	if err := tx.Update("refs/heads/main", testHash2, testHash, "commit: second", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := tx.Create("refs/tags/v1", testHash, "", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("unable to commit the transaction: %s", err)
+	}
+	if err := store.Update(Update{Name: "refs/heads/main", New: testHash, Old: testHash}, false); err == nil {
+		t.Fatalf("expected the update to fail on a stale old value")
+	}
+	if err := store.Update(Update{Name: "refs/heads/main/sub", New: testHash}, false); err == nil {
+		t.Fatalf("expected a directory conflict with refs/heads/main")
+	}
+	head, err := store.Resolve("HEAD")
+	if err != nil || head.Name != "refs/heads/main" || head.Target != testHash2 {
+		t.Fatalf("unexpected HEAD: %+v (%v)", head, err)
+	}
+	listed, err := store.List("refs/")
+	if err != nil || len(listed) != 2 || listed[0].Name != "refs/heads/main" || listed[1].Name != "refs/tags/v1" {
+		t.Fatalf("unexpected refs: %+v (%v)", listed, err)
+	}
+	second := LogEntry{Old: testHash, New: testHash2, Committer: committer, Message: "commit: second"}
+	entries, err := store.ReadLog("HEAD")
+	if err != nil || len(entries) != 2 || entries[1].String() != second.String() {
+		t.Fatalf("unexpected reflog of HEAD: %+v (%v)", entries, err)
+	}
+	// Expiring the oldest entry keeps the newest one in place
+	if err := store.WriteLog("HEAD", entries[1:]); err != nil {
+		t.Fatalf("unable to rewrite the reflog: %s", err)
+	}
+	if entries, err := store.ReadLog("HEAD"); err != nil || len(entries) != 1 || entries[0].New != testHash2 {
+		t.Fatalf("unexpected reflog of HEAD after the rewrite: %+v (%v)", entries, err)
+	}
+	if store.HasLog("refs/tags/v1") {
+		t.Fatalf("expected no reflog for a tag")
+	}
+	if err := store.Update(Update{Name: "refs/heads/main", Delete: true}, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if store.HasLog("refs/heads/main") {
+		t.Fatalf("expected the reflog to be deleted with its ref")
+	}
+	if err := store.Pack(true, func(hash string) (string, error) { return testHash2, nil }); err != nil {
+		t.Fatalf("unable to pack: %s", err)
+	}
+	tag, err := store.Read("refs/tags/v1")
+	if err != nil || tag.Peeled != testHash2 {
+		t.Fatalf("expected refs/tags/v1 to be peeled, got: %+v (%v)", tag, err)
+	}
+	if _, err := store.Read("refs/heads/main"); err != ErrNotFound {
+		t.Fatalf("expected refs/heads/main to be deleted, got %v", err)
+	}
+}
+
+// Test a transaction creating thousands of refs in a reftable stack: the conflicts are checked against one listing
+// of the refs, a check per ref would take minutes
+func TestReftableManyRefs(t *testing.T) {
+	gitDir := t.TempDir()
+	configContent := "[core]\n\trepositoryformatversion = 1\n[extensions]\n\trefStorage = reftable\n"
+	if err := os.WriteFile(filepath.Join(gitDir, "config"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("unable to write the config: %s", err)
+	}
+	store := Open(gitDir, Options{})
+	const count = 20000
+	tx := store.NewTransaction()
+	for i := 0; i < count; i++ {
+		if err := tx.Create(fmt.Sprintf("refs/heads/b%05d", i), testHash, "", true); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	start := time.Now()
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("unable to commit the transaction: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Fatalf("creating %d refs took %s", count, elapsed)
+	}
+	if listed, err := store.List("refs/heads/"); err != nil || len(listed) != count {
+		t.Fatalf("unexpected number of refs, got: %d (%v) expected: %d", len(listed), err, count)
+	}
+	// The conflicts are still found among them
+	if err := store.Update(Update{Name: "refs/heads/b01234/sub", New: testHash}, true); err == nil {
+		t.Fatalf("expected a directory conflict with refs/heads/b01234")
+	}
+	tx = store.NewTransaction()
+	for _, name := range []string{"refs/heads/x/y", "refs/heads/c", "refs/heads/x"} {
+		if err := tx.Create(name, testHash, "", true); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := tx.Commit(); err == nil || err.Error() != "cannot process 'refs/heads/x/y' and 'refs/heads/x' at the same time" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+package refs
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	objects "github.com/codecrafters-io/git-starter-go/objects"
+	reftable "github.com/codecrafters-io/git-starter-go/refs/reftable"
+)
+
+// Refs and reflogs stored in the tables of the reftable directory, selected by extensions.refStorage=reftable
+type reftableBackend struct {
+	dir      string
+	hashSize int
+	opts     Options
+}
+
+func newReftableBackend(gitDir string, hashSize int, opts Options) *reftableBackend {
+	return &reftableBackend{dir: filepath.Join(gitDir, "reftable"), hashSize: hashSize, opts: opts}
+}
+
+// Open the stack as it is now, the caller closes it
+func (b *reftableBackend) open() (*reftable.Stack, error) {
+	stack, err := reftable.OpenStack(b.dir, b.hashSize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the reftable stack: %s", err)
+	}
+	return stack, nil
+}
+
+func (b *reftableBackend) Read(name string) (Ref, error) {
+	stack, err := b.open()
+	if err != nil {
+		return Ref{}, err
+	}
+	defer stack.Close()
+	return stackReader{stack}.Read(name)
+}
+
+func refFromRecord(rec reftable.RefRecord) Ref {
+	return Ref{Name: rec.Name, Target: hexOrEmpty(rec.Value), Symbolic: rec.Target, Peeled: hexOrEmpty(rec.Peeled)}
+}
+
+func hexOrEmpty(b []byte) string {
+	if b == nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func (b *reftableBackend) List(prefix string) ([]Ref, error) {
+	stack, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	defer stack.Close()
+	records, err := stack.Refs(prefix)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]Ref, 0, len(records))
+	for _, rec := range records {
+		// HEAD and the pseudo refs live in the same tables, they aren't listed
+		if strings.HasPrefix(rec.Name, "refs/") {
+			refs = append(refs, refFromRecord(rec))
+		}
+	}
+	return refs, nil
+}
+
+// A transaction of the reftable backend: the stack stays locked until the new table is added
+type reftableTransaction struct {
+	stack    *reftable.Stack
+	addition *reftable.Addition
+	refs     []reftable.RefRecord
+	logs     []reftable.LogRecord
+}
+
+func (b *reftableBackend) Prepare(updates []Update) (PreparedTransaction, error) {
+	stack, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	addition, err := stack.NewAddition()
+	if err != nil {
+		stack.Close()
+		return nil, err
+	}
+	tx := &reftableTransaction{stack: stack, addition: addition}
+	if err := tx.prepare(b, updates); err != nil {
+		tx.Abort()
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (tx *reftableTransaction) prepare(b *reftableBackend, updates []Update) error {
+	updateIndex := tx.addition.UpdateIndex()
+	reader := stackReader{tx.stack}
+	resolveTarget := func(name string) string {
+		return resolvedTarget(reader, name)
+	}
+	current := make(map[string]string, len(updates))
+	for _, u := range updates {
+		ref, readErr := reader.Read(u.Name)
+		if err := checkOld(u.Name, ref, readErr, u.Old); err != nil {
+			return err
+		}
+		current[u.Name] = resolveTarget(u.Name)
+		switch {
+		case u.Verify:
+		case u.Delete:
+			if readErr == ErrNotFound {
+				continue
+			}
+			tx.refs = append(tx.refs, reftable.RefRecord{Name: u.Name, Deleted: true})
+			// The reflog goes with the ref
+			logs, err := tx.stack.Logs(u.Name)
+			if err != nil {
+				return err
+			}
+			for _, l := range logs {
+				tx.logs = append(tx.logs, reftable.LogRecord{Name: l.Name, UpdateIndex: l.UpdateIndex, Deleted: true})
+			}
+		case u.NewSymbolic != "":
+			tx.refs = append(tx.refs, reftable.RefRecord{Name: u.Name, Target: u.NewSymbolic})
+		default:
+			value, err := b.decodeHash(u.New)
+			if err != nil {
+				return err
+			}
+			tx.refs = append(tx.refs, reftable.RefRecord{Name: u.Name, Value: value})
+		}
+	}
+	entries, err := b.opts.logEntries(updates, current, resolveTarget)
+	if err != nil {
+		return err
+	}
+	for name, entry := range entries {
+		if !b.opts.createsLog(name) {
+			if logs, err := tx.stack.Logs(name); err != nil || len(logs) == 0 {
+				continue
+			}
+		}
+		rec, err := b.logRecord(name, updateIndex, entry)
+		if err != nil {
+			return err
+		}
+		tx.logs = append(tx.logs, rec)
+	}
+	return nil
+}
+
+func (tx *reftableTransaction) Commit() error {
+	defer tx.stack.Close()
+	return tx.addition.Commit(tx.refs, tx.logs)
+}
+
+func (tx *reftableTransaction) Abort() {
+	tx.addition.Abort()
+	tx.stack.Close()
+}
+
+// The refs of a stack already open
+type stackReader struct {
+	stack *reftable.Stack
+}
+
+func (r stackReader) Read(name string) (Ref, error) {
+	rec, found, err := r.stack.ReadRef(name)
+	if err != nil {
+		return Ref{}, err
+	}
+	if !found {
+		return Ref{}, ErrNotFound
+	}
+	return refFromRecord(rec), nil
+}
+
+// Return the binary form of a hex object name
+func (b *reftableBackend) decodeHash(hash string) ([]byte, error) {
+	value, err := hex.DecodeString(hash)
+	if err != nil || len(value) != b.hashSize {
+		return nil, fmt.Errorf("invalid object name %q", hash)
+	}
+	return value, nil
+}
+
+func (b *reftableBackend) logRecord(name string, updateIndex uint64, entry LogEntry) (reftable.LogRecord, error) {
+	old, err := b.decodeHash(entry.Old)
+	if err != nil {
+		return reftable.LogRecord{}, err
+	}
+	new, err := b.decodeHash(entry.New)
+	if err != nil {
+		return reftable.LogRecord{}, err
+	}
+	_, offset := entry.Committer.When.Zone()
+	return reftable.LogRecord{
+		Name:           name,
+		UpdateIndex:    updateIndex,
+		Old:            old,
+		New:            new,
+		CommitterName:  entry.Committer.Name,
+		CommitterEmail: entry.Committer.Email,
+		Time:           uint64(entry.Committer.When.Unix()),
+		TZOffset:       int16(offset / 60),
+		Message:        entry.Message,
+	}, nil
+}
+
+func logEntryFromRecord(rec reftable.LogRecord) LogEntry {
+	zone := time.FixedZone("", int(rec.TZOffset)*60)
+	return LogEntry{
+		Old: hex.EncodeToString(rec.Old),
+		New: hex.EncodeToString(rec.New),
+		Committer: objects.Signature{
+			Name:  rec.CommitterName,
+			Email: rec.CommitterEmail,
+			When:  time.Unix(int64(rec.Time), 0).In(zone),
+		},
+		Message: rec.Message,
+	}
+}
+
+// Record the peeled value of the annotated tags, then merge every table into one
+// There are no loose refs in a reftable, every ref is packed whatever all says
+func (b *reftableBackend) Pack(all bool, peel PeelFunc) error {
+	stack, err := b.open()
+	if err != nil {
+		return err
+	}
+	defer stack.Close()
+	if peel != nil {
+		addition, err := stack.NewAddition()
+		if err != nil {
+			return err
+		}
+		records, err := stack.Refs("refs/")
+		if err != nil {
+			addition.Abort()
+			return err
+		}
+		peeled := make([]reftable.RefRecord, 0)
+		for _, rec := range records {
+			if rec.Value == nil || rec.Peeled != nil {
+				continue
+			}
+			target, err := peel(hex.EncodeToString(rec.Value))
+			if err != nil {
+				addition.Abort()
+				return err
+			}
+			if target == "" {
+				continue
+			}
+			if rec.Peeled, err = b.decodeHash(target); err != nil {
+				addition.Abort()
+				return err
+			}
+			peeled = append(peeled, rec)
+		}
+		if err := addition.Commit(peeled, nil); err != nil {
+			return err
+		}
+	}
+	return stack.Compact()
+}
+
+func (b *reftableBackend) ReadLog(name string) ([]LogEntry, error) {
+	stack, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	defer stack.Close()
+	records, err := stack.Logs(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	entries := make([]LogEntry, 0, len(records))
+	for _, rec := range records {
+		entries = append(entries, logEntryFromRecord(rec))
+	}
+	return entries, nil
+}
+
+// Replace the reflog: the entries kept take the update indices of the newest existing entries, and the oldest ones are
+// deleted, so that the entries stay in order
+func (b *reftableBackend) WriteLog(name string, entries []LogEntry) error {
+	stack, err := b.open()
+	if err != nil {
+		return err
+	}
+	defer stack.Close()
+	addition, err := stack.NewAddition()
+	if err != nil {
+		return err
+	}
+	existing, err := stack.Logs(name)
+	if err != nil {
+		addition.Abort()
+		return err
+	}
+	indices := make([]uint64, 0, len(existing)+len(entries))
+	for _, l := range existing {
+		indices = append(indices, l.UpdateIndex)
+	}
+	for next := addition.UpdateIndex(); len(indices) < len(entries); next++ {
+		indices = append(indices, next)
+	}
+	records := make([]reftable.LogRecord, 0, len(indices))
+	deleted := len(indices) - len(entries)
+	for _, index := range indices[:deleted] {
+		records = append(records, reftable.LogRecord{Name: name, UpdateIndex: index, Deleted: true})
+	}
+	for i, entry := range entries {
+		rec, err := b.logRecord(name, indices[deleted+i], entry)
+		if err != nil {
+			addition.Abort()
+			return err
+		}
+		records = append(records, rec)
+	}
+	return addition.Commit(nil, records)
+}
+
+func (b *reftableBackend) HasLog(name string) bool {
+	entries, err := b.ReadLog(name)
+	return err == nil && len(entries) > 0
+}
@@ -0,0 +1,225 @@
+package reftable
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The types of the blocks
+const (
+	blockRef   = 'r'
+	blockIndex = 'i'
+	blockObj   = 'o'
+	blockLog   = 'g'
+)
+
+// A restart point every this many records, their key is stored whole to allow binary searches
+const restartInterval = 16
+
+// One record of a block, its key and the value of the section
+type record struct {
+	key []byte
+	ref RefRecord
+	log LogRecord
+	// The position of the block an index record points to
+	child uint64
+}
+
+// Build one block: "<type> <uint24 length>", records whose key shares a prefix with the previous one,
+// the uint24 offsets of the restart points and their uint16 count
+type blockWriter struct {
+	typ byte
+	// The bytes of the block, preceded by the file header in the first block of a table
+	buf []byte
+	// Where the block header starts in buf
+	headerOff int
+	blockSize int
+	lastKey   []byte
+	restarts  []uint32
+	entries   int
+}
+
+func newBlockWriter(typ byte, header []byte, blockSize int) *blockWriter {
+	buf := append([]byte{}, header...)
+	buf = append(buf, typ, 0, 0, 0)
+	return &blockWriter{typ: typ, buf: buf, headerOff: len(header), blockSize: blockSize}
+}
+
+// Append a record, return false when it doesn't fit in the block anymore
+func (w *blockWriter) add(key []byte, valueType byte, value []byte) bool {
+	restart := w.entries%restartInterval == 0
+	prefix := 0
+	if !restart {
+		for prefix < len(key) && prefix < len(w.lastKey) && key[prefix] == w.lastKey[prefix] {
+			prefix++
+		}
+	}
+	rec := putVarint(nil, uint64(prefix))
+	rec = putVarint(rec, uint64(len(key)-prefix)<<3|uint64(valueType))
+	rec = append(rec, key[prefix:]...)
+	rec = append(rec, value...)
+	restarts := len(w.restarts)
+	if restart {
+		restarts++
+	}
+	// Log blocks are bounded by their inflated size, they take less space once compressed
+	if w.entries > 0 && len(w.buf)+len(rec)+3*restarts+2 > w.blockSize {
+		return false
+	}
+	if restart {
+		w.restarts = append(w.restarts, uint32(len(w.buf)))
+	}
+	w.buf = append(w.buf, rec...)
+	w.lastKey = append(w.lastKey[:0], key...)
+	w.entries++
+	return true
+}
+
+// Return the finished block, log blocks compressed with zw, reset for each block
+func (w *blockWriter) finish(zw *zlib.Writer) ([]byte, error) {
+	for _, restart := range w.restarts {
+		w.buf = putUint24(w.buf, restart)
+	}
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(len(w.restarts)))
+	length := len(w.buf)
+	if length >= 1<<24 {
+		return nil, fmt.Errorf("reftable block too large: %d bytes", length)
+	}
+	copy(w.buf[w.headerOff+1:], putUint24(nil, uint32(length)))
+	if w.typ == blockLog {
+		var compressed bytes.Buffer
+		compressed.Write(w.buf[:w.headerOff+4])
+		zw.Reset(&compressed)
+		if _, err := zw.Write(w.buf[w.headerOff+4:]); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return compressed.Bytes(), nil
+	}
+	return w.buf, nil
+}
+
+// A block read from a table
+type block struct {
+	typ     byte
+	records []record
+	// Where the next block starts, after the padding of a padded block
+	next uint64
+}
+
+// Read the block starting at pos, headerOff bytes after the start of the block for the first one of the table
+func (t *Table) readBlock(pos uint64, headerOff int) (*block, error) {
+	head := make([]byte, headerOff+4)
+	if _, err := t.f.ReadAt(head, int64(pos)); err != nil {
+		return nil, fmt.Errorf("%w: truncated block at %d", errCorrupt, pos)
+	}
+	typ := head[headerOff]
+	length := int(getUint24(head[headerOff+1:]))
+	if length < headerOff+4+2 {
+		return nil, fmt.Errorf("%w: block at %d too short", errCorrupt, pos)
+	}
+	data := make([]byte, length)
+	next := pos
+	switch typ {
+	case blockLog:
+		copy(data, head)
+		section := io.NewSectionReader(t.f, int64(pos)+int64(len(head)), t.size-int64(pos)-int64(len(head)))
+		buffered := bufio.NewReader(section)
+		zr, err := zlib.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("%w: log block at %d: %s", errCorrupt, pos, err)
+		}
+		if _, err := io.ReadFull(zr, data[len(head):]); err != nil {
+			return nil, fmt.Errorf("%w: log block at %d: %s", errCorrupt, pos, err)
+		}
+		// Read to the end of the stream to check its checksum
+		if extra, err := io.Copy(io.Discard, zr); err != nil || extra != 0 {
+			return nil, fmt.Errorf("%w: log block at %d has a wrong length", errCorrupt, pos)
+		}
+		consumed, _ := section.Seek(0, io.SeekCurrent)
+		next += uint64(len(head)) + uint64(consumed) - uint64(buffered.Buffered())
+	case blockRef, blockIndex, blockObj:
+		if _, err := t.f.ReadAt(data, int64(pos)); err != nil {
+			return nil, fmt.Errorf("%w: truncated block at %d", errCorrupt, pos)
+		}
+		next += uint64(length)
+		// A shorter block is either padded with zeros to the block size or directly followed by the next one
+		if full := pos + uint64(t.blockSize); length < int(t.blockSize) && full <= t.footerPos && t.isPadding(next, full) {
+			next = full
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown block type %q at %d", errCorrupt, typ, pos)
+	}
+	b := &block{typ: typ, next: next}
+	if typ == blockObj {
+		return b, nil
+	}
+	records, err := t.decodeRecords(typ, data, headerOff)
+	if err != nil {
+		return nil, fmt.Errorf("%w (block at %d)", err, pos)
+	}
+	b.records = records
+	return b, nil
+}
+
+// Whether the block ending at from is padded up to to: the next block would start with its non-zero type
+func (t *Table) isPadding(from, to uint64) bool {
+	if from >= to {
+		return false
+	}
+	c := make([]byte, 1)
+	_, err := t.f.ReadAt(c, int64(from))
+	return err == nil && c[0] == 0
+}
+
+// Decode the records of a block, data holding the whole block
+func (t *Table) decodeRecords(typ byte, data []byte, headerOff int) ([]record, error) {
+	restartCount := int(binary.BigEndian.Uint16(data[len(data)-2:]))
+	end := len(data) - 2 - 3*restartCount
+	if end < headerOff+4 {
+		return nil, errCorrupt
+	}
+	records := make([]record, 0)
+	var lastKey []byte
+	for pos := headerOff + 4; pos < end; {
+		prefix, n, err := getVarint(data[pos:end])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		suffixType, n, err := getVarint(data[pos:end])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		suffix := int(suffixType >> 3)
+		valueType := byte(suffixType & 0x7)
+		if int(prefix) > len(lastKey) || pos+suffix > end {
+			return nil, errCorrupt
+		}
+		key := append(append([]byte{}, lastKey[:prefix]...), data[pos:pos+suffix]...)
+		pos += suffix
+		rec := record{key: key}
+		switch typ {
+		case blockRef:
+			rec.ref, n, err = decodeRefValue(string(key), valueType, data[pos:end], t.minUpdateIndex, t.hashSize)
+		case blockLog:
+			rec.log, n, err = decodeLogRecord(key, valueType, data[pos:end], t.hashSize)
+		case blockIndex:
+			rec.child, n, err = getVarint(data[pos:end])
+		}
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		records = append(records, rec)
+		lastKey = key
+	}
+	return records, nil
+}
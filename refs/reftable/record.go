@@ -0,0 +1,248 @@
+// Package reftable reads and writes the reftable format: refs and reflogs stored in sorted, block-based tables,
+// stacked from the oldest to the newest and compacted from time to time
+// https://git-scm.com/docs/reftable
+package reftable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The value types of the ref records
+const (
+	refDeletion = 0x0
+	refHash     = 0x1
+	refPeeled   = 0x2
+	refSymbolic = 0x3
+)
+
+// The value types of the log records
+const (
+	logDeletion = 0x0
+	logUpdate   = 0x1
+)
+
+// Returned when a table doesn't follow the format
+var errCorrupt = errors.New("corrupt reftable")
+
+// A ref of a table: a hash, a hash and its peeled value, a symbolic ref or a deletion
+type RefRecord struct {
+	Name        string
+	UpdateIndex uint64
+	// The object the ref points to, nil for a symbolic ref or a deletion
+	Value []byte
+	// The object an annotated tag peels to
+	Peeled []byte
+	// The ref a symbolic ref points to
+	Target string
+	// Whether the record hides the ref from the older tables
+	Deleted bool
+}
+
+func (r RefRecord) valueType() byte {
+	switch {
+	case r.Deleted:
+		return refDeletion
+	case r.Target != "":
+		return refSymbolic
+	case r.Peeled != nil:
+		return refPeeled
+	}
+	return refHash
+}
+
+// Return the encoded value of the record: the update index relative to minUpdateIndex, then the value
+func (r RefRecord) encodeValue(minUpdateIndex uint64) []byte {
+	b := putVarint(nil, r.UpdateIndex-minUpdateIndex)
+	switch r.valueType() {
+	case refHash:
+		b = append(b, r.Value...)
+	case refPeeled:
+		b = append(b, r.Value...)
+		b = append(b, r.Peeled...)
+	case refSymbolic:
+		b = putVarint(b, uint64(len(r.Target)))
+		b = append(b, r.Target...)
+	}
+	return b
+}
+
+func decodeRefValue(name string, valueType byte, b []byte, minUpdateIndex uint64, hashSize int) (RefRecord, int, error) {
+	delta, n, err := getVarint(b)
+	if err != nil {
+		return RefRecord{}, 0, err
+	}
+	r := RefRecord{Name: name, UpdateIndex: minUpdateIndex + delta}
+	switch valueType {
+	case refDeletion:
+		r.Deleted = true
+	case refHash:
+		if len(b) < n+hashSize {
+			return RefRecord{}, 0, errCorrupt
+		}
+		r.Value = append([]byte{}, b[n:n+hashSize]...)
+		n += hashSize
+	case refPeeled:
+		if len(b) < n+2*hashSize {
+			return RefRecord{}, 0, errCorrupt
+		}
+		r.Value = append([]byte{}, b[n:n+hashSize]...)
+		r.Peeled = append([]byte{}, b[n+hashSize:n+2*hashSize]...)
+		n += 2 * hashSize
+	case refSymbolic:
+		length, m, err := getVarint(b[n:])
+		if err != nil || uint64(len(b)) < uint64(n+m)+length {
+			return RefRecord{}, 0, errCorrupt
+		}
+		n += m
+		r.Target = string(b[n : n+int(length)])
+		n += int(length)
+	default:
+		return RefRecord{}, 0, fmt.Errorf("%w: unknown ref value type %d", errCorrupt, valueType)
+	}
+	return r, n, nil
+}
+
+// An entry of a reflog, or its deletion
+type LogRecord struct {
+	Name        string
+	UpdateIndex uint64
+	Deleted     bool
+	Old, New    []byte
+	// Who moved the ref, when, and in which timezone, in minutes east of UTC
+	CommitterName, CommitterEmail string
+	Time                          uint64
+	TZOffset                      int16
+	// The message, without its trailing newline
+	Message string
+}
+
+// Return the key of the record: the ref name, a NUL byte, then the update index reversed so that the newest entry comes first
+func (l LogRecord) key() []byte {
+	key := append([]byte(l.Name), 0)
+	return binary.BigEndian.AppendUint64(key, ^l.UpdateIndex)
+}
+
+func (l LogRecord) valueType() byte {
+	if l.Deleted {
+		return logDeletion
+	}
+	return logUpdate
+}
+
+func (l LogRecord) encodeValue() []byte {
+	if l.Deleted {
+		return nil
+	}
+	b := append([]byte{}, l.Old...)
+	b = append(b, l.New...)
+	b = putVarint(b, uint64(len(l.CommitterName)))
+	b = append(b, l.CommitterName...)
+	b = putVarint(b, uint64(len(l.CommitterEmail)))
+	b = append(b, l.CommitterEmail...)
+	b = putVarint(b, l.Time)
+	b = binary.BigEndian.AppendUint16(b, uint16(l.TZOffset))
+	// The messages are stored with a trailing newline like in the files of the logs directory
+	message := l.Message + "\n"
+	b = putVarint(b, uint64(len(message)))
+	return append(b, message...)
+}
+
+func decodeLogRecord(key []byte, valueType byte, b []byte, hashSize int) (LogRecord, int, error) {
+	if len(key) < 9 || key[len(key)-9] != 0 {
+		return LogRecord{}, 0, fmt.Errorf("%w: malformed log key", errCorrupt)
+	}
+	l := LogRecord{
+		Name:        string(key[:len(key)-9]),
+		UpdateIndex: ^binary.BigEndian.Uint64(key[len(key)-8:]),
+	}
+	switch valueType {
+	case logDeletion:
+		l.Deleted = true
+		return l, 0, nil
+	case logUpdate:
+	default:
+		return LogRecord{}, 0, fmt.Errorf("%w: unknown log value type %d", errCorrupt, valueType)
+	}
+	if len(b) < 2*hashSize {
+		return LogRecord{}, 0, errCorrupt
+	}
+	l.Old = append([]byte{}, b[:hashSize]...)
+	l.New = append([]byte{}, b[hashSize:2*hashSize]...)
+	n := 2 * hashSize
+	readString := func() (string, error) {
+		length, m, err := getVarint(b[n:])
+		if err != nil || uint64(len(b)) < uint64(n+m)+length {
+			return "", errCorrupt
+		}
+		s := string(b[n+m : n+m+int(length)])
+		n += m + int(length)
+		return s, nil
+	}
+	var err error
+	if l.CommitterName, err = readString(); err != nil {
+		return LogRecord{}, 0, err
+	}
+	if l.CommitterEmail, err = readString(); err != nil {
+		return LogRecord{}, 0, err
+	}
+	t, m, err := getVarint(b[n:])
+	if err != nil || len(b) < n+m+2 {
+		return LogRecord{}, 0, errCorrupt
+	}
+	l.Time = t
+	n += m
+	l.TZOffset = int16(binary.BigEndian.Uint16(b[n:]))
+	n += 2
+	message, err := readString()
+	if err != nil {
+		return LogRecord{}, 0, err
+	}
+	if len(message) > 0 && message[len(message)-1] == '\n' {
+		message = message[:len(message)-1]
+	}
+	l.Message = message
+	return l, n, nil
+}
+
+// Append the varint encoding of val: 7 bits per byte, most significant first, each continuation byte holding val-1
+// so that every value has a single encoding
+func putVarint(b []byte, val uint64) []byte {
+	var buf [10]byte
+	pos := len(buf) - 1
+	buf[pos] = byte(val & 0x7f)
+	for val >>= 7; val != 0; val >>= 7 {
+		val--
+		pos--
+		buf[pos] = 0x80 | byte(val&0x7f)
+	}
+	return append(b, buf[pos:]...)
+}
+
+// Decode a varint, return its value and its length
+func getVarint(b []byte) (uint64, int, error) {
+	if len(b) == 0 {
+		return 0, 0, errCorrupt
+	}
+	c := b[0]
+	val := uint64(c & 0x7f)
+	n := 1
+	for c&0x80 != 0 {
+		if n >= len(b) || n >= 10 {
+			return 0, 0, errCorrupt
+		}
+		c = b[n]
+		n++
+		val = ((val + 1) << 7) | uint64(c&0x7f)
+	}
+	return val, n, nil
+}
+
+func putUint24(b []byte, val uint32) []byte {
+	return append(b, byte(val>>16), byte(val>>8), byte(val))
+}
+
+func getUint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
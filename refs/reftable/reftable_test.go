@@ -0,0 +1,161 @@
+package reftable
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testHash(i int) []byte {
+	return bytes.Repeat([]byte{byte(i), byte(i >> 8)}, 10)
+}
+
+func TestVarint(t *testing.T) {
+	for _, val := range []uint64{0, 1, 127, 128, 255, 16383, 16384, 1 << 32, 1<<64 - 1} {
+		b := putVarint(nil, val)
+		got, n, err := getVarint(b)
+		if err != nil || got != val || n != len(b) {
+			t.Fatalf("varint %d: got %d (%d bytes, %v) from %x", val, got, n, err, b)
+		}
+	}
+	// Each continuation byte holds the value minus one, 128 takes 0x80 0x00 and not 0x81 0x00
+	if b := putVarint(nil, 128); !bytes.Equal(b, []byte{0x80, 0x00}) {
+		t.Fatalf("unexpected encoding of 128: %x", b)
+	}
+}
+
+// Write a table of many refs and logs in small blocks, which needs a multi-level index, and read it back
+func TestTableRoundTrip(t *testing.T) {
+	refs := make([]RefRecord, 0)
+	logs := make([]LogRecord, 0)
+	for i := 0; i < 3000; i++ {
+		name := fmt.Sprintf("refs/heads/branch-%05d", i)
+		ref := RefRecord{Name: name, UpdateIndex: 7, Value: testHash(i)}
+		switch i % 3 {
+		case 1:
+			ref.Peeled = testHash(i + 1)
+		case 2:
+			ref = RefRecord{Name: name, UpdateIndex: 7, Target: "refs/heads/main"}
+		}
+		refs = append(refs, ref)
+		logs = append(logs, LogRecord{
+			Name: name, UpdateIndex: 7, Old: testHash(0), New: testHash(i),
+			CommitterName: "Valentin", CommitterEmail: "valentin@example.com", Time: 946684800, TZOffset: -90,
+			Message: fmt.Sprintf("branch: Created from %d", i),
+		})
+	}
+	content, err := encodeTable(20, 256, 7, 7, refs, logs)
+	if err != nil {
+		t.Fatalf("unable to encode the table: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "table.ref")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("unable to write the table: %s", err)
+	}
+	table, err := OpenTable(path)
+	if err != nil {
+		t.Fatalf("unable to open the table: %s", err)
+	}
+	defer table.Close()
+	if table.refIndexPos == 0 || table.logIndexPos == 0 {
+		t.Fatalf("expected indexes, got ref index at %d and log index at %d", table.refIndexPos, table.logIndexPos)
+	}
+	for _, i := range []int{0, 1, 2, 1500, 2999} {
+		it, err := table.seek(blockRef, []byte(refs[i].Name))
+		if err != nil {
+			t.Fatalf("unable to seek %s: %s", refs[i].Name, err)
+		}
+		rec, found, err := it.next()
+		if err != nil || !found || fmt.Sprint(rec.ref) != fmt.Sprint(refs[i]) {
+			t.Fatalf("seek %s, got: %+v (%v), expected: %+v", refs[i].Name, rec.ref, err, refs[i])
+		}
+		it, err = table.seek(blockLog, append([]byte(logs[i].Name), 0))
+		if err != nil {
+			t.Fatalf("unable to seek the log of %s: %s", logs[i].Name, err)
+		}
+		rec, found, err = it.next()
+		if err != nil || !found || fmt.Sprint(rec.log) != fmt.Sprint(logs[i]) {
+			t.Fatalf("seek the log of %s, got: %+v (%v), expected: %+v", logs[i].Name, rec.log, err, logs[i])
+		}
+	}
+	count := 0
+	if err := table.scan(blockRef, []byte("refs/heads/branch-01"), func(record) { count++ }); err != nil {
+		t.Fatalf("unable to scan: %s", err)
+	}
+	if count != 1000 {
+		t.Fatalf("expected 1000 refs under refs/heads/branch-01, got %d", count)
+	}
+	it, err := table.seek(blockRef, []byte("refs/tags/"))
+	if err != nil {
+		t.Fatalf("unable to seek past the last ref: %s", err)
+	}
+	if _, found, _ := it.next(); found {
+		t.Fatalf("expected no ref after the last one")
+	}
+}
+
+func TestStack(t *testing.T) {
+	dir := t.TempDir()
+	stack, err := OpenStack(dir, 20)
+	if err != nil {
+		t.Fatalf("unable to open the stack: %s", err)
+	}
+	defer stack.Close()
+	add := func(refs []RefRecord, logs []LogRecord) {
+		t.Helper()
+		a, err := stack.NewAddition()
+		if err != nil {
+			t.Fatalf("unable to lock the stack: %s", err)
+		}
+		if err := a.Commit(refs, logs); err != nil {
+			t.Fatalf("unable to add a table: %s", err)
+		}
+	}
+	for i := 0; i < 64; i++ {
+		add([]RefRecord{{Name: fmt.Sprintf("refs/tags/v%d", i), Value: testHash(i)}}, nil)
+	}
+	// Compacted on the way, the stack stays short
+	if len(stack.tables) > 7 {
+		t.Fatalf("expected the stack to be compacted, got %d tables", len(stack.tables))
+	}
+	if stack.NextUpdateIndex() != 65 {
+		t.Fatalf("expected the next update index to be 65, got %d", stack.NextUpdateIndex())
+	}
+	add([]RefRecord{{Name: "refs/tags/v3", Deleted: true}}, []LogRecord{{Name: "HEAD", UpdateIndex: 65, Old: testHash(0), New: testHash(1)}})
+	if _, found, err := stack.ReadRef("refs/tags/v3"); found || err != nil {
+		t.Fatalf("expected refs/tags/v3 to be deleted, got found=%t err=%v", found, err)
+	}
+	if rec, found, _ := stack.ReadRef("refs/tags/v4"); !found || !bytes.Equal(rec.Value, testHash(4)) || rec.UpdateIndex != 5 {
+		t.Fatalf("unexpected refs/tags/v4: %+v", rec)
+	}
+	refs, err := stack.Refs("refs/tags/")
+	if err != nil || len(refs) != 63 {
+		t.Fatalf("expected 63 tags, got %d (%v)", len(refs), err)
+	}
+	if err := stack.Compact(); err != nil {
+		t.Fatalf("unable to compact: %s", err)
+	}
+	if len(stack.tables) != 1 {
+		t.Fatalf("expected a single table, got %d", len(stack.tables))
+	}
+	// The deletions are gone once nothing older is left to hide
+	deletions := 0
+	stack.tables[0].scan(blockRef, nil, func(rec record) {
+		if rec.ref.Deleted {
+			deletions++
+		}
+	})
+	if deletions != 0 {
+		t.Fatalf("expected no deletion in the compacted table, got %d", deletions)
+	}
+	logs, err := stack.Logs("HEAD")
+	if err != nil || len(logs) != 1 || logs[0].UpdateIndex != 65 {
+		t.Fatalf("unexpected logs of HEAD: %+v (%v)", logs, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("expected tables.list and one table, got %d files", len(entries))
+	}
+}
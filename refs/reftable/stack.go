@@ -0,0 +1,397 @@
+package reftable
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The tables of a stack, oldest first, are listed one per line in this file of the stack directory
+const tablesList = "tables.list"
+
+// Tries to read the stack again when a table disappeared, compacted by another process in the meantime
+const reloadRetries = 5
+
+// The tables of a reftable directory: a record of a newer table hides the records of the older ones with the same key
+type Stack struct {
+	dir       string
+	hashSize  int
+	blockSize int
+	names     []string
+	tables    []*Table
+}
+
+// Open the stack of dir, holding hashes of hashSize bytes
+func OpenStack(dir string, hashSize int) (*Stack, error) {
+	s := &Stack{dir: dir, hashSize: hashSize, blockSize: DefaultBlockSize}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close the tables of the stack
+func (s *Stack) Close() {
+	for _, t := range s.tables {
+		t.Close()
+	}
+	s.tables, s.names = nil, nil
+}
+
+// Read tables.list again and open its tables
+func (s *Stack) reload() error {
+	var err error
+	for try := 0; try < reloadRetries; try++ {
+		var names []string
+		if names, err = s.readList(); err != nil {
+			return err
+		}
+		tables := make([]*Table, 0, len(names))
+		for _, name := range names {
+			var t *Table
+			if t, err = OpenTable(filepath.Join(s.dir, name)); err != nil {
+				break
+			}
+			tables = append(tables, t)
+		}
+		if err == nil {
+			s.Close()
+			s.names, s.tables = names, tables
+			return nil
+		}
+		for _, t := range tables {
+			t.Close()
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *Stack) readList() ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(s.dir, tablesList))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %s", tablesList, err)
+	}
+	return strings.Fields(string(content)), nil
+}
+
+// Return the update index the next table gets
+func (s *Stack) NextUpdateIndex() uint64 {
+	if len(s.tables) == 0 {
+		return 1
+	}
+	_, max := s.tables[len(s.tables)-1].UpdateIndices()
+	return max + 1
+}
+
+// Return the ref named name, false when it doesn't exist or was deleted
+func (s *Stack) ReadRef(name string) (RefRecord, bool, error) {
+	for i := len(s.tables) - 1; i >= 0; i-- {
+		it, err := s.tables[i].seek(blockRef, []byte(name))
+		if err != nil {
+			return RefRecord{}, false, err
+		}
+		rec, found, err := it.next()
+		if err != nil {
+			return RefRecord{}, false, err
+		}
+		if found && rec.ref.Name == name {
+			return rec.ref, !rec.ref.Deleted, nil
+		}
+	}
+	return RefRecord{}, false, nil
+}
+
+// Return the refs whose name starts with prefix, sorted by name
+func (s *Stack) Refs(prefix string) ([]RefRecord, error) {
+	return s.mergeRefs(s.tables, prefix, true)
+}
+
+// Return the reflog of a ref, oldest entry first
+func (s *Stack) Logs(name string) ([]LogRecord, error) {
+	return s.mergeLogs(s.tables, name+"\x00", true)
+}
+
+// Return the records of the tables whose key starts with prefix, those of the newer tables hiding those of the older ones,
+// dropping the deletions when dropDeletions is set
+func (s *Stack) mergeRefs(tables []*Table, prefix string, dropDeletions bool) ([]RefRecord, error) {
+	byName := make(map[string]RefRecord)
+	for _, t := range tables {
+		err := t.scan(blockRef, []byte(prefix), func(rec record) {
+			byName[rec.ref.Name] = rec.ref
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	refs := make([]RefRecord, 0, len(byName))
+	for _, ref := range byName {
+		if !ref.Deleted || !dropDeletions {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+func (s *Stack) mergeLogs(tables []*Table, prefix string, dropDeletions bool) ([]LogRecord, error) {
+	byKey := make(map[string]LogRecord)
+	for _, t := range tables {
+		err := t.scan(blockLog, []byte(prefix), func(rec record) {
+			byKey[string(rec.key)] = rec.log
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	logs := make([]LogRecord, 0, len(byKey))
+	for _, log := range byKey {
+		if !log.Deleted || !dropDeletions {
+			logs = append(logs, log)
+		}
+	}
+	// By name, then oldest first
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].Name != logs[j].Name {
+			return logs[i].Name < logs[j].Name
+		}
+		return logs[i].UpdateIndex < logs[j].UpdateIndex
+	})
+	return logs, nil
+}
+
+// Call fn on every record of a section whose key starts with prefix
+func (t *Table) scan(typ byte, prefix []byte, fn func(record)) error {
+	it, err := t.seek(typ, prefix)
+	if err != nil {
+		return err
+	}
+	for {
+		rec, found, err := it.next()
+		if err != nil {
+			return err
+		}
+		if !found || !bytes.HasPrefix(rec.key, prefix) {
+			return nil
+		}
+		fn(rec)
+	}
+}
+
+// A table being added to the stack, tables.list is locked until it is committed or aborted
+type Addition struct {
+	s    *Stack
+	lock *os.File
+}
+
+// Lock the stack and read it again to see the changes of the other processes
+func (s *Stack) NewAddition() (*Addition, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.dir, tablesList)
+	lock, err := os.OpenFile(path+".lock", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("Unable to create '%s.lock': File exists.\n\n"+
+			"Another git process seems to be running in this repository, or a git process crashed earlier:\n"+
+			"remove the file manually to continue", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create '%s.lock': %s", path, err)
+	}
+	if err := s.reload(); err != nil {
+		lock.Close()
+		os.Remove(lock.Name())
+		return nil, err
+	}
+	return &Addition{s: s, lock: lock}, nil
+}
+
+// Return the update index of the table added
+func (a *Addition) UpdateIndex() uint64 {
+	return a.s.NextUpdateIndex()
+}
+
+// Write the refs and logs as a new table on top of the stack, compact the stack when it is out of balance
+// and release the lock
+func (a *Addition) Commit(refs []RefRecord, logs []LogRecord) error {
+	defer a.Abort()
+	s := a.s
+	if len(refs) == 0 && len(logs) == 0 {
+		return nil
+	}
+	updateIndex := s.NextUpdateIndex()
+	for i := range refs {
+		refs[i].UpdateIndex = updateIndex
+	}
+	// A rewritten reflog may need more than one new update index
+	maxUpdateIndex := updateIndex
+	for _, l := range logs {
+		maxUpdateIndex = max(maxUpdateIndex, l.UpdateIndex)
+	}
+	sortRecords(refs, logs)
+	name, err := s.writeTable(updateIndex, maxUpdateIndex, refs, logs)
+	if err != nil {
+		return err
+	}
+	t, err := OpenTable(filepath.Join(s.dir, name))
+	if err != nil {
+		return err
+	}
+	s.names = append(s.names, name)
+	s.tables = append(s.tables, t)
+	if start, end := s.compactionSegment(); end-start > 1 {
+		return a.compact(start, end)
+	}
+	return a.writeList(nil)
+}
+
+// Release the lock without changing the stack
+func (a *Addition) Abort() {
+	if a.lock != nil {
+		a.lock.Close()
+		os.Remove(a.lock.Name())
+		a.lock = nil
+	}
+}
+
+// Merge every table of the stack into one, dropping the deletions
+func (s *Stack) Compact() error {
+	a, err := s.NewAddition()
+	if err != nil {
+		return err
+	}
+	defer a.Abort()
+	if len(s.tables) < 2 {
+		return nil
+	}
+	return a.compact(0, len(s.tables))
+}
+
+// Merge the tables from start to end excluded into one, the deletions are dropped when nothing older is left
+func (a *Addition) compact(start, end int) error {
+	s := a.s
+	tables := s.tables[start:end]
+	refs, err := s.mergeRefs(tables, "", start == 0)
+	if err != nil {
+		return err
+	}
+	logs, err := s.mergeLogs(tables, "", start == 0)
+	if err != nil {
+		return err
+	}
+	min, _ := tables[0].UpdateIndices()
+	_, max := tables[len(tables)-1].UpdateIndices()
+	sortRecords(refs, logs)
+	name, err := s.writeTable(min, max, refs, logs)
+	if err != nil {
+		return err
+	}
+	obsolete := append([]string{}, s.names[start:end]...)
+	names := append(append(append([]string{}, s.names[:start]...), name), s.names[end:]...)
+	if err := a.writeList(names); err != nil {
+		os.Remove(filepath.Join(s.dir, name))
+		return err
+	}
+	for _, name := range obsolete {
+		os.Remove(filepath.Join(s.dir, name))
+	}
+	return s.reload()
+}
+
+// Replace tables.list with the names, or the names of the stack when nil, and release the lock
+func (a *Addition) writeList(names []string) error {
+	if names == nil {
+		names = a.s.names
+	}
+	content := strings.Join(names, "\n")
+	if len(names) > 0 {
+		content += "\n"
+	}
+	if _, err := a.lock.WriteString(content); err != nil {
+		return err
+	}
+	if err := a.lock.Close(); err != nil {
+		return err
+	}
+	path := a.lock.Name()
+	a.lock = nil
+	if err := os.Rename(path, strings.TrimSuffix(path, ".lock")); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// Return the tables to compact, from start to end excluded, for the sizes of the tables to grow at least geometrically
+// from the newest to the oldest: every table is at least twice as large as the next one
+func (s *Stack) compactionSegment() (start, end int) {
+	sizes := make([]int64, len(s.tables))
+	for i, t := range s.tables {
+		// Without the header and the footer, the same in every table
+		sizes[i] = t.size - int64(2*t.headerSize+footerTail)
+	}
+	const factor = 2
+	i := len(sizes) - 1
+	for ; i > 0; i-- {
+		if sizes[i-1] < sizes[i]*factor {
+			break
+		}
+	}
+	if i == 0 {
+		return 0, 0
+	}
+	start, end = i, i+1
+	total := sizes[i]
+	for ; i > 0; i-- {
+		current := total
+		total += sizes[i-1]
+		if sizes[i-1] < current*factor {
+			start = i - 1
+		}
+	}
+	return start, end
+}
+
+// Write a table holding the records in the stack directory, return its name
+func (s *Stack) writeTable(minUpdateIndex, maxUpdateIndex uint64, refs []RefRecord, logs []LogRecord) (string, error) {
+	content, err := encodeTable(s.hashSize, s.blockSize, minUpdateIndex, maxUpdateIndex, refs, logs)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(s.dir, "tmp_")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	name := fmt.Sprintf("0x%012x-0x%012x-%08x.ref", minUpdateIndex, maxUpdateIndex, rand.Uint32())
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("unable to write reftable: %s", err)
+	}
+	return name, nil
+}
+
+// Sort the refs by name and the logs by key: by name, then newest first
+func sortRecords(refs []RefRecord, logs []LogRecord) {
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	sort.Slice(logs, func(i, j int) bool { return bytes.Compare(logs[i].key(), logs[j].key()) < 0 })
+}
@@ -0,0 +1,356 @@
+package reftable
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+)
+
+// The block size of the tables written
+const DefaultBlockSize = 4096
+
+// A section gets an index when it spans more blocks than this, and the index another level while it does too
+const indexThreshold = 3
+
+// The length of the footer after its copy of the header: five uint64 positions and a CRC-32
+const footerTail = 5*8 + 4
+
+// Return the size of the file header for a hash size: the version 2 header also names the hash function
+func headerSize(hashSize int) int {
+	if hashSize == 32 {
+		return 28
+	}
+	return 24
+}
+
+// Return the file header: "REFT", the version, the uint24 block size and the range of update indices of the table
+func encodeHeader(hashSize, blockSize int, minUpdateIndex, maxUpdateIndex uint64) []byte {
+	version := byte(1)
+	if hashSize == 32 {
+		version = 2
+	}
+	b := append([]byte("REFT"), version)
+	b = putUint24(b, uint32(blockSize))
+	b = binary.BigEndian.AppendUint64(b, minUpdateIndex)
+	b = binary.BigEndian.AppendUint64(b, maxUpdateIndex)
+	if version == 2 {
+		b = append(b, "s256"...)
+	}
+	return b
+}
+
+// A record to write: its key, value type and encoded value
+type entry struct {
+	key       []byte
+	valueType byte
+	value     []byte
+}
+
+// Encode a table holding refs sorted by name and logs sorted by name then newest first
+func encodeTable(hashSize, blockSize int, minUpdateIndex, maxUpdateIndex uint64, refs []RefRecord, logs []LogRecord) ([]byte, error) {
+	header := encodeHeader(hashSize, blockSize, minUpdateIndex, maxUpdateIndex)
+	out := make([]byte, 0, blockSize)
+	// The ref and index blocks are padded to the block size, only when another block follows
+	padding := 0
+	// Allocating a compressor is expensive, the log blocks share one
+	zw := zlib.NewWriter(nil)
+
+	type indexEntry struct {
+		lastKey []byte
+		pos     uint64
+	}
+	// Write the entries as blocks of type typ, return the last key and the position of each block
+	writeBlocks := func(typ byte, entries []entry) ([]indexEntry, error) {
+		index := make([]indexEntry, 0)
+		var w *blockWriter
+		flush := func() error {
+			data, err := w.finish(zw)
+			if err != nil {
+				return err
+			}
+			index = append(index, indexEntry{lastKey: append([]byte{}, w.lastKey...), pos: uint64(len(out))})
+			out = append(out, data...)
+			padding = 0
+			if typ != blockLog && len(data) < blockSize {
+				padding = blockSize - len(data)
+			}
+			w = nil
+			return nil
+		}
+		for _, e := range entries {
+			if w != nil && !w.add(e.key, e.valueType, e.value) {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			if w == nil {
+				out = append(out, make([]byte, padding)...)
+				padding = 0
+				blockHeader := header
+				if len(out) > 0 {
+					blockHeader = nil
+				}
+				w = newBlockWriter(typ, blockHeader, blockSize)
+				if !w.add(e.key, e.valueType, e.value) {
+					return nil, fmt.Errorf("reftable record for %q too large", e.key)
+				}
+			}
+		}
+		if w != nil {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		return index, nil
+	}
+	// Write the entries as a section of blocks of type typ, then its index,
+	// return the position of the section and of the top level of the index, 0 without index
+	writeSection := func(typ byte, entries []entry) (uint64, uint64, error) {
+		index, err := writeBlocks(typ, entries)
+		if err != nil || len(index) == 0 {
+			return 0, 0, err
+		}
+		start, indexPos := index[0].pos, uint64(0)
+		for len(index) > indexThreshold {
+			indexEntries := make([]entry, 0, len(index))
+			for _, i := range index {
+				indexEntries = append(indexEntries, entry{key: i.lastKey, value: putVarint(nil, i.pos)})
+			}
+			if index, err = writeBlocks(blockIndex, indexEntries); err != nil {
+				return 0, 0, err
+			}
+			indexPos = index[0].pos
+		}
+		return start, indexPos, nil
+	}
+
+	refEntries := make([]entry, 0, len(refs))
+	for _, r := range refs {
+		refEntries = append(refEntries, entry{key: []byte(r.Name), valueType: r.valueType(), value: r.encodeValue(minUpdateIndex)})
+	}
+	_, refIndexPos, err := writeSection(blockRef, refEntries)
+	if err != nil {
+		return nil, err
+	}
+	logPos, logIndexPos := uint64(0), uint64(0)
+	if len(logs) > 0 {
+		logEntries := make([]entry, 0, len(logs))
+		for _, l := range logs {
+			logEntries = append(logEntries, entry{key: l.key(), valueType: l.valueType(), value: l.encodeValue()})
+		}
+		if logPos, logIndexPos, err = writeSection(blockLog, logEntries); err != nil {
+			return nil, err
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, header...)
+	}
+
+	footer := append([]byte{}, header...)
+	footer = binary.BigEndian.AppendUint64(footer, refIndexPos)
+	// No object blocks: their position and the length of their object ids are 0
+	footer = binary.BigEndian.AppendUint64(footer, 0)
+	footer = binary.BigEndian.AppendUint64(footer, 0)
+	footer = binary.BigEndian.AppendUint64(footer, logPos)
+	footer = binary.BigEndian.AppendUint64(footer, logIndexPos)
+	footer = binary.BigEndian.AppendUint32(footer, crc32.ChecksumIEEE(footer))
+	return append(out, footer...), nil
+}
+
+// A table of the stack, read one block at a time
+type Table struct {
+	f        *os.File
+	size     int64
+	hashSize int
+	// 0 when the blocks aren't aligned
+	blockSize      uint32
+	headerSize     int
+	minUpdateIndex uint64
+	maxUpdateIndex uint64
+	// Where the footer starts, the blocks end there
+	footerPos   uint64
+	refIndexPos uint64
+	logPos      uint64
+	logIndexPos uint64
+}
+
+// Open a table and check its header and footer
+func OpenTable(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := readTable(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+func readTable(f *os.File) (*Table, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	t := &Table{f: f, size: info.Size()}
+	header := make([]byte, 28)
+	if n, _ := f.ReadAt(header, 0); n < 24 || string(header[:4]) != "REFT" {
+		return nil, fmt.Errorf("%w: bad header", errCorrupt)
+	}
+	switch header[4] {
+	case 1:
+		t.hashSize = 20
+	case 2:
+		if string(header[24:28]) != "s256" && string(header[24:28]) != "sha1" {
+			return nil, fmt.Errorf("%w: unknown hash id %q", errCorrupt, header[24:28])
+		}
+		t.hashSize = 20
+		if string(header[24:28]) == "s256" {
+			t.hashSize = 32
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported version %d", errCorrupt, header[4])
+	}
+	t.headerSize = headerSize(t.hashSize)
+	if header[4] == 2 {
+		t.headerSize = 28
+	}
+	footerSize := int64(t.headerSize + footerTail)
+	if t.size < int64(t.headerSize)+footerSize {
+		return nil, fmt.Errorf("%w: truncated table", errCorrupt)
+	}
+	footer := make([]byte, footerSize)
+	if _, err := f.ReadAt(footer, t.size-footerSize); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(footer[:t.headerSize], header[:t.headerSize]) {
+		return nil, fmt.Errorf("%w: footer doesn't match header", errCorrupt)
+	}
+	if crc32.ChecksumIEEE(footer[:footerSize-4]) != binary.BigEndian.Uint32(footer[footerSize-4:]) {
+		return nil, fmt.Errorf("%w: bad footer checksum", errCorrupt)
+	}
+	t.blockSize = getUint24(header[5:])
+	t.minUpdateIndex = binary.BigEndian.Uint64(header[8:])
+	t.maxUpdateIndex = binary.BigEndian.Uint64(header[16:])
+	positions := footer[t.headerSize:]
+	t.refIndexPos = binary.BigEndian.Uint64(positions)
+	t.logPos = binary.BigEndian.Uint64(positions[24:])
+	t.logIndexPos = binary.BigEndian.Uint64(positions[32:])
+	t.footerPos = uint64(t.size - footerSize)
+	return t, nil
+}
+
+// Close the file of the table
+func (t *Table) Close() error {
+	return t.f.Close()
+}
+
+// The range of update indices of the table
+func (t *Table) UpdateIndices() (min, max uint64) {
+	return t.minUpdateIndex, t.maxUpdateIndex
+}
+
+// Return the type of the block at pos, 0 past the last block
+func (t *Table) blockType(pos uint64) byte {
+	typePos := pos + uint64(t.headerOff(pos))
+	if typePos >= t.footerPos {
+		return 0
+	}
+	typ := make([]byte, 1)
+	if _, err := t.f.ReadAt(typ, int64(typePos)); err != nil {
+		return 0
+	}
+	return typ[0]
+}
+
+// Return the length of the file header before the block at pos, only the first block has one
+func (t *Table) headerOff(pos uint64) int {
+	if pos == 0 {
+		return t.headerSize
+	}
+	return 0
+}
+
+// Iterate over the records of one section of a table, block after block
+type tableIter struct {
+	t     *Table
+	typ   byte
+	block *block
+	i     int
+	// The records before this key are skipped
+	want []byte
+}
+
+// Return the next record, false at the end of the section
+func (it *tableIter) next() (record, bool, error) {
+	for it.block != nil && it.i >= len(it.block.records) {
+		next := it.block.next
+		if it.t.blockType(next) != it.typ {
+			it.block = nil
+			break
+		}
+		b, err := it.t.readBlock(next, it.t.headerOff(next))
+		if err != nil {
+			return record{}, false, err
+		}
+		it.block, it.i = b, 0
+	}
+	if it.block == nil {
+		return record{}, false, nil
+	}
+	it.i++
+	if rec := it.block.records[it.i-1]; bytes.Compare(rec.key, it.want) >= 0 {
+		return rec, true, nil
+	}
+	return it.next()
+}
+
+// Return an iterator over the records of the section of type typ, from the first one whose key is at least want
+// The index of the section, when there is one, leads to the block holding that record without reading the others
+func (t *Table) seek(typ byte, want []byte) (*tableIter, error) {
+	start, indexPos := uint64(0), t.refIndexPos
+	if typ == blockLog {
+		start, indexPos = t.logPos, t.logIndexPos
+	}
+	it := &tableIter{t: t, typ: typ, want: want}
+	if t.blockType(start) != typ {
+		return it, nil
+	}
+	for pos := indexPos; indexPos != 0; {
+		found := false
+		for t.blockType(pos) == blockIndex && !found {
+			b, err := t.readBlock(pos, t.headerOff(pos))
+			if err != nil {
+				return nil, err
+			}
+			i := sort.Search(len(b.records), func(i int) bool { return bytes.Compare(b.records[i].key, want) >= 0 })
+			if i < len(b.records) {
+				pos, found = b.records[i].child, true
+			} else {
+				pos = b.next
+			}
+		}
+		if !found {
+			// Every key of the section comes before want
+			return it, nil
+		}
+		if t.blockType(pos) != blockIndex {
+			start = pos
+			break
+		}
+	}
+	b, err := t.readBlock(start, t.headerOff(start))
+	if err != nil {
+		return nil, err
+	}
+	if b.typ != typ {
+		return it, nil
+	}
+	it.block = b
+	return it, nil
+}
@@ -0,0 +1,208 @@
+package refs
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Where a transaction stands, it only moves forward
+type transactionState int
+
+const (
+	transactionOpen transactionState = iota
+	transactionPrepared
+	transactionClosed
+)
+
+// A set of updates applied all together or not at all
+// Every ref is locked and checked by Prepare, and nothing changes before Commit
+type Transaction struct {
+	store   *Store
+	updates []Update
+	// The names of the refs updated
+	queued   map[string]bool
+	state    transactionState
+	prepared PreparedTransaction
+}
+
+// Return an empty transaction on the refs of the store
+func (s *Store) NewTransaction() *Transaction {
+	return &Transaction{store: s, queued: make(map[string]bool)}
+}
+
+// Queue an update, following symbolic refs first unless noDeref is set
+func (tx *Transaction) Add(u Update, noDeref bool) error {
+	if tx.state != transactionOpen {
+		return fmt.Errorf("transaction is not open")
+	}
+	if !noDeref && u.NewSymbolic == "" {
+		name, err := tx.store.ResolveName(u.Name)
+		if err != nil {
+			return err
+		}
+		u.Name = name
+	}
+	if err := CheckWritableName(u.Name); err != nil {
+		return err
+	}
+	if tx.queued[u.Name] {
+		return fmt.Errorf("multiple updates for ref '%s' not allowed", u.Name)
+	}
+	if head, err := tx.store.backend.Read("HEAD"); err == nil && head.Symbolic == u.Name {
+		u.logHead = true
+	}
+	tx.updates = append(tx.updates, u)
+	tx.queued[u.Name] = true
+	return nil
+}
+
+// Queue the update of a ref that must be at old, or anywhere when old is empty
+func (tx *Transaction) Update(name, new, old, message string, noDeref bool) error {
+	return tx.Add(Update{Name: name, New: new, Old: old, Message: message}, noDeref)
+}
+
+// Queue the creation of a ref that must not exist yet
+func (tx *Transaction) Create(name, new, message string, noDeref bool) error {
+	return tx.Add(Update{Name: name, New: new, Old: zeroHash(new), Message: message}, noDeref)
+}
+
+// Queue the deletion of a ref that must be at old, or anywhere when old is empty
+func (tx *Transaction) Delete(name, old, message string, noDeref bool) error {
+	return tx.Add(Update{Name: name, Delete: true, Old: old, Message: message}, noDeref)
+}
+
+// Queue the check that a ref is at old, or doesn't exist when old is all zeros
+func (tx *Transaction) Verify(name, old string, noDeref bool) error {
+	return tx.Add(Update{Name: name, Verify: true, Old: old}, noDeref)
+}
+
+// Lock every ref and check its current value
+// Once prepared, the transaction can only be committed or aborted
+func (tx *Transaction) Prepare() error {
+	switch tx.state {
+	case transactionPrepared:
+		return nil
+	case transactionClosed:
+		return fmt.Errorf("transaction is closed")
+	}
+	if err := tx.checkConflicts(); err != nil {
+		tx.state = transactionClosed
+		return err
+	}
+	prepared, err := tx.store.backend.Prepare(tx.updates)
+	if err != nil {
+		tx.state = transactionClosed
+		return err
+	}
+	tx.prepared = prepared
+	tx.state = transactionPrepared
+	return nil
+}
+
+// Apply every update, preparing the transaction first if needed
+func (tx *Transaction) Commit() error {
+	if err := tx.Prepare(); err != nil {
+		return err
+	}
+	tx.state = transactionClosed
+	return tx.prepared.Commit()
+}
+
+// Drop the updates, releasing the locks of a prepared transaction
+func (tx *Transaction) Abort() {
+	if tx.state == transactionPrepared {
+		tx.prepared.Abort()
+	}
+	tx.state = transactionClosed
+}
+
+// Check that no ref created by the transaction is a directory of another ref, or the other way around:
+// refs/heads/a and refs/heads/a/b can't both exist
+// The existing refs are listed once, the refs below a name are found by a binary search of the sorted names
+func (tx *Transaction) checkConflicts() error {
+	deleted := make(map[string]bool)
+	// The position of each created ref among the updates
+	position := make(map[string]int)
+	created := make([]string, 0)
+	for _, u := range tx.updates {
+		switch {
+		case u.Delete:
+			deleted[u.Name] = true
+		case !u.Verify:
+			position[u.Name] = len(created)
+			created = append(created, u.Name)
+		}
+	}
+	if len(created) == 0 {
+		return nil
+	}
+	refs, err := tx.store.backend.List("")
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool, len(refs))
+	existing := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if !deleted[ref.Name] {
+			exists[ref.Name] = true
+			existing = append(existing, ref.Name)
+		}
+	}
+	sort.Strings(existing)
+	sortedCreated := slices.Clone(created)
+	sort.Strings(sortedCreated)
+	// Return the names of sorted below name, like refs/heads/a/b for refs/heads/a
+	below := func(sorted []string, name string) []string {
+		i := sort.SearchStrings(sorted, name+"/")
+		j := i
+		for j < len(sorted) && strings.HasPrefix(sorted[j], name+"/") {
+			j++
+		}
+		return sorted[i:j]
+	}
+	conflict := func(name, existing string) error {
+		return fmt.Errorf("cannot lock ref '%s': '%s' exists; cannot create '%s'", name, existing, name)
+	}
+	for i, name := range created {
+		// A parent of the ref, like refs/heads/a for refs/heads/a/b
+		components := strings.Split(name, "/")
+		parents := make([]string, 0, len(components))
+		for j := 2; j < len(components); j++ {
+			parent := strings.Join(components[:j], "/")
+			if exists[parent] {
+				return conflict(name, parent)
+			}
+			parents = append(parents, parent)
+		}
+		// A ref below it
+		if names := below(existing, name); len(names) > 0 {
+			return conflict(name, names[0])
+		}
+		// Two refs of the transaction itself, the one coming first among the updates is told
+		other := -1
+		for _, parent := range parents {
+			if j, found := position[parent]; found && j > i && (other < 0 || j < other) {
+				other = j
+			}
+		}
+		for _, child := range below(sortedCreated, name) {
+			if j := position[child]; j > i && (other < 0 || j < other) {
+				other = j
+			}
+		}
+		if other >= 0 {
+			return fmt.Errorf("cannot process '%s' and '%s' at the same time", name, created[other])
+		}
+	}
+	return nil
+}
+
+// Return the all-zero name as long as hash
+func zeroHash(hash string) string {
+	if len(hash) == 64 {
+		return strings.Repeat("0", 64)
+	}
+	return strings.Repeat("0", 40)
+}
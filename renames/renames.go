@@ -0,0 +1,173 @@
+// Rename detection: pairing deleted and added files by content, like git's diffcore-rename.c, with the similarity
+// estimate of diffcore-delta.c
+package renames
+
+import (
+	"bytes"
+	"path"
+	"sort"
+)
+
+const (
+	// The score of identical files
+	MaxScore = 60000
+	// The score a rename needs by default, 50%
+	DefaultMinScore = MaxScore / 2
+)
+
+// The bytes of a file are counted by chunks of a line, or of 64 bytes for longer lines, grouped by their hash
+const hashBase = 107927
+
+// A deleted or added file
+type File struct {
+	Path string
+	// The hex name of its object
+	Hash string
+	Mode uint32
+}
+
+// A file renamed from Src to Dst, with the similarity of their content
+type Pair struct {
+	Src, Dst File
+	Score    int
+}
+
+// Return the similarity score of two file contents, from 0 to MaxScore: the part of the bigger file made of chunks
+// the other file also has
+func Similarity(src, dst []byte) int {
+	maxSize := max(len(src), len(dst))
+	if maxSize == 0 || len(dst) == 0 {
+		return 0
+	}
+	srcChunks := countChunks(src)
+	dstChunks := countChunks(dst)
+	copied := 0
+	for hash, srcCount := range srcChunks {
+		copied += min(srcCount, dstChunks[hash])
+	}
+	return int(int64(copied) * MaxScore / int64(maxSize))
+}
+
+// Return the number of bytes of the chunks of content by their hash, ignoring the carriage returns before newlines
+// of text
+func countChunks(content []byte) map[uint32]int {
+	text := !isBinary(content)
+	chunks := make(map[uint32]int)
+	var accum1, accum2 uint32
+	n := 0
+	for i := 0; i < len(content); i++ {
+		c := uint32(content[i])
+		if text && c == '\r' && i+1 < len(content) && content[i+1] == '\n' {
+			continue
+		}
+		old1 := accum1
+		accum1 = (accum1 << 7) ^ (accum2 >> 25)
+		accum2 = (accum2 << 7) ^ (old1 >> 25)
+		accum1 += c
+		n++
+		if n < 64 && c != '\n' {
+			continue
+		}
+		chunks[(accum1+accum2*0x61)%hashBase] += n
+		n = 0
+		accum1, accum2 = 0, 0
+	}
+	if n > 0 {
+		chunks[(accum1+accum2*0x61)%hashBase] += n
+	}
+	return chunks
+}
+
+// Whether content looks binary, with a NUL byte in its first 8000 bytes like git's buffer_is_binary
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// Pair the deleted files with the added ones: first those with the same content, then those with a similarity of at
+// least minScore, the most similar first; each deleted file is the source of one rename at most
+// read returns the content of an object, only called for the regular files left after the exact renames
+func Detect(deleted, added []File, minScore int, read func(hash string) ([]byte, error)) ([]Pair, error) {
+	pairs := make([]Pair, 0)
+	usedSrc := make([]bool, len(deleted))
+	pairedDst := make([]bool, len(added))
+	for j, dst := range added {
+		best := -1
+		for i, src := range deleted {
+			if usedSrc[i] || src.Hash != dst.Hash {
+				continue
+			}
+			// A source with the same name in another directory is the most likely
+			if best < 0 || path.Base(src.Path) == path.Base(dst.Path) && path.Base(deleted[best].Path) != path.Base(dst.Path) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			usedSrc[best], pairedDst[j] = true, true
+			pairs = append(pairs, Pair{Src: deleted[best], Dst: dst, Score: MaxScore})
+		}
+	}
+
+	type candidate struct {
+		src, dst, score int
+		sameName        bool
+	}
+	candidates := make([]candidate, 0)
+	contents := make(map[string][]byte)
+	load := func(hash string) ([]byte, error) {
+		if content, found := contents[hash]; found {
+			return content, nil
+		}
+		content, err := read(hash)
+		if err != nil {
+			return nil, err
+		}
+		contents[hash] = content
+		return content, nil
+	}
+	for j, dst := range added {
+		if pairedDst[j] || !isRegular(dst.Mode) {
+			continue
+		}
+		dstContent, err := load(dst.Hash)
+		if err != nil {
+			return nil, err
+		}
+		for i, src := range deleted {
+			if usedSrc[i] || !isRegular(src.Mode) {
+				continue
+			}
+			srcContent, err := load(src.Hash)
+			if err != nil {
+				return nil, err
+			}
+			// Too different in size to be similar enough
+			maxSize := max(len(srcContent), len(dstContent))
+			delta := maxSize - min(len(srcContent), len(dstContent))
+			if int64(maxSize)*int64(MaxScore-minScore) < int64(delta)*MaxScore {
+				continue
+			}
+			if score := Similarity(srcContent, dstContent); score >= minScore {
+				candidates = append(candidates, candidate{i, j, score, path.Base(src.Path) == path.Base(dst.Path)})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if candidates[a].score != candidates[b].score {
+			return candidates[a].score > candidates[b].score
+		}
+		return candidates[a].sameName && !candidates[b].sameName
+	})
+	for _, c := range candidates {
+		if usedSrc[c.src] || pairedDst[c.dst] {
+			continue
+		}
+		usedSrc[c.src], pairedDst[c.dst] = true, true
+		pairs = append(pairs, Pair{Src: deleted[c.src], Dst: added[c.dst], Score: c.score})
+	}
+	return pairs, nil
+}
+
+// Whether a mode is a regular file, executable or not, the only files compared by content
+func isRegular(mode uint32) bool {
+	return mode&0o170000 == 0o100000
+}
@@ -0,0 +1,52 @@
+package renames
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	lines := "line1\nline2\nline3\nline4\nline5\nline6\nline7\nline8\nline9\nline10\n"
+	// Score given by git for the same rename, R89
+	if score := Similarity([]byte(lines), []byte(lines+"line11\n")); score*100/MaxScore != 89 {
+		t.Fatalf("expected a similarity of 89%%, got %d", score*100/MaxScore)
+	}
+	if score := Similarity([]byte("a\r\nb\r\n"), []byte("a\nb\n")); score*100/MaxScore != 66 {
+		t.Fatalf("expected the carriage returns of text to be ignored, got %d", score*100/MaxScore)
+	}
+	if score := Similarity([]byte("abc\n"), []byte("xyz\n")); score != 0 {
+		t.Fatalf("expected different files not to be similar, got %d", score)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	contents := map[string]string{
+		"1": strings.Repeat("shared line\n", 20) + "old\n",
+		"2": strings.Repeat("shared line\n", 20) + "new\n",
+		"3": "unrelated\n",
+		"4": "exact\n",
+	}
+	read := func(hash string) ([]byte, error) {
+		content, found := contents[hash]
+		if !found {
+			return nil, fmt.Errorf("missing %s", hash)
+		}
+		return []byte(content), nil
+	}
+	deleted := []File{{"a/exact.txt", "4", 0o100644}, {"b/exact.txt", "4", 0o100644}, {"old.txt", "1", 0o100644}}
+	added := []File{{"c/exact.txt", "4", 0o100644}, {"new.txt", "2", 0o100644}, {"other.txt", "3", 0o100644}}
+	pairs, err := Detect(deleted, added, DefaultMinScore, read)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pairs) != 2 {
+		t.Fatalf("expected 2 renames, got %+v", pairs)
+	}
+	if pairs[0].Src.Path != "a/exact.txt" || pairs[0].Dst.Path != "c/exact.txt" || pairs[0].Score != MaxScore {
+		t.Fatalf("expected the exact rename first, got %+v", pairs[0])
+	}
+	if pairs[1].Src.Path != "old.txt" || pairs[1].Dst.Path != "new.txt" || pairs[1].Score < DefaultMinScore {
+		t.Fatalf("expected old.txt renamed to new.txt, got %+v", pairs[1])
+	}
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+)
+
+// The highest core.repositoryformatversion understood
+const maxFormatVersion = 1
+
+// The extensions honored in any format version, and the values they may take, nil for any value
+var extensionsV0 = map[string][]string{
+	"noop":            nil,
+	"preciousobjects": nil,
+	"worktreeconfig":  nil,
+}
+
+// The extensions only defined by format version 1
+var extensionsV1 = map[string][]string{
+	"noop-v1":      nil,
+	"objectformat": {"sha1", "sha256"},
+	"refstorage":   {"files", "reftable"},
+}
+
+// Returned for a repository in a format that isn't understood
+type FormatError struct {
+	Reason string
+}
+
+func (e *FormatError) Error() string {
+	return e.Reason
+}
+
+func formatErrorf(format string, args ...any) error {
+	return &FormatError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Check that the repository format, and every extension it uses, is understood
+// Operating on a repository in a newer format could corrupt it silently
+func CheckFormat(gitDir string) error {
+	cfg, err := config.LoadFile(gitDir+"/config", config.ScopeLocal)
+	if err != nil {
+		return err
+	}
+	version, err := cfg.Int("core.repositoryformatversion", 0)
+	if err != nil {
+		return &FormatError{Reason: err.Error()}
+	}
+	if version < 0 || version > maxFormatVersion {
+		return formatErrorf("Expected git repo version <= %d, found %d\n"+
+			"The repository at %s uses a format this version of mygit does not understand", maxFormatVersion, version, gitDir)
+	}
+
+	unknown := make([]string, 0)
+	v1Only := make([]string, 0)
+	for _, e := range cfg.Entries() {
+		name, found := strings.CutPrefix(e.Key, "extensions.")
+		if !found || strings.Contains(name, ".") {
+			continue
+		}
+		values, isV0 := extensionsV0[name]
+		if !isV0 {
+			var isV1 bool
+			values, isV1 = extensionsV1[name]
+			switch {
+			case !isV1 && version == 0:
+				// Format version 0 ignores the extensions it doesn't know
+				continue
+			case !isV1:
+				unknown = append(unknown, name)
+				continue
+			case version == 0:
+				v1Only = append(v1Only, name)
+				continue
+			}
+		}
+		if values != nil && !contains(values, strings.ToLower(e.Value)) {
+			return formatErrorf("unknown %s value '%s' for extensions.%s\n"+
+				"The repository at %s uses a format this version of mygit does not understand", name, e.Value, name, gitDir)
+		}
+	}
+	if len(v1Only) > 0 {
+		return formatErrorf("repo version is 0, but v1-only extension found:\n\t%s\n"+
+			"Set core.repositoryformatversion to 1 if the repository really uses it", strings.Join(dedupe(v1Only), "\n\t"))
+	}
+	if len(unknown) > 0 {
+		return formatErrorf("unknown repository extension found:\n\t%s\n"+
+			"The repository at %s needs features this version of mygit does not have, refusing to touch it",
+			strings.Join(dedupe(unknown), "\n\t"), gitDir)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the sorted values without duplicates
+func dedupe(values []string) []string {
+	sort.Strings(values)
+	unique := make([]string, 0, len(values))
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
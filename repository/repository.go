@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	config "github.com/codecrafters-io/git-starter-go/config"
+)
+
+// Returned when neither the current directory nor any of its parents holds a repository
+var ErrNotFound = errors.New("not a git repository (or any of the parent directories): .git")
+
+// A repository found by Discover
+type Repository struct {
+	// Absolute path of the git directory
+	GitDir string
+	// Absolute path of the top of the work tree, empty for a bare repository
+	WorkTree string
+	// Path of the current directory from the top of the work tree, ending with a slash unless empty
+	Prefix string
+	// The git directory as named by GIT_DIR, or --git-dir
+	gitDirEnv string
+}
+
+// Whether the repository has no work tree
+func (r *Repository) Bare() bool {
+	return r.WorkTree == ""
+}
+
+// Return the path of elem inside the git directory
+func (r *Repository) Path(elem ...string) string {
+	return filepath.Join(append([]string{r.GitDir}, elem...)...)
+}
+
+// Return the git directory the way rev-parse --git-dir shows it: relative from the top of the work tree
+func (r *Repository) DisplayGitDir(cwd string) string {
+	switch {
+	case r.gitDirEnv != "":
+		return r.gitDirEnv
+	case cwd == r.GitDir:
+		return "."
+	case r.WorkTree != "" && cwd == r.WorkTree && r.GitDir == filepath.Join(r.WorkTree, ".git"):
+		return ".git"
+	}
+	return r.GitDir
+}
+
+// Find the repository of the current directory, like git does:
+// GIT_DIR and GIT_WORK_TREE when set, else the first parent holding a .git dir or file, or being a bare repository,
+// not looking above the GIT_CEILING_DIRECTORIES
+// A repository in a format that isn't understood is refused
+func Discover() (*Repository, error) {
+	r, err := discover()
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckFormat(r.GitDir); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func discover() (*Repository, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if gitDir := os.Getenv("GIT_DIR"); gitDir != "" {
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(cwd, gitDir)
+		}
+		if linked, err := ReadGitFile(gitDir); err == nil {
+			gitDir = linked
+		}
+		if !IsGitDir(gitDir) {
+			return nil, fmt.Errorf("not a git repository: '%s'", os.Getenv("GIT_DIR"))
+		}
+		r := &Repository{GitDir: gitDir, gitDirEnv: os.Getenv("GIT_DIR")}
+		// Without any work tree setting, the current directory is the top of the work tree
+		if err := r.setWorkTree(cwd, cwd); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+
+	ceiling := ceilingLength(cwd)
+	dir := cwd
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		gitDir := ""
+		if IsGitDir(dotGit) {
+			gitDir = dotGit
+		} else if linked, err := ReadGitFile(dotGit); err == nil {
+			if !IsGitDir(linked) {
+				return nil, fmt.Errorf("not a git repository: %s", linked)
+			}
+			gitDir = linked
+		}
+		if gitDir != "" {
+			r := &Repository{GitDir: gitDir}
+			if err := r.setWorkTree(cwd, dir); err != nil {
+				return nil, err
+			}
+			return r, nil
+		}
+		if IsGitDir(dir) {
+			// A bare repository, unless its config names a work tree
+			r := &Repository{GitDir: dir}
+			if err := r.setWorkTree(cwd, ""); err != nil {
+				return nil, err
+			}
+			return r, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || len(parent) < ceiling {
+			return nil, ErrNotFound
+		}
+		dir = parent
+	}
+}
+
+// Set the work tree from GIT_WORK_TREE, core.worktree or core.bare, defaulting to dir
+func (r *Repository) setWorkTree(cwd, dir string) error {
+	cfg, err := config.LoadFile(r.Path("config"), config.ScopeLocal)
+	if err != nil {
+		return err
+	}
+	bare, err := cfg.Bool("core.bare", false)
+	if err != nil {
+		return err
+	}
+	if bare {
+		dir = ""
+	}
+	if worktree, found := cfg.Get("core.worktree"); found {
+		if !filepath.IsAbs(worktree) {
+			worktree = filepath.Join(r.GitDir, worktree)
+		}
+		dir = worktree
+	}
+	if worktree := os.Getenv("GIT_WORK_TREE"); worktree != "" {
+		if !filepath.IsAbs(worktree) {
+			worktree = filepath.Join(cwd, worktree)
+		}
+		dir = worktree
+	}
+	if dir == "" {
+		return nil
+	}
+	r.WorkTree = filepath.Clean(dir)
+	if rel, err := filepath.Rel(r.WorkTree, cwd); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		r.Prefix = filepath.ToSlash(rel) + "/"
+	}
+	return nil
+}
+
+// Return the length of the longest GIT_CEILING_DIRECTORIES entry above cwd, the search never goes up to it
+func ceilingLength(cwd string) int {
+	longest := 0
+	for _, ceiling := range filepath.SplitList(os.Getenv("GIT_CEILING_DIRECTORIES")) {
+		if !filepath.IsAbs(ceiling) {
+			continue
+		}
+		ceiling = filepath.Clean(ceiling)
+		if resolved, err := filepath.EvalSymlinks(ceiling); err == nil {
+			ceiling = resolved
+		}
+		if strings.HasPrefix(cwd, ceiling+string(filepath.Separator)) && len(ceiling)+1 > longest {
+			longest = len(ceiling) + 1
+		}
+	}
+	return longest
+}
+
+// Whether dir looks like a git directory: a HEAD file, an objects and a refs dir
+func IsGitDir(dir string) bool {
+	if info, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil || info.IsDir() {
+		return false
+	}
+	for _, sub := range []string{"objects", "refs"} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the git dir a .git file links to: "gitdir: <path>"
+func ReadGitFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	link, found := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir:")
+	if !found {
+		return "", fmt.Errorf("invalid gitfile format: %s", path)
+	}
+	link = strings.TrimSpace(link)
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(filepath.Dir(path), link)
+	}
+	return filepath.Clean(link), nil
+}
@@ -0,0 +1,79 @@
+// Package unorm decomposes Unicode text to its canonical form, NFD, the form two canonically equivalent texts share:
+// "é" written as one character or as "e" and a combining accent
+package unorm
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The Hangul syllables, decomposed algorithmically
+const (
+	hangulBase    = 0xAC00
+	hangulCount   = 11172
+	leadingBase   = 0x1100
+	vowelBase     = 0x1161
+	trailingBase  = 0x11A7
+	vowelCount    = 21
+	trailingCount = 28
+)
+
+// Return the canonical decomposition of a text, NFD: its characters fully decomposed, the combining marks following
+// a character sorted by combining class
+// The invalid UTF-8 is kept as it is
+func NFD(s string) string {
+	decomposed := true
+	for _, r := range s {
+		if _, found := decompositions[r]; found || r >= hangulBase && r < hangulBase+hangulCount || combiningClasses[r] != 0 {
+			decomposed = false
+			break
+		}
+	}
+	if decomposed {
+		return s
+	}
+	runes := make([]rune, 0, len(s))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			// Kept as it is, written back by byte
+			runes = append(runes, -rune(s[i]))
+		case r >= hangulBase && r < hangulBase+hangulCount:
+			index := r - hangulBase
+			runes = append(runes, leadingBase+index/(vowelCount*trailingCount), vowelBase+index%(vowelCount*trailingCount)/trailingCount)
+			if trailing := index % trailingCount; trailing != 0 {
+				runes = append(runes, trailingBase+trailing)
+			}
+		default:
+			if d, found := decompositions[r]; found {
+				runes = append(runes, []rune(d)...)
+			} else {
+				runes = append(runes, r)
+			}
+		}
+		i += size
+	}
+	// The canonical ordering: the runs of combining marks sorted by class, the marks of a class keeping their order
+	for start := 0; start < len(runes); {
+		end := start
+		for end < len(runes) && runes[end] > 0 && combiningClasses[runes[end]] != 0 {
+			end++
+		}
+		if end-start > 1 {
+			marks := runes[start:end]
+			sort.SliceStable(marks, func(i, j int) bool { return combiningClasses[marks[i]] < combiningClasses[marks[j]] })
+		}
+		start = end + 1
+	}
+	b := new(strings.Builder)
+	for _, r := range runes {
+		if r < 0 {
+			b.WriteByte(byte(-r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
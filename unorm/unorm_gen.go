@@ -0,0 +1,77 @@
+//go:build ignore
+
+// Generate unorm_table.go from the Unicode database of Python, the unicodedata module
+//
+//	go run unorm_gen.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Print "<code point> <combining class> <code points of the canonical decomposition>" for every character with a
+// combining class or a canonical decomposition, the Hangul syllables left out
+const script = `
+import unicodedata
+print(unicodedata.unidata_version)
+for cp in range(0x110000):
+    if 0xAC00 <= cp <= 0xD7A3 or 0xD800 <= cp <= 0xDFFF:
+        continue
+    c = chr(cp)
+    ccc = unicodedata.combining(c)
+    d = unicodedata.normalize("NFD", c)
+    if ccc or d != c:
+        print("%X %d %s" % (cp, ccc, " ".join("%X" % ord(x) for x in d) if d != c else ""))
+`
+
+func main() {
+	out, err := exec.Command("python3", "-c", script).Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Scan()
+	version := scanner.Text()
+	classes := new(strings.Builder)
+	decompositions := new(strings.Builder)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		cp, _ := strconv.ParseUint(fields[0], 16, 32)
+		if fields[1] != "0" {
+			fmt.Fprintf(classes, "\t0x%04X: %s,\n", cp, fields[1])
+		}
+		if len(fields) > 2 {
+			runes := make([]string, 0, len(fields)-2)
+			for _, field := range fields[2:] {
+				r, _ := strconv.ParseUint(field, 16, 32)
+				if r > 0xFFFF {
+					runes = append(runes, fmt.Sprintf("\\U%08X", r))
+				} else {
+					runes = append(runes, fmt.Sprintf("\\u%04X", r))
+				}
+			}
+			fmt.Fprintf(decompositions, "\t0x%04X: \"%s\",\n", cp, strings.Join(runes, ""))
+		}
+	}
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "// Code generated by unorm_gen.go from the Unicode %s database of Python; DO NOT EDIT.\n\npackage unorm\n\n", version)
+	b.WriteString("// The canonical combining classes that aren't 0, by character\n")
+	b.WriteString("var combiningClasses = map[rune]uint8{\n" + classes.String() + "}\n\n")
+	b.WriteString("// The full canonical decompositions, canonically ordered, by character, the Hangul syllables left out\n")
+	b.WriteString("var decompositions = map[rune]string{\n" + decompositions.String() + "}\n")
+	source, err := format.Source([]byte(b.String()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("unorm_table.go", source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,31 @@
+package unorm
+
+import "testing"
+
+func TestNFD(t *testing.T) {
+	for _, tc := range []struct {
+		Text     string
+		Expected string
+	}{
+		{Text: "plain.txt", Expected: "plain.txt"},
+		{Text: "caf\u00e9", Expected: "cafe\u0301"},
+		{Text: "cafe\u0301", Expected: "cafe\u0301"},
+		// The Angstrom sign is the letter
+		{Text: "\u212b", Expected: "A\u030a"},
+		// Decomposed recursively
+		{Text: "\u1e69", Expected: "s\u0323\u0307"},
+		// The marks sorted by combining class, those of a class keeping their order
+		{Text: "s\u0307\u0323", Expected: "s\u0323\u0307"},
+		{Text: "a\u0301\u0300", Expected: "a\u0301\u0300"},
+		// The Hangul syllables
+		{Text: "\ud55c", Expected: "\u1112\u1161\u11ab"},
+		{Text: "\uac00", Expected: "\u1100\u1161"},
+		{Text: "\U0001d15e", Expected: "\U0001d157\U0001d165"},
+		{Text: "\xff\u00e9\xfe", Expected: "\xffe\u0301\xfe"},
+		{Text: "\u00c5\xff", Expected: "A\u030a\xff"},
+	} {
+		if got := NFD(tc.Text); got != tc.Expected {
+			t.Fatalf("%q: expected %q, got %q", tc.Text, tc.Expected, got)
+		}
+	}
+}
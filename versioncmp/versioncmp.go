@@ -0,0 +1,146 @@
+// Port of git's versioncmp.c, the comparison behind --sort=version:refname
+package versioncmp
+
+// The states of the scan: in a non-digit run, an integer, a fraction (digits after a leading zero), or leading zeros
+const (
+	stateN = 0
+	stateI = 3
+	stateF = 6
+	stateZ = 9
+)
+
+// What the states tell about the first difference: compare the bytes, or the lengths of the digit runs
+const (
+	resultCmp = 2
+	resultLen = 3
+)
+
+var nextState = [...]int{
+	/* state    x       d       0 */
+	/* N: */ stateN, stateI, stateZ,
+	/* I: */ stateN, stateI, stateI,
+	/* F: */ stateN, stateF, stateF,
+	/* Z: */ stateN, stateF, stateZ,
+}
+
+var resultType = [...]int{
+	/* state  x/x        x/d        x/0        d/x        d/d        d/0        0/x        0/d        0/0 */
+	/* N: */ resultCmp, resultCmp, resultCmp, resultCmp, resultLen, resultCmp, resultCmp, resultCmp, resultCmp,
+	/* I: */ resultCmp, -1, -1, +1, resultLen, resultLen, +1, resultLen, resultLen,
+	/* F: */ resultCmp, resultCmp, resultCmp, resultCmp, resultCmp, resultCmp, resultCmp, resultCmp, resultCmp,
+	/* Z: */ resultCmp, +1, +1, -1, resultCmp, resultCmp, -1, resultCmp, resultCmp,
+}
+
+// Return the byte at i, or 0 past the end of s like a C string
+func at(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// The class of a byte for the state tables: 0 for a non-digit, 1 for a digit, 2 for '0'
+func class(c byte) int {
+	switch {
+	case c == '0':
+		return 2
+	case isDigit(c):
+		return 1
+	}
+	return 0
+}
+
+// Compare two version strings, the digit runs compared as numbers, like strverscmp(3)
+// A name holding one of the prerelease suffixes, like "-rc" in "v1.0-rc1", sorts before the release it is a suffix of;
+// between two different suffixes, the one listed first sorts first
+func Compare(s1, s2 string, suffixes []string) int {
+	if s1 == s2 {
+		return 0
+	}
+	i := 0
+	c1, c2 := at(s1, i), at(s2, i)
+	state := stateN + class(c1)
+	diff := int(c1) - int(c2)
+	for diff == 0 {
+		if c1 == 0 {
+			return 0
+		}
+		state = nextState[state]
+		i++
+		c1, c2 = at(s1, i), at(s2, i)
+		state += class(c1)
+		diff = int(c1) - int(c2)
+	}
+	if d, swapped := swapPrereleases(s1, s2, i, suffixes); swapped {
+		return d
+	}
+	switch result := resultType[state*3+class(c2)]; result {
+	case resultCmp:
+		return diff
+	case resultLen:
+		// The longer digit run is the larger number, the first difference decides between runs of the same length
+		j := i + 1
+		for isDigit(at(s1, j)) {
+			if !isDigit(at(s2, j)) {
+				return 1
+			}
+			j++
+		}
+		if isDigit(at(s2, j)) {
+			return -1
+		}
+		return diff
+	default:
+		return result
+	}
+}
+
+// Where a suffix was found in a name: its position in the suffix list, its offset and length
+type suffixMatch struct {
+	confPos int
+	start   int
+	length  int
+}
+
+// Record the suffix in match when it is found in name between start and the current match, a better match either
+// starts earlier, or at the same offset and is longer
+func findBetterMatchingSuffix(name, suffix string, start, confPos int, match *suffixMatch) {
+	end := match.start - 1
+	if match.length < len(suffix) {
+		end = match.start
+	}
+	for i := start; i <= end && i <= len(name); i++ {
+		if len(name)-i >= len(suffix) && name[i:i+len(suffix)] == suffix {
+			*match = suffixMatch{confPos: confPos, start: i, length: len(suffix)}
+			return
+		}
+	}
+}
+
+// Return the order of two names differing at off when a prerelease suffix decides it
+func swapPrereleases(s1, s2 string, off int, suffixes []string) (int, bool) {
+	match1 := suffixMatch{confPos: -1, start: off, length: -1}
+	match2 := suffixMatch{confPos: -1, start: off, length: -1}
+	for i, suffix := range suffixes {
+		start := 0
+		if len(suffix) < off {
+			start = off - len(suffix)
+		}
+		findBetterMatchingSuffix(s1, suffix, start, i, &match1)
+		findBetterMatchingSuffix(s2, suffix, start, i, &match2)
+	}
+	switch {
+	case match1.confPos == match2.confPos:
+		// The same suffix in both, like "-rc" in "v1.0-rc1" and "v1.0-rc2", or none: the rest of the names decides
+		return 0, false
+	case match1.confPos >= 0 && match2.confPos >= 0:
+		return match1.confPos - match2.confPos, true
+	case match1.confPos >= 0:
+		return -1, true
+	}
+	return 1, true
+}
@@ -0,0 +1,50 @@
+package versioncmp
+
+import "testing"
+
+// Cases of git's t7004-tag and of strverscmp(3)
+var TestCaseCompare = []struct {
+	A, B     string
+	Suffixes []string
+	Expected int
+}{
+	{"v1.2", "v1.10", nil, -1},
+	{"v1.10", "v1.9", nil, 1},
+	{"v1.0", "v1.0", nil, 0},
+	{"v1.0", "v1.0.1", nil, -1},
+	{"000", "00", nil, -1},
+	{"00", "01", nil, -1},
+	{"01", "010", nil, -1},
+	{"010", "09", nil, -1},
+	{"09", "0", nil, -1},
+	{"0", "1", nil, -1},
+	{"9", "10", nil, -1},
+	{"foo1.0", "foo1.0-rc1", nil, -1},
+	{"foo1.0-rc1", "foo1.0", []string{"-rc"}, -1},
+	{"foo1.0-rc1", "foo1.0-rc2", []string{"-rc"}, -1},
+	{"foo1.0-beta", "foo1.0-rc1", []string{"-rc", "-beta"}, 1},
+	{"foo1.0-beta", "foo1.0-rc1", []string{"-beta", "-rc"}, -1},
+	{"v2.0-rc1", "v1.9", []string{"-rc"}, 1},
+}
+
+func TestCompare(t *testing.T) {
+	for _, tc := range TestCaseCompare {
+		got := Compare(tc.A, tc.B, tc.Suffixes)
+		if sign(got) != tc.Expected {
+			t.Fatalf("Compare(%q, %q, %q) = %d, expected the sign of %d", tc.A, tc.B, tc.Suffixes, got, tc.Expected)
+		}
+		if back := Compare(tc.B, tc.A, tc.Suffixes); sign(back) != -tc.Expected {
+			t.Fatalf("Compare(%q, %q, %q) = %d, expected the sign of %d", tc.B, tc.A, tc.Suffixes, back, -tc.Expected)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
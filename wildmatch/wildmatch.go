@@ -0,0 +1,278 @@
+// Port of git's wildmatch.c, the glob matcher shared by config includes, pathspecs, ignore and attributes rules
+package wildmatch
+
+import "strings"
+
+type Flags int
+
+const (
+	// Wildcards don't match slashes, except "**" matching whole directories
+	Pathname Flags = 1 << iota
+	// Match case-insensitively
+	CaseFold
+)
+
+const (
+	match = iota
+	noMatch
+	abortAll
+	abortToStarStar
+)
+
+// Whether text matches the glob pattern
+func Match(pattern, text string, flags Flags) bool {
+	return dowild(pattern, text, flags) == match
+}
+
+// Whether s holds any of the characters special to Match
+func HasWildcard(s string) bool {
+	return strings.ContainsAny(s, "*?[\\")
+}
+
+// Return the byte at i, or 0 past the end of s like a C string
+func at(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
+
+func toLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func toUpper(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+func isGlobSpecial(c byte) bool {
+	return c == '*' || c == '?' || c == '[' || c == '\\'
+}
+
+func dowild(pattern, text string, flags Flags) int {
+	p, t := 0, 0
+	for ; at(pattern, p) != 0; t, p = t+1, p+1 {
+		pCh := at(pattern, p)
+		tCh := at(text, t)
+		if tCh == 0 && pCh != '*' {
+			return abortAll
+		}
+		if flags&CaseFold != 0 {
+			tCh = toLower(tCh)
+			pCh = toLower(pCh)
+		}
+		switch pCh {
+		case '?':
+			// Match anything but '/'
+			if flags&Pathname != 0 && tCh == '/' {
+				return noMatch
+			}
+			continue
+		case '*':
+			matchSlash := false
+			p++
+			if at(pattern, p) == '*' {
+				prev := p - 2
+				for p++; at(pattern, p) == '*'; p++ {
+				}
+				if (prev < 0 || pattern[prev] == '/') &&
+					(at(pattern, p) == 0 || at(pattern, p) == '/' || (at(pattern, p) == '\\' && at(pattern, p+1) == '/')) {
+					// Assume "**/" matches nothing first, so that "foo/**/bar" matches "foo/bar"
+					if at(pattern, p) == '/' && dowild(pattern[p+1:], text[t:], flags) == match {
+						return match
+					}
+					matchSlash = true
+				}
+			} else {
+				// Without Pathname, '*' is '**'
+				matchSlash = flags&Pathname == 0
+			}
+			if at(pattern, p) == 0 {
+				// A trailing "**" matches everything, a trailing "*" only if no slash is left
+				if !matchSlash && strings.Contains(text[t:], "/") {
+					return noMatch
+				}
+				return match
+			} else if !matchSlash && at(pattern, p) == '/' {
+				// One asterisk followed by a slash matches the next directory
+				slash := strings.IndexByte(text[t:], '/')
+				if slash < 0 {
+					return noMatch
+				}
+				t += slash
+				continue
+			}
+			for {
+				if tCh == 0 {
+					break
+				}
+				// Advance faster when the asterisk is followed by a literal
+				if !isGlobSpecial(at(pattern, p)) {
+					pCh = at(pattern, p)
+					if flags&CaseFold != 0 {
+						pCh = toLower(pCh)
+					}
+					for tCh = at(text, t); tCh != 0 && (matchSlash || tCh != '/'); tCh = at(text, t) {
+						if flags&CaseFold != 0 {
+							tCh = toLower(tCh)
+						}
+						if tCh == pCh {
+							break
+						}
+						t++
+					}
+					if tCh != pCh {
+						return noMatch
+					}
+				}
+				if matched := dowild(pattern[p:], text[t:], flags); matched != noMatch {
+					if !matchSlash || matched != abortToStarStar {
+						return matched
+					}
+				} else if !matchSlash && tCh == '/' {
+					return abortToStarStar
+				}
+				t++
+				tCh = at(text, t)
+				if flags&CaseFold != 0 {
+					tCh = toLower(tCh)
+				}
+			}
+			return abortAll
+		case '[':
+			p++
+			pCh = at(pattern, p)
+			if pCh == '^' {
+				pCh = '!'
+			}
+			negated := pCh == '!'
+			if negated {
+				p++
+				pCh = at(pattern, p)
+			}
+			var prevCh byte
+			matched := false
+			for {
+				if pCh == 0 {
+					return abortAll
+				}
+				if pCh == '\\' {
+					p++
+					pCh = at(pattern, p)
+					if pCh == 0 {
+						return abortAll
+					}
+					if tCh == pCh {
+						matched = true
+					}
+				} else if pCh == '-' && prevCh != 0 && at(pattern, p+1) != 0 && at(pattern, p+1) != ']' {
+					p++
+					pCh = at(pattern, p)
+					if pCh == '\\' {
+						p++
+						pCh = at(pattern, p)
+						if pCh == 0 {
+							return abortAll
+						}
+					}
+					if tCh <= pCh && tCh >= prevCh {
+						matched = true
+					} else if flags&CaseFold != 0 && toUpper(tCh) <= pCh && toUpper(tCh) >= prevCh {
+						matched = true
+					}
+					pCh = 0
+				} else if pCh == '[' && at(pattern, p+1) == ':' {
+					s := p + 2
+					for p = s; at(pattern, p) != 0 && at(pattern, p) != ']'; p++ {
+					}
+					if at(pattern, p) == 0 {
+						return abortAll
+					}
+					if p-s-1 < 0 || pattern[p-1] != ':' {
+						// Didn't find ":]", treat it like a normal set
+						p = s - 2
+						pCh = '['
+						if tCh == pCh {
+							matched = true
+						}
+					} else {
+						class, ok := matchClass(pattern[s:p-1], tCh, flags)
+						if !ok {
+							return abortAll
+						}
+						matched = matched || class
+						pCh = 0
+					}
+				} else if tCh == pCh {
+					matched = true
+				}
+				prevCh = pCh
+				p++
+				pCh = at(pattern, p)
+				if pCh == ']' {
+					break
+				}
+			}
+			if matched == negated || (flags&Pathname != 0 && tCh == '/') {
+				return noMatch
+			}
+			continue
+		case '\\':
+			// Literal match with the following character
+			p++
+			pCh = at(pattern, p)
+			if flags&CaseFold != 0 {
+				pCh = toLower(pCh)
+			}
+		}
+		if tCh != pCh {
+			return noMatch
+		}
+	}
+	if t < len(text) {
+		return noMatch
+	}
+	return match
+}
+
+// Whether c belongs to the [:class:], and whether class is known
+func matchClass(class string, c byte, flags Flags) (bool, bool) {
+	isLower := 'a' <= c && c <= 'z'
+	isUpper := 'A' <= c && c <= 'Z'
+	isDigit := '0' <= c && c <= '9'
+	isAlpha := isLower || isUpper
+	isPrint := c >= 0x20 && c < 0x7f
+	switch class {
+	case "alnum":
+		return isAlpha || isDigit, true
+	case "alpha":
+		return isAlpha, true
+	case "blank":
+		return c == ' ' || c == '\t', true
+	case "cntrl":
+		return c < 0x20 || c == 0x7f, true
+	case "digit":
+		return isDigit, true
+	case "graph":
+		return isPrint && c != ' ', true
+	case "lower":
+		return isLower || (flags&CaseFold != 0 && isUpper), true
+	case "print":
+		return isPrint, true
+	case "punct":
+		return isPrint && c != ' ' && !isAlpha && !isDigit, true
+	case "space":
+		return c == ' ' || ('\t' <= c && c <= '\r'), true
+	case "upper":
+		return isUpper || (flags&CaseFold != 0 && isLower), true
+	case "xdigit":
+		return isDigit || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F'), true
+	}
+	return false, false
+}
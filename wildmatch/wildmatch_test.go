@@ -0,0 +1,47 @@
+package wildmatch
+
+import "testing"
+
+// A subset of the cases of git's t3070-wildmatch
+var TestCaseMatch = []struct {
+	Pattern, Text string
+	Flags         Flags
+	Expected      bool
+}{
+	{"foo", "foo", Pathname, true},
+	{"bar", "foo", Pathname, false},
+	{"???", "foo", Pathname, true},
+	{"*f", "foo", Pathname, false},
+	{"*", "foo/bar", Pathname, false},
+	{"*", "foo/bar", 0, true},
+	{"foo/*", "foo/bar", Pathname, true},
+	{"foo/*", "foo/bar/baz", Pathname, false},
+	{"foo/**", "foo/bar/baz", Pathname, true},
+	{"**/foo", "foo", Pathname, true},
+	{"**/foo", "a/b/foo", Pathname, true},
+	{"foo/**/bar", "foo/bar", Pathname, true},
+	{"foo/**/bar", "foo/a/b/bar", Pathname, true},
+	{"foo**bar", "foo/baz/bar", Pathname, false},
+	{"*/bar", "foo/bar", Pathname, true},
+	{"[ab]*", "bar", Pathname, true},
+	{"[!ab]*", "bar", Pathname, false},
+	{"[^ab]*", "car", Pathname, true},
+	{"[a-c]at", "bat", Pathname, true},
+	{"[[:digit:]]x", "5x", Pathname, true},
+	{"[[:upper:]]", "a", Pathname, false},
+	{"\\*", "*", Pathname, true},
+	{"\\*", "a", Pathname, false},
+	{"foo/[/]bar", "foo/[/]bar", 0, false},
+	{"*.C", "main.c", Pathname | CaseFold, true},
+	{"a[", "a[", Pathname, false},
+	{"-*-*-*-*-*-*-12-*-*-*-m-*-*-*", "-adobe-courier-bold-o-normal--12-120-75-75-m-70-iso8859-1", Pathname, true},
+	{"**/*a*b*g*n*t", "abcd/abcdefg/abcdefghijk/abcdefghijklmnop.txtz", Pathname, false},
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range TestCaseMatch {
+		if got := Match(tc.Pattern, tc.Text, tc.Flags); got != tc.Expected {
+			t.Errorf("Match(%q, %q, %d) = %v, expected %v", tc.Pattern, tc.Text, tc.Flags, got, tc.Expected)
+		}
+	}
+}